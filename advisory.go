@@ -0,0 +1,247 @@
+package artifactor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// files written alongside a version when advisories are attached to it
+var advisoryFilepaths = []string{"advisories.json", "advisories.json.asc.sig"}
+
+// severities an advisory may have, least severe first
+var advisorySeverities = []string{"low", "medium", "high", "critical"}
+
+// Advisory: a security advisory, such as a CVE, attached to a version after it
+// was published
+type Advisory struct {
+	ID        string    `json:"id"`
+	Severity  string    `json:"severity"`
+	Summary   string    `json:"summary,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor,omitempty"`
+}
+
+// validate: check the advisory has an id and a known severity
+func (a Advisory) validate() error {
+	if a.ID == "" {
+		return fmt.Errorf("an advisory id, such as CVE-2024-1234, is required")
+	}
+
+	if !containsString(advisorySeverities, a.Severity) {
+		return fmt.Errorf("%s: severity must be one of %s", a.ID, strings.Join(advisorySeverities, ", "))
+	}
+
+	return nil
+}
+
+// VersionAdvisories: the signed list of advisories attached to a version,
+// published as advisories.json in the version's directory
+type VersionAdvisories struct {
+	Project    string     `json:"project"`
+	Version    string     `json:"version"`
+	Advisories []Advisory `json:"advisories"`
+}
+
+// AdviseVersion: attach an advisory to a published version, replacing any
+// previous advisory with the same id. The version's signed advisories.json is
+// rewritten guarded by the generation it was read at, and retried if a
+// concurrent writer gets there first. When the project keeps an index, the
+// version's entry and any feeds are updated to list the advisory too
+func AdviseVersion(project Project, version string, advisory Advisory) error {
+	if err := advisory.validate(); err != nil {
+		return err
+	}
+
+	if _, err := fetchManifest(project.gcsPrefix + version + "/manifest.json"); err != nil {
+		return fmt.Errorf("%s %s: %v", project.name, version, err)
+	}
+
+	var advisories VersionAdvisories
+	var err error
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		advisories, err = tryAdviseVersion(project, version, advisory)
+		if err == nil || !isPreconditionFailed(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return updateIndexVersion(project, version, func(indexVersion *IndexVersion) {
+		indexVersion.Advisories = advisories.Advisories
+	})
+}
+
+func tryAdviseVersion(project Project, version string, advisory Advisory) (VersionAdvisories, error) {
+	versionPrefix := project.gcsPrefix + version + "/"
+
+	gcsPaths := make([]string, 0, len(advisoryFilepaths))
+	for _, filename := range advisoryFilepaths {
+		gcsPaths = append(gcsPaths, versionPrefix+filename)
+	}
+
+	// generations are read before the advisories, so a concurrent update
+	// between the two reads fails the write rather than being lost
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return VersionAdvisories{}, err
+	}
+
+	previous, err := fetchAdvisories(versionPrefix)
+	if err != nil {
+		return VersionAdvisories{}, err
+	}
+
+	advisories := VersionAdvisories{
+		Project:    project.name,
+		Version:    version,
+		Advisories: make([]Advisory, 0, len(previous.Advisories)+1),
+	}
+	for _, previousAdvisory := range previous.Advisories {
+		if previousAdvisory.ID != advisory.ID {
+			advisories.Advisories = append(advisories.Advisories, previousAdvisory)
+		}
+	}
+	advisories.Advisories = append(advisories.Advisories, advisory)
+
+	jsonBytes, err := json.Marshal(advisories)
+	if err != nil {
+		return VersionAdvisories{}, err
+	}
+
+	tmpDir, err := newScratchDir("artifactor-advisories")
+	if err != nil {
+		return VersionAdvisories{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	advisoriesFilepath := filepath.Join(tmpDir, advisoryFilepaths[0])
+	if err := ioutil.WriteFile(advisoriesFilepath, jsonBytes, 0644); err != nil {
+		return VersionAdvisories{}, err
+	}
+
+	if err := createSigFile(advisoriesFilepath, filepath.Join(tmpDir, advisoryFilepaths[1])); err != nil {
+		return VersionAdvisories{}, err
+	}
+
+	components := make([]Component, 0, len(advisoryFilepaths))
+	for _, filename := range advisoryFilepaths {
+		component, err := newTempComponent(tmpDir, filename, versionPrefix, project.urlPrefix+version+"/")
+		if err != nil {
+			return VersionAdvisories{}, err
+		}
+
+		components = append(components, component)
+	}
+
+	if _, err := uploadComponents(versionPrefix, components, generations, false); err != nil {
+		return VersionAdvisories{}, err
+	}
+
+	return advisories, nil
+}
+
+// fetchAdvisories: download the advisories attached to a version, returning
+// none when it has no advisories.json
+func fetchAdvisories(versionPrefix string) (VersionAdvisories, error) {
+	byts, _, err := fetchObject(versionPrefix + advisoryFilepaths[0])
+	if err == storage.ErrObjectNotExist {
+		return VersionAdvisories{}, nil
+	}
+	if err != nil {
+		return VersionAdvisories{}, err
+	}
+
+	var advisories VersionAdvisories
+	if err := json.Unmarshal(byts, &advisories); err != nil {
+		return VersionAdvisories{}, err
+	}
+
+	return advisories, nil
+}
+
+// updateIndexVersion: update a version's project index entry, such as to list
+// its advisories, regenerating the feeds when the project publishes them.
+// Projects without an index, or whose index doesn't list the version, are
+// left alone
+func updateIndexVersion(project Project, version string, update func(*IndexVersion)) error {
+	index, err := fetchIndex(project)
+	if err != nil {
+		return err
+	}
+
+	for _, indexVersion := range index.Versions {
+		if indexVersion.Version != version {
+			continue
+		}
+
+		generations, err := fetchGenerations([]string{project.gcsPrefix + indexFilepaths[2]})
+		if err != nil {
+			return err
+		}
+
+		update(&indexVersion)
+		_, err = updateIndex(project, indexVersion, generations[project.gcsPrefix+indexFilepaths[2]] != 0)
+		return err
+	}
+
+	return nil
+}
+
+// advisoriesSummary: a line naming each advisory, for feeds and pages
+func advisoriesSummary(advisories []Advisory) string {
+	if len(advisories) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(advisories))
+	for _, advisory := range advisories {
+		parts = append(parts, fmt.Sprintf("%s (%s)", advisory.ID, advisory.Severity))
+	}
+
+	return "Advisories: " + strings.Join(parts, ", ")
+}
+
+// FetchAdvisories: download the advisories attached to a version from their
+// public url, and verify their signature against the trust policy's keys.
+// Advisories are signed by whoever attached them, so a single accepted
+// signature is enough, and policies requiring no gpg signatures check none
+func FetchAdvisories(project Project, version string, trust TrustPolicy) ([]Advisory, error) {
+	advisoriesURL := project.urlPrefix + version + "/" + advisoryFilepaths[0]
+
+	byts, found, err := fetchOptionalURL(advisoriesURL)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return []Advisory{}, nil
+	}
+
+	if trust.MinimumSignatures > 0 {
+		sigBytes, err := fetchURL(advisoriesURL + ".asc.sig")
+		if err != nil {
+			return nil, err
+		}
+
+		trust.MinimumSignatures = 1
+		if err := trust.verifySignature(byts, sigBytes); err != nil {
+			return nil, fmt.Errorf("%s: %v", advisoriesURL, err)
+		}
+	}
+
+	var advisories VersionAdvisories
+	if err := json.Unmarshal(byts, &advisories); err != nil {
+		return nil, err
+	}
+
+	return advisories.Advisories, nil
+}
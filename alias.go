@@ -0,0 +1,397 @@
+package artifactor
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// files written when publishing pointer style aliases
+var aliasPointerFilepaths = []string{"alias.json", "alias.json.asc.sig"}
+
+// AliasPointer: a small document uploaded in place of an alias's manifests,
+// which names the version the alias currently points to. Flipping an alias is
+// a single object write, and the versions themselves are never rewritten
+type AliasPointer struct {
+	Alias                string    `json:"alias"`
+	Project              string    `json:"project"`
+	Version              string    `json:"version"`
+	ManifestURL          string    `json:"manifest_url"`
+	ManifestSignatureURL string    `json:"manifest_signature_url"`
+	Timestamp            time.Time `json:"timestamp"`
+	UnixTimestamp        int       `json:"unix_timestamp"`
+
+	manifestFilepath  string
+	signatureFilepath string
+}
+
+// NewAliasPointer: create an alias pointer for the given project version
+func NewAliasPointer(project Project, alias string, version string, ts time.Time) AliasPointer {
+	manifestURL := project.urlPrefix + version + "/manifest.json"
+	return AliasPointer{
+		Alias:                alias,
+		Project:              project.name,
+		Version:              version,
+		ManifestURL:          manifestURL,
+		ManifestSignatureURL: manifestURL + ".asc.sig",
+		Timestamp:            ts,
+		UnixTimestamp:        int(ts.Unix()),
+
+		manifestFilepath:  aliasPointerFilepaths[0],
+		signatureFilepath: aliasPointerFilepaths[1],
+	}
+}
+
+func (a AliasPointer) write() error {
+	jsonBytes, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(a.manifestFilepath, jsonBytes, 0644); err != nil {
+		return err
+	}
+
+	return createSigFile(a.manifestFilepath, a.signatureFilepath)
+}
+
+// ReleaseVersion: release a version published to one channel, such as rc, to
+// another by copying the exact same objects server side, rather than
+// rebuilding, and then point the destination's aliases at it
+func ReleaseVersion(src, dst Project, opts *Options) error {
+	ts := time.Now()
+
+	generations, err := fetchGenerations(aliasPaths(dst, opts))
+	if err != nil {
+		return err
+	}
+
+	if err := CopyVersion(src, dst, opts.Version); err != nil {
+		return err
+	}
+
+	if opts.Index || opts.Feed {
+		manifest, err := fetchManifest(dst.gcsPrefix + opts.Version + "/manifest.json")
+		if err != nil {
+			return err
+		}
+
+		if _, err := updateIndex(dst, NewIndexVersion(dst, manifest, opts.ReleaseNotes), opts.Feed); err != nil {
+			return err
+		}
+	}
+
+	return pointAliases(dst, opts, ts, generations)
+}
+
+// SetAlias: point the project's aliases at a version which has already been
+// published, such as to roll latest back to an earlier version, without
+// publishing it again
+func SetAlias(project Project, opts *Options) error {
+	ts := time.Now()
+
+	manifest, err := fetchManifest(project.gcsPrefix + opts.Version + "/manifest.json")
+	if err == storage.ErrObjectNotExist {
+		return fmt.Errorf("version %s of %s not found", opts.Version, project.name)
+	}
+	if err != nil {
+		return err
+	}
+
+	// an alias's own manifest names the version it serves, so this catches
+	// an alias being given in place of a version
+	if manifest.Version != opts.Version {
+		return fmt.Errorf("%s is an alias of version %s, not a version", opts.Version, manifest.Version)
+	}
+
+	generations, err := fetchGenerations(aliasPaths(project, opts))
+	if err != nil {
+		return err
+	}
+
+	return pointAliases(project, opts, ts, generations)
+}
+
+// pointAliases: update the aliases to serve the project's version, and check
+// that each of them now does
+func pointAliases(project Project, opts *Options, ts time.Time, generations map[string]int64) error {
+	versionGCSPrefix := project.gcsPrefix + opts.Version + "/"
+	manifestComponents := make([]Component, 0, len(managedFilepaths))
+	for _, filepath := range managedFilepaths {
+		component, err := statComponent(versionGCSPrefix, filepath)
+		if err != nil {
+			return err
+		}
+
+		manifestComponents = append(manifestComponents, component)
+	}
+
+	_, aliasErr := updateAliases(project, opts, ts, manifestComponents, generations)
+
+	stale, err := staleAliases(project, opts, manifestComponents)
+	if err != nil {
+		return err
+	}
+	if aliasErr != nil {
+		return aliasErr
+	}
+
+	if len(stale) > 0 {
+		return fmt.Errorf("aliases left stale: %s", strings.Join(stale, ", "))
+	}
+
+	return nil
+}
+
+// aliasPaths: the gcs paths of every object written when updating a project's
+// aliases
+func aliasPaths(project Project, opts *Options) []string {
+	aliasFilepaths := managedFilepaths
+	if opts.PointerAliases {
+		aliasFilepaths = aliasPointerFilepaths
+	}
+
+	paths := make([]string, 0, len(opts.Aliases)*len(aliasFilepaths))
+	for _, alias := range opts.Aliases {
+		for _, filepath := range aliasFilepaths {
+			paths = append(paths, project.gcsPrefix+alias+"/"+filepath)
+		}
+	}
+
+	return paths
+}
+
+// updateAliases: point each alias at the version concurrently, either by
+// uploading an alias pointer or by copying the version's manifest components,
+// and record each alias that changed in the project's alias history
+func updateAliases(project Project, opts *Options, ts time.Time, manifestComponents []Component, generations map[string]int64) ([]PublishedObject, error) {
+	previousVersions, err := aliasVersions(project, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(opts.Aliases))
+	objectsCh := make(chan []PublishedObject, len(opts.Aliases))
+	changeCh := make(chan AliasChange, len(opts.Aliases))
+
+	// every alias is copied server side from the version's objects, so the
+	// manifests are only ever hashed and uploaded once. An alias given twice
+	// is still only copied once, rather than racing itself
+	for _, alias := range uniqueAliases(opts.Aliases) {
+		wg.Add(1)
+
+		go func(alias string) {
+			defer wg.Done()
+
+			var aliasObjects []PublishedObject
+			var err error
+
+			if opts.PointerAliases {
+				aliasObjects, err = uploadAliasPointer(project, alias, opts.Version, ts, generations)
+			} else {
+				aliasObjects, err = copyAliasComponents(project.gcsPrefix+alias+"/", manifestComponents, generations)
+			}
+			if err != nil {
+				errCh <- fmt.Errorf("alias %s: %v", alias, err)
+				return
+			}
+
+			objectsCh <- aliasObjects
+			if previousVersions[alias] != opts.Version {
+				changeCh <- AliasChange{
+					Alias:         alias,
+					OldVersion:    previousVersions[alias],
+					NewVersion:    opts.Version,
+					Timestamp:     ts,
+					UnixTimestamp: int(ts.Unix()),
+					Actor:         opts.Actor,
+				}
+			}
+		}(alias)
+	}
+
+	wg.Wait()
+	close(objectsCh)
+	close(changeCh)
+
+	objects := make([]PublishedObject, 0)
+	for aliasObjects := range objectsCh {
+		objects = append(objects, aliasObjects...)
+	}
+
+	changes := make([]AliasChange, 0, len(opts.Aliases))
+	for change := range changeCh {
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Alias < changes[j].Alias
+	})
+
+	historyObjects, err := recordAliasChanges(project, changes)
+	if err != nil {
+		return objects, err
+	}
+	objects = append(objects, historyObjects...)
+
+	select {
+	case err := <-errCh:
+		return objects, err
+	default:
+	}
+
+	return objects, nil
+}
+
+// uniqueAliases: the aliases in the order given, without repeats
+func uniqueAliases(aliases []string) []string {
+	seen := make(map[string]bool, len(aliases))
+	unique := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		if seen[alias] {
+			continue
+		}
+
+		seen[alias] = true
+		unique = append(unique, alias)
+	}
+
+	return unique
+}
+
+// staleAliases: check that every alias now resolves to the version, returning
+// the aliases which don't. Copied aliases must hold the exact manifest.json
+// of the version, and pointer aliases must name it
+func staleAliases(project Project, opts *Options, manifestComponents []Component) ([]string, error) {
+	// released versions' components are stat'd rather than hashed, so only
+	// their md5 is known
+	manifestMd5 := ""
+	for _, component := range manifestComponents {
+		if component.Filepath == "manifest.json" {
+			manifestMd5 = component.Md5Checksum
+		}
+	}
+
+	stale := make([]string, 0)
+	for _, alias := range uniqueAliases(opts.Aliases) {
+		aliasPrefix := project.gcsPrefix + alias + "/"
+
+		if opts.PointerAliases {
+			byts, _, err := fetchObject(aliasPrefix + aliasPointerFilepaths[0])
+			if err != nil && err != storage.ErrObjectNotExist {
+				return nil, err
+			}
+
+			var pointer AliasPointer
+			if err != nil || json.Unmarshal(byts, &pointer) != nil || pointer.Version != opts.Version {
+				stale = append(stale, alias)
+			}
+			continue
+		}
+
+		byts, _, err := fetchObject(aliasPrefix + "manifest.json")
+		if err != nil && err != storage.ErrObjectNotExist {
+			return nil, err
+		}
+
+		if err != nil || fmt.Sprintf("%x", md5.Sum(byts)) != manifestMd5 {
+			stale = append(stale, alias)
+		}
+	}
+
+	return stale, nil
+}
+
+// uploadAliasPointer: write, sign and upload the alias.json for an alias
+func uploadAliasPointer(project Project, alias string, version string, ts time.Time, generations map[string]int64) ([]PublishedObject, error) {
+	aliasPrefix := project.gcsPrefix + alias + "/"
+	aliasURLPrefix := project.urlPrefix + alias + "/"
+
+	// aliases are updated concurrently, so each pointer is written to its
+	// own directory rather than the working directory
+	tmpDir, err := newScratchDir("artifactor-alias")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pointer := NewAliasPointer(project, alias, version, ts)
+
+	// an alias already pointing at the version is left untouched, rather
+	// than being rewritten with a new timestamp
+	current, unchanged, err := currentAliasPointer(aliasPrefix, aliasURLPrefix, pointer)
+	if err != nil || current {
+		return unchanged, err
+	}
+
+	pointer.manifestFilepath = filepath.Join(tmpDir, aliasPointerFilepaths[0])
+	pointer.signatureFilepath = filepath.Join(tmpDir, aliasPointerFilepaths[1])
+	if err := pointer.write(); err != nil {
+		return nil, err
+	}
+
+	components := make([]Component, 0, len(aliasPointerFilepaths))
+	for _, filename := range aliasPointerFilepaths {
+		component, err := newTempComponent(tmpDir, filename, aliasPrefix, aliasURLPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, component)
+	}
+
+	return uploadComponents(aliasPrefix, components, generations, false)
+}
+
+// currentAliasPointer: whether an alias's pointer already names the same
+// manifest as the given pointer, and if so an unchanged object for each of
+// its files
+func currentAliasPointer(aliasPrefix, aliasURLPrefix string, pointer AliasPointer) (bool, []PublishedObject, error) {
+	byts, _, err := fetchObject(aliasPrefix + aliasPointerFilepaths[0])
+	if err == storage.ErrObjectNotExist {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+
+	var current AliasPointer
+	if json.Unmarshal(byts, &current) != nil || current.Version != pointer.Version || current.ManifestURL != pointer.ManifestURL {
+		return false, nil, nil
+	}
+
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+
+	objects := make([]PublishedObject, 0, len(aliasPointerFilepaths))
+	for _, filepath := range aliasPointerFilepaths {
+		started := time.Now()
+
+		attrs, err := store.Attrs(ctx, aliasPrefix+filepath)
+		if err == storage.ErrObjectNotExist {
+			return false, nil, nil
+		}
+		if err != nil {
+			return false, nil, err
+		}
+
+		object := newPublishedObject(Component{GCSFilepath: aliasPrefix + filepath, URL: aliasURLPrefix + filepath}, OutcomeUnchanged, attrs, started)
+		object.Attempts = 0
+		objects = append(objects, object)
+	}
+
+	return true, objects, nil
+}
@@ -0,0 +1,187 @@
+package artifactor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// files written when recording alias changes
+var aliasHistoryFilepaths = []string{"aliases-history.jsonl", "aliases-history.jsonl.asc.sig"}
+
+// AliasChange: a record of an alias being pointed at a new version
+type AliasChange struct {
+	Alias         string    `json:"alias"`
+	OldVersion    string    `json:"old_version"`
+	NewVersion    string    `json:"new_version"`
+	Timestamp     time.Time `json:"timestamp"`
+	UnixTimestamp int       `json:"unix_timestamp"`
+	Actor         string    `json:"actor"`
+}
+
+// aliasVersions: the version each alias currently points to, or an empty
+// string for aliases which don't exist yet
+func aliasVersions(project Project, opts *Options) (map[string]string, error) {
+	versions := make(map[string]string, len(opts.Aliases))
+
+	for _, alias := range uniqueAliases(opts.Aliases) {
+		aliasPrefix := project.gcsPrefix + alias + "/"
+
+		var byts []byte
+		var err error
+		var version struct {
+			Version string `json:"version"`
+		}
+
+		// both alias.json and manifest.json name the version
+		if opts.PointerAliases {
+			byts, _, err = fetchObject(aliasPrefix + aliasPointerFilepaths[0])
+		} else {
+			byts, _, err = fetchObject(aliasPrefix + "manifest.json")
+		}
+
+		switch {
+		case err == storage.ErrObjectNotExist:
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(byts, &version); err != nil {
+				return nil, err
+			}
+		}
+
+		versions[alias] = version.Version
+	}
+
+	return versions, nil
+}
+
+// recordAliasChanges: append alias changes to the project's signed
+// aliases-history.jsonl. The history is rewritten guarded by the generation
+// it was read at, and retried if a concurrent publisher gets there first
+func recordAliasChanges(project Project, changes []AliasChange) ([]PublishedObject, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		var objects []PublishedObject
+
+		objects, err = tryRecordAliasChanges(project, changes)
+		if err == nil {
+			return retried(objects, attempt), nil
+		}
+
+		if !isPreconditionFailed(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func tryRecordAliasChanges(project Project, changes []AliasChange) ([]PublishedObject, error) {
+	gcsPaths := make([]string, 0, len(aliasHistoryFilepaths))
+	for _, filename := range aliasHistoryFilepaths {
+		gcsPaths = append(gcsPaths, project.gcsPrefix+filename)
+	}
+
+	// generations are read before the history, so a concurrent update
+	// between the two reads fails the write rather than being lost
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	history, _, err := fetchObject(gcsPaths[0])
+	if err != nil && err != storage.ErrObjectNotExist {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(history)
+	for _, change := range changes {
+		line, err := json.Marshal(change)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(line)
+		buf.WriteString("\n")
+	}
+
+	tmpDir, err := newScratchDir("artifactor-alias-history")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	historyFilepath := filepath.Join(tmpDir, aliasHistoryFilepaths[0])
+	if err := ioutil.WriteFile(historyFilepath, buf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+
+	if err := createSigFile(historyFilepath, filepath.Join(tmpDir, aliasHistoryFilepaths[1])); err != nil {
+		return nil, err
+	}
+
+	components := make([]Component, 0, len(aliasHistoryFilepaths))
+	for _, filename := range aliasHistoryFilepaths {
+		component, err := newTempComponent(tmpDir, filename, project.gcsPrefix, project.urlPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, component)
+	}
+
+	return uploadComponents(project.gcsPrefix, components, generations, false)
+}
+
+// AliasHistory: every recorded change to an alias, oldest first, after
+// verifying the history's signature. When trusted keys are given the
+// signature must be made by one of them, otherwise any key in the local gpg
+// keyring is accepted. An empty alias returns the changes to every alias
+func AliasHistory(project Project, alias string, trustedKeys []string) ([]AliasChange, error) {
+	history, _, err := fetchObject(project.gcsPrefix + aliasHistoryFilepaths[0])
+	if err == storage.ErrObjectNotExist {
+		return []AliasChange{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sigBytes, _, err := fetchObject(project.gcsPrefix + aliasHistoryFilepaths[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(history, sigBytes, trustedKeys); err != nil {
+		return nil, err
+	}
+
+	changes := make([]AliasChange, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(history))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var change AliasChange
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			return nil, err
+		}
+
+		if alias == "" || change.Alias == alias {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, scanner.Err()
+}
@@ -0,0 +1,225 @@
+package artifactor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveEntry: a component's contents held in a tar or zip archive, rather
+// than in a file of their own
+type archiveEntry struct {
+	archive string
+	name    string
+}
+
+// isInputArchive: whether a path names an archive a version can be published
+// from
+func isInputArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, suffix := range []string{".tar", ".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// archiveComponents: create a set of components from the files in a tar,
+// tar.gz or zip archive, hashing each entry as it's read rather than
+// extracting the archive. Directories, links and the files the artifactor
+// manages itself are skipped, as createComponents skips them in a directory
+func archiveComponents(archive, gcsPrefix, urlPrefix string) ([]Component, error) {
+	if !isInputArchive(archive) {
+		return nil, fmt.Errorf("%s: not a .tar, .tar.gz, .tgz or .zip archive", archive)
+	}
+
+	components := make([]Component, 0)
+
+	err := walkArchive(archive, func(name string, reader io.Reader) error {
+		if isManagedFilepath(name) {
+			return nil
+		}
+
+		component, err := newStreamedComponent(name, gcsPrefix, urlPrefix, reader)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", archive, name, err)
+		}
+		component.entry = &archiveEntry{archive: archive, name: name}
+
+		components = append(components, component)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return components, nil
+}
+
+// walkArchive: call fn with the name and contents of each regular file in an
+// archive, in the order they're stored
+func walkArchive(archive string, fn func(name string, reader io.Reader) error) error {
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		return walkZip(archive, fn)
+	}
+
+	return walkTar(archive, fn)
+}
+
+func walkZip(archive string, fn func(name string, reader io.Reader) error) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		name, err := archiveEntryName(archive, file.Name)
+		if err != nil {
+			return err
+		}
+
+		fileReader, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", archive, name, err)
+		}
+		err = fn(name, fileReader)
+		fileReader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkTar(archive string, fn func(name string, reader io.Reader) error) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var src io.Reader = file
+	lower := strings.ToLower(archive)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", archive, err)
+		}
+		defer gzipReader.Close()
+		src = gzipReader
+	}
+
+	reader := tar.NewReader(src)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", archive, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name, err := archiveEntryName(archive, header.Name)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(name, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveEntryName: the component filepath of an archive entry, refusing
+// entries which would land outside of the version
+func archiveEntryName(archive, name string) (string, error) {
+	cleaned := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%s: %s: entry is outside of the archive", archive, name)
+	}
+
+	return cleaned, nil
+}
+
+// open: read the entry's contents. Zip entries are opened directly, while a
+// tar archive is read up to the entry, since tar has no index
+func (e *archiveEntry) open() (io.ReadCloser, error) {
+	if strings.HasSuffix(strings.ToLower(e.archive), ".zip") {
+		reader, err := zip.OpenReader(e.archive)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range reader.File {
+			if name, err := archiveEntryName(e.archive, file.Name); err != nil || name != e.name {
+				continue
+			}
+
+			fileReader, err := file.Open()
+			if err != nil {
+				reader.Close()
+				return nil, err
+			}
+			return archiveEntryReader{fileReader, reader}, nil
+		}
+
+		reader.Close()
+		return nil, fmt.Errorf("%s: %s: not found", e.archive, e.name)
+	}
+
+	// the tar is walked on a goroutine, handing the entry to a pipe, so that
+	// it's streamed rather than held in memory
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		found := false
+		err := walkTar(e.archive, func(name string, reader io.Reader) error {
+			if name != e.name {
+				return nil
+			}
+
+			found = true
+			if _, err := io.Copy(pipeWriter, reader); err != nil {
+				return err
+			}
+			return io.EOF
+		})
+		if err == nil && !found {
+			err = fmt.Errorf("%s: %s: not found", e.archive, e.name)
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	return pipeReader, nil
+}
+
+// archiveEntryReader: a zip entry's reader, which closes the archive along
+// with the entry
+type archiveEntryReader struct {
+	io.ReadCloser
+	archive io.Closer
+}
+
+func (r archiveEntryReader) Close() error {
+	r.ReadCloser.Close()
+	return r.archive.Close()
+}
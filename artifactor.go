@@ -1,21 +1,22 @@
 package artifactor
 
 import (
-	"bytes"
 	"context"
 	"crypto/md5"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"hash"
 	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"log"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/tabwriter"
@@ -27,17 +28,32 @@ import (
 // number of seconds to set the cache-control:max-age=%v header too
 const CacheControlMaxAge = 60
 
+// checksumBufferSize: how much of a component is read at a time while it's
+// hashed, however large the component is
+const checksumBufferSize = 1 << 20
+
+// built in files that are managed by the artifactor, rather than provided as
+// part of the artifact
+var managedFilepaths = []string{"manifest.json", "manifest.json.asc.sig", "checksums", "checksums.asc.sig"}
+
 type Project struct {
 	name      string
 	gcsPrefix string
 	urlPrefix string
 }
 
+// NewProject: create a project, which is scoped to a channel such as rc/ when
+// one is set
 func NewProject(opts *Options) Project {
+	projectPrefix := opts.ProjectName + "/"
+	if opts.Channel != "" {
+		projectPrefix = projectPrefix + opts.Channel + "/"
+	}
+
 	return Project{
 		name:      opts.ProjectName,
-		gcsPrefix: opts.GcsPrefix + opts.ProjectName + "/",
-		urlPrefix: opts.UrlPrefix + opts.ProjectName + "/",
+		gcsPrefix: opts.GcsPrefix + projectPrefix,
+		urlPrefix: opts.UrlPrefix + projectPrefix,
 	}
 }
 
@@ -46,6 +62,217 @@ type Options struct {
 
 	ProjectName, GcsPrefix, Version, Dir, UrlPrefix string
 	Aliases                                         []string
+
+	// Input publishes the files of a tar, tar.gz or zip archive as the
+	// version's components, reading them from the archive rather than the
+	// working directory, without extracting it first
+	Input string
+
+	// Stream publishes what's read from it until EOF, such as stdin, as the
+	// version's only component, named StreamName
+	Stream     io.Reader
+	StreamName string
+
+	// Staged publishes the components staged for the version with
+	// StageComponents, rather than reading them from a source of its own,
+	// once each of RequiredParts has staged its components
+	Staged        bool
+	RequiredParts []string
+
+	// Channel publishes versions and their aliases under a subdirectory of
+	// the project, such as rc/, rather than the stable project root
+	Channel string
+
+	// RootManifest maintains a signed root.json for the project, which chains
+	// the sha256 of every version's manifest.json
+	RootManifest bool
+
+	// Index maintains a signed index.json listing every version of the
+	// project, and Feed also publishes a feed of them alongside it
+	Index, Feed bool
+
+	// ReleaseNotes, when set, summarize the version in the index and feeds
+	ReleaseNotes string
+
+	// Notifiers are told when the version has been published, and
+	// Alerters are told when publishing fails
+	Notifiers []Notifier
+	Alerters  []Notifier
+
+	// Progress, when set, is told about each step of the publish as it
+	// happens, such as every component written
+	Progress ProgressReporter
+
+	// ObjectNaming, when set, customizes how component filepaths map to
+	// object names, rather than publishing them as <version>/<filepath>
+	ObjectNaming *NamingScheme
+
+	// URLTemplates, when set, build the public url of each component from
+	// the first template matching it, rather than from UrlPrefix
+	URLTemplates []URLTemplate
+
+	// Actor names who is publishing, and is recorded in the alias history
+	Actor string
+
+	// PublishedBy names the publisher recorded in the manifest, defaulting
+	// to Actor, and IdentityTokenFilepath is a ci identity token, such as a
+	// github actions oidc token, whose claims are recorded along with it
+	PublishedBy, IdentityTokenFilepath string
+
+	// Metadata, when set, describes the project in the manifest, and in the
+	// index and feeds
+	Metadata ProjectMetadata
+
+	// PointerAliases uploads a signed alias.json pointing at the version
+	// for each alias, rather than copying the version's manifests
+	PointerAliases bool
+
+	// ManifestGenerations records the storage generation of each component
+	// in manifest.json
+	ManifestGenerations bool
+
+	// ReportFilepath, when set, is where a publish report listing the
+	// generation of every written object is saved, whether or not the
+	// publish succeeds. No report is written without it
+	ReportFilepath string
+
+	// PreviousVersion, when set, is compared against the new version so that
+	// unchanged components are copied server side rather than re-uploaded
+	PreviousVersion string
+
+	// ContentRules, when set, are checked against the components before
+	// anything is uploaded, failing the publish on any violation
+	ContentRules *ContentRules
+
+	// ContentReportFilepath, when set, is where the pre-publish content
+	// report is saved
+	ContentReportFilepath string
+
+	// Deduplicate uploads components with identical contents once, and
+	// copies the rest server side
+	Deduplicate bool
+
+	// RequireLicense fails a publish which contains binaries but no license
+	// file, rather than only warning about it
+	RequireLicense bool
+
+	// ExpiresIn, when set, records an expiration in the manifest and project
+	// root for versions that are only kept for a while, such as nightly builds
+	ExpiresIn time.Duration
+
+	// TerraformOutputsFilepath, when set, is where the published version's
+	// coordinates are written in the shape of `terraform output -json`,
+	// including signed urls valid for SignedURLExpiry when it is set
+	TerraformOutputsFilepath string
+	SignedURLExpiry          time.Duration
+
+	// BazelSnippetsFilepath, when set, is where http_archive and http_file
+	// rules for every component are written
+	BazelSnippetsFilepath string
+
+	// GoModulePath, when set, publishes the Go module in GoModuleDir as the
+	// version in GOPROXY layout under the project, so the project can be used
+	// as a module proxy. The version must be a semantic version such as v1.2.3
+	GoModulePath, GoModuleDir string
+
+	// Maven copies the version's poms, and the jars published alongside
+	// them, into maven2 repository layout under the project
+	Maven bool
+
+	// PythonIndex adds the version's wheels and sdists to a PEP 503 simple
+	// repository under the project
+	PythonIndex bool
+
+	// PackageSigningKey, when set, is the gpg key .deb and .rpm components
+	// are signed with before they're uploaded
+	PackageSigningKey string
+
+	// FailFast cancels every in flight upload of the version's components
+	// as soon as one of them fails, rather than letting the rest finish
+	FailFast bool
+
+	// Force republishes a version which already exists, overwriting its
+	// objects. Without it, publishing fails if any of the version's objects
+	// exist, in its prefix, its mirrors or its symbols prefix
+	Force bool
+
+	// CompressManifest also publishes a signed, zstd compressed
+	// manifest.json.zst, which download and get prefer. It is not copied to
+	// aliases, which always serve the plain manifest
+	CompressManifest bool
+
+	// Concurrency is how many components are uploaded or copied at once,
+	// to the bucket and its mirrors together, DefaultConcurrency when it
+	// isn't set
+	Concurrency int
+
+	// UploadChunkSize, when set, is how many bytes of an object each upload
+	// to Google Cloud Storage buffers and sends per request, rather than the
+	// client's 16MiB. Every concurrent upload holds a buffer of up to this
+	// size, though never more than its object needs. Objects no larger than
+	// SingleRequestUploadSize are sent in a single request without a buffer,
+	// and so can't be retried part way
+	UploadChunkSize, SingleRequestUploadSize int
+
+	// ManifestShardSize, when set, also splits the manifest of versions with
+	// more components than it into signed shards of at most that many
+	// components, so a single component can be looked up without fetching
+	// the whole manifest.json
+	ManifestShardSize int
+
+	// VerifySource snapshots the size and modification time of every file in
+	// the source directory before publishing, and fails before the manifest
+	// is generated if any of them changed in the meantime
+	VerifySource bool
+
+	// Groups name the groups of components recorded in the manifest, which
+	// can be downloaded on their own
+	Groups []ComponentGroup
+
+	// SymbolsPrefix, when set, is a storage prefix such as a private bucket
+	// debug symbol components are published to instead of GcsPrefix. They're
+	// listed under symbols in the manifest rather than with the components,
+	// with urls under SymbolsURLPrefix when it's set. SymbolsACL is the
+	// predefined acl they're written with, private by default, and an empty
+	// acl leaves them to the bucket's default
+	SymbolsPrefix, SymbolsURLPrefix string
+	SymbolsACL                      *string
+
+	// SymbolServer lays pdbs out at the root of SymbolsPrefix in the
+	// layout of a microsoft symbol server, name.pdb/GUIDAGE/name.pdb, so
+	// that debuggers and crash tooling can use it as one. Versions share
+	// the layout, so it holds every project's pdbs published there
+	SymbolServer bool
+
+	// DSYMIndex publishes a signed dsyms.json alongside the manifest,
+	// mapping the build uuid of every dSYM among the components and symbols
+	// to the component holding it, for crash symbolication services
+	DSYMIndex bool
+
+	// SymbolUploaders are sent a zip of each dSYM bundle once the version
+	// is published, such as to upload them to sentry or crashlytics
+	SymbolUploaders []SymbolUploader
+
+	// Mirrors are further storage prefixes the version's components and
+	// manifests are published to, concurrently with the primary GcsPrefix.
+	// Aliases, indexes and other project wide files are only kept in the
+	// primary
+	Mirrors []Mirror
+
+	// OCIRepository, when set, is a container registry repository such as
+	// ghcr.io/org/project the components and manifests are also pushed to as
+	// an oci artifact, tagged with the version and each alias
+	OCIRepository string
+
+	// GitHubRepository, when set, is an owner/repo a GitHub release of the
+	// version is created in, with every component, the manifests and their
+	// signatures attached. The GITHUB_TOKEN environment variable is used
+	GitHubRepository string
+
+	// ChangelogFilepath, when set along with PreviousVersion, is where a
+	// changelog fragment diffing the two versions is saved. A .md extension
+	// writes markdown, anything else writes json
+	ChangelogFilepath string
 }
 
 type ComponentManifest struct {
@@ -56,6 +283,33 @@ type ComponentManifest struct {
 	GCSPrefix     string      `json:"gcs_prefix"`
 	Components    []Component `json:"components"`
 
+	// Licenses lists the filepaths of the license and notice files among
+	// the components
+	Licenses []string `json:"licenses"`
+
+	// PackageSigningKey is the gpg key the version's .deb and .rpm
+	// components were signed with
+	PackageSigningKey string `json:"package_signing_key,omitempty"`
+
+	// ExpiresAt marks short lived versions, such as nightly builds, which
+	// may be garbage collected and no longer served after it passes
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// PublishedBy records who published the version
+	PublishedBy *Publisher `json:"published_by,omitempty"`
+
+	// Yanked is set when the version has been yanked, steering users off it
+	// while its artifacts are kept
+	Yanked *Yank `json:"yanked,omitempty"`
+
+	// Symbols lists the debug symbol components published apart from the
+	// rest, to a symbols prefix which isn't publicly readable
+	Symbols []Component `json:"symbols,omitempty"`
+
+	// ProjectMetadata links to the project's homepage, documentation and
+	// support, and names its license
+	ProjectMetadata
+
 	manifestFilepath  string
 	signatureFilepath string
 }
@@ -78,6 +332,11 @@ func NewComponentManifest(srcDir string, project string, version string, ts time
 	}
 }
 
+// Expired: whether the version has an expiration which has passed
+func (c ComponentManifest) Expired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
+}
+
 func (c ComponentManifest) write() error {
 	jsonBytes, err := json.Marshal(c)
 	if err != nil {
@@ -149,65 +408,206 @@ type Component struct {
 	Sha256Checksum string `json:"sha256_checksum"`
 	Sha384Checksum string `json:"sha384_checksum"`
 	Sha512Checksum string `json:"sha512_checksum"`
+
+	// Crc32cChecksum is the castagnoli crc32 google cloud storage keeps for
+	// every object, so stored objects can be checked without reading them
+	Crc32cChecksum string `json:"crc32c_checksum,omitempty"`
+
+	Generation     int64 `json:"generation,omitempty"`
+	Metageneration int64 `json:"metageneration,omitempty"`
+
+	// Mirrors lists the url of the component in each mirror it was
+	// published to
+	Mirrors []string `json:"mirrors,omitempty"`
+
+	// Groups names the groups the component belongs to
+	Groups []string `json:"groups,omitempty"`
+
+	// Role classifies the component, such as a binary, archive or
+	// signature, judging by its filepath or contents
+	Role string `json:"role,omitempty"`
+
+	// localFilepath is where the component's contents are read from when
+	// they aren't at Filepath, such as a manifest written to a scratch
+	// directory
+	localFilepath string
+
+	// entry is the archive entry holding the component's contents when the
+	// version is published from an archive
+	entry *archiveEntry
+
+	// staged is the object holding the component's contents when the
+	// version is finalized from what was staged for it, read through
+	// stagedStore, which every staged component of a finalize shares
+	staged      string
+	stagedStore Storage
 }
 
-// NewComponent: initialize a component and it's checksums
-func NewComponent(filepath string, gcsPrefix string, urlPrefix string) (Component, error) {
-	file, err := os.Open(filepath)
+// contentsFilepath: the local path the component's contents are read from
+func (c Component) contentsFilepath() string {
+	if c.localFilepath != "" {
+		return c.localFilepath
+	}
+
+	return c.Filepath
+}
+
+// hasLocalFile: whether the component's contents are in a local file, rather
+// than an archive entry or a staged object
+func (c Component) hasLocalFile() bool {
+	return c.entry == nil && c.staged == ""
+}
+
+// openContents: read the component's contents, from its archive entry, the
+// object it was staged to, or else its local file
+func (c Component) openContents() (io.ReadCloser, error) {
+	if c.entry != nil {
+		return c.entry.open()
+	}
+
+	if c.staged != "" {
+		return c.stagedStore.NewRangeReader(context.Background(), c.staged, 0, 0, -1)
+	}
+
+	return os.Open(c.contentsFilepath())
+}
+
+// readContents: the component's contents, read with openContents
+func (c Component) readContents() ([]byte, error) {
+	reader, err := c.openContents()
 	if err != nil {
-		return Component{}, err
+		return nil, err
 	}
+	defer reader.Close()
 
-	byts, err := ioutil.ReadAll(file)
+	return ioutil.ReadAll(reader)
+}
+
+// writeContents: copy the component's contents to a local file, for the
+// tools which only take a path
+func (c Component) writeContents(dst string) error {
+	reader, err := c.openContents()
 	if err != nil {
-		return Component{}, err
+		return err
 	}
-	file.Close()
+	defer reader.Close()
 
-	reader := bytes.NewReader(byts)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
 
-	hashes := []hash.Hash{
-		md5.New(),
-		sha256.New(),
-		sha512.New384(),
-		sha512.New512_256(),
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
 	}
-	checksums := make([]string, 4)
 
-	for idx, h := range hashes {
-		reader.Seek(0, 0)
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		return err
+	}
 
-		if _, err := io.Copy(h, reader); err != nil {
-			return Component{}, err
-		}
+	return out.Close()
+}
+
+// NewComponent: initialize a component and it's checksums, streaming the
+// file through the hashes rather than reading it into memory
+func NewComponent(filepath string, gcsPrefix string, urlPrefix string) (Component, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return Component{}, err
+	}
+	defer file.Close()
+
+	return newStreamedComponent(filepath, gcsPrefix, urlPrefix, file)
+}
+
+// newStreamedComponent: initialize a component and its checksums from a
+// reader, hashing its contents in a single pass as they're read, so only
+// checksumBufferSize bytes of it are held at a time
+func newStreamedComponent(filepath string, gcsPrefix string, urlPrefix string, reader io.Reader) (Component, error) {
+	md5Hash, sha256Hash, sha384Hash, sha512Hash := md5.New(), sha256.New(), sha512.New384(), sha512.New512_256()
+	crc32cHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
 
-		checksums[idx] = fmt.Sprintf("%x", h.Sum(nil))
+	size, err := io.CopyBuffer(io.MultiWriter(md5Hash, sha256Hash, sha384Hash, sha512Hash, crc32cHash), reader, make([]byte, checksumBufferSize))
+	if err != nil {
+		return Component{}, err
 	}
 
 	return Component{
 		Filepath:    filepath,
 		GCSFilepath: gcsPrefix + filepath,
 		URL:         urlPrefix + filepath,
-		Bytes:       reader.Size(),
+		Bytes:       size,
 
-		Md5Checksum:    checksums[0],
-		Sha256Checksum: checksums[1],
-		Sha384Checksum: checksums[2],
-		Sha512Checksum: checksums[3],
+		Md5Checksum:    fmt.Sprintf("%x", md5Hash.Sum(nil)),
+		Sha256Checksum: fmt.Sprintf("%x", sha256Hash.Sum(nil)),
+		Sha384Checksum: fmt.Sprintf("%x", sha384Hash.Sum(nil)),
+		Sha512Checksum: fmt.Sprintf("%x", sha512Hash.Sum(nil)),
+		Crc32cChecksum: fmt.Sprintf("%08x", crc32cHash.Sum32()),
 	}, nil
 }
 
-// uploadAliasComponents: alias the given components into a new directory. Usually, this
-// is used to alias the manifest.json and manifest.json.asc.sig files into the
-// /latest subdir
-func uploadAliasComponents(aliasPrefix string, components []Component) error {
-	// rewrite the gcs filepath for each, while maintaining references to
-	// all of the old filepaths!
-	for idx, component := range components {
-		components[idx].GCSFilepath = aliasPrefix + component.Filepath
+// copyAliasComponents: alias the given components into a new directory by
+// copying the just published version objects server side, so the alias is
+// byte-identical to the version. Usually, this is used to alias the
+// manifest.json and manifest.json.asc.sig files into the /latest subdir.
+// Alias objects which are already identical are left untouched
+func copyAliasComponents(aliasPrefix string, components []Component, generations map[string]int64) ([]PublishedObject, error) {
+	copies := make([]componentCopy, 0, len(components))
+	for _, component := range components {
+		aliasComponent := component
+		aliasComponent.GCSFilepath = aliasPrefix + component.Filepath
+
+		copies = append(copies, componentCopy{
+			src: component.GCSFilepath,
+			dst: aliasComponent,
+		})
 	}
 
-	return uploadComponents(aliasPrefix, components)
+	copies, unchanged, err := skipUnchangedCopies(copies)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := copyComponents(aliasPrefix, copies, generations, false)
+	return append(unchanged, objects...), err
+}
+
+// skipUnchangedCopies: split out the copies whose destination already has the
+// size and md5 of the component being copied, returning the copies still to
+// be made and an unchanged object for each one skipped
+func skipUnchangedCopies(copies []componentCopy) ([]componentCopy, []PublishedObject, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	remaining := make([]componentCopy, 0, len(copies))
+	unchanged := make([]PublishedObject, 0)
+	for _, cp := range copies {
+		started := time.Now()
+
+		attrs, err := store.Attrs(ctx, cp.dst.GCSFilepath)
+		if err == storage.ErrObjectNotExist {
+			remaining = append(remaining, cp)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if cp.dst.Md5Checksum == "" || verifyObjectAttrs(attrs, cp.dst) != nil {
+			remaining = append(remaining, cp)
+			continue
+		}
+
+		object := newPublishedObject(cp.dst, OutcomeUnchanged, attrs, started)
+		object.Attempts = 0
+		unchanged = append(unchanged, object)
+	}
+
+	return remaining, unchanged, nil
 }
 
 // createComponents: create a set of components given an input directory. Return
@@ -225,10 +625,8 @@ func createComponents(srcDir, gcsPrefix string, urlPrefix string) ([]Component,
 		}
 
 		// built in files that are managed by the artifactor do not get injected into the artifact manifest
-		for _, bannedFilepath := range []string{"manifest.json", "manifest.json.asc.sig", "checksums", "checksums.asc.sig"} {
-			if path == bannedFilepath {
-				return nil
-			}
+		if isManagedFilepath(path) {
+			return nil
 		}
 
 		component, err := NewComponent(path, gcsPrefix, urlPrefix)
@@ -247,31 +645,381 @@ func createComponents(srcDir, gcsPrefix string, urlPrefix string) ([]Component,
 	return components, nil
 }
 
-// createSigFile: create a signature file using the local gpg environment. This
-// does not use the crypto packages, so that it can use gpg-agent which is
-// often tunneled over ssh
-func createSigFile(input, output string) error {
-	cmd := exec.Command("gpg", "--yes", "--armor", "--output", output, "--detach-sig", input)
-	return cmd.Run()
+// streamComponents: create the single component read from a stream. Since the
+// stream can't be read twice, it's written to the scratch directory as it's
+// hashed, and uploaded from there
+func streamComponents(stream io.Reader, name, scratch, gcsPrefix, urlPrefix string) ([]Component, error) {
+	name = path.Clean(name)
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return nil, fmt.Errorf("%q: a component name must be a path within the version", name)
+	}
+	if isManagedFilepath(name) {
+		return nil, fmt.Errorf("%s: written by artifactor itself, so can't be published as a component", name)
+	}
+
+	// a directory of its own keeps it apart from the packages signed in the
+	// scratch directory under their own filepaths
+	streamDir, err := ioutil.TempDir(scratch, "stream")
+	if err != nil {
+		return nil, err
+	}
+
+	localFilepath := filepath.Join(streamDir, path.Base(name))
+	file, err := os.Create(localFilepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	component, err := newStreamedComponent(name, gcsPrefix, urlPrefix, io.TeeReader(stream, file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	component.localFilepath = localFilepath
+
+	return []Component{component}, nil
+}
+
+// isManagedFilepath: whether a path is one of the files the artifactor writes
+// itself, rather than a component
+func isManagedFilepath(path string) bool {
+	for _, bannedFilepaths := range [][]string{managedFilepaths, compressedManifestFilepaths, aliasPointerFilepaths, rootFilepaths, keyRingFilepaths, indexFilepaths, dsymIndexFilepaths} {
+		for _, bannedFilepath := range bannedFilepaths {
+			if path == bannedFilepath {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// createSigFile: create a signature file with the current signer, the local
+// gpg environment by default. When several keys are given, the signature file
+// holds a signature from each of them
+func createSigFile(input, output string, keys ...string) error {
+	return currentSigner().Sign(input, output, keys...)
 }
 
-// CreateVersion: create and upload a project version given a component set
+// CreateVersion: create and upload a project version given a component set,
+// alerting if it fails. The publish report is written either way
 func CreateVersion(project Project, opts *Options) error {
-	ts := time.Now()
+	report := NewPublishReport(project.name, opts.Version, time.Now())
+	report.destinationPrefixes = publishDestinations(opts)
+	reportProgress(opts.Progress, ProgressEvent{Kind: ProgressStarted, Project: project.name, Version: opts.Version})
+
+	err := createVersion(project, opts, &report)
+	if err != nil {
+		notify(opts.Alerters, publishFailedEvent(project, opts.Version, err))
+		reportProgress(opts.Progress, ProgressEvent{Kind: ProgressFailed, Project: project.name, Version: opts.Version, Error: err.Error()})
+	} else {
+		reportProgress(opts.Progress, ProgressEvent{Kind: ProgressSucceeded, Project: project.name, Version: opts.Version})
+	}
+
+	if opts.ReportFilepath != "" {
+		report.finish(err)
+		if writeErr := report.write(opts.ReportFilepath); writeErr != nil {
+			log.Println(fmt.Sprintf("writing publish report: %v", writeErr))
+		}
+	}
+
+	return err
+}
+
+func createVersion(project Project, opts *Options, report *PublishReport) error {
+	ts := report.Timestamp
 	versionGCSPrefix := project.gcsPrefix + opts.Version + "/"
 	versionURLPrefix := project.urlPrefix + opts.Version + "/"
 
-	components, err := createComponents(".", versionGCSPrefix, versionURLPrefix)
+	// record the generation of each alias object before doing any work, so
+	// that an alias updated by a concurrent publisher is never overwritten
+	generations, err := fetchGenerations(aliasPaths(project, opts))
+	if err != nil {
+		return err
+	}
+
+	// manifests, signatures and signed packages are written to a scratch
+	// directory, leaving the source directory untouched
+	scratch, err := newScratchDir("artifactor-publish")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+
+	var snapshot sourceSnapshot
+	if opts.VerifySource {
+		if opts.Input != "" || opts.Stream != nil || opts.Staged {
+			return fmt.Errorf("verifying the source only applies to a directory")
+		}
+
+		snapshot, err = snapshotSource(".", opts.ContentReportFilepath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var components []Component
+	if opts.Staged {
+		components, err = stagedComponents(project, opts.Version, opts.RequiredParts, versionGCSPrefix, versionURLPrefix)
+	} else {
+		components, err = sourceComponents(opts, scratch, versionGCSPrefix, versionURLPrefix)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.PackageSigningKey != "" {
+		components, err = signPackages(components, opts.PackageSigningKey, scratch, versionGCSPrefix, versionURLPrefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.ObjectNaming != nil {
+		components, err = nameComponents(project, opts.Version, components, *opts.ObjectNaming)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(opts.URLTemplates) > 0 {
+		components, err = templateURLs(project, opts, components)
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.Groups) > 0 {
+		components, err = groupComponents(components, opts.Groups)
+		if err != nil {
+			return err
+		}
+	}
+
+	components, err = classifyComponents(components)
+	if err != nil {
+		return err
+	}
+
+	symbols := []Component(nil)
+	if opts.SymbolsPrefix != "" {
+		components, symbols, err = splitSymbols(project, opts, components)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(opts.Mirrors) > 0 {
+		components = mirrorURLs(opts, components)
+	}
+	report.components = components
+
+	versionPaths := make([]string, 0, len(components)+len(managedFilepaths))
+	for _, component := range components {
+		versionPaths = append(versionPaths, component.GCSFilepath)
+	}
+	for _, filepath := range managedFilepaths {
+		versionPaths = append(versionPaths, versionGCSPrefix+filepath)
+	}
+	if opts.CompressManifest {
+		for _, filepath := range compressedManifestFilepaths {
+			versionPaths = append(versionPaths, versionGCSPrefix+filepath)
+		}
+	}
+	if opts.DSYMIndex {
+		for _, filepath := range dsymIndexFilepaths {
+			versionPaths = append(versionPaths, versionGCSPrefix+filepath)
+		}
+	}
+
+	if opts.ContentRules != nil {
+		contentReport, err := NewContentReport(components, *opts.ContentRules)
+		if err != nil {
+			return err
+		}
+
+		if opts.ContentReportFilepath != "" {
+			if err := contentReport.write(opts.ContentReportFilepath); err != nil {
+				return err
+			}
+		}
+
+		if err := contentReport.Err(); err != nil {
+			return err
+		}
+	}
+
+	licenses, binaries, err := detectLicenses(components)
+	if err != nil {
+		return err
+	}
+
+	if len(binaries) > 0 && len(licenses) == 0 {
+		if opts.RequireLicense {
+			return fmt.Errorf("%d binaries found, but no license file", len(binaries))
+		}
+
+		log.Println(fmt.Sprintf("warning: %d binaries found, but no license file", len(binaries)))
+	}
+
+	versionGenerations, err := fetchGenerations(append(versionPaths, mirrorPaths(opts, versionPaths)...))
+	if err != nil {
+		return err
+	}
+	for gcsPath, generation := range versionGenerations {
+		generations[gcsPath] = generation
+	}
+
+	symbolPaths := make([]string, 0, len(symbols))
+	for _, component := range symbols {
+		symbolPaths = append(symbolPaths, component.GCSFilepath)
+	}
+	symbolGenerations, err := fetchGenerations(symbolPaths)
+	if err != nil {
+		return err
+	}
+	for gcsPath, generation := range symbolGenerations {
+		generations[gcsPath] = generation
+	}
+
+	// versions are immutable unless forced, so each of the version's objects
+	// is written on the condition that it doesn't exist yet, and a version
+	// already published fails here, before anything is uploaded
+	if !opts.Force {
+		// pdbs laid out for a symbol server are shared by every version
+		// built with them, so only symbols beneath the version are checked
+		symbolsVersionPrefix := opts.SymbolsPrefix + strings.TrimPrefix(versionGCSPrefix, opts.GcsPrefix)
+		versionSymbolGenerations := make(map[string]int64, len(symbolGenerations))
+		for gcsPath, generation := range symbolGenerations {
+			if strings.HasPrefix(gcsPath, symbolsVersionPrefix) {
+				versionSymbolGenerations[gcsPath] = generation
+			}
+		}
+
+		if err := checkVersionUnpublished(opts.Version, versionGenerations, versionSymbolGenerations); err != nil {
+			return err
+		}
+	}
+
+	uploads := components
+	copies := []componentCopy(nil)
+	previousManifest := ComponentManifest{}
+	if opts.PreviousVersion != "" {
+		previousManifest, err = fetchManifest(project.gcsPrefix + opts.PreviousVersion + "/manifest.json")
+		if err != nil {
+			return err
+		}
+
+		uploads, copies = deltaComponents(previousManifest, components)
+	}
+
+	report.Duplicates = duplicateComponents(components)
+	for _, duplicates := range report.Duplicates {
+		log.Println(fmt.Sprintf("warning: identical contents in %s", strings.Join(duplicates, ", ")))
+	}
+
+	if opts.Deduplicate {
+		var dedupeCopies []componentCopy
+		uploads, dedupeCopies = dedupeComponents(uploads)
+		copies = append(copies, dedupeCopies...)
+	}
+
+	total, totalBytes := len(uploads)+len(copies)+len(symbols), int64(0)
+	for _, component := range uploads {
+		totalBytes += component.Bytes
+	}
+	for _, component := range symbols {
+		totalBytes += component.Bytes
+	}
+	for _, cp := range copies {
+		totalBytes += cp.dst.Bytes
+	}
+	reportProgress(opts.Progress, ProgressEvent{Kind: ProgressUploading, Project: project.name, Version: opts.Version, Bytes: totalBytes, Total: total})
+
+	settings := newUploadSettings(opts)
+	var completedMu sync.Mutex
+	completed := 0
+	written := func(component Component, object PublishedObject) {
+		completedMu.Lock()
+		completed++
+		event := ProgressEvent{
+			Kind:      ProgressObjectWritten,
+			Project:   project.name,
+			Version:   opts.Version,
+			Filepath:  component.Filepath,
+			URL:       object.URL,
+			Outcome:   object.Outcome,
+			Bytes:     component.Bytes,
+			Completed: completed,
+			Total:     total,
+		}
+		completedMu.Unlock()
+
+		reportProgress(opts.Progress, event)
+	}
+	// components are published before the manifests that reference them, so
+	// that their generations can be recorded in the manifest. Mirrors are
+	// sent every component, whether or not the primary copies it
+	mirrorErrCh := make(chan error, 1)
+	go func() {
+		mirrorErrCh <- uploadMirrors(opts, components, generations, report, settings)
+	}()
+
+	uploadedObjects, err := uploadComponentsWithProgress(project.gcsPrefix, uploads, generations, opts.FailFast, written, settings)
+	report.Objects = append(report.Objects, uploadedObjects...)
+	if mirrorErr := <-mirrorErrCh; err == nil {
+		err = mirrorErr
+	}
 	if err != nil {
 		return err
 	}
 
-	componentManifest := NewComponentManifest(".", project.name, opts.Version, ts, components)
+	copiedObjects, err := copyComponentsWithProgress(project.gcsPrefix, copies, generations, opts.FailFast, written, settings)
+	report.Objects = append(report.Objects, copiedObjects...)
+	if err != nil {
+		return err
+	}
+
+	symbolObjects, err := uploadComponentsWithACL(opts.SymbolsPrefix, symbols, generations, opts.FailFast, symbolsACL(opts), written, settings)
+	report.Objects = append(report.Objects, symbolObjects...)
+	if err != nil {
+		return err
+	}
+
+	if opts.ManifestGenerations {
+		components = report.annotate(components)
+		symbols = report.annotate(symbols)
+	}
+
+	if snapshot != nil {
+		if err := snapshot.verify(".", opts.ContentReportFilepath); err != nil {
+			return err
+		}
+	}
+
+	componentManifest := NewComponentManifest(scratch, project.name, opts.Version, ts, components)
+	componentManifest.Licenses = licenses
+	componentManifest.PackageSigningKey = opts.PackageSigningKey
+	publisher, err := newPublisher(opts)
+	if err != nil {
+		return err
+	}
+	componentManifest.PublishedBy = &publisher
+	componentManifest.ProjectMetadata = opts.Metadata
+	componentManifest.Symbols = symbols
+	if opts.ExpiresIn > 0 {
+		expiresAt := ts.Add(opts.ExpiresIn)
+		componentManifest.ExpiresAt = &expiresAt
+	}
 	if err := componentManifest.write(); err != nil {
 		return err
 	}
 
 	checksumManifest := NewChecksumManifest(components)
+	checksumManifest.manifestFilepath = filepath.Join(scratch, checksumManifest.manifestFilepath)
+	checksumManifest.signatureFilepath = filepath.Join(scratch, checksumManifest.signatureFilepath)
 	if err := checksumManifest.write(); err != nil {
 		return err
 	}
@@ -283,95 +1031,560 @@ func CreateVersion(project Project, opts *Options) error {
 		componentManifest.signatureFilepath,
 	}
 	newComponents := make([]Component, 0, len(newComponentFilepaths))
-	for _, filepath := range newComponentFilepaths {
-		component, err := NewComponent(filepath, versionGCSPrefix, versionURLPrefix)
+	for _, newComponentFilepath := range newComponentFilepaths {
+		component, err := newTempComponent(scratch, filepath.Base(newComponentFilepath), versionGCSPrefix, versionURLPrefix)
 		if err != nil {
 			return err
 		}
 
-		components = append(components, component)
 		newComponents = append(newComponents, component)
 	}
 
-	if err := uploadComponents(project.gcsPrefix, components); err != nil {
+	// the compressed manifest is uploaded with the version's manifests, but
+	// is kept out of the components copied to its aliases
+	manifestUploads := newComponents
+	if opts.CompressManifest {
+		if err := writeCompressedManifest(componentManifest.manifestFilepath); err != nil {
+			return err
+		}
+
+		manifestUploads = append([]Component(nil), newComponents...)
+		for _, filename := range compressedManifestFilepaths {
+			component, err := newTempComponent(scratch, filename, versionGCSPrefix, versionURLPrefix)
+			if err != nil {
+				return err
+			}
+
+			manifestUploads = append(manifestUploads, component)
+		}
+	}
+
+	// the dSYM index is likewise kept out of the version's aliases
+	if opts.DSYMIndex {
+		index, err := NewDSYMIndex(project.name, opts.Version, append(append([]Component(nil), components...), symbols...))
+		if err != nil {
+			return err
+		}
+
+		if err := writeDSYMIndex(scratch, index); err != nil {
+			return err
+		}
+
+		manifestUploads = append([]Component(nil), manifestUploads...)
+		for _, filename := range dsymIndexFilepaths {
+			component, err := newTempComponent(scratch, filename, versionGCSPrefix, versionURLPrefix)
+			if err != nil {
+				return err
+			}
+
+			manifestUploads = append(manifestUploads, component)
+		}
+	}
+
+	go func() {
+		mirrorErrCh <- uploadMirrors(opts, manifestUploads, generations, report, settings)
+	}()
+
+	manifestObjects, err := uploadComponentsWithProgress(project.gcsPrefix, manifestUploads, generations, opts.FailFast, nil, settings)
+	report.Objects = append(report.Objects, manifestObjects...)
+	if mirrorErr := <-mirrorErrCh; err == nil {
+		err = mirrorErr
+	}
+	if err != nil {
+		return err
+	}
+	reportProgress(opts.Progress, ProgressEvent{Kind: ProgressManifestPublished, Project: project.name, Version: opts.Version, URL: versionURLPrefix + "manifest.json"})
+
+	if opts.ManifestShardSize > 0 && len(components) > opts.ManifestShardSize {
+		shardObjects, err := publishManifestShards(project, componentManifest, opts.ManifestShardSize)
+		report.Objects = append(report.Objects, shardObjects...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.RootManifest {
+		rootObjects, err := updateRoot(project, opts.Version, newComponents, ts, componentManifest.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		report.Objects = append(report.Objects, rootObjects...)
+	}
+
+	if opts.Index || opts.Feed {
+		indexObjects, err := updateIndex(project, NewIndexVersion(project, componentManifest, opts.ReleaseNotes), opts.Feed)
+		if err != nil {
+			return err
+		}
+		report.Objects = append(report.Objects, indexObjects...)
+	}
+
+	if opts.PythonIndex {
+		simpleObjects, err := updateSimpleIndex(project, components)
+		if err != nil {
+			return err
+		}
+		report.Objects = append(report.Objects, simpleObjects...)
+	}
+
+	if opts.Maven {
+		mavenObjects, err := publishMaven(project, components, ts)
+		if err != nil {
+			return err
+		}
+		report.Objects = append(report.Objects, mavenObjects...)
+	}
+
+	if opts.GoModulePath != "" {
+		moduleObjects, err := publishGoModule(project, opts.GoModulePath, opts.GoModuleDir, opts.Version, ts)
+		if err != nil {
+			return err
+		}
+		report.Objects = append(report.Objects, moduleObjects...)
+	}
+
+	if opts.OCIRepository != "" {
+		tags := append([]string{opts.Version}, opts.Aliases...)
+		if err := pushOCIArtifact(opts.OCIRepository, append(append([]Component(nil), components...), newComponents...), tags, ts); err != nil {
+			return err
+		}
+	}
+
+	if opts.GitHubRepository != "" {
+		releaseURL, err := mirrorGitHubRelease(opts.GitHubRepository, opts, append(append([]Component(nil), components...), newComponents...))
+		if err != nil {
+			return err
+		}
+		log.Println(fmt.Sprintf("mirrored to github release %s", releaseURL))
+	}
+
+	// every alias is checked even when one fails to update, so the report
+	// lists each alias left stale
+	aliasObjects, aliasErr := updateAliases(project, opts, ts, newComponents, generations)
+	report.Objects = append(report.Objects, aliasObjects...)
+
+	report.StaleAliases, err = staleAliases(project, opts, newComponents)
+	if err != nil {
 		return err
 	}
+	if aliasErr != nil {
+		return aliasErr
+	}
+	if len(report.StaleAliases) > 0 {
+		return fmt.Errorf("aliases left stale: %s", strings.Join(report.StaleAliases, ", "))
+	}
+
+	if opts.ChangelogFilepath != "" && opts.PreviousVersion != "" {
+		if err := DiffManifests(previousManifest, componentManifest).write(opts.ChangelogFilepath); err != nil {
+			return err
+		}
+	}
+
+	if opts.TerraformOutputsFilepath != "" {
+		if err := writeTerraformOutputs(opts.TerraformOutputsFilepath, project, componentManifest, opts.SignedURLExpiry); err != nil {
+			return err
+		}
+	}
 
-	for _, alias := range opts.Aliases {
-		aliasPrefix := project.gcsPrefix + alias + "/"
-		if err := uploadAliasComponents(aliasPrefix, newComponents); err != nil {
+	if opts.BazelSnippetsFilepath != "" {
+		if err := writeBazelSnippets(opts.BazelSnippetsFilepath, componentManifest); err != nil {
 			return err
 		}
 	}
 
+	if len(opts.SymbolUploaders) > 0 {
+		archives, err := dsymArchives(scratch, append(append([]Component(nil), components...), symbols...))
+		if err != nil {
+			return err
+		}
+		uploadSymbols(opts.SymbolUploaders, project.name, opts.Version, archives)
+	}
+
+	// the version is live, so what was staged for it is no longer needed
+	if opts.Staged {
+		if err := discardStaged(project, opts.Version); err != nil {
+			log.Println(fmt.Sprintf("warning: removing what was staged for %s: %v", opts.Version, err))
+		}
+	}
+
+	notify(opts.Notifiers, publishedEvent(project, componentManifest, *report))
 	return nil
 }
 
+// sourceComponents: create the components of the version from the stream,
+// archive or working directory the options publish from
+func sourceComponents(opts *Options, scratch, gcsPrefix, urlPrefix string) ([]Component, error) {
+	switch {
+	case opts.Stream != nil:
+		return streamComponents(opts.Stream, opts.StreamName, scratch, gcsPrefix, urlPrefix)
+	case opts.Input != "":
+		return archiveComponents(opts.Input, gcsPrefix, urlPrefix)
+	}
+
+	return createComponents(".", gcsPrefix, urlPrefix)
+}
+
 // uploadComponents: upload all components to their corresponding location in
-// the storage bucket
-func uploadComponents(gcsPrefix string, components []Component) error {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return err
+// the storage bucket. Writes are guarded by any recorded generations. When
+// failFast is set, the first error cancels every other upload rather than
+// letting them finish
+func uploadComponents(gcsPrefix string, components []Component, generations map[string]int64, failFast bool) ([]PublishedObject, error) {
+	return uploadComponentsWithProgress(gcsPrefix, components, generations, failFast, nil, uploadSettings{})
+}
+
+// uploadComponentsWithProgress: upload the components with the settings of a
+// publish, calling written as each one is, when it is set
+func uploadComponentsWithProgress(gcsPrefix string, components []Component, generations map[string]int64, failFast bool, written func(Component, PublishedObject), settings uploadSettings) ([]PublishedObject, error) {
+	return uploadComponentsWithACL(gcsPrefix, components, generations, failFast, "publicRead", written, settings)
+}
+
+// uploadSettings: how the objects of a publish are uploaded, taken from its
+// options. The zero value uploads with the storage client's defaults, up to
+// DefaultConcurrency components at once
+type uploadSettings struct {
+	chunkSize, singleRequestSize int
+
+	// semaphore: a slot is taken for each component uploaded or copied. It's
+	// shared by every destination of the publish, its mirrors included, so
+	// that Concurrency bounds them all together
+	semaphore chan struct{}
+}
+
+// newUploadSettings: the upload settings of a publish
+func newUploadSettings(opts *Options) uploadSettings {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
 	}
 
-	fullPrefix := strings.TrimLeft(gcsPrefix, "gcs://")
-	bucketName := strings.Split(fullPrefix, "/")[0]
+	return uploadSettings{
+		chunkSize:         opts.UploadChunkSize,
+		singleRequestSize: opts.SingleRequestUploadSize,
+		semaphore:         make(chan struct{}, concurrency),
+	}
+}
+
+// slots: the semaphore bounding how many components are uploaded or copied at
+// once
+func (u uploadSettings) slots() chan struct{} {
+	if u.semaphore == nil {
+		return make(chan struct{}, DefaultConcurrency)
+	}
+
+	return u.semaphore
+}
+
+// uploadComponentsWithACL: upload the components with a predefined acl
+// rather than publicly readable, such as private for debug symbols
+func uploadComponentsWithACL(gcsPrefix string, components []Component, generations map[string]int64, failFast bool, predefinedACL string, written func(Component, PublishedObject), settings uploadSettings) ([]PublishedObject, error) {
+	ctx, cancel := context.WithCancel(withUploadChunking(context.Background(), settings.chunkSize, settings.singleRequestSize))
+	defer cancel()
 
-	bucket := client.Bucket(bucketName)
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	var wg sync.WaitGroup
 	errCh := make(chan error, len(components))
+	objectCh := make(chan PublishedObject, len(components))
+
+	// a slot is taken before each upload starts, so no more writers are ever
+	// open at once than the settings allow
+	semaphore := settings.slots()
 
 	for _, component := range components {
+		semaphore <- struct{}{}
 		wg.Add(1)
 
 		go func(component Component) {
+			defer func() { <-semaphore }()
+
 			err := func() error {
-				byts, err := ioutil.ReadFile(component.Filepath)
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				started := time.Now()
+
+				md5Sum, crc32c, err := componentChecksums(component)
 				if err != nil {
 					return err
 				}
 
-				objectName := strings.TrimPrefix(component.GCSFilepath, "gcs://"+bucketName+"/")
-				bucketObject := bucket.Object(objectName)
-				writer := bucketObject.NewWriter(ctx)
+				// staged components are already in the bucket, and are
+				// copied into the version server side
+				outcome := OutcomeUploaded
+				var attrs *storage.ObjectAttrs
+				if component.staged != "" {
+					outcome = OutcomeCopied
+					attrs, err = store.Copy(ctx, component.staged, component.GCSFilepath, storage.ObjectAttrs{
+						CacheControl:  fmt.Sprintf("max-age=%v", CacheControlMaxAge),
+						PredefinedACL: predefinedACL,
+					}, conditions(component.GCSFilepath, generations))
+					if err == nil {
+						err = verifyObjectAttrs(attrs, component)
+					}
+				} else {
+					// setting the acl as part of the write, rather than
+					// afterwards, keeps the recorded metageneration
+					// stable. Contents are streamed from the component,
+					// and refused by the store if they've changed since
+					// they were hashed
+					attrs, err = store.WriteFrom(ctx, component.GCSFilepath, component.openContents, storage.ObjectAttrs{
+						CacheControl:  fmt.Sprintf("max-age=%v", CacheControlMaxAge),
+						PredefinedACL: predefinedACL,
+						Size:          component.Bytes,
+						MD5:           md5Sum,
+						CRC32C:        crc32c,
+					}, conditions(component.GCSFilepath, generations))
+				}
+				if err != nil {
+					return err
+				}
+
+				object := newPublishedObject(component, outcome, attrs, started)
+				if written != nil {
+					written(component, object)
+				}
+
+				objectCh <- object
+				return nil
+			}()
+
+			if err != nil {
+				errCh <- err
+				if failFast {
+					cancel()
+				}
+			}
+			wg.Done()
+		}(component)
+	}
+
+	wg.Wait()
+	close(objectCh)
+
+	// objects written before a failure are returned along with it, so they
+	// can still be reported
+	select {
+	case err := <-errCh:
+		return collectPublishedObjects(objectCh), err
+	default:
+	}
 
-				writer.SendCRC32C = true
-				writer.CRC32C = crc32.Checksum(byts, crc32.MakeTable(crc32.Castagnoli))
-				writer.ObjectAttrs.CacheControl = fmt.Sprintf("max-age=%v", CacheControlMaxAge)
+	return collectPublishedObjects(objectCh), nil
+}
+
+// checkVersionUnpublished: fail if any of a version's objects already exist,
+// naming its manifest when that does, as republishing would overwrite them
+func checkVersionUnpublished(version string, generations ...map[string]int64) error {
+	existing := make([]string, 0)
+	for _, objectGenerations := range generations {
+		for gcsPath, generation := range objectGenerations {
+			if generation != 0 {
+				existing = append(existing, gcsPath)
+			}
+		}
+	}
+
+	if len(existing) == 0 {
+		return nil
+	}
+
+	sort.Slice(existing, func(i, j int) bool {
+		iManifest, jManifest := path.Base(existing[i]) == managedFilepaths[0], path.Base(existing[j]) == managedFilepaths[0]
+		if iManifest != jManifest {
+			return iManifest
+		}
+
+		return existing[i] < existing[j]
+	})
+
+	return fmt.Errorf("version %s already exists, and republishing it would overwrite %d objects, such as %s", version, len(existing), existing[0])
+}
+
+// copyComponents: copy objects that already exist in the storage bucket to the
+// location of their corresponding component, without a local round trip.
+// Writes are guarded by any recorded generations, and the first error cancels
+// every other copy when failFast is set
+func copyComponents(gcsPrefix string, copies []componentCopy, generations map[string]int64, failFast bool) ([]PublishedObject, error) {
+	return copyComponentsWithProgress(gcsPrefix, copies, generations, failFast, nil, uploadSettings{})
+}
+
+// copyComponentsWithProgress: copy the components with the settings of a
+// publish, calling written as each one is, when it is set
+func copyComponentsWithProgress(gcsPrefix string, copies []componentCopy, generations map[string]int64, failFast bool, written func(Component, PublishedObject), settings uploadSettings) ([]PublishedObject, error) {
+	if len(copies) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-				if _, err := writer.Write(byts); err != nil {
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(copies))
+	objectCh := make(chan PublishedObject, len(copies))
+	semaphore := settings.slots()
+
+	for _, cp := range copies {
+		semaphore <- struct{}{}
+		wg.Add(1)
+
+		go func(cp componentCopy) {
+			defer func() { <-semaphore }()
+
+			err := func() error {
+				if err := ctx.Err(); err != nil {
 					return err
 				}
+				started := time.Now()
 
-				if err := writer.Close(); err != nil {
+				attrs, err := store.Copy(ctx, cp.src, cp.dst.GCSFilepath, storage.ObjectAttrs{
+					CacheControl:  fmt.Sprintf("max-age=%v", CacheControlMaxAge),
+					PredefinedACL: "publicRead",
+				}, conditions(cp.dst.GCSFilepath, generations))
+				if err != nil {
 					return err
 				}
 
-				// set attributes on the object
-				if err := bucketObject.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+				if err := verifyObjectAttrs(attrs, cp.dst); err != nil {
 					return err
 				}
 
+				object := newPublishedObject(cp.dst, OutcomeCopied, attrs, started)
+				if written != nil {
+					written(cp.dst, object)
+				}
+
+				objectCh <- object
 				return nil
 			}()
 
 			if err != nil {
 				errCh <- err
+				if failFast {
+					cancel()
+				}
 			}
 			wg.Done()
-		}(component)
+		}(cp)
 	}
 
 	wg.Wait()
+	close(objectCh)
 
+	// objects written before a failure are returned along with it, so they
+	// can still be reported
 	select {
 	case err := <-errCh:
-		return err
+		return collectPublishedObjects(objectCh), err
 	default:
 	}
 
+	return collectPublishedObjects(objectCh), nil
+}
+
+// verifyObjectAttrs: confirm that the size, md5 and crc32c of a stored object
+// match the component it is supposed to hold. The crc32c is only compared when
+// both the component and the backend record one
+func verifyObjectAttrs(attrs *storage.ObjectAttrs, component Component) error {
+	if attrs.Size != component.Bytes {
+		return fmt.Errorf("%s: expected %d bytes, found %d", component.GCSFilepath, component.Bytes, attrs.Size)
+	}
+
+	if component.Md5Checksum != "" && fmt.Sprintf("%x", attrs.MD5) != component.Md5Checksum {
+		return fmt.Errorf("%s: expected md5 %s, found %x", component.GCSFilepath, component.Md5Checksum, attrs.MD5)
+	}
+
+	if component.Crc32cChecksum != "" && attrs.CRC32C != 0 && fmt.Sprintf("%08x", attrs.CRC32C) != component.Crc32cChecksum {
+		return fmt.Errorf("%s: expected crc32c %s, found %08x", component.GCSFilepath, component.Crc32cChecksum, attrs.CRC32C)
+	}
+
 	return nil
 }
+
+// componentChecksums: the md5 and crc32c recorded for a component, decoded
+// for the store to check what it's sent against. Either is empty or zero
+// when the component doesn't record it
+func componentChecksums(component Component) ([]byte, uint32, error) {
+	md5Sum, err := hex.DecodeString(component.Md5Checksum)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: md5 %q: %v", component.Filepath, component.Md5Checksum, err)
+	}
+
+	var crc32c uint32
+	if component.Crc32cChecksum != "" {
+		parsed, err := strconv.ParseUint(component.Crc32cChecksum, 16, 32)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: crc32c %q: %v", component.Filepath, component.Crc32cChecksum, err)
+		}
+		crc32c = uint32(parsed)
+	}
+
+	return md5Sum, crc32c, nil
+}
+
+// fetchManifest: download and decode a published manifest.json from the
+// storage bucket
+func fetchManifest(gcsPath string) (ComponentManifest, error) {
+	byts, _, err := fetchObject(gcsPath)
+	if err != nil {
+		return ComponentManifest{}, err
+	}
+
+	var manifest ComponentManifest
+	if err := json.Unmarshal(byts, &manifest); err != nil {
+		return ComponentManifest{}, err
+	}
+
+	return manifest, nil
+}
+
+// fetchObject: download an object's contents along with its generation
+func fetchObject(gcsPath string) ([]byte, int64, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	attrs, err := store.Attrs(ctx, gcsPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the read is pinned to the generation that was stat'd, so the contents
+	// always match the generation returned
+	reader, err := store.NewRangeReader(ctx, gcsPath, attrs.Generation, 0, -1)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+
+	byts, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return byts, attrs.Generation, nil
+}
+
+// splitGCSPath: split a gcs://bucket/object path, or the path of another
+// storage backend such as s3://bucket/object, into its bucket and object names
+func splitGCSPath(gcsPath string) (string, string) {
+	if separator := strings.Index(gcsPath, "://"); separator >= 0 {
+		gcsPath = gcsPath[separator+3:]
+	}
+
+	parts := strings.SplitN(gcsPath, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
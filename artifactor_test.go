@@ -0,0 +1,321 @@
+package artifactor_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonmorehouse/artifactor"
+	"github.com/jonmorehouse/artifactor/artifactortest"
+)
+
+// coSigner: a second primary key, which co-signs manifests in the tests
+const coSigner = "0F1E2D3C4B5A69788796A5B4C3D2E1F00F1E2D3C"
+
+// inDir: run fn with the working directory changed to dir, as publishing
+// reads its components from the working directory
+func inDir(t *testing.T, dir string, fn func() error) error {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	return fn()
+}
+
+// writeFiles: write the given files to a new directory, returning it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// publish: publish a version holding the given files to the store
+func publish(t *testing.T, opts artifactor.Options, files map[string]string) {
+	t.Helper()
+
+	publishDir(t, opts, writeFiles(t, files))
+}
+
+// publishDir: publish a version holding the files in dir to the store
+func publishDir(t *testing.T, opts artifactor.Options, dir string) {
+	t.Helper()
+
+	err := inDir(t, dir, func() error {
+		return artifactor.CreateVersion(artifactor.NewProject(&opts), &opts)
+	})
+	if err != nil {
+		t.Fatalf("publishing %s: %v", opts.Version, err)
+	}
+}
+
+// snapshotDir: the path, mode, size and modification time of everything in
+// dir, to compare before and after publishing from it
+func snapshotDir(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var snapshot []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		snapshot = append(snapshot, fmt.Sprintf("%s %v %d %d", path, info.Mode(), info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return snapshot
+}
+
+// testOptions: the options for publishing a version of project p to the
+// store's bucket, served at urlPrefix
+func testOptions(urlPrefix, version string) artifactor.Options {
+	return artifactor.Options{
+		ProjectName: "p",
+		GcsPrefix:   "gcs://bucket/",
+		UrlPrefix:   urlPrefix,
+		Version:     version,
+		Aliases:     []string{"latest"},
+	}
+}
+
+func TestPublish(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	publish(t, testOptions(urlPrefix, "v1"), map[string]string{"a.txt": "a", "bin/b": "b"})
+
+	manifest := artifactortest.AssertManifest(t, store, "gcs://bucket/p/v1/manifest.json")
+	if manifest.Version != "v1" || len(manifest.Components) != 2 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	artifactortest.AssertObjects(t, store, "gcs://bucket/p/v1/bin/", "b")
+	artifactortest.AssertManifest(t, store, "gcs://bucket/p/latest/manifest.json")
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testOptions(urlPrefix, "v1")
+	err := inDir(t, dir, func() error {
+		return artifactor.CreateVersion(artifactor.NewProject(&opts), &opts)
+	})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected republishing v1 to fail, got %v", err)
+	}
+}
+
+func TestDownloadAndVerify(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	opts := testOptions(urlPrefix, "v1")
+	publish(t, opts, map[string]string{"a.txt": "a", "bin/b": "b"})
+
+	project := artifactor.NewProject(&opts)
+	trust := artifactor.TrustPolicy{Fingerprints: []string{artifactortest.DefaultKey}, MinimumSignatures: 1}
+
+	dest := t.TempDir()
+	manifest, err := artifactor.DownloadVersion(project, "latest", dest, 2, trust, artifactor.ComponentFilter{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byts, err := ioutil.ReadFile(filepath.Join(dest, "bin", "b"))
+	if err != nil || string(byts) != "b" {
+		t.Fatalf("unexpected download %q: %v", byts, err)
+	}
+
+	if err := artifactor.VerifyDirectory(manifest, dest, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dest, "a.txt"), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := artifactor.VerifyDirectory(manifest, dest, 2); err == nil {
+		t.Fatal("expected a tampered file to fail verification")
+	}
+
+	untrusted := artifactor.TrustPolicy{Fingerprints: []string{coSigner}, MinimumSignatures: 1}
+	if _, _, err := artifactor.FetchVerifiedManifest(project, "v1", untrusted); err == nil {
+		t.Fatal("expected a manifest signed by an untrusted key to fail verification")
+	}
+
+	manifestBytes, _ := store.Get("gcs://bucket/p/v1/manifest.json")
+	store.Put("gcs://bucket/p/v1/manifest.json", []byte(strings.Replace(string(manifestBytes), "a.txt", "c.txt", 1)))
+	if _, _, err := artifactor.FetchVerifiedManifest(project, "v1", trust); err == nil {
+		t.Fatal("expected a rewritten manifest to fail verification")
+	}
+}
+
+func TestMinimumSignatures(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	opts := testOptions(urlPrefix, "v1")
+	publish(t, opts, map[string]string{"a.txt": "a"})
+
+	project := artifactor.NewProject(&opts)
+	trust := artifactor.TrustPolicy{Fingerprints: []string{artifactortest.DefaultKey, coSigner}, MinimumSignatures: 2}
+
+	if _, _, err := artifactor.FetchVerifiedManifest(project, "v1", trust); err == nil {
+		t.Fatal("expected a manifest with one signature to fail a policy requiring two")
+	}
+
+	// co-sign the published manifest, appending a signature from the second
+	// key to its signature file
+	manifestBytes, _ := store.Get("gcs://bucket/p/v1/manifest.json")
+	sigBytes, _ := store.Get("gcs://bucket/p/v1/manifest.json.asc.sig")
+
+	dir := t.TempDir()
+	manifestFilepath := filepath.Join(dir, "manifest.json")
+	if err := ioutil.WriteFile(manifestFilepath, manifestBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (artifactortest.Signer{}).Sign(manifestFilepath, manifestFilepath+".asc.sig", coSigner); err != nil {
+		t.Fatal(err)
+	}
+	coSigBytes, err := ioutil.ReadFile(manifestFilepath + ".asc.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("gcs://bucket/p/v1/manifest.json.asc.sig", append(sigBytes, coSigBytes...))
+
+	if _, _, err := artifactor.FetchVerifiedManifest(project, "v1", trust); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubkeySignatures(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	// the default key is a signing subkey of coSigner
+	artifactor.SetSigner(artifactortest.Signer{Subkeys: map[string]string{artifactortest.DefaultKey: coSigner}})
+
+	opts := testOptions(urlPrefix, "v1")
+	publish(t, opts, map[string]string{"a.txt": "a"})
+
+	project := artifactor.NewProject(&opts)
+	for _, key := range []string{artifactortest.DefaultKey, coSigner} {
+		trust := artifactor.TrustPolicy{Fingerprints: []string{key}, MinimumSignatures: 1}
+		if _, _, err := artifactor.FetchVerifiedManifest(project, "v1", trust); err != nil {
+			t.Fatalf("trusting %s: %v", key, err)
+		}
+	}
+
+	// a subkey and its primary are one identity, so count as one signature
+	trust := artifactor.TrustPolicy{Fingerprints: []string{artifactortest.DefaultKey, coSigner}, MinimumSignatures: 2}
+	if _, _, err := artifactor.FetchVerifiedManifest(project, "v1", trust); err == nil {
+		t.Fatal("expected a subkey and its primary to count as one signature")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	publish(t, testOptions(urlPrefix, "v1"), map[string]string{"a.txt": "1"})
+	opts := testOptions(urlPrefix, "v2")
+	publish(t, opts, map[string]string{"a.txt": "2"})
+
+	project := artifactor.NewProject(&opts)
+	if _, err := artifactor.DeleteVersion(project, "v2", nil, false); err == nil {
+		t.Fatal("expected deleting the version latest serves to fail")
+	}
+
+	err := inDir(t, t.TempDir(), func() error {
+		_, err := artifactor.DeleteVersion(project, "v1", nil, false)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifactortest.AssertObjects(t, store, "gcs://bucket/p/v1/")
+	artifactortest.AssertManifest(t, store, "gcs://bucket/p/v2/manifest.json")
+
+	versions, err := artifactor.ListVersions(project, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Version != "v2" {
+		t.Fatalf("unexpected versions %+v", versions)
+	}
+}
+
+func TestPublishReadOnlyDir(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	dir := writeFiles(t, map[string]string{"a.txt": "a", "bin/b": "b", "LICENSE": "mit"})
+
+	// make the build outputs read only, as from a read only mount, and
+	// writable again so the test can remove them
+	setMode := func(dirMode, fileMode os.FileMode) {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return os.Chmod(path, dirMode)
+			}
+			return os.Chmod(path, fileMode)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	setMode(0555, 0444)
+	t.Cleanup(func() { setMode(0755, 0644) })
+
+	before := snapshotDir(t, dir)
+
+	opts := testOptions(urlPrefix, "v1")
+	opts.Index = true
+	opts.Feed = true
+	opts.RootManifest = true
+	opts.CompressManifest = true
+	opts.ManifestShardSize = 1
+	opts.VerifySource = true
+	publishDir(t, opts, dir)
+
+	opts.Version = "v2"
+	opts.PreviousVersion = "v1"
+	opts.Deduplicate = true
+	publishDir(t, opts, dir)
+
+	after := snapshotDir(t, dir)
+	if strings.Join(before, "\n") != strings.Join(after, "\n") {
+		t.Fatalf("publishing changed the source directory\nbefore:\n%s\nafter:\n%s", strings.Join(before, "\n"), strings.Join(after, "\n"))
+	}
+
+	for _, version := range []string{"v1", "v2"} {
+		artifactortest.AssertManifest(t, store, "gcs://bucket/p/"+version+"/manifest.json")
+	}
+}
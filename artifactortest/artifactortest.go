@@ -0,0 +1,99 @@
+// Package artifactortest provides an in-memory Storage and a fake Signer, so
+// that publish, download and verify flows can be exercised hermetically
+// without GCS or gpg, along with helpers to assert on published layouts.
+package artifactortest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+// Install: publish to a new in-memory store and sign with the fake signer
+// for the rest of the test, going back to GCS and gpg when it finishes
+func Install(t testing.TB) *Storage {
+	store := NewStorage()
+
+	artifactor.SetStorage(store)
+	artifactor.SetSigner(Signer{})
+	t.Cleanup(func() {
+		artifactor.SetStorage(nil)
+		artifactor.SetSigner(nil)
+	})
+
+	return store
+}
+
+// NewServer: serve a bucket of the store over http for the rest of the test,
+// returning the url prefix it is served at
+func NewServer(t testing.TB, store *Storage, bucketName string) string {
+	server := httptest.NewServer(store.Handler(bucketName))
+	t.Cleanup(server.Close)
+
+	return server.URL + "/"
+}
+
+// AssertObjects: fail the test unless the objects under a prefix are exactly
+// the given paths, relative to the prefix
+func AssertObjects(t testing.TB, store *Storage, gcsPrefix string, want ...string) {
+	t.Helper()
+
+	wanted := make(map[string]bool, len(want))
+	for _, objectPath := range want {
+		wanted[gcsPrefix+objectPath] = true
+	}
+
+	for _, gcsPath := range store.Objects(gcsPrefix) {
+		if !wanted[gcsPath] {
+			t.Errorf("unexpected object %s", gcsPath)
+		}
+		delete(wanted, gcsPath)
+	}
+
+	for gcsPath := range wanted {
+		t.Errorf("missing object %s", gcsPath)
+	}
+}
+
+// AssertManifest: decode a published manifest.json, failing the test unless
+// its signature verifies and every component it lists is stored with the
+// recorded sha256
+func AssertManifest(t testing.TB, store *Storage, gcsPath string) artifactor.ComponentManifest {
+	t.Helper()
+
+	byts, ok := store.Get(gcsPath)
+	if !ok {
+		t.Fatalf("missing manifest %s", gcsPath)
+	}
+
+	sigBytes, ok := store.Get(gcsPath + ".asc.sig")
+	if !ok {
+		t.Fatalf("missing manifest signature %s.asc.sig", gcsPath)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256(byts)); len(signedBy(sigBytes, want, nil)) == 0 {
+		t.Errorf("%s.asc.sig does not sign %s", gcsPath, gcsPath)
+	}
+
+	var manifest artifactor.ComponentManifest
+	if err := json.Unmarshal(byts, &manifest); err != nil {
+		t.Fatalf("%s: %v", gcsPath, err)
+	}
+
+	for _, component := range manifest.Components {
+		componentBytes, ok := store.Get(component.GCSFilepath)
+		if !ok {
+			t.Errorf("missing component %s", component.GCSFilepath)
+			continue
+		}
+
+		if checksum := fmt.Sprintf("%x", sha256.Sum256(componentBytes)); checksum != component.Sha256Checksum {
+			t.Errorf("%s: expected sha256 %s, found %s", component.GCSFilepath, component.Sha256Checksum, checksum)
+		}
+	}
+
+	return manifest
+}
@@ -0,0 +1,78 @@
+package artifactortest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+// DefaultKey: the fingerprint signatures are made with when no key is given
+const DefaultKey = "A27F4C1E0D5B9E3F6A7B8C9D0E1F2A3B4C5D6E7F"
+
+// Signer: a fake artifactor.Signer which "signs" by recording the sha256 of
+// the signed file alongside each key's fingerprint, so signatures verify
+// exactly when the file is unchanged, without gpg
+type Signer struct {
+	// Subkeys: the primary key fingerprint of each signing subkey. Keys not
+	// listed are primary keys
+	Subkeys map[string]string
+}
+
+func (Signer) Sign(input, output string, keys ...string) error {
+	byts, err := ioutil.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		keys = []string{DefaultKey}
+	}
+
+	var signature strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&signature, "artifactortest %s %x\n", key, sha256.Sum256(byts))
+	}
+
+	return ioutil.WriteFile(output, []byte(signature.String()), 0644)
+}
+
+func (s Signer) Verify(input, signature string) ([]artifactor.Signature, error) {
+	byts, err := ioutil.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+
+	sigBytes, err := ioutil.ReadFile(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return signedBy(sigBytes, fmt.Sprintf("%x", sha256.Sum256(byts)), s.Subkeys), nil
+}
+
+// signedBy: the signatures of the keys which signed contents with the given
+// sha256, with the primary key of each subkey
+func signedBy(sigBytes []byte, checksum string, subkeys map[string]string) []artifactor.Signature {
+	signatures := make([]artifactor.Signature, 0)
+	for _, line := range strings.Split(string(sigBytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "artifactortest" || fields[2] != checksum {
+			continue
+		}
+
+		signature := artifactor.Signature{Subkey: fields[1], Primary: fields[1]}
+		if primary, ok := subkeys[fields[1]]; ok {
+			signature.Primary = primary
+		}
+		signatures = append(signatures, signature)
+	}
+
+	return signatures
+}
+
+func (Signer) PublicKey(key string) ([]byte, error) {
+	return []byte(fmt.Sprintf("-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nartifactortest %s\n-----END PGP PUBLIC KEY BLOCK-----\n", key)), nil
+}
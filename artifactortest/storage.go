@@ -0,0 +1,345 @@
+package artifactortest
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+type object struct {
+	byts  []byte
+	attrs storage.ObjectAttrs
+}
+
+// Storage: an in-memory artifactor.Storage which keeps every generation of
+// every object, and enforces write preconditions the way GCS does
+type Storage struct {
+	mu         sync.Mutex
+	objects    map[string][]object
+	generation int64
+}
+
+// NewStorage: create an empty in-memory store
+func NewStorage() *Storage {
+	return &Storage{
+		objects: make(map[string][]object),
+	}
+}
+
+func (s *Storage) latest(gcsPath string) (object, bool) {
+	generations := s.objects[gcsPath]
+	if len(generations) == 0 {
+		return object{}, false
+	}
+
+	return generations[len(generations)-1], true
+}
+
+func (s *Storage) Attrs(ctx context.Context, gcsPath string) (*storage.ObjectAttrs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.latest(gcsPath)
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	attrs := obj.attrs
+	return &attrs, nil
+}
+
+func (s *Storage) NewRangeReader(ctx context.Context, gcsPath string, generation int64, offset int64, length int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.latest(gcsPath)
+	if generation != 0 {
+		ok = false
+		for _, candidate := range s.objects[gcsPath] {
+			if candidate.attrs.Generation == generation {
+				obj, ok = candidate, true
+			}
+		}
+	}
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	if offset > int64(len(obj.byts)) {
+		return nil, &googleapi.Error{Code: http.StatusRequestedRangeNotSatisfiable, Message: "range not satisfiable"}
+	}
+
+	end := int64(len(obj.byts))
+	if length >= 0 && offset+length < end {
+		end = offset + length
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(obj.byts[offset:end])), nil
+}
+
+func (s *Storage) Write(ctx context.Context, gcsPath string, byts []byte, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(gcsPath, byts, attrs, conds)
+}
+
+// WriteFrom: read the contents open returns and write them like Write,
+// refusing them the way GCS does if they don't match the size, md5 or crc32c
+// given in attrs
+func (s *Storage) WriteFrom(ctx context.Context, gcsPath string, open func() (io.ReadCloser, error), attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	reader, err := open()
+	if err != nil {
+		return nil, err
+	}
+	byts, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	md5Sum := md5.Sum(byts)
+	switch {
+	case attrs.Size != 0 && attrs.Size != int64(len(byts)):
+		return nil, badRequest(gcsPath, fmt.Sprintf("expected %d bytes, read %d", attrs.Size, len(byts)))
+	case len(attrs.MD5) > 0 && !bytes.Equal(attrs.MD5, md5Sum[:]):
+		return nil, badRequest(gcsPath, "md5 doesn't match the contents")
+	case attrs.CRC32C != 0 && attrs.CRC32C != crc32.Checksum(byts, crc32.MakeTable(crc32.Castagnoli)):
+		return nil, badRequest(gcsPath, "crc32c doesn't match the contents")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(gcsPath, byts, attrs, conds)
+}
+
+func (s *Storage) Copy(ctx context.Context, srcGCSPath string, dstGCSPath string, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src, ok := s.latest(srcGCSPath)
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	if attrs.ContentType == "" {
+		attrs.ContentType = src.attrs.ContentType
+	}
+
+	return s.write(dstGCSPath, src.byts, attrs, conds)
+}
+
+// Delete: delete every generation of an object
+func (s *Storage) Delete(ctx context.Context, gcsPath string, conds storage.Conditions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.latest(gcsPath)
+	if !exists {
+		return storage.ErrObjectNotExist
+	}
+	if conds.DoesNotExist || (conds.GenerationMatch != 0 && current.attrs.Generation != conds.GenerationMatch) {
+		return preconditionFailed(gcsPath)
+	}
+
+	delete(s.objects, gcsPath)
+	return nil
+}
+
+// SignedURL: a fake signed url, which is only useful for asserting on
+func (s *Storage) SignedURL(gcsPath string, expiresAt time.Time) (string, error) {
+	bucketName, objectName := splitGCSPath(gcsPath)
+	return fmt.Sprintf("https://storage.invalid/%s/%s?expires=%d", bucketName, objectName, expiresAt.Unix()), nil
+}
+
+// ListPrefixes: the prefixes directly beneath a prefix, found from the paths
+// of the objects under it
+func (s *Storage) ListPrefixes(ctx context.Context, gcsPrefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	prefixes := make([]string, 0)
+	for gcsPath := range s.objects {
+		if !strings.HasPrefix(gcsPath, gcsPrefix) {
+			continue
+		}
+
+		separator := strings.Index(gcsPath[len(gcsPrefix):], "/")
+		if separator < 0 {
+			continue
+		}
+
+		prefix := gcsPath[:len(gcsPrefix)+separator+1]
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+
+	return prefixes, nil
+}
+
+// ListObjects: the paths of every object beneath a prefix
+func (s *Storage) ListObjects(ctx context.Context, gcsPrefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gcsPaths := make([]string, 0)
+	for gcsPath := range s.objects {
+		if strings.HasPrefix(gcsPath, gcsPrefix) {
+			gcsPaths = append(gcsPaths, gcsPath)
+		}
+	}
+	sort.Strings(gcsPaths)
+
+	return gcsPaths, nil
+}
+
+func (s *Storage) write(gcsPath string, byts []byte, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	current, exists := s.latest(gcsPath)
+	if conds.DoesNotExist && exists {
+		return nil, preconditionFailed(gcsPath)
+	}
+	if conds.GenerationMatch != 0 && (!exists || current.attrs.Generation != conds.GenerationMatch) {
+		return nil, preconditionFailed(gcsPath)
+	}
+
+	s.generation++
+	now := time.Now()
+	md5Sum := md5.Sum(byts)
+
+	attrs.Bucket, attrs.Name = splitGCSPath(gcsPath)
+	attrs.Size = int64(len(byts))
+	attrs.MD5 = md5Sum[:]
+	attrs.CRC32C = crc32.Checksum(byts, crc32.MakeTable(crc32.Castagnoli))
+	attrs.Generation = s.generation
+	attrs.Metageneration = 1
+	attrs.Created = now
+	attrs.Updated = now
+	if attrs.ContentType == "" {
+		attrs.ContentType = http.DetectContentType(byts)
+	}
+
+	s.objects[gcsPath] = append(s.objects[gcsPath], object{
+		byts:  append([]byte(nil), byts...),
+		attrs: attrs,
+	})
+
+	result := attrs
+	return &result, nil
+}
+
+// Put: store an object unconditionally, such as a fixture published by an
+// earlier version
+func (s *Storage) Put(gcsPath string, byts []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.write(gcsPath, byts, storage.ObjectAttrs{}, storage.Conditions{})
+}
+
+// Get: the contents of the latest generation of an object
+func (s *Storage) Get(gcsPath string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.latest(gcsPath)
+	return obj.byts, ok
+}
+
+// Objects: the gcs paths of every object under a prefix, sorted
+func (s *Storage) Objects(gcsPrefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gcsPaths := make([]string, 0, len(s.objects))
+	for gcsPath := range s.objects {
+		if strings.HasPrefix(gcsPath, gcsPrefix) {
+			gcsPaths = append(gcsPaths, gcsPath)
+		}
+	}
+	sort.Strings(gcsPaths)
+
+	return gcsPaths
+}
+
+// Handler: serve the latest generation of objects in a bucket by path, the
+// way a public bucket is served, so that download paths can be exercised
+// against the store with an httptest.Server
+func (s *Storage) Handler(bucketName string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		objectName, err := url.PathUnescape(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		obj, ok := s.latest("gcs://" + bucketName + "/" + objectName)
+		s.mu.Unlock()
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", obj.attrs.ContentType)
+		http.ServeContent(w, r, objectName, obj.attrs.Updated, bytes.NewReader(obj.byts))
+	})
+}
+
+func preconditionFailed(gcsPath string) error {
+	return &googleapi.Error{
+		Code:    http.StatusPreconditionFailed,
+		Message: fmt.Sprintf("%s: precondition failed", gcsPath),
+	}
+}
+
+func badRequest(gcsPath, reason string) error {
+	return &googleapi.Error{
+		Code:    http.StatusBadRequest,
+		Message: fmt.Sprintf("%s: %s", gcsPath, reason),
+	}
+}
+
+// splitGCSPath: split a gcs://bucket/object path into its bucket and object names
+func splitGCSPath(gcsPath string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(gcsPath, "gcs://"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
@@ -0,0 +1,211 @@
+package artifactor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditReport: what auditing a project's bucket against its manifests found.
+// Missing lists the objects manifests name which don't exist, Mismatched
+// describes each object whose size or checksums differ from its manifest, and
+// Orphaned lists the objects which no manifest references, such as strays in
+// a version directory or the remains of a publish which failed
+type AuditReport struct {
+	Project    string   `json:"project"`
+	Versions   int      `json:"versions"`
+	Objects    int      `json:"objects"`
+	Missing    []string `json:"missing"`
+	Mismatched []string `json:"mismatched"`
+	Orphaned   []string `json:"orphaned"`
+}
+
+// Problems: the number of missing, mismatched and orphaned objects found
+func (a AuditReport) Problems() int {
+	return len(a.Missing) + len(a.Mismatched) + len(a.Orphaned)
+}
+
+// AuditProject: cross-check every version's manifest against the objects in
+// the bucket, to find drift such as objects deleted or overwritten by hand.
+// Every component and symbol is stat'd, up to concurrency at once, and
+// compared with its manifest without downloading it, and the project is
+// listed to find orphaned objects which nothing references. Any problems are
+// reported to the alerters as corruption
+func AuditProject(project Project, concurrency int, alerters []Notifier) (AuditReport, error) {
+	report := AuditReport{Project: project.name}
+
+	manifests, err := listManifests(project, concurrency)
+	if err != nil {
+		return report, err
+	}
+
+	aliases, err := listAliases(project, concurrency)
+	if err != nil {
+		return report, err
+	}
+
+	components := make([]Component, 0)
+	for _, manifest := range manifests {
+		components = append(components, manifest.Components...)
+		components = append(components, manifest.Symbols...)
+	}
+
+	report.Versions = len(manifests)
+	report.Objects = len(components)
+
+	report.Missing, report.Mismatched, err = checkObjects(components, concurrency)
+	if err != nil {
+		return report, err
+	}
+
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	objects, err := store.ListObjects(ctx, project.gcsPrefix)
+	if err != nil {
+		return report, err
+	}
+
+	report.Orphaned = orphanedObjects(project, manifests, aliases, objects)
+
+	if report.Problems() == 0 {
+		return report, nil
+	}
+
+	details := make([]string, 0, report.Problems())
+	for _, gcsPath := range report.Missing {
+		details = append(details, fmt.Sprintf("%s: missing", gcsPath))
+	}
+	details = append(details, report.Mismatched...)
+	for _, gcsPath := range report.Orphaned {
+		details = append(details, fmt.Sprintf("%s: orphaned", gcsPath))
+	}
+
+	notify(alerters, Event{
+		Kind:      EventCorruption,
+		Project:   project.name,
+		Timestamp: time.Now(),
+		Summary:   fmt.Sprintf("auditing %s found %d missing, %d mismatched and %d orphaned objects", project.name, len(report.Missing), len(report.Mismatched), len(report.Orphaned)),
+		Details:   details,
+	})
+
+	return report, nil
+}
+
+// projectLayoutDirs: the directories beneath a project which artifactor
+// writes project wide layouts to, rather than versions
+var projectLayoutDirs = []string{"keys/", "roots/", mavenRepositoryDir, simpleIndexDir}
+
+// orphanedObjects: the objects which no manifest references, and which aren't
+// among the files artifactor writes itself. These are objects in version and
+// alias directories beyond what belongs there, and every object in a
+// directory which is neither a version, an alias, a channel nor a project
+// wide layout, such as a publish which failed before its manifest was
+// uploaded. Objects directly beneath the project are left out
+func orphanedObjects(project Project, manifests []ComponentManifest, aliases map[string]string, objects []string) []string {
+	versions := make(map[string]bool, len(manifests))
+	referenced := make(map[string]bool)
+	for _, manifest := range manifests {
+		versions[manifest.Version] = true
+
+		versionGCSPrefix := project.gcsPrefix + manifest.Version + "/"
+		for _, component := range append(append([]Component(nil), manifest.Components...), manifest.Symbols...) {
+			// mirrored manifests name the source's objects, so the copy
+			// in the version directory is referenced too
+			referenced[component.GCSFilepath] = true
+			referenced[versionGCSPrefix+component.Filepath] = true
+		}
+	}
+
+	// channels hold versions of their own, and are left to be checked on
+	// their own
+	channels := make(map[string]bool)
+	for _, gcsPath := range objects {
+		parts := strings.Split(strings.TrimPrefix(gcsPath, project.gcsPrefix), "/")
+		if len(parts) == 3 && parts[2] == "manifest.json" && !versions[parts[0]] {
+			channels[parts[0]] = true
+		}
+	}
+
+	orphaned := make([]string, 0)
+	for _, gcsPath := range objects {
+		if referenced[gcsPath] {
+			continue
+		}
+
+		relpath := strings.TrimPrefix(gcsPath, project.gcsPrefix)
+		separator := strings.Index(relpath, "/")
+		if separator < 0 {
+			continue
+		}
+
+		dir, filepath := relpath[:separator], relpath[separator+1:]
+		_, isAlias := aliases[dir]
+
+		switch {
+		case versions[dir]:
+			if isVersionFilepath(filepath) {
+				continue
+			}
+		case isAlias:
+			if isAliasFilepath(filepath) {
+				continue
+			}
+		case channels[dir] || isProjectLayoutDir(dir+"/") || strings.Contains(relpath, "/@v/"):
+			continue
+		}
+
+		orphaned = append(orphaned, gcsPath)
+	}
+
+	return orphaned
+}
+
+// isProjectLayoutDir: whether a directory beneath a project holds one of its
+// project wide layouts, such as its keys or maven repository
+func isProjectLayoutDir(dir string) bool {
+	for _, layoutDir := range projectLayoutDirs {
+		if dir == layoutDir {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isVersionFilepath: whether a path within a version directory is one of the
+// files artifactor writes there itself, rather than a component
+func isVersionFilepath(path string) bool {
+	if isManagedFilepath(path) || path == sigstoreBundleFilepath || path == yankedSigstoreBundleFilepath || strings.HasPrefix(path, manifestShardsDir) {
+		return true
+	}
+
+	for _, filepaths := range [][]string{advisoryFilepaths, yankFilepaths, manifestIndexFilepaths} {
+		for _, filepath := range filepaths {
+			if path == filepath {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isAliasFilepath: whether a path within an alias directory is one of the
+// files an alias is made of, either a copy of its version's manifests or a
+// pointer to it
+func isAliasFilepath(path string) bool {
+	for _, filepaths := range [][]string{managedFilepaths, aliasPointerFilepaths} {
+		for _, filepath := range filepaths {
+			if path == filepath {
+				return true
+			}
+		}
+	}
+
+	return false
+}
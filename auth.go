@@ -0,0 +1,158 @@
+package artifactor
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authorize: check a request against the server's ip allowlist and
+// credentials, writing an error response and returning false if it is denied
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if len(s.opts.AllowedNetworks) > 0 && !s.allowedAddr(r.RemoteAddr) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+
+	if !s.authRequired {
+		return true
+	}
+
+	if s.validBearerToken(r) || s.validBasicAuth(r) {
+		return true
+	}
+
+	if len(s.opts.BasicAuthUsers) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="artifactor"`)
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+func (s *Server) allowedAddr(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range s.opts.AllowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) validBearerToken(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+
+	valid := false
+	for _, bearerToken := range s.opts.BearerTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(bearerToken)) == 1 {
+			valid = true
+		}
+	}
+
+	return valid
+}
+
+func (s *Server) validBasicAuth(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	hash, ok := s.opts.BasicAuthUsers[username]
+	if !ok {
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// LoadHtpasswd: read an htpasswd file of username:bcrypt-hash lines, as
+// created by htpasswd -B
+func LoadHtpasswd(filepath string) (map[string]string, error) {
+	lines, err := readLines(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]string, len(lines))
+	for _, line := range lines {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "$2") {
+			return nil, fmt.Errorf("%s: expected username:bcrypt-hash, found %q", filepath, line)
+		}
+
+		users[parts[0]] = parts[1]
+	}
+
+	return users, nil
+}
+
+// LoadTokens: read a file of bearer tokens, one per line
+func LoadTokens(filepath string) ([]string, error) {
+	return readLines(filepath)
+}
+
+// ParseNetworks: parse cidrs, or bare ip addresses, into networks
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr = cidr + "/32"
+			} else {
+				cidr = cidr + "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// readLines: read the non-empty, non-comment lines of a file
+func readLines(filepath string) ([]string, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
@@ -0,0 +1,85 @@
+package artifactor_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonmorehouse/artifactor"
+	"github.com/jonmorehouse/artifactor/artifactortest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authStatus: the status of a request for an object through a server
+// with the given options, authenticating with basic auth when user is set
+func authStatus(t *testing.T, opts artifactor.ServerOptions, user, password string) int {
+	t.Helper()
+
+	server, err := artifactor.NewServer("gcs://bucket/", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/p/v1/a.txt", nil)
+	if user != "" {
+		r.SetBasicAuth(user, password)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestServerAuth(t *testing.T) {
+	store := artifactortest.Install(t)
+	store.Put("gcs://bucket/p/v1/a.txt", []byte("a"))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]string{"alice": string(hash)}
+
+	for _, tc := range []struct {
+		name           string
+		opts           artifactor.ServerOptions
+		user, password string
+		want           int
+	}{
+		{"open", artifactor.ServerOptions{}, "", "", http.StatusOK},
+		{"no credentials", artifactor.ServerOptions{BasicAuthUsers: users}, "", "", http.StatusUnauthorized},
+		{"wrong password", artifactor.ServerOptions{BasicAuthUsers: users}, "alice", "guess", http.StatusUnauthorized},
+		{"valid credentials", artifactor.ServerOptions{BasicAuthUsers: users}, "alice", "secret", http.StatusOK},
+		{"required without credentials", artifactor.ServerOptions{RequireAuth: true}, "alice", "secret", http.StatusUnauthorized},
+	} {
+		if status := authStatus(t, tc.opts, tc.user, tc.password); status != tc.want {
+			t.Errorf("%s: expected status %d, found %d", tc.name, tc.want, status)
+		}
+	}
+}
+
+func TestLoadCredentialsSkipsComments(t *testing.T) {
+	dir := t.TempDir()
+
+	tokensFilepath := filepath.Join(dir, "tokens")
+	if err := ioutil.WriteFile(tokensFilepath, []byte("# no tokens yet\n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := artifactor.LoadTokens(tokensFilepath)
+	if err != nil || len(tokens) != 0 {
+		t.Fatalf("expected no tokens, found %v: %v", tokens, err)
+	}
+
+	htpasswdFilepath := filepath.Join(dir, "htpasswd")
+	if err := ioutil.WriteFile(htpasswdFilepath, []byte("# no users yet\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := artifactor.LoadHtpasswd(htpasswdFilepath)
+	if err != nil || len(users) != 0 {
+		t.Fatalf("expected no users, found %v: %v", users, err)
+	}
+}
@@ -0,0 +1,120 @@
+package artifactor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// path under which shields.io endpoint badges are served
+const badgePathPrefix = "/_badges/"
+
+// Badge: the json consumed by shields.io's endpoint badge, such as
+// https://img.shields.io/endpoint?url=https://artifacts.jm.house/_badges/foobar/version.json
+type Badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color,omitempty"`
+	IsError       bool   `json:"isError,omitempty"`
+}
+
+// serveBadge: serve the version, downloads or size badge of the project, or
+// project channel, the badge path is under
+func (s *Server) serveBadge(w http.ResponseWriter, r *http.Request, badgePath string) {
+	projectPath, name := path.Dir(badgePath), path.Base(badgePath)
+	if projectPath == "." || projectPath == "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var badge Badge
+	switch name {
+	case "downloads.json":
+		s.mu.Lock()
+		downloads := s.downloads[projectPath]
+		s.mu.Unlock()
+
+		badge = Badge{Label: "downloads", Message: fmt.Sprintf("%d", downloads), Color: "brightgreen"}
+	case "version.json", "size.json":
+		manifest, found, err := s.latestManifest(r.Context(), projectPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		switch {
+		case !found:
+			badge = Badge{Label: strings.TrimSuffix(name, ".json"), Message: "not found", Color: "lightgrey", IsError: true}
+		case name == "version.json":
+			badge = Badge{Label: "version", Message: manifest.Version, Color: "blue"}
+		default:
+			var bytes int64
+			for _, component := range manifest.Components {
+				bytes += component.Bytes
+			}
+
+			badge = Badge{Label: "size", Message: humanBytes(bytes), Color: "blue"}
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	badge.SchemaVersion = 1
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%v", CacheControlMaxAge))
+	json.NewEncoder(w).Encode(badge)
+}
+
+// latestManifest: the manifest of the version the project's latest alias
+// serves, following the alias.json of a pointer alias
+func (s *Server) latestManifest(ctx context.Context, projectPath string) (ComponentManifest, bool, error) {
+	manifest, found, err := s.manifest(ctx, projectPath+"/latest")
+	if err != nil || found {
+		return manifest, found, err
+	}
+
+	reader, err := s.store.NewRangeReader(ctx, s.gcsPrefix+projectPath+"/latest/"+aliasPointerFilepaths[0], 0, 0, -1)
+	if err == storage.ErrObjectNotExist {
+		return ComponentManifest{}, false, nil
+	}
+	if err != nil {
+		return ComponentManifest{}, false, err
+	}
+	defer reader.Close()
+
+	var pointer AliasPointer
+	if err := json.NewDecoder(reader).Decode(&pointer); err != nil {
+		return ComponentManifest{}, false, err
+	}
+
+	return s.manifest(ctx, projectPath+"/"+pointer.Version)
+}
+
+// countDownload: count a download of a component towards its project's
+// downloads badge. Range requests resuming a download part way aren't
+// counted again
+func (s *Server) countDownload(r *http.Request, versionPath string) {
+	if r.Method != "GET" {
+		return
+	}
+
+	if byteRange := r.Header.Get("Range"); byteRange != "" && !strings.HasPrefix(byteRange, "bytes=0-") {
+		return
+	}
+
+	projectPath := path.Dir(versionPath)
+	if projectPath == "." {
+		return
+	}
+
+	s.mu.Lock()
+	s.downloads[projectPath]++
+	s.mu.Unlock()
+}
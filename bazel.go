@@ -0,0 +1,70 @@
+package artifactor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// extensions of archives which bazel's http_archive can extract
+var bazelArchiveExtensions = []string{".tar.gz", ".tgz", ".tar.bz2", ".tbz", ".tar.xz", ".txz", ".tar.zst", ".tzst", ".tar", ".zip", ".jar", ".war", ".aar", ".deb"}
+
+// isBazelArchive: whether a component can be consumed with http_archive,
+// rather than http_file
+func isBazelArchive(filepath string) bool {
+	name := strings.ToLower(filepath)
+	for _, extension := range bazelArchiveExtensions {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bazelName: a bazel repository name for a component, such as
+// artifactor_artifactor_linux_amd64_tar_gz
+func bazelName(project string, filepath string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, project+"_"+filepath)
+
+	return strings.Trim(name, "_")
+}
+
+// BazelSnippets: ready to paste http_archive and http_file rules, with urls
+// and sha256 checksums, for every component of a version
+func BazelSnippets(manifest ComponentManifest) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "# %s %s\n", manifest.Project, manifest.Version)
+	fmt.Fprintf(&buf, "load(\"@bazel_tools//tools/build_defs/repo:http.bzl\", \"http_archive\", \"http_file\")\n")
+
+	for _, component := range manifest.Components {
+		rule := "http_file"
+		if isBazelArchive(component.Filepath) {
+			rule = "http_archive"
+		}
+
+		fmt.Fprintf(&buf, "\n%s(\n", rule)
+		fmt.Fprintf(&buf, "    name = %q,\n", bazelName(manifest.Project, component.Filepath))
+		fmt.Fprintf(&buf, "    urls = [%q],\n", component.URL)
+		fmt.Fprintf(&buf, "    sha256 = %q,\n", component.Sha256Checksum)
+		if rule == "http_file" {
+			fmt.Fprintf(&buf, "    downloaded_file_path = %q,\n", path.Base(component.Filepath))
+		}
+		fmt.Fprintf(&buf, ")\n")
+	}
+
+	return buf.Bytes()
+}
+
+func writeBazelSnippets(filepath string, manifest ComponentManifest) error {
+	return ioutil.WriteFile(filepath, BazelSnippets(manifest), 0644)
+}
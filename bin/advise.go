@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type adviseOptions struct {
+	artifactor.Options
+
+	advisory artifactor.Advisory
+}
+
+func parseAdviseFlags(args []string) (adviseOptions, error) {
+	flags := flag.NewFlagSet("advise", flag.ExitOnError)
+
+	var projectName, gcsPrefix, urlPrefix, version, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version the advisory applies to")
+	flags.StringVar(&channel, "channel", "", "-channel channel the version was published to, the stable project root by default")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix for the public url used in the index and feeds")
+
+	var id, severity, summary, advisoryURL string
+	flags.StringVar(&id, "cve", "", "-cve id of the advisory, such as CVE-2024-1234 or GHSA-xxxx-xxxx-xxxx")
+	flags.StringVar(&severity, "severity", "", "-severity severity of the advisory, one of low, medium, high or critical")
+	flags.StringVar(&summary, "summary", "", "-summary one line description of the advisory")
+	flags.StringVar(&advisoryURL, "url", "", "-url link to the full advisory")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key, such as secret/data/artifactor/signing#private_key. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	var actor string
+	flags.StringVar(&actor, "actor", defaultActor(), "-actor who is attaching the advisory, recorded in it")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return adviseOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return adviseOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	if id == "" {
+		return adviseOptions{}, errInvalidOption{"-cve is required"}
+	}
+
+	gcsPrefix, urlPrefix, err := normalizePrefixes(gcsPrefix, urlPrefix)
+	if err != nil {
+		return adviseOptions{}, err
+	}
+
+	if err := storage.configure(); err != nil {
+		return adviseOptions{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return adviseOptions{}, err
+	}
+
+	return adviseOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			UrlPrefix:   urlPrefix,
+			Version:     version,
+			Channel:     channel,
+		},
+		advisory: artifactor.Advisory{
+			ID:        id,
+			Severity:  strings.ToLower(severity),
+			Summary:   summary,
+			URL:       advisoryURL,
+			Timestamp: time.Now().UTC(),
+			Actor:     actor,
+		},
+	}, nil
+}
+
+// advise: attach a signed security advisory to a published version
+func advise(args []string) {
+	opts, err := parseAdviseFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("attaching %s to version %s %s", opts.advisory.ID, opts.ProjectName, opts.Version))
+
+	if err := artifactor.AdviseVersion(artifactor.NewProject(&opts.Options), opts.Version, opts.advisory); err != nil {
+		log.Fatal(err)
+	}
+}
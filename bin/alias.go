@@ -0,0 +1,190 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type aliasHistoryOptions struct {
+	artifactor.Options
+
+	alias       string
+	trustedKeys []string
+}
+
+// parseAliasHistoryFlags: parse the options for showing an alias's history.
+// The alias may be given before or after the flags
+func parseAliasHistoryFlags(args []string) (aliasHistoryOptions, error) {
+	flags := flag.NewFlagSet("alias history", flag.ExitOnError)
+
+	var projectName, gcsPrefix, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&channel, "channel", "", "-channel channel whose aliases to show, the stable project root by default")
+
+	var trustedKeys stringsFlag
+	flags.Var(&trustedKeys, "key", "-key full fingerprint of a key trusted to sign the history, may be repeated. Defaults to any key in the local keyring")
+
+	alias := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		alias, args = args[0], args[1:]
+	}
+
+	flags.Parse(args)
+
+	if alias == "" && flags.NArg() == 1 {
+		alias = flags.Arg(0)
+	}
+
+	if alias == "" {
+		return aliasHistoryOptions{}, errInvalidOption{"an alias is required"}
+	}
+
+	if projectName == "" {
+		return aliasHistoryOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if !isStoragePrefix(gcsPrefix) {
+		return aliasHistoryOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs://, s3:// or https://"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	return aliasHistoryOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			Channel:     channel,
+		},
+		alias:       alias,
+		trustedKeys: trustedKeys,
+	}, nil
+}
+
+// parseAliasSetFlags: parse the options for pointing aliases at a published
+// version
+func parseAliasSetFlags(args []string) (artifactor.Options, error) {
+	flags := flag.NewFlagSet("alias set", flag.ExitOnError)
+
+	var projectName, gcsPrefix, urlPrefix, version, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version published version to point the aliases at")
+	flags.StringVar(&channel, "channel", "", "-channel channel of the version and its aliases, the stable project root by default")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix for the public url used in alias pointers")
+
+	var aliases stringsFlag
+	flags.Var(&aliases, "alias", "-alias alias to point at the version, such as latest, may be repeated")
+
+	var pointerAliases bool
+	flags.BoolVar(&pointerAliases, "pointer-aliases", false, "-pointer-aliases upload a signed alias.json pointing at the version instead of copying its manifests")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key, such as secret/data/artifactor/signing#private_key. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	var actor string
+	flags.StringVar(&actor, "actor", defaultActor(), "-actor who is setting the aliases, recorded in the alias history")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return artifactor.Options{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return artifactor.Options{}, errInvalidOption{"-version is required"}
+	}
+
+	if len(aliases) == 0 {
+		return artifactor.Options{}, errInvalidOption{"-alias is required"}
+	}
+
+	gcsPrefix, urlPrefix, err := normalizePrefixes(gcsPrefix, urlPrefix)
+	if err != nil {
+		return artifactor.Options{}, err
+	}
+
+	if err := storage.configure(); err != nil {
+		return artifactor.Options{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return artifactor.Options{}, err
+	}
+
+	return artifactor.Options{
+		ProjectName:    projectName,
+		GcsPrefix:      gcsPrefix,
+		UrlPrefix:      urlPrefix,
+		Version:        version,
+		Channel:        channel,
+		Aliases:        aliases,
+		PointerAliases: pointerAliases,
+		Actor:          actor,
+	}, nil
+}
+
+// alias: inspect and update a project's aliases. `alias history <alias>`
+// prints every recorded change to an alias, and `alias set` points aliases at
+// a version which was already published, such as to roll latest back
+func alias(args []string) {
+	if len(args) > 0 && args[0] == "set" {
+		aliasSet(args[1:])
+		return
+	}
+
+	if len(args) == 0 || args[0] != "history" {
+		log.Fatal(errInvalidOption{"usage: artifactor alias history <alias> -project <project> -gcs-prefix <gcs-prefix>, or artifactor alias set -project <project> -alias <alias> -version <version> -gcs-prefix <gcs-prefix> -url-prefix <url-prefix>"})
+	}
+
+	opts, err := parseAliasHistoryFlags(args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts.Options)
+	changes, err := artifactor.AliasHistory(project, opts.alias, opts.trustedKeys)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tabWriter := tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "TIMESTAMP\tALIAS\tOLD VERSION\tNEW VERSION\tACTOR")
+	for _, change := range changes {
+		oldVersion := change.OldVersion
+		if oldVersion == "" {
+			oldVersion = "-"
+		}
+
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\n", change.Timestamp.UTC().Format(time.RFC3339), change.Alias, oldVersion, change.NewVersion, change.Actor)
+	}
+	tabWriter.Flush()
+}
+
+// aliasSet: point aliases at a published version
+func aliasSet(args []string) {
+	opts, err := parseAliasSetFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("pointing %s %s at version %s", opts.ProjectName, strings.Join(opts.Aliases, ", "), opts.Version))
+
+	project := artifactor.NewProject(&opts)
+	if err := artifactor.SetAlias(project, &opts); err != nil {
+		log.Fatal(err)
+	}
+}
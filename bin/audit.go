@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type auditOptions struct {
+	artifactor.Options
+
+	concurrency int
+	json        bool
+	alerters    []artifactor.Notifier
+}
+
+func parseAuditFlags(args []string) (auditOptions, error) {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+
+	var projectName, gcsPrefix, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/ or s3://bucket/")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&channel, "channel", "", "-channel channel to audit, the stable project root by default")
+
+	storage := storageFlags(flags)
+
+	var alertCommand, alertWebhook string
+	flags.StringVar(&alertCommand, "alert-command", "", "-alert-command command run with the event as json on stdin when the audit finds problems")
+	flags.StringVar(&alertWebhook, "alert-webhook", "", "-alert-webhook url the event is posted to as json when the audit finds problems")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of manifests to fetch, and objects to stat, at once")
+
+	var jsonOutput bool
+	flags.BoolVar(&jsonOutput, "json", false, "-json print the audit report as json")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return auditOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if !strings.HasPrefix(gcsPrefix, "gcs://") && !strings.HasPrefix(gcsPrefix, "s3://") {
+		return auditOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs:// or s3://, since http storage can't be listed"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	if err := storage.configure(); err != nil {
+		return auditOptions{}, err
+	}
+
+	return auditOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			Channel:     channel,
+		},
+		concurrency: concurrency,
+		json:        jsonOutput,
+		alerters:    parseAlerters(alertCommand, alertWebhook),
+	}, nil
+}
+
+// audit: cross-check every manifest of a project against the objects in the
+// bucket, failing when any are missing, mismatched or orphaned
+func audit(args []string) {
+	opts, err := parseAuditFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := artifactor.AuditProject(artifactor.NewProject(&opts.Options), opts.concurrency, opts.alerters)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	} else if report.Problems() > 0 {
+		tabWriter := tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+		fmt.Fprintln(tabWriter, "PROBLEM\tOBJECT")
+		for _, gcsPath := range report.Missing {
+			fmt.Fprintf(tabWriter, "missing\t%s\n", gcsPath)
+		}
+		for _, problem := range report.Mismatched {
+			fmt.Fprintf(tabWriter, "mismatched\t%s\n", problem)
+		}
+		for _, gcsPath := range report.Orphaned {
+			fmt.Fprintf(tabWriter, "orphaned\t%s\n", gcsPath)
+		}
+		tabWriter.Flush()
+	}
+
+	if report.Problems() > 0 {
+		log.Fatal(fmt.Sprintf("%d problems found auditing %d objects of %d versions", report.Problems(), report.Objects, report.Versions))
+	}
+
+	log.Println(fmt.Sprintf("audited %d objects of %d versions of %s, no problems found", report.Objects, report.Versions, opts.ProjectName))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type bomOptions struct {
+	artifactor.Options
+
+	digest      string
+	filter      artifactor.ComponentFilter
+	concurrency int
+	json        bool
+}
+
+func parseBOMFlags(args []string) (bomOptions, error) {
+	flags := flag.NewFlagSet("bom", flag.ExitOnError)
+
+	var projectName, gcsPrefix, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&channel, "channel", "", "-channel channel whose versions to include, the stable project root by default")
+
+	storage := storageFlags(flags)
+
+	var digest string
+	flags.StringVar(&digest, "digest", "", "-digest only include content whose sha256 starts with this")
+
+	var only stringsFlag
+	flags.Var(&only, "only", "-only glob of the component filepaths to include, matching a filepath, its base name or any of its directories. May be repeated")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of manifests to fetch at once")
+
+	var jsonOutput bool
+	flags.BoolVar(&jsonOutput, "json", false, "-json print the bill of materials as json")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return bomOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if !isStoragePrefix(gcsPrefix) {
+		return bomOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs://, s3:// or https://"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	if err := storage.configure(); err != nil {
+		return bomOptions{}, err
+	}
+
+	return bomOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			Channel:     channel,
+		},
+		digest:      strings.ToLower(digest),
+		filter:      artifactor.ComponentFilter{Patterns: only},
+		concurrency: concurrency,
+		json:        jsonOutput,
+	}, nil
+}
+
+// bom: print every distinct piece of content a project has published, and
+// the versions containing it
+func bom(args []string) {
+	opts, err := parseBOMFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	entries, err := artifactor.BillOfMaterials(artifactor.NewProject(&opts.Options), opts.filter, opts.concurrency)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	matching := make([]artifactor.BOMEntry, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Sha256Checksum, opts.digest) {
+			matching = append(matching, entry)
+		}
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(matching); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	tabWriter := tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "SHA256\tBYTES\tFILEPATHS\tVERSIONS")
+	for _, entry := range matching {
+		fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\n", entry.Sha256Checksum, entry.Bytes, strings.Join(entry.Filepaths, ","), strings.Join(entry.Versions, ","))
+	}
+	tabWriter.Flush()
+}
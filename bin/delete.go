@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type deleteOptions struct {
+	artifactor.Options
+
+	aliases []string
+	force   bool
+}
+
+func parseDeleteFlags(args []string) (deleteOptions, error) {
+	flags := flag.NewFlagSet("delete", flag.ExitOnError)
+
+	var projectName, gcsPrefix, version, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&channel, "channel", "", "-channel channel the version was published to, the stable project root by default")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key used to re-sign the index. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	var aliases stringsFlag
+	flags.Var(&aliases, "alias", "-alias alias which must not serve the version for it to be deleted, may be repeated. Defaults to every alias found by listing the project")
+
+	var force bool
+	flags.BoolVar(&force, "force", false, "-force delete the version even if an alias still serves it")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return deleteOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return deleteOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	if !isStoragePrefix(gcsPrefix) {
+		return deleteOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs://, s3:// or https://"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	if err := storage.configure(); err != nil {
+		return deleteOptions{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return deleteOptions{}, err
+	}
+
+	return deleteOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			Version:     version,
+			Channel:     channel,
+		},
+		aliases: aliases,
+		force:   force,
+	}, nil
+}
+
+// deleteVersion: delete a version's components and manifests, and remove it
+// from the project index
+func deleteVersion(args []string) {
+	opts, err := parseDeleteFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("deleting version %s %s", opts.ProjectName, opts.Version))
+
+	deleted, err := artifactor.DeleteVersion(artifactor.NewProject(&opts.Options), opts.Version, opts.aliases, opts.force)
+	for _, gcsPath := range deleted {
+		log.Println(fmt.Sprintf("deleted %s", gcsPath))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
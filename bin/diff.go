@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type diffOptions struct {
+	artifactor.Options
+
+	fromVersion, toVersion string
+	trust                  artifactor.TrustPolicy
+	json, markdown         bool
+}
+
+func parseDiffFlags(args []string) (diffOptions, error) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+
+	var projectName, urlPrefix, fromVersion, toVersion string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&fromVersion, "from", "", "-from version to compare from, or an alias such as stable")
+	flags.StringVar(&toVersion, "to", "", "-to version to compare to, or an alias such as latest")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix public url the versions were published to")
+
+	signers := trustFlags(flags)
+
+	var jsonOutput, markdownOutput bool
+	flags.BoolVar(&jsonOutput, "json", false, "-json print the diff as json")
+	flags.BoolVar(&markdownOutput, "markdown", false, "-markdown print the diff as a markdown changelog fragment")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return diffOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if fromVersion == "" || toVersion == "" {
+		return diffOptions{}, errInvalidOption{"-from and -to are required"}
+	}
+
+	if jsonOutput && markdownOutput {
+		return diffOptions{}, errInvalidOption{"-json and -markdown can't be combined"}
+	}
+
+	urlPrefix, err := normalizeURLPrefix(urlPrefix)
+	if err != nil {
+		return diffOptions{}, err
+	}
+
+	trust, err := signers.policy()
+	if err != nil {
+		return diffOptions{}, err
+	}
+
+	return diffOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			UrlPrefix:   urlPrefix,
+		},
+		fromVersion: fromVersion,
+		toVersion:   toVersion,
+		trust:       trust,
+		json:        jsonOutput,
+		markdown:    markdownOutput,
+	}, nil
+}
+
+// diff: print the components added, removed and changed between two versions'
+// signature verified manifests
+func diff(args []string) {
+	opts, err := parseDiffFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts.Options)
+	from, _, err := artifactor.FetchVerifiedManifest(project, opts.fromVersion, opts.trust)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	to, _, err := artifactor.FetchVerifiedManifest(project, opts.toVersion, opts.trust)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifestDiff := artifactor.DiffManifests(from, to)
+
+	switch {
+	case opts.json:
+		jsonBytes, err := manifestDiff.JSON()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(string(jsonBytes))
+	case opts.markdown:
+		os.Stdout.Write(manifestDiff.Markdown())
+	default:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(writer, "STATUS\tFILEPATH\tFROM BYTES\tTO BYTES\tDELTA\tSHA256")
+		for _, component := range manifestDiff.Added {
+			fmt.Fprintf(writer, "added\t%s\t-\t%d\t%+d\t%s\n", component.Filepath, component.Bytes, component.Bytes, component.Sha256Checksum)
+		}
+		for _, change := range manifestDiff.Changed {
+			fmt.Fprintf(writer, "changed\t%s\t%d\t%d\t%+d\t%s\n", change.Filepath, change.FromBytes, change.ToBytes, change.ByteDelta, change.ToSha256)
+		}
+		for _, component := range manifestDiff.Removed {
+			fmt.Fprintf(writer, "removed\t%s\t%d\t-\t%+d\t%s\n", component.Filepath, component.Bytes, -component.Bytes, component.Sha256Checksum)
+		}
+		writer.Flush()
+
+		fmt.Println(fmt.Sprintf("%s %s to %s: %d added, %d changed, %d removed, %d unchanged, %+d bytes", manifestDiff.Project, manifestDiff.FromVersion, manifestDiff.ToVersion, len(manifestDiff.Added), len(manifestDiff.Changed), len(manifestDiff.Removed), len(manifestDiff.Unchanged), manifestDiff.ByteDelta))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+// doctor: check that a publish would succeed before starting it. It takes the
+// same flags as publish, so that the one command line can be checked and then
+// run
+func doctor(args []string) {
+	opts, err := parsePublishFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts)
+	checks := artifactor.Doctor(project, &opts)
+
+	// closed before any log.Fatal below, which skips deferred calls
+	if closer, ok := opts.Progress.(io.Closer); ok {
+		closer.Close()
+	}
+
+	failed := 0
+	tabWriter := tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "CHECK\tRESULT\tDETAIL")
+	for _, check := range checks {
+		if check.Err != nil {
+			failed++
+			fmt.Fprintf(tabWriter, "%s\tfailed\t%v\n", check.Name, check.Err)
+			continue
+		}
+
+		fmt.Fprintf(tabWriter, "%s\tok\t%s\n", check.Name, check.Detail)
+	}
+	tabWriter.Flush()
+
+	if failed > 0 {
+		log.Fatal(fmt.Sprintf("%d of %d checks failed", failed, len(checks)))
+	}
+}
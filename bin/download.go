@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type downloadOptions struct {
+	artifactor.Options
+
+	dest        string
+	concurrency int
+	trust       artifactor.TrustPolicy
+	filter      artifactor.ComponentFilter
+	extract     bool
+}
+
+func parseDownloadFlags(args []string) (downloadOptions, error) {
+	flags := flag.NewFlagSet("download", flag.ExitOnError)
+
+	var projectName, urlPrefix, version, dest string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version name")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix public url the version was published to")
+	flags.StringVar(&dest, "dest", "", "-dest directory to download components into")
+
+	var only, groups stringsFlag
+	flags.Var(&only, "only", "-only glob of the component filepaths to download, such as 'linux/*', matching a filepath, its base name or any of its directories. May be repeated")
+	flags.Var(&groups, "group", "-group only download components in the group, as named with -group when publishing. May be repeated")
+
+	var roles stringsFlag
+	flags.Var(&roles, "role", "-role only download components with the role, such as binary, archive, checksum, signature, symbols or docs. May be repeated")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of components to fetch and verify at once")
+
+	signers := trustFlags(flags)
+
+	var extract bool
+	flags.BoolVar(&extract, "extract", false, "-extract extract downloaded tar and zip archives where they were downloaded, once verified, restoring the permissions recorded in them")
+
+	var verificationCache string
+	flags.StringVar(&verificationCache, "verification-cache", artifactor.DefaultVerificationCacheDir(), "-verification-cache directory remembering verified manifests and files, so they aren't verified again. Empty turns the cache off")
+
+	flags.Parse(args)
+
+	artifactor.SetVerificationCache(verificationCache)
+
+	if projectName == "" {
+		return downloadOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return downloadOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	if dest == "" {
+		return downloadOptions{}, errInvalidOption{"-dest is required"}
+	}
+
+	urlPrefix, err := normalizeURLPrefix(urlPrefix)
+	if err != nil {
+		return downloadOptions{}, err
+	}
+
+	trust, err := signers.policy()
+	if err != nil {
+		return downloadOptions{}, err
+	}
+
+	return downloadOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			UrlPrefix:   urlPrefix,
+			Version:     version,
+		},
+		dest:        dest,
+		trust:       trust,
+		filter:      artifactor.ComponentFilter{Patterns: only, Groups: groups, Roles: roles},
+		concurrency: concurrency,
+		extract:     extract,
+	}, nil
+}
+
+// download: verify the signature of a version's manifest, then fetch and
+// verify every component of it, resuming any previous download into the same
+// directory
+func download(args []string) {
+	opts, err := parseDownloadFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("downloading version %s %s to %s", opts.ProjectName, opts.Version, opts.dest))
+
+	project := artifactor.NewProject(&opts.Options)
+	manifest, err := artifactor.DownloadVersion(project, opts.Version, opts.dest, opts.concurrency, opts.trust, opts.filter, opts.extract)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("verified version %s %s, %d components in %s", opts.ProjectName, opts.Version, len(manifest.Components), opts.dest))
+
+	// yanks are recorded against the version an alias points at
+	yanked, err := artifactor.FetchYank(project, manifest.Version, opts.trust)
+	if err != nil {
+		log.Println(fmt.Sprintf("warning: failed to check whether %s %s was yanked: %v", opts.ProjectName, manifest.Version, err))
+	} else if yanked != nil {
+		log.Println(fmt.Sprintf("warning: version %s %s was yanked: %s", opts.ProjectName, manifest.Version, yanked.Reason))
+	}
+}
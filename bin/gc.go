@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type gcOptions struct {
+	artifactor.Options
+
+	minAge      time.Duration
+	dryRun      bool
+	concurrency int
+}
+
+func parseGCFlags(args []string) (gcOptions, error) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+
+	var projectName, gcsPrefix, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/ or s3://bucket/")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&channel, "channel", "", "-channel channel to collect the garbage of, the stable project root by default")
+
+	minAge := ageFlag(24 * time.Hour)
+	flags.Var(&minAge, "min-age", "-min-age only delete orphaned objects last written longer ago than this, such as 7d or 48h, so that publishes in progress are left alone")
+
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "-dry-run print the objects and versions which would be deleted without deleting them")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of manifests to fetch, and objects to stat, at once")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key used to re-sign the index. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return gcOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if !strings.HasPrefix(gcsPrefix, "gcs://") && !strings.HasPrefix(gcsPrefix, "s3://") {
+		return gcOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs:// or s3://, since http storage can't be listed"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	if err := storage.configure(); err != nil {
+		return gcOptions{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return gcOptions{}, err
+	}
+
+	return gcOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			Channel:     channel,
+		},
+		minAge:      time.Duration(minAge),
+		dryRun:      dryRun,
+		concurrency: concurrency,
+	}, nil
+}
+
+// gc: delete the objects beneath a project which no manifest or alias
+// references, and its expired versions which no alias serves
+func gc(args []string) {
+	opts, err := parseGCFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts.Options)
+	report, err := artifactor.CollectGarbage(project, opts.minAge, opts.dryRun, opts.concurrency)
+
+	verb := "deleted"
+	if opts.dryRun {
+		verb = "would delete"
+	}
+	for _, gcsPath := range report.Orphaned {
+		log.Println(fmt.Sprintf("%s orphaned object %s", verb, gcsPath))
+	}
+	for _, version := range report.Expired {
+		log.Println(fmt.Sprintf("%s expired version %s %s", verb, opts.ProjectName, version))
+	}
+	for _, gcsPath := range report.Recent {
+		log.Println(fmt.Sprintf("left orphaned object %s, written within the last %s", gcsPath, opts.minAge))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
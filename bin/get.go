@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type getOptions struct {
+	artifactor.Options
+
+	componentFilepath string
+	dest              string
+	trust             artifactor.TrustPolicy
+	extract           bool
+}
+
+func parseGetFlags(args []string) (getOptions, error) {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+
+	var projectName, urlPrefix, version, dest string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version name")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix public url the version was published to")
+	flags.StringVar(&dest, "dest", ".", "-dest directory to download the component into")
+
+	signers := trustFlags(flags)
+
+	var extract bool
+	flags.BoolVar(&extract, "extract", false, "-extract extract the component, when it's a tar or zip archive, into -dest once verified, restoring the permissions recorded in it")
+
+	var verificationCache string
+	flags.StringVar(&verificationCache, "verification-cache", artifactor.DefaultVerificationCacheDir(), "-verification-cache directory remembering verified manifests and files, so they aren't verified again. Empty turns the cache off")
+
+	flags.Parse(args)
+
+	artifactor.SetVerificationCache(verificationCache)
+
+	if projectName == "" {
+		return getOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return getOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	if flags.NArg() != 1 {
+		return getOptions{}, errInvalidOption{"exactly one component filepath is required"}
+	}
+
+	urlPrefix, err := normalizeURLPrefix(urlPrefix)
+	if err != nil {
+		return getOptions{}, err
+	}
+
+	trust, err := signers.policy()
+	if err != nil {
+		return getOptions{}, err
+	}
+
+	return getOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			UrlPrefix:   urlPrefix,
+			Version:     version,
+		},
+		componentFilepath: flags.Arg(0),
+		dest:              dest,
+		trust:             trust,
+		extract:           extract,
+	}, nil
+}
+
+// get: fetch and verify a single component of a version
+func get(args []string) {
+	opts, err := parseGetFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("fetching %s from version %s %s", opts.componentFilepath, opts.ProjectName, opts.Version))
+
+	project := artifactor.NewProject(&opts.Options)
+	if _, err := artifactor.GetComponent(project, opts.Version, opts.componentFilepath, opts.dest, opts.trust, opts.extract); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type importOptions struct {
+	artifactor.Options
+
+	versions    []string
+	dryRun      bool
+	concurrency int
+}
+
+func parseImportFlags(args []string) (importOptions, error) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+
+	var projectName, gcsPrefix, urlPrefix, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/ or s3://bucket/")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix public url the versions are served from, used in the manifests")
+	flags.StringVar(&channel, "channel", "", "-channel channel whose versions to import, the stable project root by default")
+
+	var versions stringsFlag
+	flags.Var(&versions, "version", "-version version directory to import, may be repeated. Defaults to every version directory without a manifest.json")
+
+	var index, feed bool
+	flags.BoolVar(&index, "index", false, "-index add each imported version to the project's index.json")
+	flags.BoolVar(&feed, "feed", false, "-feed publish atom and json feeds of the project's versions alongside its index")
+
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "-dry-run print the versions which would be imported without uploading anything")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of objects to read at once")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key, such as secret/data/artifactor/signing#private_key. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	var actor string
+	flags.StringVar(&actor, "actor", defaultActor(), "-actor who is importing, recorded as the publisher in manifest.json")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return importOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if strings.HasPrefix(gcsPrefix, "http://") || strings.HasPrefix(gcsPrefix, "https://") {
+		return importOptions{}, errInvalidOption{"-gcs-prefix must start with gcs:// or s3://, since http storage can't be listed"}
+	}
+
+	gcsPrefix, urlPrefix, err := normalizePrefixes(gcsPrefix, urlPrefix)
+	if err != nil {
+		return importOptions{}, err
+	}
+
+	if err := storage.configure(); err != nil {
+		return importOptions{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return importOptions{}, err
+	}
+
+	return importOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			UrlPrefix:   urlPrefix,
+			Channel:     channel,
+			Index:       index,
+			Feed:        feed,
+			Actor:       actor,
+		},
+		versions:    versions,
+		dryRun:      dryRun,
+		concurrency: concurrency,
+	}, nil
+}
+
+// importVersions: generate signed manifests for versions published to a
+// bucket before artifactor managed it
+func importVersions(args []string) {
+	opts, err := parseImportFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts.Options)
+	imported, err := artifactor.ImportVersions(project, &opts.Options, opts.versions, opts.dryRun, opts.concurrency)
+	for _, version := range imported {
+		if opts.dryRun {
+			log.Println(fmt.Sprintf("would import version %s %s", opts.ProjectName, version))
+		} else {
+			log.Println(fmt.Sprintf("imported version %s %s", opts.ProjectName, version))
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
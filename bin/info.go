@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type infoOptions struct {
+	artifactor.Options
+
+	trust artifactor.TrustPolicy
+	json  bool
+}
+
+func parseInfoFlags(args []string) (infoOptions, error) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+
+	var projectName, urlPrefix, version string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version name, or an alias such as latest")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix public url the version was published to")
+
+	signers := trustFlags(flags)
+
+	var jsonOutput bool
+	flags.BoolVar(&jsonOutput, "json", false, "-json print the manifest and advisories as json")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return infoOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return infoOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	urlPrefix, err := normalizeURLPrefix(urlPrefix)
+	if err != nil {
+		return infoOptions{}, err
+	}
+
+	trust, err := signers.policy()
+	if err != nil {
+		return infoOptions{}, err
+	}
+
+	return infoOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			UrlPrefix:   urlPrefix,
+			Version:     version,
+		},
+		trust: trust,
+		json:  jsonOutput,
+	}, nil
+}
+
+// versionInfo: a version's manifest along with the advisories attached to it
+// since it was published, and why it was yanked if it has been
+type versionInfo struct {
+	Manifest   artifactor.ComponentManifest `json:"manifest"`
+	Advisories []artifactor.Advisory        `json:"advisories"`
+	Yanked     *artifactor.Yank             `json:"yanked,omitempty"`
+}
+
+// info: print a version's signature verified manifest, its advisories and
+// whether it was yanked
+func info(args []string) {
+	opts, err := parseInfoFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts.Options)
+	manifest, _, err := artifactor.FetchVerifiedManifest(project, opts.Version, opts.trust)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// advisories are attached to the version an alias points at
+	advisories, err := artifactor.FetchAdvisories(project, manifest.Version, opts.trust)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	yanked, err := artifactor.FetchYank(project, manifest.Version, opts.trust)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(versionInfo{Manifest: manifest, Advisories: advisories, Yanked: yanked}); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	bytes := int64(0)
+	for _, component := range manifest.Components {
+		bytes += component.Bytes
+	}
+
+	tabWriter := tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+	fmt.Fprintf(tabWriter, "project:\t%s\n", manifest.Project)
+	fmt.Fprintf(tabWriter, "version:\t%s\n", manifest.Version)
+	fmt.Fprintf(tabWriter, "published:\t%s\n", manifest.Timestamp.UTC().Format(time.RFC3339))
+	if manifest.PublishedBy != nil {
+		fmt.Fprintf(tabWriter, "published by:\t%s\n", manifest.PublishedBy.Name)
+	}
+	if manifest.ExpiresAt != nil {
+		fmt.Fprintf(tabWriter, "expires:\t%s\n", manifest.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if manifest.Homepage != "" {
+		fmt.Fprintf(tabWriter, "homepage:\t%s\n", manifest.Homepage)
+	}
+	if manifest.DocumentationURL != "" {
+		fmt.Fprintf(tabWriter, "documentation:\t%s\n", manifest.DocumentationURL)
+	}
+	if manifest.Support != "" {
+		fmt.Fprintf(tabWriter, "support:\t%s\n", manifest.Support)
+	}
+	if manifest.License != "" {
+		fmt.Fprintf(tabWriter, "license:\t%s\n", manifest.License)
+	}
+	if yanked != nil {
+		fmt.Fprintf(tabWriter, "yanked:\t%s %s\n", yanked.Timestamp.UTC().Format(time.RFC3339), yanked.Reason)
+	}
+	fmt.Fprintf(tabWriter, "components:\t%d (%d bytes)\n", len(manifest.Components), bytes)
+	for _, advisory := range advisories {
+		fmt.Fprintf(tabWriter, "advisory:\t%s (%s) %s\n", advisory.ID, advisory.Severity, strings.TrimSpace(advisory.Summary+" "+advisory.URL))
+	}
+	tabWriter.Flush()
+
+	fmt.Println()
+	tabWriter = tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "FILEPATH\tBYTES\tSHA256\tSHA512\tURL")
+	for _, component := range manifest.Components {
+		fmt.Fprintf(tabWriter, "%s\t%d\t%s\t%s\t%s\n", component.Filepath, component.Bytes, component.Sha256Checksum, component.Sha512Checksum, component.URL)
+	}
+	tabWriter.Flush()
+}
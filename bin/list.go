@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type listOptions struct {
+	artifactor.Options
+
+	concurrency int
+	json        bool
+}
+
+func parseListFlags(args []string) (listOptions, error) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+
+	var projectName, gcsPrefix, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&channel, "channel", "", "-channel channel whose versions to list, the stable project root by default")
+
+	storage := storageFlags(flags)
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of manifests to fetch at once")
+
+	var jsonOutput bool
+	flags.BoolVar(&jsonOutput, "json", false, "-json print the versions as json")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return listOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if !isStoragePrefix(gcsPrefix) {
+		return listOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs://, s3:// or https://"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	if err := storage.configure(); err != nil {
+		return listOptions{}, err
+	}
+
+	return listOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			Channel:     channel,
+		},
+		concurrency: concurrency,
+		json:        jsonOutput,
+	}, nil
+}
+
+// list: print every version published under a project, oldest first
+func list(args []string) {
+	opts, err := parseListFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	versions, err := artifactor.ListVersions(artifactor.NewProject(&opts.Options), opts.concurrency)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(versions); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	tabWriter := tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "VERSION\tTIMESTAMP\tCOMPONENTS\tBYTES\tEXPIRES")
+	for _, version := range versions {
+		expires := "-"
+		if version.ExpiresAt != nil {
+			expires = version.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(tabWriter, "%s\t%s\t%d\t%d\t%s\n", version.Version, version.Timestamp.UTC().Format(time.RFC3339), version.Components, version.Bytes, expires)
+	}
+	tabWriter.Flush()
+}
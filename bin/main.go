@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/jonmorehouse/artifactor"
 )
@@ -18,71 +22,305 @@ func (e errInvalidOption) Error() string {
 	return e.msg
 }
 
-func parseFlags() (artifactor.Options, error) {
-	var latest bool
-	flag.BoolVar(&latest, "latest", true, "-latest whether to create a latest alias")
+// stringsFlag: a flag which may be passed more than once
+type stringsFlag []string
 
-	var projectName, gcsPrefix, urlPrefix, version, dir string
-	flag.StringVar(&projectName, "project", "", "-project top level project name")
-	flag.StringVar(&version, "version", "", "-version version name")
-	flag.StringVar(&dir, "dir", "", "-dir input dir")
-	flag.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address")
-	flag.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix for the public url used in the manifest")
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// storageFlagValues: the -gcs-endpoint and -storage-header flags, which
+// configure how storage prefixes are opened
+type storageFlagValues struct {
+	gcsEndpoint string
+	headers     stringsFlag
+}
 
-	flag.Parse()
+// storageFlags: register the flags shared by every command reading or writing
+// a storage bucket
+func storageFlags(flags *flag.FlagSet) *storageFlagValues {
+	values := &storageFlagValues{}
+	flags.StringVar(&values.gcsEndpoint, "gcs-endpoint", "", "-gcs-endpoint google cloud storage api endpoint, such as an emulator at http://localhost:4443. STORAGE_EMULATOR_HOST is also honored")
+	flags.Var(&values.headers, "storage-header", "-storage-header 'Name: value' header sent with every request to an https storage prefix, such as an Authorization header. $VARIABLES are expanded, may be repeated")
+	return values
+}
 
-	if dir == "" {
-		return artifactor.Options{}, errInvalidOption{"-dir is required"}
+// configure: open storage prefixes as the parsed flags describe
+func (s *storageFlagValues) configure() error {
+	if err := registerHTTPStorage(s.headers); err != nil {
+		return err
 	}
-	if version == "" {
-		return artifactor.Options{}, errInvalidOption{"-version is required"}
+
+	return registerGCSEndpoint(s.gcsEndpoint)
+}
+
+// trustFlagValues: the -key, -sigstore and -trust-policy flags, which say who
+// a verified manifest must be signed by
+type trustFlagValues struct {
+	trustedKeys                     stringsFlag
+	sigstoreIssuer, sigstoreSubject string
+	trustPolicy                     string
+}
+
+// trustFlags: register the flags shared by every command verifying a manifest
+func trustFlags(flags *flag.FlagSet) *trustFlagValues {
+	values := &trustFlagValues{}
+	flags.Var(&values.trustedKeys, "key", "-key full fingerprint of a key trusted to sign the manifest, may be repeated. Defaults to any key in the local keyring")
+	flags.StringVar(&values.sigstoreIssuer, "sigstore-issuer", "", "-sigstore-issuer regular expression the oidc issuer of the manifest's sigstore bundle must match in full")
+	flags.StringVar(&values.sigstoreSubject, "sigstore-subject", "", "-sigstore-subject regular expression the certificate subject of the manifest's sigstore bundle must match in full")
+	flags.StringVar(&values.trustPolicy, "trust-policy", "", "-trust-policy json file of the gpg fingerprints and sigstore identities trusted to sign the manifest, in place of -key and -sigstore flags")
+	return values
+}
+
+// policy: the trust policy given by the parsed flags
+func (t *trustFlagValues) policy() (artifactor.TrustPolicy, error) {
+	return parseTrustPolicy(t.trustPolicy, t.trustedKeys, t.sigstoreIssuer, t.sigstoreSubject, 1)
+}
+
+// parseTrustPolicy: the trust policy loaded from -trust-policy, or else the
+// one given by the -key and -sigstore flags, requiring minimumSignatures gpg
+// signatures
+func parseTrustPolicy(policyFilepath string, trustedKeys []string, issuer, subject string, minimumSignatures int) (artifactor.TrustPolicy, error) {
+	if policyFilepath != "" {
+		if len(trustedKeys) > 0 || issuer != "" || subject != "" {
+			return artifactor.TrustPolicy{}, errInvalidOption{"-trust-policy can't be combined with -key, -sigstore-issuer or -sigstore-subject"}
+		}
+
+		return artifactor.LoadTrustPolicy(policyFilepath)
 	}
 
-	if projectName == "" {
-		return artifactor.Options{}, errInvalidOption{"-option is required"}
+	policy := artifactor.TrustPolicy{Fingerprints: trustedKeys, MinimumSignatures: minimumSignatures}
+	if issuer == "" && subject == "" {
+		return policy, nil
 	}
 
-	if gcsPrefix == "" || !strings.HasPrefix(gcsPrefix, "gcs://") {
-		return artifactor.Options{}, errInvalidOption{"-gcs-prefix is required and must start with gcs://"}
+	if issuer == "" || subject == "" {
+		return artifactor.TrustPolicy{}, errInvalidOption{"-sigstore-issuer and -sigstore-subject are required together"}
 	}
 
-	if urlPrefix == "" || !strings.HasPrefix(urlPrefix, "https://") {
-		return artifactor.Options{}, errInvalidOption{"-url-prefix is required and must start with https://"}
+	policy.SigstoreIdentities = []artifactor.SigstoreIdentity{{Issuer: issuer, Subject: subject}}
+	return policy, nil
+}
+
+// defaultActor: who is running artifactor, preferring the ci job's actor
+func defaultActor() string {
+	for _, key := range []string{"ARTIFACTOR_ACTOR", "GITHUB_ACTOR", "USER"} {
+		if actor := os.Getenv(key); actor != "" {
+			return actor
+		}
+	}
+
+	return ""
+}
+
+// isStoragePrefix: whether a prefix addresses a supported storage backend
+func isStoragePrefix(prefix string) bool {
+	for _, scheme := range []string{"gcs://", "s3://", "http://", "https://"} {
+		if strings.HasPrefix(prefix, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registerGCSEndpoint: open gcs:// storage prefixes through the endpoint, when
+// one is given
+func registerGCSEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return errInvalidOption{"-gcs-endpoint must start with http:// or https://"}
+	}
+
+	artifactor.RegisterStorage("gcs", artifactor.GCSEndpoint(endpoint))
+	return nil
+}
+
+// registerHTTPStorage: publish to http(s) storage prefixes with the given
+// "Name: value" headers, expanding environment variables in their values so
+// that secrets needn't be passed as flags
+func registerHTTPStorage(headers []string) error {
+	header := make(http.Header)
+	for _, value := range headers {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 {
+			return errInvalidOption{fmt.Sprintf("-storage-header %q must be of the form Name: value", value)}
+		}
+
+		header.Add(strings.TrimSpace(parts[0]), os.ExpandEnv(strings.TrimSpace(parts[1])))
+	}
+
+	store := artifactor.NewHTTPStorage(header)
+	open := func(ctx context.Context) (artifactor.Storage, error) {
+		return store, nil
+	}
+	artifactor.RegisterStorage("http", open)
+	artifactor.RegisterStorage("https", open)
+
+	return nil
+}
+
+// useVaultSigner: sign with the key stored in a vault secret, given as its
+// path and optionally the field holding the key after a #
+func useVaultSigner(secret string) error {
+	if secret == "" {
+		return nil
+	}
+
+	key := artifactor.VaultKey{Path: secret}
+	if separator := strings.Index(secret, "#"); separator >= 0 {
+		key.Path, key.Field = secret[:separator], secret[separator+1:]
+	}
+
+	signer, err := artifactor.NewVaultSigner(key)
+	if err != nil {
+		return err
+	}
+
+	artifactor.SetSigner(signer)
+	return nil
+}
+
+// configureHTTP: send every request through the proxy ARTIFACTOR_PROXY names,
+// for networks where HTTPS_PROXY can't be set for artifactor alone, and trust
+// the CA certificates in the files and directories ARTIFACTOR_CA_CERTS lists
+func configureHTTP() error {
+	if proxyURL := os.Getenv("ARTIFACTOR_PROXY"); proxyURL != "" {
+		if err := artifactor.SetProxy(proxyURL); err != nil {
+			return errInvalidOption{fmt.Sprintf("ARTIFACTOR_PROXY: %v", err)}
+		}
+	}
+
+	if caCerts := os.Getenv("ARTIFACTOR_CA_CERTS"); caCerts != "" {
+		if err := artifactor.SetCACertificates(filepath.SplitList(caCerts)...); err != nil {
+			return errInvalidOption{fmt.Sprintf("ARTIFACTOR_CA_CERTS: %v", err)}
+		}
+	}
+
+	return nil
+}
+
+// normalizePrefixes: validate the storage and url prefixes, and ensure they end
+// in a trailing slash. The url prefix of an https storage prefix defaults to it
+func normalizePrefixes(gcsPrefix, urlPrefix string) (string, string, error) {
+	if !isStoragePrefix(gcsPrefix) {
+		return "", "", errInvalidOption{"-gcs-prefix is required and must start with gcs://, s3:// or https://"}
+	}
+
+	// objects published over http are served from where they're put
+	if urlPrefix == "" && strings.HasPrefix(gcsPrefix, "https://") {
+		urlPrefix = gcsPrefix
+	}
+
+	urlPrefix, err := normalizeURLPrefix(urlPrefix)
+	if err != nil {
+		return "", "", err
 	}
 
 	if !strings.HasSuffix(gcsPrefix, "/") {
 		gcsPrefix = gcsPrefix + "/"
 	}
 
+	return gcsPrefix, urlPrefix, nil
+}
+
+// normalizeURLPrefix: validate the url prefix, and ensure it ends in a
+// trailing slash
+func normalizeURLPrefix(urlPrefix string) (string, error) {
+	if urlPrefix == "" || !strings.HasPrefix(urlPrefix, "https://") {
+		return "", errInvalidOption{"-url-prefix is required and must start with https://"}
+	}
+
 	if !strings.HasSuffix(urlPrefix, "/") {
 		urlPrefix = urlPrefix + "/"
 	}
 
-	aliases := make([]string, 0)
-	if latest {
-		aliases = append(aliases, "latest")
+	return urlPrefix, nil
+}
+
+// command: a subcommand of artifactor
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var commands = []command{
+	{"publish", "create a version from a directory, archive or stdin, the default when no command is given", publish},
+	{"stage", "upload one job's part of a version without publishing it", stage},
+	{"finalize", "publish a version from the parts staged for it, taking the same flags as publish", finalize},
+	{"doctor", "check that a publish would succeed, taking the same flags as publish", doctor},
+	{"verify", "verify the signatures of a version's manifest, and optionally a local copy of it", verify},
+	{"audit", "cross-check every manifest of a project against the objects in the bucket", audit},
+	{"validate", "check manifest.json files against the manifest schema", validate},
+	{"list", "list the versions published under a project", list},
+	{"info", "print a version's manifest and advisories", info},
+	{"bom", "list every distinct file a project has published, and the versions containing it", bom},
+	{"diff", "compare the components of two versions", diff},
+	{"download", "download and verify every component of a version", download},
+	{"get", "download and verify a single component of a version", get},
+	{"release", "promote a version from one channel to another", release},
+	{"promote", "copy a version from one bucket to another", promote},
+	{"mirror", "replicate a project, or some of its versions, to another bucket", mirror},
+	{"alias", "show the history of an alias, or point it at a published version", alias},
+	{"advise", "attach a signed security advisory to a published version", advise},
+	{"yank", "mark a version as yanked, steering users off it without deleting it", yank},
+	{"delete", "delete a version's objects", deleteVersion},
+	{"prune", "delete old versions no alias serves", prune},
+	{"gc", "delete orphaned objects and expired versions no alias serves", gc},
+	{"import", "generate signed manifests for versions published before artifactor", importVersions},
+	{"rotate-key", "rotate the key a project is signed with", rotateKey},
+	{"resign", "refresh the signatures of published versions with the current key", resign},
+	{"serve", "serve artifacts straight from the storage bucket", serve},
+}
+
+// usage: the commands artifactor runs
+func usage() string {
+	var usage strings.Builder
+	usage.WriteString("usage: artifactor <command> [flags]\n\ncommands:\n")
+
+	tabWriter := tabwriter.NewWriter(&usage, 1, 8, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tabWriter, "  %s\t%s\n", cmd.name, cmd.summary)
 	}
+	tabWriter.Flush()
 
-	return artifactor.Options{
-		Latest:      latest,
-		ProjectName: projectName,
-		GcsPrefix:   gcsPrefix,
-		UrlPrefix:   urlPrefix,
-		Aliases:     aliases,
-	}, nil
+	usage.WriteString("\nrun artifactor <command> -h for the flags of a command")
+	return usage.String()
 }
 
+// main: run the named command. Flags given without a command publish a
+// version, as artifactor did before it had commands
 func main() {
-	opts, err := parseFlags()
-	if err != nil {
+	if err := configureHTTP(); err != nil {
 		log.Fatal(err)
 	}
-	os.Chdir(opts.Dir)
 
-	log.Println(fmt.Sprintf("creating version %s %s", opts.ProjectName, opts.Version))
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		publish(args)
+		return
+	}
 
-	project := artifactor.NewProject(&opts)
-	if err := artifactor.CreateVersion(project, &opts); err != nil {
-		log.Fatal(err)
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			cmd.run(args[1:])
+			return
+		}
+	}
+
+	if args[0] == "help" {
+		fmt.Println(usage())
+		return
 	}
+
+	log.Fatal(errInvalidOption{fmt.Sprintf("unknown command %q\n\n%s", args[0], usage())})
 }
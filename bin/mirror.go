@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type mirrorOptions struct {
+	src, dst artifactor.Options
+
+	versions    []string
+	concurrency int
+}
+
+// parseMirrorFlags: parse the options for the bucket a project is mirrored
+// from, and the bucket it is mirrored to
+func parseMirrorFlags(args []string) (mirrorOptions, error) {
+	flags := flag.NewFlagSet("mirror", flag.ExitOnError)
+
+	var projectName, channel, fromPrefix, toPrefix string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&channel, "channel", "", "-channel channel to mirror, the stable project root by default")
+	flags.StringVar(&fromPrefix, "from", "", "-from storage bucket the project is published to, such as gcs://us-artifacts/")
+	flags.StringVar(&toPrefix, "to", "", "-to storage bucket to mirror the project to, such as gcs://eu-artifacts/")
+
+	var versions stringsFlag
+	flags.Var(&versions, "version", "-version version to mirror, may be repeated. Defaults to every version, along with the project's aliases, index and other project wide files")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of versions to mirror at once")
+
+	storage := storageFlags(flags)
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return mirrorOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if !isStoragePrefix(fromPrefix) || !isStoragePrefix(toPrefix) {
+		return mirrorOptions{}, errInvalidOption{"-from and -to are required and must start with gcs://, s3:// or https://"}
+	}
+
+	// http storage can't be listed, so its versions must be named
+	if len(versions) == 0 && (strings.HasPrefix(fromPrefix, "http://") || strings.HasPrefix(fromPrefix, "https://")) {
+		return mirrorOptions{}, errInvalidOption{"-version is required when mirroring from http storage, since it can't be listed"}
+	}
+
+	if !strings.HasSuffix(fromPrefix, "/") {
+		fromPrefix = fromPrefix + "/"
+	}
+
+	if !strings.HasSuffix(toPrefix, "/") {
+		toPrefix = toPrefix + "/"
+	}
+
+	if fromPrefix == toPrefix {
+		return mirrorOptions{}, errInvalidOption{"-from and -to must differ"}
+	}
+
+	if err := storage.configure(); err != nil {
+		return mirrorOptions{}, err
+	}
+
+	src := artifactor.Options{
+		ProjectName: projectName,
+		GcsPrefix:   fromPrefix,
+		Channel:     channel,
+	}
+
+	dst := src
+	dst.GcsPrefix = toPrefix
+
+	return mirrorOptions{src: src, dst: dst, versions: versions, concurrency: concurrency}, nil
+}
+
+// mirror: replicate a project, or some of its versions, from one bucket to
+// another with server side copies, such as to serve it from another region
+func mirror(args []string) {
+	opts, err := parseMirrorFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("mirroring %s from %s to %s", opts.src.ProjectName, opts.src.GcsPrefix, opts.dst.GcsPrefix))
+
+	src := artifactor.NewProject(&opts.src)
+	dst := artifactor.NewProject(&opts.dst)
+	mirrored, err := artifactor.MirrorVersions(src, dst, opts.versions, opts.concurrency)
+	for _, version := range mirrored {
+		name := "version " + version.Version
+		if version.Version == "" {
+			name = "aliases and project files"
+		}
+
+		log.Println(fmt.Sprintf("mirrored %s %s: %d objects copied, %d already mirrored", opts.src.ProjectName, name, version.Copied, version.Unchanged))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type promoteOptions struct {
+	src, dst artifactor.Options
+
+	resign bool
+}
+
+// parsePromoteFlags: parse the options for the bucket a version is promoted
+// from, and the bucket it is promoted to
+func parsePromoteFlags(args []string) (promoteOptions, error) {
+	flags := flag.NewFlagSet("promote", flag.ExitOnError)
+
+	var projectName, version, channel, fromPrefix, toPrefix, urlPrefix string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version name")
+	flags.StringVar(&channel, "channel", "", "-channel channel the version was published to, and is promoted to, the stable project root by default")
+	flags.StringVar(&fromPrefix, "from", "", "-from storage bucket the version was published to, such as gcs://staging/")
+	flags.StringVar(&toPrefix, "to", "", "-to storage bucket to promote the version to, such as gcs://prod/")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix public url of the destination bucket, required with -resign")
+
+	var resign bool
+	flags.BoolVar(&resign, "resign", false, "-resign point the promoted manifests at the destination and sign them with the current signing key, rather than keeping the source's signatures")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key used with -resign. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return promoteOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return promoteOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	if !isStoragePrefix(fromPrefix) || !isStoragePrefix(toPrefix) {
+		return promoteOptions{}, errInvalidOption{"-from and -to are required and must start with gcs://, s3:// or https://"}
+	}
+
+	if !strings.HasSuffix(fromPrefix, "/") {
+		fromPrefix = fromPrefix + "/"
+	}
+
+	if !strings.HasSuffix(toPrefix, "/") {
+		toPrefix = toPrefix + "/"
+	}
+
+	if fromPrefix == toPrefix {
+		return promoteOptions{}, errInvalidOption{"-from and -to must differ"}
+	}
+
+	if resign {
+		var err error
+		urlPrefix, err = normalizeURLPrefix(urlPrefix)
+		if err != nil {
+			return promoteOptions{}, err
+		}
+	}
+
+	if err := storage.configure(); err != nil {
+		return promoteOptions{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return promoteOptions{}, err
+	}
+
+	src := artifactor.Options{
+		ProjectName: projectName,
+		GcsPrefix:   fromPrefix,
+		Version:     version,
+		Channel:     channel,
+	}
+
+	dst := src
+	dst.GcsPrefix = toPrefix
+	dst.UrlPrefix = urlPrefix
+
+	return promoteOptions{src: src, dst: dst, resign: resign}, nil
+}
+
+// promote: copy a version from one bucket to another with server side
+// rewrites, without downloading it
+func promote(args []string) {
+	opts, err := parsePromoteFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("promoting version %s %s from %s to %s", opts.src.ProjectName, opts.src.Version, opts.src.GcsPrefix, opts.dst.GcsPrefix))
+
+	src := artifactor.NewProject(&opts.src)
+	dst := artifactor.NewProject(&opts.dst)
+	if err := artifactor.PromoteVersion(src, dst, opts.src.Version, opts.resign); err != nil {
+		log.Fatal(err)
+	}
+}
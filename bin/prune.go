@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type pruneOptions struct {
+	artifactor.Options
+
+	keep        int
+	olderThan   time.Duration
+	dryRun      bool
+	concurrency int
+}
+
+// ageFlag: a duration which may also be given in days, such as 90d
+type ageFlag time.Duration
+
+func (a *ageFlag) String() string {
+	return time.Duration(*a).String()
+}
+
+func (a *ageFlag) Set(value string) error {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return err
+		}
+
+		*a = ageFlag(time.Duration(days) * 24 * time.Hour)
+		return nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*a = ageFlag(duration)
+	return nil
+}
+
+func parsePruneFlags(args []string) (pruneOptions, error) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+
+	var projectName, gcsPrefix, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/ or s3://bucket/")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&channel, "channel", "", "-channel channel whose versions to prune, the stable project root by default")
+
+	var keep int
+	flags.IntVar(&keep, "keep", 0, "-keep number of the newest versions to keep")
+
+	var olderThan ageFlag
+	flags.Var(&olderThan, "older-than", "-older-than only prune versions published longer ago than this, such as 90d or 2160h")
+
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "-dry-run print the versions which would be pruned without deleting them")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of manifests to fetch at once")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key used to re-sign the index. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return pruneOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if keep <= 0 && olderThan <= 0 {
+		return pruneOptions{}, errInvalidOption{"-keep or -older-than is required"}
+	}
+
+	if !isStoragePrefix(gcsPrefix) {
+		return pruneOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs:// or s3://"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	if err := storage.configure(); err != nil {
+		return pruneOptions{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return pruneOptions{}, err
+	}
+
+	return pruneOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			Channel:     channel,
+		},
+		keep:        keep,
+		olderThan:   time.Duration(olderThan),
+		dryRun:      dryRun,
+		concurrency: concurrency,
+	}, nil
+}
+
+// prune: delete a project's old versions, other than those an alias serves
+func prune(args []string) {
+	opts, err := parsePruneFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts.Options)
+	pruned, err := artifactor.PruneVersions(project, opts.keep, opts.olderThan, opts.dryRun, opts.concurrency)
+	for _, version := range pruned {
+		if opts.dryRun {
+			log.Println(fmt.Sprintf("would prune version %s %s", opts.ProjectName, version))
+		} else {
+			log.Println(fmt.Sprintf("pruned version %s %s", opts.ProjectName, version))
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+// parsePublishFlags: parse the options for publishing a version
+func parsePublishFlags(args []string) (artifactor.Options, error) {
+	flags := flag.NewFlagSet("publish", flag.ExitOnError)
+
+	var latest, pointerAliases, manifestGenerations, rootManifest, requireLicense, deduplicate, index, feed, maven, pythonIndex, failFast, verifySource, compressManifest, flatten, lowercase, digestSuffix, githubRelease, force, staged bool
+	flags.BoolVar(&latest, "latest", true, "-latest whether to create a latest alias")
+
+	var aliasValues stringsFlag
+	flags.Var(&aliasValues, "alias", "-alias further alias to point at the version, such as stable or 1.x, may be repeated")
+	flags.BoolVar(&pointerAliases, "pointer-aliases", false, "-pointer-aliases upload a signed alias.json pointing at the version instead of copying its manifests")
+
+	var projectName, gcsPrefix, urlPrefix, version, previousVersion, dir, reportFilepath, changelogFilepath, channel, contentReportFilepath, contentRulesFilepath, releaseNotesFilepath, terraformOutputsFilepath, bazelSnippetsFilepath, goModulePath, goModuleDir, packageSigningKey, objectTemplate, ociRepository, githubRepository, input, streamName string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version name")
+	flags.StringVar(&previousVersion, "previous-version", "", "-previous-version copy unchanged components from this version instead of uploading them")
+	flags.StringVar(&dir, "dir", "", "-dir input dir")
+	flags.StringVar(&streamName, "name", "", "-name filepath of the single component read from stdin when the last argument is -, such as myapp.tar.gz")
+	var requiredParts stringsFlag
+	flags.BoolVar(&staged, "staged", false, "-staged publish the components staged for the version with artifactor stage instead of -dir, as artifactor finalize does")
+	flags.Var(&requiredParts, "require-part", "-require-part part which must have been staged before the version is published with -staged, may be repeated")
+	flags.StringVar(&input, "input", "", "-input .tar, .tar.gz, .tgz or .zip archive whose files are published, read without extracting it, instead of -dir")
+
+	var scratchDir string
+	flags.StringVar(&scratchDir, "scratch-dir", "", "-scratch-dir directory intermediate files, such as manifests before they're uploaded, are written under. Defaults to the system temporary directory")
+	flags.StringVar(&channel, "channel", "", "-channel publish to a channel such as rc, with its own aliases, instead of the stable project root")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+
+	storage := storageFlags(flags)
+
+	var workloadIdentityProvider, workloadIdentityServiceAccount string
+	flags.StringVar(&workloadIdentityProvider, "workload-identity-provider", "", "-workload-identity-provider GCP workload identity provider, such as projects/123/locations/global/workloadIdentityPools/ci/providers/github, to exchange the ci job's oidc token with for short lived credentials")
+	flags.StringVar(&workloadIdentityServiceAccount, "workload-identity-service-account", "", "-workload-identity-service-account service account to impersonate with -workload-identity-provider")
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key, such as secret/data/artifactor/signing#private_key, which is signed with in memory. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix for the public url used in the manifest")
+	flags.StringVar(&reportFilepath, "report", "", "-report path to write a publish report with the generation of every uploaded object, whether or not the publish succeeds. No report is written without it")
+
+	var progressSocket string
+	flags.StringVar(&progressSocket, "progress-socket", "", "-progress-socket unix socket to stream progress events to as json lines, for tools wrapping artifactor")
+	flags.StringVar(&contentReportFilepath, "content-report", "", "-content-report path to write a report on the version's contents before uploading")
+	flags.StringVar(&contentRulesFilepath, "content-rules", "", "-content-rules json file of rules checked against the version's contents before uploading")
+	flags.StringVar(&releaseNotesFilepath, "release-notes", "", "-release-notes file summarizing the version in the project index and feeds")
+	flags.StringVar(&terraformOutputsFilepath, "terraform-outputs", "", "-terraform-outputs path to write the version's urls and checksums in the shape of terraform output -json")
+	flags.StringVar(&bazelSnippetsFilepath, "bazel-snippets", "", "-bazel-snippets path to write bazel http_archive and http_file rules for every component")
+	flags.StringVar(&goModulePath, "go-module", "", "-go-module publish the go module with this path in GOPROXY layout under the project")
+	flags.StringVar(&goModuleDir, "go-module-dir", ".", "-go-module-dir directory containing the go.mod of -go-module")
+	flags.BoolVar(&maven, "maven", false, "-maven publish the version's poms and jars in maven2 repository layout under the project")
+	flags.BoolVar(&pythonIndex, "python-index", false, "-python-index add the version's wheels and sdists to a PEP 503 simple repository under the project")
+	flags.StringVar(&packageSigningKey, "sign-packages", "", "-sign-packages gpg key to sign .deb and .rpm components with, using dpkg-sig and rpmsign")
+	flags.StringVar(&ociRepository, "oci-repository", "", "-oci-repository container registry repository, such as ghcr.io/org/project, to also push the version to as an oci artifact tagged with the version and its aliases. Uses the docker credentials")
+	flags.BoolVar(&githubRelease, "github-release", false, "-github-release also create a github release of the version in -github-repository and attach every component, the manifests and their signatures. Uses GITHUB_TOKEN")
+	flags.StringVar(&githubRepository, "github-repository", os.Getenv("GITHUB_REPOSITORY"), "-github-repository owner/repo of -github-release, GITHUB_REPOSITORY by default")
+	flags.StringVar(&changelogFilepath, "changelog", "", "-changelog path to write a changelog fragment diffing against -previous-version, markdown if it ends in .md and json otherwise")
+	flags.StringVar(&objectTemplate, "object-template", "", "-object-template object name of each component relative to the project, using {version}, {platform}, {dir}, {name} and {path}. Defaults to {version}/{path}")
+	flags.BoolVar(&flatten, "flatten", false, "-flatten drop directories from each component's object name")
+	flags.BoolVar(&lowercase, "lowercase", false, "-lowercase lowercase each component's object name")
+	flags.BoolVar(&digestSuffix, "digest-suffix", false, "-digest-suffix add a sha256 prefix to each component's object name, before its extension")
+	flags.BoolVar(&index, "index", false, "-index maintain a signed index.json listing every version of the project")
+	flags.BoolVar(&feed, "feed", false, "-feed publish atom and json feeds of the project's versions alongside its index")
+	flags.BoolVar(&failFast, "fail-fast", false, "-fail-fast cancel every other upload as soon as one fails")
+	flags.BoolVar(&force, "force", false, "-force republish a version which already exists, overwriting its objects")
+	flags.BoolVar(&verifySource, "verify-source", false, "-verify-source fail if any file in the source directory changes while the version is being published")
+	flags.BoolVar(&deduplicate, "deduplicate", false, "-deduplicate upload components with identical contents once and copy the rest server side")
+	flags.BoolVar(&requireLicense, "require-license", false, "-require-license fail if the version contains binaries but no LICENSE or NOTICE file")
+	flags.BoolVar(&rootManifest, "root", false, "-root chain the sha256 of this version's manifest into the project's signed root.json")
+	flags.BoolVar(&manifestGenerations, "manifest-generations", false, "-manifest-generations record each component's storage generation in manifest.json")
+
+	var smtpAddr, smtpFrom, smtpUsername string
+	var smtpTo stringsFlag
+	flags.StringVar(&smtpAddr, "smtp-addr", "", "-smtp-addr host:port of an smtp server to email notifications through")
+	flags.StringVar(&smtpFrom, "smtp-from", "", "-smtp-from address notifications are sent from")
+	flags.Var(&smtpTo, "smtp-to", "-smtp-to address to email notifications to, may be repeated")
+	flags.StringVar(&smtpUsername, "smtp-username", "", "-smtp-username username to authenticate with, the password is read from $ARTIFACTOR_SMTP_PASSWORD")
+
+	var alertCommand, alertWebhook string
+	flags.StringVar(&alertCommand, "alert-command", "", "-alert-command command run with the event as json on stdin when publishing fails")
+	flags.StringVar(&alertWebhook, "alert-webhook", "", "-alert-webhook url the event is posted to as json when publishing fails")
+
+	var groupValues stringsFlag
+	flags.Var(&groupValues, "group", "-group name=pattern recording every component matching the glob as part of the named group, such as binaries=bin/*, so it can be downloaded on its own. May be repeated")
+
+	var symbolsPrefix, symbolsURLPrefix, symbolsACL string
+	flags.StringVar(&symbolsPrefix, "symbols-prefix", "", "-symbols-prefix storage prefix, such as a private bucket, to publish debug symbols (.pdb, .debug, .dSYM.zip) to instead, listing them under symbols in manifest.json")
+	flags.StringVar(&symbolsURLPrefix, "symbols-url-prefix", "", "-symbols-url-prefix url the -symbols-prefix is served from, such as a symbol server, recorded in manifest.json")
+	flags.StringVar(&symbolsACL, "symbols-acl", "private", "-symbols-acl predefined acl debug symbols are written with, or empty for the bucket's default")
+
+	var symbolServer bool
+	flags.BoolVar(&symbolServer, "symbol-server", false, "-symbol-server lay .pdb files out at the root of -symbols-prefix as a microsoft symbol server, name.pdb/GUIDAGE/name.pdb")
+
+	var dsymIndex bool
+	flags.BoolVar(&dsymIndex, "dsym-index", false, "-dsym-index publish a signed dsyms.json mapping the build uuid of every dSYM to the component holding it")
+
+	var sentryURL, sentryOrg, sentryProject string
+	flags.StringVar(&sentryURL, "sentry-url", "", "-sentry-url sentry instance to upload dSYMs to, https://sentry.io/ by default")
+	flags.StringVar(&sentryOrg, "sentry-org", "", "-sentry-org sentry organization to upload dSYMs to once published, the auth token is read from $SENTRY_AUTH_TOKEN")
+	flags.StringVar(&sentryProject, "sentry-project", "", "-sentry-project sentry project to upload dSYMs to")
+
+	var crashlyticsGoogleServiceInfo, crashlyticsUploadSymbols, crashlyticsPlatform string
+	flags.StringVar(&crashlyticsGoogleServiceInfo, "crashlytics-google-service-info", "", "-crashlytics-google-service-info GoogleService-Info.plist of the app to upload dSYMs to crashlytics for once published")
+	flags.StringVar(&crashlyticsUploadSymbols, "crashlytics-upload-symbols", "upload-symbols", "-crashlytics-upload-symbols firebase's upload-symbols command")
+	flags.StringVar(&crashlyticsPlatform, "crashlytics-platform", "ios", "-crashlytics-platform platform of the app, ios, mac or tvos")
+
+	var mirrorValues stringsFlag
+	flags.Var(&mirrorValues, "mirror", "-mirror storage prefix to also publish the version's components and manifests to, such as gcs://dr-bucket/=https://dr.example.com/ with the url it's served from after an =. May be repeated")
+
+	var urlTemplates stringsFlag
+	flags.Var(&urlTemplates, "url-template", "-url-template public url template of each component, such as https://dl.example.com/{project}/{version}/{path}. Prefix with pattern= to only apply to matching components, may be repeated")
+
+	var actor string
+	flags.StringVar(&actor, "actor", defaultActor(), "-actor who is publishing, recorded in the alias history")
+
+	var publishedBy, identityToken string
+	flags.StringVar(&publishedBy, "published-by", "", "-published-by publisher recorded in manifest.json, defaulting to -actor")
+	flags.StringVar(&identityToken, "identity-token", "", "-identity-token path to a ci identity token, such as a gitlab ci id token, whose claims are recorded in manifest.json, and which -workload-identity-provider exchanges for credentials")
+
+	var metadata artifactor.ProjectMetadata
+	flags.StringVar(&metadata.Homepage, "homepage", "", "-homepage url of the project's homepage, recorded in manifest.json and linked from the index and feeds")
+	flags.StringVar(&metadata.DocumentationURL, "documentation-url", "", "-documentation-url url of the project's documentation, recorded in manifest.json")
+	flags.StringVar(&metadata.Support, "support", "", "-support contact for help with the project, such as an email address or issue tracker url, recorded in manifest.json")
+	flags.StringVar(&metadata.License, "license", "", "-license spdx identifier of the project's license, such as Apache-2.0, recorded in manifest.json")
+
+	var signedURLExpiry time.Duration
+	flags.DurationVar(&signedURLExpiry, "signed-url-expiry", 0, "-signed-url-expiry include signed component urls valid for this long in -terraform-outputs")
+
+	var expiresIn time.Duration
+	flags.DurationVar(&expiresIn, "expires-in", 0, "-expires-in mark the version as expiring after this duration, for short lived builds such as nightlies")
+
+	flags.BoolVar(&compressManifest, "compress-manifest", false, "-compress-manifest also publish a signed, zstd compressed manifest.json.zst, which download and get prefer")
+
+	var manifestShardSize int
+	flags.IntVar(&manifestShardSize, "manifest-shard-size", 0, "-manifest-shard-size also publish the manifest as signed shards of this many components when the version has more")
+
+	var uploadChunkSize, singleRequestUploadSize int
+	flags.IntVar(&uploadChunkSize, "upload-chunk-size", 0, "-upload-chunk-size bytes of each object buffered and sent per request when uploading to gcs, 16MiB by default. Each concurrent upload holds a buffer of up to this size")
+	flags.IntVar(&singleRequestUploadSize, "single-request-upload-size", 0, "-single-request-upload-size upload objects of up to this many bytes to gcs in a single request without buffering, which isn't retried part way")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of components to upload at once")
+
+	flags.Parse(args)
+
+	var stream io.Reader
+	if flags.NArg() == 1 && flags.Arg(0) == "-" {
+		stream = os.Stdin
+	}
+
+	if stream != nil && streamName == "" {
+		return artifactor.Options{}, errInvalidOption{"-name is required when publishing from stdin"}
+	}
+	if stream == nil && streamName != "" {
+		return artifactor.Options{}, errInvalidOption{"-name only applies when publishing from stdin with -"}
+	}
+
+	if len(requiredParts) > 0 && !staged {
+		return artifactor.Options{}, errInvalidOption{"-require-part only applies to -staged"}
+	}
+
+	sources := 0
+	for _, given := range []bool{dir != "", input != "", stream != nil, staged} {
+		if given {
+			sources++
+		}
+	}
+	if sources == 0 {
+		return artifactor.Options{}, errInvalidOption{"-dir, -input, -staged or - for stdin is required"}
+	}
+	if sources > 1 {
+		return artifactor.Options{}, errInvalidOption{"only one of -dir, -input, -staged and - for stdin may be given"}
+	}
+	if verifySource && dir == "" {
+		return artifactor.Options{}, errInvalidOption{"-verify-source only applies to -dir"}
+	}
+	if version == "" {
+		return artifactor.Options{}, errInvalidOption{"-version is required"}
+	}
+
+	if projectName == "" {
+		return artifactor.Options{}, errInvalidOption{"-option is required"}
+	}
+
+	if !githubRelease {
+		githubRepository = ""
+	} else if strings.Count(githubRepository, "/") != 1 {
+		return artifactor.Options{}, errInvalidOption{"-github-repository must be of the form owner/repo with -github-release"}
+	}
+
+	gcsPrefix, urlPrefix, err := normalizePrefixes(gcsPrefix, urlPrefix)
+	if err != nil {
+		return artifactor.Options{}, err
+	}
+
+	mirrors, err := parseMirrors(mirrorValues)
+	if err != nil {
+		return artifactor.Options{}, err
+	}
+
+	if symbolsPrefix != "" {
+		if !isStoragePrefix(symbolsPrefix) {
+			return artifactor.Options{}, errInvalidOption{"-symbols-prefix must start with gcs://, s3:// or https://"}
+		}
+
+		if !strings.HasSuffix(symbolsPrefix, "/") {
+			symbolsPrefix = symbolsPrefix + "/"
+		}
+	}
+
+	if symbolsURLPrefix != "" {
+		if symbolsPrefix == "" {
+			return artifactor.Options{}, errInvalidOption{"-symbols-url-prefix requires -symbols-prefix"}
+		}
+
+		symbolsURLPrefix, err = normalizeURLPrefix(symbolsURLPrefix)
+		if err != nil {
+			return artifactor.Options{}, errInvalidOption{fmt.Sprintf("-symbols-url-prefix: %v", err)}
+		}
+	}
+
+	for _, alias := range aliasValues {
+		if alias == "" || strings.Contains(alias, "/") {
+			return artifactor.Options{}, errInvalidOption{fmt.Sprintf("-alias %q must be a single, non-empty path segment", alias)}
+		}
+
+		if alias == version {
+			return artifactor.Options{}, errInvalidOption{"-alias can't be the version being published"}
+		}
+	}
+
+	if concurrency < 1 {
+		return artifactor.Options{}, errInvalidOption{"-concurrency must be at least 1"}
+	}
+
+	if uploadChunkSize < 0 || singleRequestUploadSize < 0 {
+		return artifactor.Options{}, errInvalidOption{"-upload-chunk-size and -single-request-upload-size must not be negative"}
+	}
+
+	if symbolServer && symbolsPrefix == "" {
+		return artifactor.Options{}, errInvalidOption{"-symbol-server requires -symbols-prefix"}
+	}
+
+	groups, err := parseGroups(groupValues)
+	if err != nil {
+		return artifactor.Options{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return artifactor.Options{}, err
+	}
+
+	// the working directory changes to -dir before publishing, so paths
+	// given relative to where artifactor was run are made absolute
+	for _, outputFilepath := range []*string{&reportFilepath, &changelogFilepath, &contentReportFilepath, &terraformOutputsFilepath, &bazelSnippetsFilepath, &goModuleDir, &identityToken, &scratchDir, &crashlyticsGoogleServiceInfo, &input} {
+		if *outputFilepath == "" {
+			continue
+		}
+
+		absFilepath, err := filepath.Abs(*outputFilepath)
+		if err != nil {
+			return artifactor.Options{}, err
+		}
+		*outputFilepath = absFilepath
+	}
+
+	if scratchDir != "" {
+		if info, err := os.Stat(scratchDir); err != nil || !info.IsDir() {
+			return artifactor.Options{}, errInvalidOption{"-scratch-dir must be an existing directory"}
+		}
+
+		artifactor.SetScratchDir(scratchDir)
+	}
+
+	if err := storage.configure(); err != nil {
+		return artifactor.Options{}, err
+	}
+
+	if workloadIdentityProvider != "" {
+		if storage.gcsEndpoint != "" {
+			return artifactor.Options{}, errInvalidOption{"-workload-identity-provider can't be combined with -gcs-endpoint"}
+		}
+
+		artifactor.RegisterStorage("gcs", artifactor.WorkloadIdentity{
+			Provider:       workloadIdentityProvider,
+			ServiceAccount: workloadIdentityServiceAccount,
+			TokenFilepath:  identityToken,
+		}.Storage)
+	}
+
+	releaseNotes := ""
+	if releaseNotesFilepath != "" {
+		byts, err := ioutil.ReadFile(releaseNotesFilepath)
+		if err != nil {
+			return artifactor.Options{}, err
+		}
+		releaseNotes = string(byts)
+	}
+
+	var contentRules *artifactor.ContentRules
+	if contentRulesFilepath != "" {
+		rules, err := artifactor.LoadContentRules(contentRulesFilepath)
+		if err != nil {
+			return artifactor.Options{}, err
+		}
+		contentRules = &rules
+	} else if contentReportFilepath != "" {
+		rules := artifactor.DefaultContentRules()
+		contentRules = &rules
+	}
+
+	notifiers, err := parseNotifiers(smtpAddr, smtpFrom, smtpTo, smtpUsername)
+	if err != nil {
+		return artifactor.Options{}, err
+	}
+
+	alerters := parseAlerters(alertCommand, alertWebhook)
+
+	symbolUploaders, err := parseSymbolUploaders(sentryURL, sentryOrg, sentryProject, crashlyticsGoogleServiceInfo, crashlyticsUploadSymbols, crashlyticsPlatform)
+	if err != nil {
+		return artifactor.Options{}, err
+	}
+
+	var progress artifactor.ProgressReporter
+	if err := metadata.Validate(); err != nil {
+		return artifactor.Options{}, errInvalidOption{err.Error()}
+	}
+
+	if progressSocket != "" {
+		socketProgress, err := artifactor.DialProgressSocket(progressSocket)
+		if err != nil {
+			return artifactor.Options{}, fmt.Errorf("-progress-socket: %v", err)
+		}
+		progress = socketProgress
+	}
+
+	var objectNaming *artifactor.NamingScheme
+	if objectTemplate != "" || flatten || lowercase || digestSuffix {
+		objectNaming = &artifactor.NamingScheme{
+			Template:     objectTemplate,
+			Flatten:      flatten,
+			Lowercase:    lowercase,
+			DigestSuffix: digestSuffix,
+		}
+	}
+
+	aliases := make([]string, 0, len(aliasValues)+1)
+	if latest {
+		aliases = append(aliases, "latest")
+	}
+	aliases = append(aliases, aliasValues...)
+
+	return artifactor.Options{
+		Latest:                   latest,
+		PointerAliases:           pointerAliases,
+		ManifestGenerations:      manifestGenerations,
+		RootManifest:             rootManifest,
+		RequireLicense:           requireLicense,
+		Deduplicate:              deduplicate,
+		FailFast:                 failFast,
+		Force:                    force,
+		VerifySource:             verifySource,
+		ManifestShardSize:        manifestShardSize,
+		Concurrency:              concurrency,
+		UploadChunkSize:          uploadChunkSize,
+		SingleRequestUploadSize:  singleRequestUploadSize,
+		CompressManifest:         compressManifest,
+		Index:                    index,
+		Feed:                     feed,
+		ReleaseNotes:             releaseNotes,
+		Notifiers:                notifiers,
+		Alerters:                 alerters,
+		Progress:                 progress,
+		TerraformOutputsFilepath: terraformOutputsFilepath,
+		SignedURLExpiry:          signedURLExpiry,
+		BazelSnippetsFilepath:    bazelSnippetsFilepath,
+		Maven:                    maven,
+		PythonIndex:              pythonIndex,
+		PackageSigningKey:        packageSigningKey,
+		GoModulePath:             goModulePath,
+		GoModuleDir:              goModuleDir,
+		ContentRules:             contentRules,
+		ContentReportFilepath:    contentReportFilepath,
+		ReportFilepath:           reportFilepath,
+		ChangelogFilepath:        changelogFilepath,
+		OCIRepository:            ociRepository,
+		GitHubRepository:         githubRepository,
+		ProjectName:              projectName,
+		GcsPrefix:                gcsPrefix,
+		UrlPrefix:                urlPrefix,
+		Version:                  version,
+		PreviousVersion:          previousVersion,
+		ExpiresIn:                expiresIn,
+		Metadata:                 metadata,
+		Dir:                      dir,
+		Input:                    input,
+		Stream:                   stream,
+		StreamName:               streamName,
+		Staged:                   staged,
+		RequiredParts:            requiredParts,
+		Aliases:                  aliases,
+		Channel:                  channel,
+		Actor:                    actor,
+		PublishedBy:              publishedBy,
+		IdentityTokenFilepath:    identityToken,
+		ObjectNaming:             objectNaming,
+		URLTemplates:             parseURLTemplates(urlTemplates),
+		Mirrors:                  mirrors,
+		SymbolsPrefix:            symbolsPrefix,
+		SymbolsURLPrefix:         symbolsURLPrefix,
+		SymbolsACL:               &symbolsACL,
+		SymbolServer:             symbolServer,
+		DSYMIndex:                dsymIndex,
+		SymbolUploaders:          symbolUploaders,
+		Groups:                   groups,
+	}, nil
+}
+
+// parseGroups: parse -group flags, which are a group name and a pattern
+// separated by an =
+func parseGroups(values []string) ([]artifactor.ComponentGroup, error) {
+	groups := make([]artifactor.ComponentGroup, 0, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errInvalidOption{fmt.Sprintf("-group %q must be of the form name=pattern", value)}
+		}
+
+		groups = append(groups, artifactor.ComponentGroup{Name: parts[0], Pattern: parts[1]})
+	}
+
+	return groups, nil
+}
+
+// parseMirrors: parse -mirror flags, which are a storage prefix optionally
+// followed by an = and the url prefix it is served from. Https storage
+// prefixes are served from where they're put
+func parseMirrors(values []string) ([]artifactor.Mirror, error) {
+	mirrors := make([]artifactor.Mirror, 0, len(values))
+	for _, value := range values {
+		var mirror artifactor.Mirror
+		mirror.GcsPrefix = value
+
+		if separator := strings.Index(value, "="); separator >= 0 {
+			mirror.GcsPrefix, mirror.UrlPrefix = value[:separator], value[separator+1:]
+		}
+
+		gcsPrefix, urlPrefix, err := normalizePrefixes(mirror.GcsPrefix, mirror.UrlPrefix)
+		if err != nil {
+			return nil, errInvalidOption{fmt.Sprintf("-mirror %q: %v", value, err)}
+		}
+
+		mirrors = append(mirrors, artifactor.Mirror{GcsPrefix: gcsPrefix, UrlPrefix: urlPrefix})
+	}
+
+	return mirrors, nil
+}
+
+// parseURLTemplates: parse -url-template flags, which are either a template,
+// or a pattern and a template separated by an = before the template's scheme
+func parseURLTemplates(values []string) []artifactor.URLTemplate {
+	templates := make([]artifactor.URLTemplate, 0, len(values))
+	for _, value := range values {
+		template := artifactor.URLTemplate{Template: value}
+
+		separator := strings.Index(value, "=")
+		if scheme := strings.Index(value, "://"); separator >= 0 && (scheme < 0 || separator < scheme) {
+			template.Pattern, template.Template = value[:separator], value[separator+1:]
+		}
+
+		templates = append(templates, template)
+	}
+
+	return templates
+}
+
+// parseNotifiers: build the notifiers configured by flags
+func parseNotifiers(smtpAddr, smtpFrom string, smtpTo []string, smtpUsername string) ([]artifactor.Notifier, error) {
+	notifiers := make([]artifactor.Notifier, 0)
+
+	if smtpAddr != "" {
+		if smtpFrom == "" || len(smtpTo) == 0 {
+			return nil, errInvalidOption{"-smtp-from and -smtp-to are required with -smtp-addr"}
+		}
+
+		notifiers = append(notifiers, artifactor.SMTPNotifier{
+			Addr:     smtpAddr,
+			From:     smtpFrom,
+			To:       smtpTo,
+			Username: smtpUsername,
+			Password: os.Getenv("ARTIFACTOR_SMTP_PASSWORD"),
+		})
+	}
+
+	return notifiers, nil
+}
+
+// parseSymbolUploaders: build the dSYM uploaders configured by flags. The
+// upload-symbols command is split on whitespace
+func parseSymbolUploaders(sentryURL, sentryOrg, sentryProject, googleServiceInfo, uploadSymbols, platform string) ([]artifactor.SymbolUploader, error) {
+	uploaders := make([]artifactor.SymbolUploader, 0)
+
+	if sentryOrg != "" || sentryProject != "" {
+		if sentryOrg == "" || sentryProject == "" {
+			return nil, errInvalidOption{"-sentry-org and -sentry-project are required together"}
+		}
+
+		token := os.Getenv("SENTRY_AUTH_TOKEN")
+		if token == "" {
+			return nil, errInvalidOption{"$SENTRY_AUTH_TOKEN is required with -sentry-org"}
+		}
+
+		uploaders = append(uploaders, artifactor.SentryUploader{
+			URL:          sentryURL,
+			Organization: sentryOrg,
+			Project:      sentryProject,
+			Token:        token,
+		})
+	}
+
+	if googleServiceInfo != "" {
+		uploaders = append(uploaders, artifactor.CrashlyticsUploader{
+			Command:                   strings.Fields(uploadSymbols),
+			GoogleServiceInfoFilepath: googleServiceInfo,
+			Platform:                  platform,
+		})
+	}
+
+	return uploaders, nil
+}
+
+// parseAlerters: build the alerting hooks configured by flags. The alert
+// command is split on whitespace
+func parseAlerters(alertCommand, alertWebhook string) []artifactor.Notifier {
+	alerters := make([]artifactor.Notifier, 0)
+
+	if alertCommand != "" {
+		alerters = append(alerters, artifactor.ExecNotifier{Command: strings.Fields(alertCommand)})
+	}
+
+	if alertWebhook != "" {
+		alerters = append(alerters, artifactor.WebhookNotifier{URL: alertWebhook})
+	}
+
+	return alerters
+}
+
+// publish: create a version from the contents of a directory, archive or
+// stdin, uploading its components and signed manifests and updating its
+// aliases
+func publish(args []string) {
+	opts, err := parsePublishFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.Dir != "" {
+		os.Chdir(opts.Dir)
+	}
+
+	log.Println(fmt.Sprintf("creating version %s %s", opts.ProjectName, opts.Version))
+
+	project := artifactor.NewProject(&opts)
+	err = artifactor.CreateVersion(project, &opts)
+
+	// the progress socket is closed before exiting, which log.Fatal skips
+	// deferred calls for
+	if closer, ok := opts.Progress.(io.Closer); ok {
+		closer.Close()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
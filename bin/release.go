@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+// parseReleaseFlags: parse the options for the channel a version is released
+// from, and the channel it is released to
+func parseReleaseFlags(args []string) (artifactor.Options, artifactor.Options, error) {
+	flags := flag.NewFlagSet("release", flag.ExitOnError)
+
+	var latest, pointerAliases, index, feed bool
+	flags.BoolVar(&latest, "latest", true, "-latest whether to update the latest alias of the destination channel")
+	flags.BoolVar(&pointerAliases, "pointer-aliases", false, "-pointer-aliases upload a signed alias.json pointing at the version instead of copying its manifests")
+
+	flags.BoolVar(&index, "index", false, "-index add the version to the destination channel's index.json")
+	flags.BoolVar(&feed, "feed", false, "-feed publish atom and json feeds of the destination channel's versions alongside its index")
+
+	var projectName, gcsPrefix, urlPrefix, version, fromChannel, toChannel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version name")
+	flags.StringVar(&fromChannel, "from-channel", "rc", "-from-channel channel the version was published to")
+	flags.StringVar(&toChannel, "to-channel", "", "-to-channel channel to release the version to, the stable project root by default")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key, such as secret/data/artifactor/signing#private_key. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix for the public url used in the manifest")
+
+	var actor string
+	flags.StringVar(&actor, "actor", defaultActor(), "-actor who is releasing, recorded in the alias history")
+
+	flags.Parse(args)
+
+	if version == "" {
+		return artifactor.Options{}, artifactor.Options{}, errInvalidOption{"-version is required"}
+	}
+
+	if projectName == "" {
+		return artifactor.Options{}, artifactor.Options{}, errInvalidOption{"-project is required"}
+	}
+
+	if fromChannel == toChannel {
+		return artifactor.Options{}, artifactor.Options{}, errInvalidOption{"-from-channel and -to-channel must differ"}
+	}
+
+	gcsPrefix, urlPrefix, err := normalizePrefixes(gcsPrefix, urlPrefix)
+	if err != nil {
+		return artifactor.Options{}, artifactor.Options{}, err
+	}
+
+	if err := storage.configure(); err != nil {
+		return artifactor.Options{}, artifactor.Options{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return artifactor.Options{}, artifactor.Options{}, err
+	}
+
+	aliases := make([]string, 0)
+	if latest {
+		aliases = append(aliases, "latest")
+	}
+
+	src := artifactor.Options{
+		ProjectName: projectName,
+		GcsPrefix:   gcsPrefix,
+		UrlPrefix:   urlPrefix,
+		Version:     version,
+		Channel:     fromChannel,
+	}
+
+	dst := src
+	dst.Channel = toChannel
+	dst.Latest = latest
+	dst.PointerAliases = pointerAliases
+	dst.Aliases = aliases
+	dst.Index = index
+	dst.Feed = feed
+	dst.Actor = actor
+
+	return src, dst, nil
+}
+
+// release: promote the exact objects of a version published to one channel to
+// another, and update its aliases
+func release(args []string) {
+	srcOpts, dstOpts, err := parseReleaseFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("releasing version %s %s from %q to %q", srcOpts.ProjectName, srcOpts.Version, srcOpts.Channel, dstOpts.Channel))
+
+	src := artifactor.NewProject(&srcOpts)
+	dst := artifactor.NewProject(&dstOpts)
+	if err := artifactor.ReleaseVersion(src, dst, &dstOpts); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type resignOptions struct {
+	artifactor.Options
+
+	versions    []string
+	all         bool
+	trustedKeys []string
+	concurrency int
+}
+
+func parseResignFlags(args []string) (resignOptions, error) {
+	flags := flag.NewFlagSet("resign", flag.ExitOnError)
+
+	var projectName, gcsPrefix, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&channel, "channel", "", "-channel channel of the versions, the stable project root by default")
+
+	var versions stringsFlag
+	flags.Var(&versions, "version", "-version version to re-sign, may be repeated")
+
+	var all bool
+	flags.BoolVar(&all, "all", false, "-all re-sign every version of the project, in place of -version")
+
+	var trustedKeys stringsFlag
+	flags.Var(&trustedKeys, "key", "-key full fingerprint of a key trusted to have made the existing signatures, may be repeated. Defaults to any key in the local keyring")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of manifests to fetch at once when listing versions for -all")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key to sign with, such as secret/data/artifactor/signing#private_key. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return resignOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if len(versions) == 0 && !all {
+		return resignOptions{}, errInvalidOption{"-version or -all is required"}
+	}
+
+	if len(versions) > 0 && all {
+		return resignOptions{}, errInvalidOption{"-version and -all can't be combined"}
+	}
+
+	if !isStoragePrefix(gcsPrefix) {
+		return resignOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs://, s3:// or https://"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	if err := storage.configure(); err != nil {
+		return resignOptions{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return resignOptions{}, err
+	}
+
+	return resignOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			Channel:     channel,
+		},
+		versions:    versions,
+		all:         all,
+		trustedKeys: trustedKeys,
+		concurrency: concurrency,
+	}, nil
+}
+
+// resign: refresh the signatures of published versions with the current
+// signing key, such as after rotating keys
+func resign(args []string) {
+	opts, err := parseResignFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts.Options)
+
+	versions := opts.versions
+	if opts.all {
+		indexVersions, err := artifactor.ListVersions(project, opts.concurrency)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, version := range indexVersions {
+			versions = append(versions, version.Version)
+		}
+	}
+
+	for _, version := range versions {
+		objects, err := artifactor.ResignVersion(project, version, opts.trustedKeys)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("%s: %v", version, err))
+		}
+
+		log.Println(fmt.Sprintf("re-signed version %s %s, %d signatures", opts.ProjectName, version, len(objects)))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type rotateKeyOptions struct {
+	artifactor.Options
+
+	oldKey, newKey string
+	window         time.Duration
+}
+
+func parseRotateKeyFlags(args []string) (rotateKeyOptions, error) {
+	flags := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+
+	var projectName, gcsPrefix, urlPrefix, oldKey, newKey string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix for the public url used in the manifest")
+	flags.StringVar(&oldKey, "old-key", "", "-old-key full fingerprint of the key being rotated out")
+	flags.StringVar(&newKey, "new-key", "", "-new-key full fingerprint of the key being rotated in")
+
+	var window time.Duration
+	flags.DurationVar(&window, "window", 30*24*time.Hour, "-window how long signatures from the old key are still accepted")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return rotateKeyOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if oldKey == "" || newKey == "" {
+		return rotateKeyOptions{}, errInvalidOption{"-old-key and -new-key are required"}
+	}
+
+	gcsPrefix, urlPrefix, err := normalizePrefixes(gcsPrefix, urlPrefix)
+	if err != nil {
+		return rotateKeyOptions{}, err
+	}
+
+	return rotateKeyOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			UrlPrefix:   urlPrefix,
+		},
+		oldKey: oldKey,
+		newKey: newKey,
+		window: window,
+	}, nil
+}
+
+// rotateKey: publish a new signing key for a project, and dual sign its key
+// ring and root for the transition window
+func rotateKey(args []string) {
+	opts, err := parseRotateKeyFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("rotating %s signing key from %s to %s", opts.ProjectName, opts.oldKey, opts.newKey))
+
+	project := artifactor.NewProject(&opts.Options)
+	if err := artifactor.RotateKey(project, opts.oldKey, opts.newKey, opts.window); err != nil {
+		log.Fatal(err)
+	}
+}
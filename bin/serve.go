@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type serveOptions struct {
+	artifactor.ServerOptions
+
+	gcsPrefix string
+	listen    string
+}
+
+func parseServeFlags(args []string) (serveOptions, error) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+
+	var gcsPrefix, listen string
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to to serve artifacts from")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&listen, "listen", ":8080", "-listen address to listen on")
+
+	var connectionRate, globalRate int64
+	flags.Int64Var(&connectionRate, "connection-rate", 0, "-connection-rate bytes per second allowed for each download, 0 for unlimited")
+	flags.Int64Var(&globalRate, "global-rate", 0, "-global-rate bytes per second allowed across all downloads, 0 for unlimited")
+
+	var templatesDir, staticDir string
+	flags.StringVar(&templatesDir, "templates", "", "-templates directory of .html templates overriding the default page templates")
+	flags.StringVar(&staticDir, "static", "", "-static directory of assets served under /_static/")
+
+	var htpasswdFilepath, tokensFilepath string
+	flags.StringVar(&htpasswdFilepath, "htpasswd", "", "-htpasswd file of username:bcrypt-hash lines allowed to authenticate with basic auth")
+	flags.StringVar(&tokensFilepath, "bearer-tokens", "", "-bearer-tokens file of tokens, one per line, allowed to authenticate with an Authorization: Bearer header")
+
+	var downloads string
+	flags.StringVar(&downloads, "downloads", artifactor.DownloadsProxy, "-downloads how objects are served: proxy through the server, redirect components to their url in the manifest, or signed to redirect to a signed url")
+
+	var signedURLExpiry time.Duration
+	flags.DurationVar(&signedURLExpiry, "signed-url-expiry", 15*time.Minute, "-signed-url-expiry how long the signed urls downloads are redirected to are valid, with -downloads signed")
+
+	var allowedCIDRs stringsFlag
+	flags.Var(&allowedCIDRs, "allow", "-allow cidr or ip address allowed to make requests, may be repeated. Defaults to any address")
+
+	flags.Parse(args)
+
+	if !isStoragePrefix(gcsPrefix) {
+		return serveOptions{}, errInvalidOption{"-gcs-prefix is required and must start with gcs://, s3:// or https://"}
+	}
+
+	if !strings.HasSuffix(gcsPrefix, "/") {
+		gcsPrefix = gcsPrefix + "/"
+	}
+
+	switch downloads {
+	case artifactor.DownloadsProxy, artifactor.DownloadsRedirect, artifactor.DownloadsSigned:
+	default:
+		return serveOptions{}, errInvalidOption{"-downloads must be proxy, redirect or signed"}
+	}
+
+	allowedNetworks, err := artifactor.ParseNetworks(allowedCIDRs)
+	if err != nil {
+		return serveOptions{}, err
+	}
+
+	basicAuthUsers := make(map[string]string)
+	if htpasswdFilepath != "" {
+		basicAuthUsers, err = artifactor.LoadHtpasswd(htpasswdFilepath)
+		if err != nil {
+			return serveOptions{}, err
+		}
+
+		if len(basicAuthUsers) == 0 {
+			return serveOptions{}, errInvalidOption{fmt.Sprintf("-htpasswd %s holds no users", htpasswdFilepath)}
+		}
+	}
+
+	bearerTokens := make([]string, 0)
+	if tokensFilepath != "" {
+		bearerTokens, err = artifactor.LoadTokens(tokensFilepath)
+		if err != nil {
+			return serveOptions{}, err
+		}
+
+		if len(bearerTokens) == 0 {
+			return serveOptions{}, errInvalidOption{fmt.Sprintf("-bearer-tokens %s holds no tokens", tokensFilepath)}
+		}
+	}
+
+	return serveOptions{
+		ServerOptions: artifactor.ServerOptions{
+			ConnectionBytesPerSecond: connectionRate,
+			GlobalBytesPerSecond:     globalRate,
+			AllowedNetworks:          allowedNetworks,
+			BasicAuthUsers:           basicAuthUsers,
+			BearerTokens:             bearerTokens,
+			RequireAuth:              htpasswdFilepath != "" || tokensFilepath != "",
+			TemplatesDir:             templatesDir,
+			StaticDir:                staticDir,
+			Downloads:                downloads,
+			SignedURLExpiry:          signedURLExpiry,
+		},
+		gcsPrefix: gcsPrefix,
+		listen:    listen,
+	}, nil
+}
+
+// serve: serve artifacts out of the storage bucket over http
+func serve(args []string) {
+	opts, err := parseServeFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, err := artifactor.NewServer(opts.gcsPrefix, opts.ServerOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("serving", opts.gcsPrefix, "on", opts.listen)
+	log.Fatal(http.ListenAndServe(opts.listen, server))
+}
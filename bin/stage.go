@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type stageOptions struct {
+	artifactor.Options
+
+	part string
+}
+
+func parseStageFlags(args []string) (stageOptions, error) {
+	flags := flag.NewFlagSet("stage", flag.ExitOnError)
+
+	var projectName, gcsPrefix, urlPrefix, version, channel, dir, input, streamName, part string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version to stage components for")
+	flags.StringVar(&channel, "channel", "", "-channel channel the version will be published to, the stable project root by default")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix for the public url used once the version is finalized")
+	flags.StringVar(&part, "part", "", "-part name of this job's part of the version, such as linux-amd64. Staging a part again replaces it")
+	flags.StringVar(&dir, "dir", "", "-dir input dir")
+	flags.StringVar(&input, "input", "", "-input .tar, .tar.gz, .tgz or .zip archive whose files are staged, read without extracting it, instead of -dir")
+	flags.StringVar(&streamName, "name", "", "-name filepath of the single component read from stdin when the last argument is -, such as myapp.tar.gz")
+
+	var failFast bool
+	flags.BoolVar(&failFast, "fail-fast", false, "-fail-fast cancel every other upload as soon as one fails")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of components to upload at once")
+
+	storage := storageFlags(flags)
+
+	var actor string
+	flags.StringVar(&actor, "actor", defaultActor(), "-actor who is staging the part, recorded with it")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return stageOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return stageOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	if part == "" {
+		return stageOptions{}, errInvalidOption{"-part is required"}
+	}
+
+	var stream io.Reader
+	if flags.NArg() == 1 && flags.Arg(0) == "-" {
+		stream = os.Stdin
+	}
+
+	if stream != nil && streamName == "" {
+		return stageOptions{}, errInvalidOption{"-name is required when staging from stdin"}
+	}
+	if stream == nil && streamName != "" {
+		return stageOptions{}, errInvalidOption{"-name only applies when staging from stdin with -"}
+	}
+
+	if concurrency < 1 {
+		return stageOptions{}, errInvalidOption{"-concurrency must be at least 1"}
+	}
+
+	sources := 0
+	for _, given := range []bool{dir != "", input != "", stream != nil} {
+		if given {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return stageOptions{}, errInvalidOption{"one of -dir, -input or - for stdin is required"}
+	}
+
+	// the working directory changes to -dir before staging
+	if input != "" {
+		absFilepath, err := filepath.Abs(input)
+		if err != nil {
+			return stageOptions{}, err
+		}
+		input = absFilepath
+	}
+
+	gcsPrefix, urlPrefix, err := normalizePrefixes(gcsPrefix, urlPrefix)
+	if err != nil {
+		return stageOptions{}, err
+	}
+
+	if err := storage.configure(); err != nil {
+		return stageOptions{}, err
+	}
+
+	return stageOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			UrlPrefix:   urlPrefix,
+			Version:     version,
+			Channel:     channel,
+			Dir:         dir,
+			Input:       input,
+			Stream:      stream,
+			StreamName:  streamName,
+			FailFast:    failFast,
+			Concurrency: concurrency,
+			Actor:       actor,
+		},
+		part: part,
+	}, nil
+}
+
+// stage: upload one job's part of a version without publishing it, to be
+// published along with the other parts by finalize
+func stage(args []string) {
+	opts, err := parseStageFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.Dir != "" {
+		os.Chdir(opts.Dir)
+	}
+
+	staged, err := artifactor.StageComponents(artifactor.NewProject(&opts.Options), &opts.Options, opts.part)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("staged %d components for %s %s as %s", len(staged.Components), opts.ProjectName, opts.Version, opts.part))
+}
+
+// finalize: publish a version from the parts staged for it, taking the same
+// flags as publish other than its source
+func finalize(args []string) {
+	publish(append([]string{"-staged"}, args...))
+}
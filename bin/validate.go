@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type validateOptions struct {
+	manifestFilepaths []string
+	schema            bool
+}
+
+func parseValidateFlags(args []string) (validateOptions, error) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+
+	var schema bool
+	flags.BoolVar(&schema, "schema", false, "-schema print the json schema manifests are validated against, rather than validating any")
+
+	flags.Parse(args)
+
+	if !schema && flags.NArg() == 0 {
+		return validateOptions{}, errInvalidOption{"at least one manifest.json to validate is required"}
+	}
+
+	return validateOptions{
+		manifestFilepaths: flags.Args(),
+		schema:            schema,
+	}, nil
+}
+
+// validate: check manifest.json files against the manifest schema, such as
+// those written by other tools, printing every problem found
+func validate(args []string) {
+	opts, err := parseValidateFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.schema {
+		fmt.Print(artifactor.ManifestSchema)
+		return
+	}
+
+	invalid := 0
+	for _, manifestFilepath := range opts.manifestFilepaths {
+		byts, err := ioutil.ReadFile(manifestFilepath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		problems, err := artifactor.ValidateManifest(byts)
+		if err != nil {
+			problems = []string{err.Error()}
+		}
+
+		if len(problems) > 0 {
+			invalid++
+		}
+
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", manifestFilepath, problem)
+		}
+	}
+
+	if invalid > 0 {
+		log.Fatal(fmt.Sprintf("%d of %d manifests are invalid", invalid, len(opts.manifestFilepaths)))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type verifyOptions struct {
+	artifactor.Options
+
+	dir         string
+	objects     bool
+	concurrency int
+	trust       artifactor.TrustPolicy
+	alerters    []artifactor.Notifier
+}
+
+func parseVerifyFlags(args []string) (verifyOptions, error) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+
+	var projectName, gcsPrefix, urlPrefix, version, dir string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version name")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix public url the version was published to")
+	flags.StringVar(&dir, "dir", "", "-dir directory holding a downloaded copy of the version to verify against its manifest")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, when given the project's signed root is verified too")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+
+	var objects bool
+	flags.BoolVar(&objects, "objects", false, "-objects stat every component in the storage bucket at -gcs-prefix and compare its size, md5 and crc32c with the manifest, without downloading it")
+
+	storage := storageFlags(flags)
+
+	var alertCommand, alertWebhook string
+	flags.StringVar(&alertCommand, "alert-command", "", "-alert-command command run with the event as json on stdin when -objects finds corruption")
+	flags.StringVar(&alertWebhook, "alert-webhook", "", "-alert-webhook url the event is posted to as json when -objects finds corruption")
+
+	var concurrency int
+	flags.IntVar(&concurrency, "concurrency", artifactor.DefaultConcurrency, "-concurrency number of files to verify at once")
+
+	signers := trustFlags(flags)
+
+	var verificationCache string
+	flags.StringVar(&verificationCache, "verification-cache", "", "-verification-cache directory remembering verified manifests and files, so they aren't verified again. Off by default")
+
+	flags.Parse(args)
+
+	artifactor.SetVerificationCache(verificationCache)
+
+	if projectName == "" {
+		return verifyOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return verifyOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	urlPrefix, err := normalizeURLPrefix(urlPrefix)
+	if err != nil {
+		return verifyOptions{}, err
+	}
+
+	if objects && gcsPrefix == "" {
+		return verifyOptions{}, errInvalidOption{"-objects requires -gcs-prefix"}
+	}
+
+	if gcsPrefix != "" {
+		if !isStoragePrefix(gcsPrefix) {
+			return verifyOptions{}, errInvalidOption{"-gcs-prefix must start with gcs://, s3:// or https://"}
+		}
+
+		if !strings.HasSuffix(gcsPrefix, "/") {
+			gcsPrefix = gcsPrefix + "/"
+		}
+	}
+
+	trust, err := signers.policy()
+	if err != nil {
+		return verifyOptions{}, err
+	}
+
+	if err := storage.configure(); err != nil {
+		return verifyOptions{}, err
+	}
+
+	return verifyOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			UrlPrefix:   urlPrefix,
+			Version:     version,
+		},
+		dir:         dir,
+		objects:     objects,
+		concurrency: concurrency,
+		trust:       trust,
+		alerters:    parseAlerters(alertCommand, alertWebhook),
+	}, nil
+}
+
+// verify: verify a version's manifest against the trust policy, along with the
+// project root when its storage prefix is given, the stored objects of the
+// version with -objects, and a downloaded copy of the version when its
+// directory is given
+func verify(args []string) {
+	opts, err := parseVerifyFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project := artifactor.NewProject(&opts.Options)
+	if opts.GcsPrefix != "" {
+		if err := artifactor.VerifyRoot(project, opts.trust.Fingerprints); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	manifest, _, err := artifactor.FetchVerifiedManifest(project, opts.Version, opts.trust)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.objects {
+		if err := artifactor.VerifyObjects(manifest, opts.concurrency, opts.alerters); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if opts.dir != "" {
+		if err := artifactor.VerifyDirectory(manifest, opts.dir, opts.concurrency); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Println(fmt.Sprintf("verified version %s %s", opts.ProjectName, opts.Version))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+)
+
+type yankOptions struct {
+	artifactor.Options
+
+	yank      artifactor.Yank
+	notifiers []artifactor.Notifier
+}
+
+func parseYankFlags(args []string) (yankOptions, error) {
+	flags := flag.NewFlagSet("yank", flag.ExitOnError)
+
+	var projectName, gcsPrefix, urlPrefix, version, channel string
+	flags.StringVar(&projectName, "project", "", "-project top level project name")
+	flags.StringVar(&version, "version", "", "-version version to yank")
+	flags.StringVar(&channel, "channel", "", "-channel channel the version was published to, the stable project root by default")
+	flags.StringVar(&gcsPrefix, "gcs-prefix", "", "-gcs-prefix storage bucket address, gcs://bucket/, s3://bucket/ or an https:// url to PUT to")
+	flags.StringVar(&gcsPrefix, "storage-prefix", "", "-storage-prefix alias of -gcs-prefix")
+	flags.StringVar(&urlPrefix, "url-prefix", "", "-url-prefix for the public url used in the index and feeds")
+
+	var reason string
+	flags.StringVar(&reason, "reason", "", "-reason why the version was yanked, shown to anyone looking at it")
+
+	var smtpAddr, smtpFrom, smtpUsername string
+	var smtpTo stringsFlag
+	flags.StringVar(&smtpAddr, "smtp-addr", "", "-smtp-addr host:port of an smtp server to email notifications through")
+	flags.StringVar(&smtpFrom, "smtp-from", "", "-smtp-from address notifications are sent from")
+	flags.Var(&smtpTo, "smtp-to", "-smtp-to address to email notifications to, may be repeated")
+	flags.StringVar(&smtpUsername, "smtp-username", "", "-smtp-username username to authenticate with, the password is read from $ARTIFACTOR_SMTP_PASSWORD")
+
+	var alertCommand, alertWebhook string
+	flags.StringVar(&alertCommand, "alert-command", "", "-alert-command command run with the event as json on stdin once the version is yanked")
+	flags.StringVar(&alertWebhook, "alert-webhook", "", "-alert-webhook url the event is posted to as json once the version is yanked")
+
+	storage := storageFlags(flags)
+
+	var vaultSigningKey string
+	flags.StringVar(&vaultSigningKey, "vault-signing-key", "", "-vault-signing-key vault kv secret holding the armored gpg signing key, such as secret/data/artifactor/signing#private_key. Uses VAULT_ADDR and VAULT_TOKEN")
+
+	var actor string
+	flags.StringVar(&actor, "actor", defaultActor(), "-actor who is yanking the version, recorded with the reason")
+
+	flags.Parse(args)
+
+	if projectName == "" {
+		return yankOptions{}, errInvalidOption{"-project is required"}
+	}
+
+	if version == "" {
+		return yankOptions{}, errInvalidOption{"-version is required"}
+	}
+
+	if reason == "" {
+		return yankOptions{}, errInvalidOption{"-reason is required"}
+	}
+
+	gcsPrefix, urlPrefix, err := normalizePrefixes(gcsPrefix, urlPrefix)
+	if err != nil {
+		return yankOptions{}, err
+	}
+
+	notifiers, err := parseNotifiers(smtpAddr, smtpFrom, smtpTo, smtpUsername)
+	if err != nil {
+		return yankOptions{}, err
+	}
+
+	if err := storage.configure(); err != nil {
+		return yankOptions{}, err
+	}
+
+	if err := useVaultSigner(vaultSigningKey); err != nil {
+		return yankOptions{}, err
+	}
+
+	return yankOptions{
+		Options: artifactor.Options{
+			ProjectName: projectName,
+			GcsPrefix:   gcsPrefix,
+			UrlPrefix:   urlPrefix,
+			Version:     version,
+			Channel:     channel,
+		},
+		yank: artifactor.Yank{
+			Reason:    reason,
+			Timestamp: time.Now().UTC(),
+			Actor:     actor,
+		},
+		notifiers: append(notifiers, parseAlerters(alertCommand, alertWebhook)...),
+	}, nil
+}
+
+// yank: mark a published version as yanked, keeping its artifacts
+func yank(args []string) {
+	opts, err := parseYankFlags(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println(fmt.Sprintf("yanking version %s %s: %s", opts.ProjectName, opts.Version, opts.yank.Reason))
+
+	if err := artifactor.YankVersion(artifactor.NewProject(&opts.Options), opts.Version, opts.yank, opts.notifiers); err != nil {
+		log.Fatal(err)
+	}
+}
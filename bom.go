@@ -0,0 +1,65 @@
+package artifactor
+
+import (
+	"sort"
+)
+
+// BOMEntry: a distinct piece of content published by a project, with every
+// filepath and version it was published under
+type BOMEntry struct {
+	Sha256Checksum string   `json:"sha256_checksum"`
+	Bytes          int64    `json:"bytes"`
+	Filepaths      []string `json:"filepaths"`
+	Versions       []string `json:"versions"`
+}
+
+// BillOfMaterials: read the manifest of every version in the bucket, up to
+// concurrency at once, and aggregate their components into an inventory of
+// distinct content, keyed by sha256, listing the versions containing each.
+// Only components matching the filter are included
+func BillOfMaterials(project Project, filter ComponentFilter, concurrency int) ([]BOMEntry, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	manifests, err := listManifests(project, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	// versions are added oldest first, so each entry lists them in order
+	entries := make(map[string]*BOMEntry)
+	for _, manifest := range manifests {
+		for _, component := range manifest.Components {
+			if !filter.matches(component) {
+				continue
+			}
+
+			entry, ok := entries[component.Sha256Checksum]
+			if !ok {
+				entry = &BOMEntry{Sha256Checksum: component.Sha256Checksum, Bytes: component.Bytes}
+				entries[component.Sha256Checksum] = entry
+			}
+
+			if !containsString(entry.Filepaths, component.Filepath) {
+				entry.Filepaths = append(entry.Filepaths, component.Filepath)
+			}
+
+			if !containsString(entry.Versions, manifest.Version) {
+				entry.Versions = append(entry.Versions, manifest.Version)
+			}
+		}
+	}
+
+	bom := make([]BOMEntry, 0, len(entries))
+	for _, entry := range entries {
+		sort.Strings(entry.Filepaths)
+		bom = append(bom, *entry)
+	}
+
+	sort.Slice(bom, func(i, j int) bool {
+		return bom[i].Sha256Checksum < bom[j].Sha256Checksum
+	})
+
+	return bom, nil
+}
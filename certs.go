@@ -0,0 +1,100 @@
+package artifactor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// rootCAs: the certificates servers are verified against, the system's along
+// with those given to SetCACertificates, or nil for the system's alone
+var rootCAs *x509.CertPool
+
+// SetCACertificates: trust the pem encoded CA certificates in each path, a
+// file or a directory of them, in addition to the system's, such as the
+// internal CA an on-prem S3 compatible store, Artifactory or a webhook is
+// served with. Like SetProxy, they're set on http.DefaultTransport, and must
+// be set before any storage is opened. No paths goes back to the system's
+// certificates alone
+func SetCACertificates(paths ...string) error {
+	var pool *x509.CertPool
+	if len(paths) > 0 {
+		var err error
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		for _, path := range paths {
+			if err := appendCACertificates(pool, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	rootCAs = pool
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		configureTLS(transport)
+	}
+
+	return nil
+}
+
+// configureTLS: verify the servers a transport connects to against the
+// configured CA certificates, keeping the rest of its tls configuration
+func configureTLS(transport *http.Transport) {
+	config := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		config = transport.TLSClientConfig.Clone()
+	}
+
+	config.RootCAs = rootCAs
+	transport.TLSClientConfig = config
+}
+
+// appendCACertificates: add the certificates in a pem file, or in every file
+// of a directory, to the pool. Files in a directory which hold no
+// certificates are skipped, but the directory must hold some
+func appendCACertificates(pool *x509.CertPool, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	filepaths := []string{path}
+	if info.IsDir() {
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+
+		filepaths = filepaths[:0]
+		for _, info := range infos {
+			if !info.IsDir() {
+				filepaths = append(filepaths, filepath.Join(path, info.Name()))
+			}
+		}
+	}
+
+	found := false
+	for _, certFilepath := range filepaths {
+		pemBytes, err := ioutil.ReadFile(certFilepath)
+		if err != nil {
+			return err
+		}
+
+		if pool.AppendCertsFromPEM(pemBytes) {
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%s: no pem encoded certificates found", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package artifactor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// files written when publishing a zstd compressed copy of the manifest
+var compressedManifestFilepaths = []string{"manifest.json.zst", "manifest.json.zst.asc.sig"}
+
+// maximum size a compressed manifest may decompress to
+const maxManifestBytes = 1 << 30
+
+// writeCompressedManifest: write and sign a zstd compressed copy of a
+// manifest alongside it. Decompressing it gives back the exact bytes of the manifest, so
+// consumers can verify it against manifest.json's signature or bundle too
+func writeCompressedManifest(manifestFilepath string) error {
+	manifestBytes, err := ioutil.ReadFile(manifestFilepath)
+	if err != nil {
+		return err
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	if err != nil {
+		return err
+	}
+	defer encoder.Close()
+
+	dir := filepath.Dir(manifestFilepath)
+	compressedFilepath := filepath.Join(dir, compressedManifestFilepaths[0])
+	if err := ioutil.WriteFile(compressedFilepath, encoder.EncodeAll(manifestBytes, nil), 0644); err != nil {
+		return err
+	}
+
+	return createSigFile(compressedFilepath, filepath.Join(dir, compressedManifestFilepaths[1]))
+}
+
+// fetchManifestBytes: download a manifest from its public url, preferring its
+// compressed variant when the version has one. Returns the manifest, along
+// with the url and bytes of the file actually fetched, whose detached
+// signature is at its url with .asc.sig appended
+func fetchManifestBytes(manifestURL string) ([]byte, string, []byte, error) {
+	compressedURL := manifestURL + ".zst"
+
+	compressedBytes, found, err := fetchOptionalURL(compressedURL)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if !found {
+		manifestBytes, err := fetchURL(manifestURL)
+		return manifestBytes, manifestURL, manifestBytes, err
+	}
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxManifestBytes))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer decoder.Close()
+
+	manifestBytes, err := decoder.DecodeAll(compressedBytes, nil)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("%s: %v", compressedURL, err)
+	}
+
+	return manifestBytes, compressedURL, compressedBytes, nil
+}
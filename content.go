@@ -0,0 +1,262 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// number of components listed as the largest in a content report
+const contentReportLargest = 10
+
+// ContentRules: checks run against the components of a version before
+// anything is uploaded. Violations fail the publish
+type ContentRules struct {
+	// SuspiciousPatterns are glob patterns matched against component
+	// basenames, for files that should almost never be published
+	SuspiciousPatterns []string `json:"suspicious_patterns"`
+	FailOnSuspicious   bool     `json:"fail_on_suspicious"`
+	FailOnDuplicates   bool     `json:"fail_on_duplicates"`
+
+	// MaxComponentBytes, when set, is the largest component allowed
+	MaxComponentBytes int64 `json:"max_component_bytes"`
+
+	// ForbiddenMimeTypes are mime types, such as application/x-pem-file,
+	// which are not allowed in a version
+	ForbiddenMimeTypes []string `json:"forbidden_mime_types"`
+}
+
+// DefaultContentRules: rules which flag key material and other secrets, and
+// fail the publish if any are found
+func DefaultContentRules() ContentRules {
+	return ContentRules{
+		SuspiciousPatterns: []string{
+			"*.pem", "*.key", "*.p12", "*.pfx", "*.jks", "*.keystore", "*.kdbx",
+			"id_rsa*", "id_dsa*", "id_ecdsa*", "id_ed25519*",
+			".env", ".netrc", ".npmrc", ".pgpass", "*.gpg",
+		},
+		FailOnSuspicious:   true,
+		ForbiddenMimeTypes: make([]string, 0),
+	}
+}
+
+// LoadContentRules: read content rules from a json file
+func LoadContentRules(filepath string) (ContentRules, error) {
+	byts, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return ContentRules{}, err
+	}
+
+	var rules ContentRules
+	if err := json.Unmarshal(byts, &rules); err != nil {
+		return ContentRules{}, err
+	}
+
+	return rules, nil
+}
+
+// ContentEntry: a component as described in a content report
+type ContentEntry struct {
+	Filepath       string `json:"filepath"`
+	Bytes          int64  `json:"bytes"`
+	MimeType       string `json:"mime_type"`
+	Sha256Checksum string `json:"sha256_checksum"`
+}
+
+// ContentReport: a local report on the contents of a version, generated
+// before it is uploaded
+type ContentReport struct {
+	Components []ContentEntry `json:"components"`
+	Largest    []ContentEntry `json:"largest"`
+	Duplicates [][]string     `json:"duplicates"`
+	Suspicious []string       `json:"suspicious"`
+	Violations []string       `json:"violations"`
+}
+
+// NewContentReport: inspect the components of a version and check them
+// against the rules
+func NewContentReport(components []Component, rules ContentRules) (ContentReport, error) {
+	report := ContentReport{
+		Components: make([]ContentEntry, 0, len(components)),
+		Duplicates: make([][]string, 0),
+		Suspicious: make([]string, 0),
+		Violations: make([]string, 0),
+	}
+
+	for _, component := range components {
+		mimeType, err := sniffComponent(component)
+		if err != nil {
+			return ContentReport{}, err
+		}
+
+		suspicious, err := isSuspicious(component, rules.SuspiciousPatterns)
+		if err != nil {
+			return ContentReport{}, err
+		}
+
+		report.Components = append(report.Components, ContentEntry{
+			Filepath:       component.Filepath,
+			Bytes:          component.Bytes,
+			MimeType:       mimeType,
+			Sha256Checksum: component.Sha256Checksum,
+		})
+
+		if suspicious {
+			report.Suspicious = append(report.Suspicious, component.Filepath)
+			if rules.FailOnSuspicious {
+				report.Violations = append(report.Violations, fmt.Sprintf("%s: suspicious file", component.Filepath))
+			}
+		}
+
+		if rules.MaxComponentBytes > 0 && component.Bytes > rules.MaxComponentBytes {
+			report.Violations = append(report.Violations, fmt.Sprintf("%s: %d bytes exceeds the maximum of %d", component.Filepath, component.Bytes, rules.MaxComponentBytes))
+		}
+
+		for _, forbiddenMimeType := range rules.ForbiddenMimeTypes {
+			if strings.HasPrefix(mimeType, forbiddenMimeType) {
+				report.Violations = append(report.Violations, fmt.Sprintf("%s: forbidden mime type %s", component.Filepath, mimeType))
+			}
+		}
+	}
+
+	report.Duplicates = duplicateComponents(components)
+	if rules.FailOnDuplicates {
+		for _, duplicates := range report.Duplicates {
+			report.Violations = append(report.Violations, fmt.Sprintf("duplicate contents: %s", strings.Join(duplicates, ", ")))
+		}
+	}
+
+	report.Largest = append([]ContentEntry(nil), report.Components...)
+	sort.SliceStable(report.Largest, func(i, j int) bool {
+		return report.Largest[i].Bytes > report.Largest[j].Bytes
+	})
+	if len(report.Largest) > contentReportLargest {
+		report.Largest = report.Largest[:contentReportLargest]
+	}
+
+	return report, nil
+}
+
+// Err: an error describing every rule violation, if there were any
+func (c ContentReport) Err() error {
+	if len(c.Violations) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("content rules failed: %s", strings.Join(c.Violations, "; "))
+}
+
+func (c ContentReport) write(filepath string) error {
+	jsonBytes, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath, jsonBytes, 0644)
+}
+
+// duplicateComponents: group the filepaths of components with identical
+// contents, for every group with more than one member
+func duplicateComponents(components []Component) [][]string {
+	groups := make(map[string][]string)
+	order := make([]string, 0)
+	for _, component := range components {
+		if _, ok := groups[component.Sha256Checksum]; !ok {
+			order = append(order, component.Sha256Checksum)
+		}
+		groups[component.Sha256Checksum] = append(groups[component.Sha256Checksum], component.Filepath)
+	}
+
+	duplicates := make([][]string, 0)
+	for _, checksum := range order {
+		if len(groups[checksum]) > 1 {
+			duplicates = append(duplicates, groups[checksum])
+		}
+	}
+
+	return duplicates
+}
+
+// sniffComponent: detect a component's mime type from its contents, falling
+// back to its extension
+func sniffComponent(component Component) (string, error) {
+	file, err := component.openContents()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	mimeType := http.DetectContentType(header)
+	if strings.HasPrefix(mimeType, "application/octet-stream") || strings.HasPrefix(mimeType, "text/plain") {
+		if extensionType := mime.TypeByExtension(path.Ext(component.Filepath)); extensionType != "" {
+			mimeType = extensionType
+		}
+	}
+
+	return mimeType, nil
+}
+
+// isSuspicious: whether a component looks like key material, either by name
+// or by containing a pem encoded private key anywhere in its contents
+func isSuspicious(component Component, patterns []string) (bool, error) {
+	name := path.Base(component.Filepath)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true, nil
+		}
+	}
+
+	return containsPrivateKey(component)
+}
+
+// marks the end of a pem private key's begin line, such as -----BEGIN RSA
+// PRIVATE KEY-----
+var privateKeyMarker = []byte("PRIVATE KEY-----")
+
+// containsPrivateKey: scan a component's contents for a pem encoded private
+// key, checksumBufferSize bytes at a time. The end of each read is carried
+// into the next, so a marker split across reads is still found
+func containsPrivateKey(component Component) (bool, error) {
+	reader, err := component.openContents()
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+
+	buf := make([]byte, len(privateKeyMarker)-1+checksumBufferSize)
+	carried := 0
+	for {
+		n, err := reader.Read(buf[carried:])
+		window := buf[:carried+n]
+		if bytes.Contains(window, privateKeyMarker) {
+			return true, nil
+		}
+
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		carried = len(privateKeyMarker) - 1
+		if len(window) < carried {
+			carried = len(window)
+		}
+		copy(buf, window[len(window)-carried:])
+	}
+}
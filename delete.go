@@ -0,0 +1,199 @@
+package artifactor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+// DeleteVersion: delete a published version's components, manifests and
+// signatures, and remove it from the project index. A version still served by
+// an alias isn't deleted unless force is set. The given aliases are checked,
+// or when there are none every alias found by listing the project. pdbs laid
+// out for a symbol server are only deleted once no other version lists them.
+// manifest.json is deleted last, so a delete which fails part way can be run
+// again. Returns the paths deleted
+func DeleteVersion(project Project, version string, aliases []string, force bool) ([]string, error) {
+	if !force {
+		if err := checkUnaliased(project, version, aliases); err != nil {
+			return nil, err
+		}
+	}
+
+	versionPrefix := project.gcsPrefix + version + "/"
+	manifest, err := fetchManifest(versionPrefix + "manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", versionPrefix+"manifest.json", err)
+	}
+
+	symbolPaths, err := deletableSymbols(project, version, manifest.Symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	gcsPaths := make([]string, 0, len(manifest.Components)+len(symbolPaths)+len(managedFilepaths))
+	for _, component := range manifest.Components {
+		gcsPaths = append(gcsPaths, component.GCSFilepath)
+	}
+	gcsPaths = append(gcsPaths, symbolPaths...)
+
+	filepaths := append([]string{sigstoreBundleFilepath, yankedSigstoreBundleFilepath}, compressedManifestFilepaths...)
+	filepaths = append(filepaths, manifestIndexFilepaths...)
+	filepaths = append(filepaths, advisoryFilepaths...)
+	filepaths = append(filepaths, yankFilepaths...)
+	filepaths = append(filepaths, dsymIndexFilepaths...)
+	indexBytes, _, err := fetchObject(versionPrefix + manifestIndexFilepaths[0])
+	if err != nil && err != storage.ErrObjectNotExist {
+		return nil, err
+	}
+	if err == nil {
+		var index ManifestIndex
+		if err := json.Unmarshal(indexBytes, &index); err != nil {
+			return nil, err
+		}
+
+		for _, shard := range index.Shards {
+			filepaths = append(filepaths, shard.Filepath)
+		}
+	}
+
+	// manifest.json is left for last
+	for _, filepath := range managedFilepaths {
+		if filepath != "manifest.json" {
+			filepaths = append(filepaths, filepath)
+		}
+	}
+	for _, filepath := range filepaths {
+		gcsPaths = append(gcsPaths, versionPrefix+filepath)
+	}
+
+	deleted, err := deleteObjects(gcsPaths)
+	if err != nil {
+		return deleted, err
+	}
+
+	if err := removeFromIndex(project, version); err != nil {
+		return deleted, err
+	}
+
+	manifestDeleted, err := deleteObjects([]string{versionPrefix + "manifest.json"})
+	return append(deleted, manifestDeleted...), err
+}
+
+// checkUnaliased: error if any of the aliases, or when there are none any
+// alias listed in the project, serves the version
+func checkUnaliased(project Project, version string, aliases []string) error {
+	if len(aliases) == 0 {
+		listed, err := listAliases(project, DefaultConcurrency)
+		if err != nil {
+			return fmt.Errorf("listing aliases: %v", err)
+		}
+
+		for alias, aliasVersion := range listed {
+			if aliasVersion == version {
+				aliases = append(aliases, alias)
+			}
+		}
+		sort.Strings(aliases)
+	}
+
+	for _, alias := range aliases {
+		aliased, err := aliasServes(project, alias, version)
+		if err != nil {
+			return err
+		}
+
+		if aliased {
+			return fmt.Errorf("%s %s is still served by the %s alias", project.name, version, alias)
+		}
+	}
+
+	return nil
+}
+
+// aliasServes: whether an alias currently serves the version, either through
+// its copied manifest or its pointer
+func aliasServes(project Project, alias string, version string) (bool, error) {
+	aliasVersion, found, err := aliasTarget(project, alias)
+	return found && aliasVersion == version, err
+}
+
+// aliasTarget: the version an alias currently serves, either through its
+// copied manifest or its pointer, and false when there is no such alias. A
+// version's own directory is reported as serving itself
+func aliasTarget(project Project, alias string) (string, bool, error) {
+	aliasPrefix := project.gcsPrefix + alias + "/"
+
+	byts, _, err := fetchObject(aliasPrefix + aliasPointerFilepaths[0])
+	if err != nil && err != storage.ErrObjectNotExist {
+		return "", false, err
+	}
+	if err == nil {
+		var pointer AliasPointer
+		if err := json.Unmarshal(byts, &pointer); err != nil {
+			return "", false, err
+		}
+
+		return pointer.Version, true, nil
+	}
+
+	manifest, err := fetchManifest(aliasPrefix + "manifest.json")
+	if err == storage.ErrObjectNotExist {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return manifest.Version, true, nil
+}
+
+// deleteObjects: delete every object concurrently, skipping those which
+// don't exist. Returns the paths deleted
+func deleteObjects(gcsPaths []string) ([]string, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(gcsPaths))
+	deletedCh := make(chan string, len(gcsPaths))
+
+	for _, gcsPath := range gcsPaths {
+		wg.Add(1)
+
+		go func(gcsPath string) {
+			defer wg.Done()
+
+			err := store.Delete(ctx, gcsPath, storage.Conditions{})
+			switch {
+			case err == nil:
+				deletedCh <- gcsPath
+			case err != storage.ErrObjectNotExist:
+				errCh <- fmt.Errorf("%s: %v", gcsPath, err)
+			}
+		}(gcsPath)
+	}
+
+	wg.Wait()
+	close(deletedCh)
+
+	deleted := make([]string, 0, len(deletedCh))
+	for gcsPath := range deletedCh {
+		deleted = append(deleted, gcsPath)
+	}
+
+	select {
+	case err := <-errCh:
+		return deleted, err
+	default:
+	}
+
+	return deleted, nil
+}
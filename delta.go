@@ -0,0 +1,65 @@
+package artifactor
+
+import "fmt"
+
+// componentCopy: a component whose contents are already stored in the bucket
+// at src, and only need to be copied to the component's own location
+type componentCopy struct {
+	src string
+	dst Component
+}
+
+// deltaComponents: partition components into those that need to be uploaded,
+// and those that are byte-identical to a component in the previous manifest
+// and can be copied server side instead
+func deltaComponents(previous ComponentManifest, components []Component) ([]Component, []componentCopy) {
+	previousComponents := make(map[string]Component, len(previous.Components))
+	for _, component := range previous.Components {
+		previousComponents[component.Filepath] = component
+	}
+
+	uploads := make([]Component, 0, len(components))
+	copies := make([]componentCopy, 0)
+
+	for _, component := range components {
+		previousComponent, ok := previousComponents[component.Filepath]
+		if !ok || previousComponent.Bytes != component.Bytes || previousComponent.Sha256Checksum != component.Sha256Checksum || previousComponent.Sha512Checksum != component.Sha512Checksum {
+			uploads = append(uploads, component)
+			continue
+		}
+
+		copies = append(copies, componentCopy{
+			src: previousComponent.GCSFilepath,
+			dst: component,
+		})
+	}
+
+	return uploads, copies
+}
+
+// dedupeComponents: partition components so that only the first component
+// with any given contents is uploaded, and the others are copied from it
+// server side once it has been
+func dedupeComponents(components []Component) ([]Component, []componentCopy) {
+	firstComponents := make(map[string]Component, len(components))
+	uploads := make([]Component, 0, len(components))
+	copies := make([]componentCopy, 0)
+
+	for _, component := range components {
+		key := fmt.Sprintf("%d:%s:%s", component.Bytes, component.Sha256Checksum, component.Sha512Checksum)
+
+		firstComponent, ok := firstComponents[key]
+		if !ok {
+			firstComponents[key] = component
+			uploads = append(uploads, component)
+			continue
+		}
+
+		copies = append(copies, componentCopy{
+			src: firstComponent.GCSFilepath,
+			dst: component,
+		})
+	}
+
+	return uploads, copies
+}
@@ -0,0 +1,241 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// operating systems and architectures recognized in component filenames, such
+// as artifactor_linux_amd64
+var (
+	platformOSes   = []string{"darwin", "linux", "windows", "freebsd", "openbsd", "netbsd", "android", "ios"}
+	platformArches = []string{"386", "amd64", "arm", "arm64", "ppc64", "ppc64le", "mips", "mipsle", "mips64", "mips64le", "s390x", "riscv64"}
+)
+
+// ComponentChange: a component present in both versions of a diff
+type ComponentChange struct {
+	Filepath       string `json:"filepath"`
+	FromBytes      int64  `json:"from_bytes"`
+	ToBytes        int64  `json:"to_bytes"`
+	ByteDelta      int64  `json:"byte_delta"`
+	FromSha256     string `json:"from_sha256_checksum"`
+	ToSha256       string `json:"to_sha256_checksum"`
+	ContentChanged bool   `json:"content_changed"`
+}
+
+// ManifestDiff: the differences between the components of two versions of a
+// project, structured so it can be consumed by release notes tooling
+type ManifestDiff struct {
+	Project          string            `json:"project"`
+	FromVersion      string            `json:"from_version"`
+	ToVersion        string            `json:"to_version"`
+	Added            []Component       `json:"added"`
+	Removed          []Component       `json:"removed"`
+	Changed          []ComponentChange `json:"changed"`
+	Unchanged        []ComponentChange `json:"unchanged"`
+	NewPlatforms     []string          `json:"new_platforms"`
+	RemovedPlatforms []string          `json:"removed_platforms"`
+	ByteDelta        int64             `json:"byte_delta"`
+}
+
+// DiffManifests: compare the components of two manifests by filepath, size
+// and checksum
+func DiffManifests(from, to ComponentManifest) ManifestDiff {
+	diff := ManifestDiff{
+		Project:          to.Project,
+		FromVersion:      from.Version,
+		ToVersion:        to.Version,
+		Added:            make([]Component, 0),
+		Removed:          make([]Component, 0),
+		Changed:          make([]ComponentChange, 0),
+		Unchanged:        make([]ComponentChange, 0),
+		NewPlatforms:     make([]string, 0),
+		RemovedPlatforms: make([]string, 0),
+	}
+
+	fromComponents := make(map[string]Component, len(from.Components))
+	for _, component := range from.Components {
+		fromComponents[component.Filepath] = component
+	}
+
+	toComponents := make(map[string]Component, len(to.Components))
+	for _, component := range to.Components {
+		toComponents[component.Filepath] = component
+	}
+
+	for _, component := range to.Components {
+		diff.ByteDelta += component.Bytes
+
+		fromComponent, ok := fromComponents[component.Filepath]
+		if !ok {
+			diff.Added = append(diff.Added, component)
+			continue
+		}
+
+		change := ComponentChange{
+			Filepath:       component.Filepath,
+			FromBytes:      fromComponent.Bytes,
+			ToBytes:        component.Bytes,
+			ByteDelta:      component.Bytes - fromComponent.Bytes,
+			FromSha256:     fromComponent.Sha256Checksum,
+			ToSha256:       component.Sha256Checksum,
+			ContentChanged: fromComponent.Sha256Checksum != component.Sha256Checksum || fromComponent.Sha512Checksum != component.Sha512Checksum,
+		}
+
+		if change.ContentChanged {
+			diff.Changed = append(diff.Changed, change)
+		} else {
+			diff.Unchanged = append(diff.Unchanged, change)
+		}
+	}
+
+	for _, component := range from.Components {
+		diff.ByteDelta -= component.Bytes
+
+		if _, ok := toComponents[component.Filepath]; !ok {
+			diff.Removed = append(diff.Removed, component)
+		}
+	}
+
+	fromPlatforms := manifestPlatforms(from)
+	toPlatforms := manifestPlatforms(to)
+	for platform := range toPlatforms {
+		if !fromPlatforms[platform] {
+			diff.NewPlatforms = append(diff.NewPlatforms, platform)
+		}
+	}
+	for platform := range fromPlatforms {
+		if !toPlatforms[platform] {
+			diff.RemovedPlatforms = append(diff.RemovedPlatforms, platform)
+		}
+	}
+	sort.Strings(diff.NewPlatforms)
+	sort.Strings(diff.RemovedPlatforms)
+
+	return diff
+}
+
+// JSON: render the diff as an indented json document
+func (d ManifestDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// Markdown: render the diff as a changelog fragment suitable for including in
+// release notes
+func (d ManifestDiff) Markdown() []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "## %s %s\n\n", d.Project, d.ToVersion)
+	fmt.Fprintf(&buf, "Changes since %s (%s total).\n", d.FromVersion, formatByteDelta(d.ByteDelta))
+
+	if len(d.NewPlatforms) > 0 {
+		fmt.Fprintf(&buf, "\n### New platforms\n\n")
+		for _, platform := range d.NewPlatforms {
+			fmt.Fprintf(&buf, "- `%s`\n", platform)
+		}
+	}
+
+	if len(d.RemovedPlatforms) > 0 {
+		fmt.Fprintf(&buf, "\n### Removed platforms\n\n")
+		for _, platform := range d.RemovedPlatforms {
+			fmt.Fprintf(&buf, "- `%s`\n", platform)
+		}
+	}
+
+	if len(d.Added) > 0 {
+		fmt.Fprintf(&buf, "\n### Added\n\n")
+		for _, component := range d.Added {
+			fmt.Fprintf(&buf, "- `%s` (%d bytes)\n", component.Filepath, component.Bytes)
+		}
+	}
+
+	if len(d.Changed) > 0 {
+		fmt.Fprintf(&buf, "\n### Changed\n\n")
+		fmt.Fprintf(&buf, "| component | size | delta |\n")
+		fmt.Fprintf(&buf, "|---|---|---|\n")
+		for _, change := range d.Changed {
+			fmt.Fprintf(&buf, "| `%s` | %d bytes | %s |\n", change.Filepath, change.ToBytes, formatByteDelta(change.ByteDelta))
+		}
+	}
+
+	if len(d.Removed) > 0 {
+		fmt.Fprintf(&buf, "\n### Removed\n\n")
+		for _, component := range d.Removed {
+			fmt.Fprintf(&buf, "- `%s`\n", component.Filepath)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// write: save the diff to a file, as markdown if the filepath ends in .md and
+// as json otherwise
+func (d ManifestDiff) write(filepath string) error {
+	if path.Ext(filepath) == ".md" {
+		return ioutil.WriteFile(filepath, d.Markdown(), 0644)
+	}
+
+	jsonBytes, err := d.JSON()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath, jsonBytes, 0644)
+}
+
+// manifestPlatforms: the set of os/arch platforms found in a manifest's
+// component filenames
+func manifestPlatforms(manifest ComponentManifest) map[string]bool {
+	platforms := make(map[string]bool)
+	for _, component := range manifest.Components {
+		if platform := componentPlatform(component.Filepath); platform != "" {
+			platforms[platform] = true
+		}
+	}
+
+	return platforms
+}
+
+// componentPlatform: parse the os/arch platform out of a filename such as
+// artifactor_darwin_amd64.tar.gz, returning an empty string if there isn't one
+func componentPlatform(filepath string) string {
+	name := path.Base(filepath)
+	if idx := strings.Index(name, "."); idx > 0 {
+		name = name[:idx]
+	}
+
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-'
+	})
+
+	for idx := 0; idx < len(parts)-1; idx++ {
+		if containsString(platformOSes, parts[idx]) && containsString(platformArches, parts[idx+1]) {
+			return parts[idx] + "/" + parts[idx+1]
+		}
+	}
+
+	return ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatByteDelta(delta int64) string {
+	if delta >= 0 {
+		return fmt.Sprintf("+%d bytes", delta)
+	}
+
+	return fmt.Sprintf("%d bytes", delta)
+}
@@ -0,0 +1,293 @@
+package artifactor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// DoctorCheck: the outcome of one of the checks made before a publish. Detail
+// describes what was found when the check passed, and Err why it failed
+type DoctorCheck struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+// doctorProbe: a named check, returning what it found or why it failed
+type doctorProbe struct {
+	name  string
+	check func() (string, error)
+}
+
+// Doctor: check the environment a publish of the version would run in,
+// without publishing anything, so that a locked gpg-agent or missing bucket
+// permission is found before any components are hashed and signed rather than
+// halfway through. Every check is made, even once one has failed
+func Doctor(project Project, opts *Options) []DoctorCheck {
+	versionGCSPrefix := project.gcsPrefix + opts.Version + "/"
+
+	checks := []doctorProbe{
+		{"source", func() (string, error) { return checkSource(project, opts) }},
+		{"scratch", checkScratchDir},
+		{"signing", checkSigning},
+		{"storage", func() (string, error) { return checkWritable(project.gcsPrefix, "publicRead") }},
+		{"version", func() (string, error) { return checkVersionUnoccupied(versionGCSPrefix, opts.Force) }},
+	}
+
+	if opts.SymbolsPrefix != "" {
+		symbolsGCSPrefix := opts.SymbolsPrefix + strings.TrimPrefix(project.gcsPrefix, opts.GcsPrefix)
+		checks = append(checks, doctorProbe{"symbols", func() (string, error) { return checkWritable(symbolsGCSPrefix, symbolsACL(opts)) }})
+	}
+
+	results := make([]DoctorCheck, 0, len(checks))
+	for _, check := range checks {
+		detail, err := check.check()
+		results = append(results, DoctorCheck{Name: check.name, Detail: detail, Err: err})
+	}
+
+	return results
+}
+
+// checkSource: the archive or directory the version is published from holds
+// components, or every required part has been staged. A stream can't be
+// checked without consuming it
+func checkSource(project Project, opts *Options) (string, error) {
+	if opts.Staged {
+		return checkStaged(project, opts)
+	}
+
+	if opts.Stream != nil {
+		return fmt.Sprintf("%s is read from the stream once publishing starts", opts.StreamName), nil
+	}
+
+	if opts.Input != "" {
+		return checkSourceArchive(opts.Input)
+	}
+
+	return checkSourceDir(opts.Dir)
+}
+
+// checkStaged: every required part has been staged for the version, without
+// conflicting with the others
+func checkStaged(project Project, opts *Options) (string, error) {
+	components, err := stagedComponents(project, opts.Version, opts.RequiredParts, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	parts, err := ListStagedParts(project, opts.Version)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		names = append(names, part.Part)
+	}
+
+	return fmt.Sprintf("%d components staged by %s", len(components), strings.Join(names, ", ")), nil
+}
+
+// checkSourceArchive: the archive holds at least one component, and can be
+// read to the end
+func checkSourceArchive(archive string) (string, error) {
+	if !isInputArchive(archive) {
+		return "", fmt.Errorf("%s: not a .tar, .tar.gz, .tgz or .zip archive", archive)
+	}
+
+	components := 0
+	skipped := make([]string, 0)
+	err := walkArchive(archive, func(name string, reader io.Reader) error {
+		if isManagedFilepath(name) {
+			skipped = append(skipped, name)
+			return nil
+		}
+
+		components++
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if components == 0 {
+		return "", fmt.Errorf("%s: no components found", archive)
+	}
+
+	detail := fmt.Sprintf("%d components in %s", components, archive)
+	if len(skipped) > 0 {
+		detail += fmt.Sprintf(", skipping %s which artifactor writes itself", strings.Join(skipped, ", "))
+	}
+
+	return detail, nil
+}
+
+// checkSourceDir: the directory holds at least one component, and every file
+// in it can be read
+func checkSourceDir(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s: not a directory", dir)
+	}
+
+	components := 0
+	skipped := make([]string, 0)
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relpath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if isManagedFilepath(relpath) {
+			skipped = append(skipped, relpath)
+			return nil
+		}
+
+		// opening each file catches unreadable files and broken symlinks
+		// without hashing anything
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		file.Close()
+
+		components++
+		return nil
+	}
+
+	if err := filepath.Walk(dir, walkFn); err != nil {
+		return "", err
+	}
+
+	if components == 0 {
+		return "", fmt.Errorf("%s: no components found", dir)
+	}
+
+	detail := fmt.Sprintf("%d components in %s", components, dir)
+	if len(skipped) > 0 {
+		detail += fmt.Sprintf(", skipping %s which artifactor writes itself", strings.Join(skipped, ", "))
+	}
+
+	return detail, nil
+}
+
+// checkScratchDir: intermediate files can be written to the scratch directory
+func checkScratchDir() (string, error) {
+	tmpDir, err := newScratchDir("artifactor-doctor")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "probe"), []byte("artifactor"), 0644); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("wrote to %s", filepath.Dir(tmpDir)), nil
+}
+
+// checkSigning: the signer can sign a probe file, and verify the signature it
+// made
+func checkSigning() (string, error) {
+	if _, ok := currentSigner().(gpgSigner); ok {
+		if _, err := exec.LookPath("gpg"); err != nil {
+			return "", err
+		}
+	}
+
+	fingerprints, err := signingFingerprints()
+	if err != nil {
+		return "", fmt.Errorf("signing a probe file: %v", err)
+	}
+
+	if len(fingerprints) == 0 {
+		return "", fmt.Errorf("the probe file was signed, but its signature didn't verify")
+	}
+
+	return fmt.Sprintf("signed with %s", strings.Join(fingerprints, ", ")), nil
+}
+
+// checkWritable: an object can be written beneath the prefix with the acl a
+// publish would use, and deleted again. This checks both the credentials and
+// the permissions they're granted
+func checkWritable(gcsPrefix, predefinedACL string) (string, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	probePath := fmt.Sprintf("%s.artifactor-doctor-%d", gcsPrefix, time.Now().UnixNano())
+	attrs, err := store.Write(ctx, probePath, []byte("artifactor"), storage.ObjectAttrs{
+		CacheControl:  "no-store",
+		PredefinedACL: predefinedACL,
+	}, storage.Conditions{DoesNotExist: true})
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", probePath, err)
+	}
+
+	if err := store.Delete(ctx, probePath, storage.Conditions{GenerationMatch: attrs.Generation}); err != nil {
+		return "", fmt.Errorf("%s: written, but not deleted: %v", probePath, err)
+	}
+
+	return fmt.Sprintf("wrote and deleted %s", probePath), nil
+}
+
+// checkVersionUnoccupied: nothing has been published to the version's prefix,
+// neither its manifest nor objects left behind by a publish which failed
+// partway, since the publish won't overwrite either unless forced
+func checkVersionUnoccupied(versionGCSPrefix string, force bool) (string, error) {
+	if force {
+		return fmt.Sprintf("%s may be republished, since the publish is forced", versionGCSPrefix), nil
+	}
+
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = store.Attrs(ctx, versionGCSPrefix+managedFilepaths[0])
+	if err == nil {
+		return "", fmt.Errorf("%s: already published", versionGCSPrefix)
+	}
+	if err != storage.ErrObjectNotExist {
+		return "", err
+	}
+
+	// http storage can't be listed, so only the manifest can be checked
+	objects, err := store.ListObjects(ctx, versionGCSPrefix)
+	if err != nil {
+		return fmt.Sprintf("%s has no manifest, its objects couldn't be listed: %v", versionGCSPrefix, err), nil
+	}
+
+	if len(objects) > 0 {
+		return "", fmt.Errorf("%s: %d objects already exist, such as %s", versionGCSPrefix, len(objects), objects[0])
+	}
+
+	return fmt.Sprintf("%s is empty", versionGCSPrefix), nil
+}
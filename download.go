@@ -0,0 +1,421 @@
+package artifactor
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultConcurrency: the number of components fetched or hashed at once
+const DefaultConcurrency = 8
+
+// DownloadVersion: download every component of a published version into
+// dest, fetching up to concurrency components at once and verifying each
+// against the checksums in the manifest as it is written. Components which are already present
+// and verified are skipped, and partially downloaded components are resumed,
+// so an interrupted download can simply be run again. The compressed
+// manifest.json.zst is fetched when the version has one. The manifest is
+// verified against the trust policy, which checks nothing beyond the
+// checksums when it is empty. Only the components matching the filter are
+// downloaded, though the whole manifest is verified and saved. With extract
+// set, archives are extracted where they were downloaded once every component
+// has been verified
+func DownloadVersion(project Project, version string, dest string, concurrency int, trust TrustPolicy, filter ComponentFilter, extract bool) (ComponentManifest, error) {
+	manifestURL := project.urlPrefix + version + "/manifest.json"
+
+	manifestBytes, fetchedURL, fetchedBytes, err := fetchManifestBytes(manifestURL)
+	if err != nil {
+		return ComponentManifest{}, err
+	}
+
+	if err := trust.verifyManifest(manifestURL, manifestBytes, fetchedURL, fetchedBytes); err != nil {
+		return ComponentManifest{}, err
+	}
+
+	var manifest ComponentManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return ComponentManifest{}, err
+	}
+
+	components, err := filter.filter(manifest.Components)
+	if err != nil {
+		return ComponentManifest{}, fmt.Errorf("%s %s: %v", project.name, version, err)
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return ComponentManifest{}, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dest, "manifest.json"), manifestBytes, 0644); err != nil {
+		return ComponentManifest{}, err
+	}
+
+	err = forEachComponent(components, concurrency, func(component Component) error {
+		return downloadComponent(component, dest)
+	})
+	if err != nil {
+		return ComponentManifest{}, err
+	}
+
+	if extract {
+		if err := extractComponents(components, dest, concurrency); err != nil {
+			return ComponentManifest{}, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// VerifyDirectory: hash up to concurrency components at once and confirm that
+// every component in the manifest is present in dir with matching checksums
+func VerifyDirectory(manifest ComponentManifest, dir string, concurrency int) error {
+	return forEachComponent(manifest.Components, concurrency, func(component Component) error {
+		target, err := componentTarget(dir, component)
+		if err != nil {
+			return err
+		}
+
+		return verifyComponentFileCached(target, component)
+	})
+}
+
+// forEachComponent: call fn for every component, running at most concurrency
+// calls at once, and returning the first error
+func forEachComponent(components []Component, concurrency int, fn func(Component) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(components))
+	sem := make(chan struct{}, concurrency)
+
+	for _, component := range components {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(component Component) {
+			if err := fn(component); err != nil {
+				errCh <- err
+			}
+
+			<-sem
+			wg.Done()
+		}(component)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+	}
+
+	return nil
+}
+
+// downloadComponent: download a component into dest, resuming from a previous
+// partial download when one exists, and verifying it as it's written
+func downloadComponent(component Component, dest string) error {
+	target, err := componentTarget(dest, component)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(target); err == nil && info.Size() == component.Bytes {
+		if verifyComponentFileCached(target, component) == nil {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	partial := target + ".part"
+	offset := int64(0)
+	if info, err := os.Stat(partial); err == nil && info.Size() < component.Bytes {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest("GET", component.URL, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+	default:
+		return fmt.Errorf("%s: unexpected status %s", component.URL, resp.Status)
+	}
+
+	// each object is hashed as it's written, with the bytes of a resumed
+	// download hashed first, so the file is never read back to verify it
+	hashes := newChecksumHashes()
+	hashed := hashWriter(hashes)
+	size := int64(0)
+	if flags&os.O_APPEND != 0 {
+		size, err = hashFile(partial, hashed)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(io.MultiWriter(file, hashed), resp.Body)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := matchChecksums(component, sumHashes(hashes), size+written); err != nil {
+		os.Remove(partial)
+		return err
+	}
+
+	if err := os.Rename(partial, target); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(target); err == nil {
+		cacheVerified(fileCachePath(target, component), verifiedFile{Bytes: info.Size(), ModTime: info.ModTime()})
+	}
+
+	return nil
+}
+
+// componentTarget: the local path of a component within dir, refusing any
+// component filepath which would escape it
+func componentTarget(dir string, component Component) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(component.Filepath))
+
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(component.Filepath) {
+		return "", fmt.Errorf("%s: component filepath escapes %s", component.Filepath, dir)
+	}
+
+	return target, nil
+}
+
+// verifyComponentFile: confirm a local file matches the size and checksums of
+// a component
+func verifyComponentFile(path string, component Component) error {
+	checksums, size, err := fileChecksums(path)
+	if err != nil {
+		return err
+	}
+
+	return matchChecksums(component, checksums, size)
+}
+
+// matchChecksums: confirm a size and the md5, sha256, sha384 and sha512
+// checksums match those of a component
+func matchChecksums(component Component, checksums []string, size int64) error {
+	if size != component.Bytes {
+		return fmt.Errorf("%s: expected %d bytes, found %d", component.Filepath, component.Bytes, size)
+	}
+
+	expected := []string{component.Md5Checksum, component.Sha256Checksum, component.Sha384Checksum, component.Sha512Checksum}
+	for idx, checksum := range checksums {
+		if expected[idx] != "" && expected[idx] != checksum {
+			return fmt.Errorf("%s: checksum mismatch, expected %s found %s", component.Filepath, expected[idx], checksum)
+		}
+	}
+
+	return nil
+}
+
+// newChecksumHashes: a hash for every checksum recorded for a component
+func newChecksumHashes() []hash.Hash {
+	return []hash.Hash{
+		md5.New(),
+		sha256.New(),
+		sha512.New384(),
+		sha512.New512_256(),
+	}
+}
+
+// hashWriter: a writer feeding every hash at once
+func hashWriter(hashes []hash.Hash) io.Writer {
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+
+	return io.MultiWriter(writers...)
+}
+
+// sumHashes: the hex encoded sums of the hashes
+func sumHashes(hashes []hash.Hash) []string {
+	checksums := make([]string, len(hashes))
+	for idx, h := range hashes {
+		checksums[idx] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+
+	return checksums
+}
+
+// hashFile: stream a file into w, returning its size
+func hashFile(path string, w io.Writer) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return io.Copy(w, file)
+}
+
+// fileChecksums: stream a file through every checksum recorded for a
+// component in a single pass, returning the md5, sha256, sha384 and sha512
+// checksums along with the file's size
+func fileChecksums(path string) ([]string, int64, error) {
+	hashes := newChecksumHashes()
+
+	size, err := hashFile(path, hashWriter(hashes))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return sumHashes(hashes), size, nil
+}
+
+// fetchURL: download the contents of a url
+func fetchURL(url string) ([]byte, error) {
+	resp, err := httpClient().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// fetchOptionalURL: download the contents of a url, returning false rather
+// than an error when it doesn't exist
+func fetchOptionalURL(url string) ([]byte, bool, error) {
+	resp, err := httpClient().Get(url)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	// public buckets which can't be listed answer 403 for missing objects
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+		return nil, false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+
+	byts, err := ioutil.ReadAll(resp.Body)
+	return byts, err == nil, err
+}
+
+// FetchVerifiedManifest: download a version's manifest.json and its detached
+// signature from their public urls, and verify the signature. When the version
+// has a manifest.json.zst, it and its own signature are fetched instead. The
+// signature, and the manifest's sigstore bundle when the policy names any
+// sigstore identities, are verified against the trust policy
+func FetchVerifiedManifest(project Project, version string, trust TrustPolicy) (ComponentManifest, []byte, error) {
+	manifestURL := project.urlPrefix + version + "/manifest.json"
+
+	manifestBytes, fetchedURL, fetchedBytes, err := fetchManifestBytes(manifestURL)
+	if err != nil {
+		return ComponentManifest{}, nil, err
+	}
+
+	if err := trust.verifyManifest(manifestURL, manifestBytes, fetchedURL, fetchedBytes); err != nil {
+		return ComponentManifest{}, nil, err
+	}
+
+	var manifest ComponentManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return ComponentManifest{}, nil, err
+	}
+
+	return manifest, manifestBytes, nil
+}
+
+// GetComponent: download a single component of a version into dest, verifying
+// it against the checksums of the signature verified manifest. Versions with a
+// sharded manifest are looked up through its index, unless the trust policy
+// requires a sigstore identity, as only manifest.json carries a sigstore bundle.
+// With extract set, an archive is extracted once it has been verified
+func GetComponent(project Project, version string, componentFilepath string, dest string, trust TrustPolicy, extract bool) (Component, error) {
+	if len(trust.SigstoreIdentities) == 0 {
+		component, found, err := fetchShardedComponent(project.urlPrefix+version+"/", componentFilepath, trust)
+		if err != nil {
+			return Component{}, err
+		}
+
+		if found {
+			return component, getComponent(component, dest, extract)
+		}
+	}
+
+	manifest, _, err := FetchVerifiedManifest(project, version, trust)
+	if err != nil {
+		return Component{}, err
+	}
+
+	for _, component := range manifest.Components {
+		if component.Filepath != componentFilepath {
+			continue
+		}
+
+		return component, getComponent(component, dest, extract)
+	}
+
+	return Component{}, fmt.Errorf("%s: no component %s in version %s", project.name, componentFilepath, version)
+}
+
+// getComponent: download and verify a single component, extracting it when
+// asked to
+func getComponent(component Component, dest string, extract bool) error {
+	if err := downloadComponent(component, dest); err != nil {
+		return err
+	}
+
+	if !extract {
+		return nil
+	}
+
+	return extractComponents([]Component{component}, dest, 1)
+}
@@ -0,0 +1,379 @@
+package artifactor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"debug/macho"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var dsymIndexFilepaths = []string{"dsyms.json", "dsyms.json.asc.sig"}
+
+// the load command holding the uuid of a mach-o file
+const machoLoadCmdUUID = 0x1b
+
+// DSYM: the debug symbols of one architecture of a binary, found in a dSYM
+// bundle among a version's components. Member is the symbol file's path
+// within the component when the component is an archive of the bundle
+type DSYM struct {
+	UUID        string `json:"uuid"`
+	Arch        string `json:"arch"`
+	Filepath    string `json:"filepath"`
+	Member      string `json:"member,omitempty"`
+	GCSFilepath string `json:"gcs_filepath"`
+	URL         string `json:"url"`
+}
+
+// DSYMIndex: the dSYMs of a version by build uuid, so that crash symbolication
+// services can find the symbols for a crash report without downloading every
+// bundle
+type DSYMIndex struct {
+	Project string `json:"project"`
+	Version string `json:"version"`
+	DSYMs   []DSYM `json:"dsyms"`
+}
+
+// NewDSYMIndex: index the dSYMs among the components, whether published as
+// .dSYM.zip or .dSYM.tar.gz archives or as the files of a .dSYM directory
+func NewDSYMIndex(project, version string, components []Component) (DSYMIndex, error) {
+	index := DSYMIndex{Project: project, Version: version, DSYMs: make([]DSYM, 0)}
+
+	for _, component := range components {
+		err := readDSYMFiles(component, func(member string, byts []byte) error {
+			uuids, err := machoUUIDs(byts)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path.Join(component.Filepath, member), err)
+			}
+
+			for _, uuid := range uuids {
+				uuid.Filepath = component.Filepath
+				uuid.Member = member
+				uuid.GCSFilepath = component.GCSFilepath
+				uuid.URL = component.URL
+				index.DSYMs = append(index.DSYMs, uuid)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return DSYMIndex{}, err
+		}
+	}
+
+	return index, nil
+}
+
+// writeDSYMIndex: write and sign the dSYM index of a version to a directory
+func writeDSYMIndex(dir string, index DSYMIndex) error {
+	jsonBytes, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	indexFilepath := filepath.Join(dir, dsymIndexFilepaths[0])
+	if err := ioutil.WriteFile(indexFilepath, jsonBytes, 0644); err != nil {
+		return err
+	}
+
+	return createSigFile(indexFilepath, filepath.Join(dir, dsymIndexFilepaths[1]))
+}
+
+// isDWARFFilepath: whether a path is the symbol file within a dSYM bundle,
+// such as Foo.app.dSYM/Contents/Resources/DWARF/Foo
+func isDWARFFilepath(path string) bool {
+	return strings.Contains(strings.ToLower(path), ".dsym/contents/resources/dwarf/") && !strings.HasSuffix(path, "/")
+}
+
+// dsymBundle: the path of the .dSYM directory a path is within
+func dsymBundle(path string) string {
+	idx := strings.Index(strings.ToLower(path), ".dsym/")
+	if idx < 0 {
+		return ""
+	}
+
+	return path[:idx+len(".dsym")]
+}
+
+// readDSYMFiles: call fn with each symbol file a component holds, along with
+// its path within the component when it's an archive
+func readDSYMFiles(component Component, fn func(member string, byts []byte) error) error {
+	switch {
+	case isDWARFFilepath(component.Filepath):
+		byts, err := component.readContents()
+		if err != nil {
+			return err
+		}
+		return fn("", byts)
+
+	case strings.HasSuffix(strings.ToLower(component.Filepath), ".dsym.zip"):
+		byts, err := component.readContents()
+		if err != nil {
+			return err
+		}
+
+		reader, err := zip.NewReader(bytes.NewReader(byts), int64(len(byts)))
+		if err != nil {
+			return fmt.Errorf("%s: %v", component.Filepath, err)
+		}
+
+		for _, file := range reader.File {
+			if !isDWARFFilepath(file.Name) {
+				continue
+			}
+
+			fileReader, err := file.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %v", component.Filepath, err)
+			}
+			byts, err := ioutil.ReadAll(fileReader)
+			fileReader.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %v", component.Filepath, err)
+			}
+
+			if err := fn(file.Name, byts); err != nil {
+				return err
+			}
+		}
+
+	case strings.HasSuffix(strings.ToLower(component.Filepath), ".dsym.tar.gz"):
+		file, err := component.openContents()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", component.Filepath, err)
+		}
+
+		reader := tar.NewReader(gzipReader)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %v", component.Filepath, err)
+			}
+
+			if header.Typeflag != tar.TypeReg || !isDWARFFilepath(header.Name) {
+				continue
+			}
+
+			byts, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return fmt.Errorf("%s: %v", component.Filepath, err)
+			}
+
+			if err := fn(strings.TrimPrefix(header.Name, "./"), byts); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// machoUUIDs: the uuid and architecture of each slice of a mach-o file,
+// which may be a universal binary
+func machoUUIDs(byts []byte) ([]DSYM, error) {
+	files := make([]*macho.File, 0)
+	if fat, err := macho.NewFatFile(bytes.NewReader(byts)); err == nil {
+		for _, arch := range fat.Arches {
+			files = append(files, arch.File)
+		}
+	} else {
+		file, err := macho.NewFile(bytes.NewReader(byts))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	uuids := make([]DSYM, 0, len(files))
+	for _, file := range files {
+		for _, load := range file.Loads {
+			raw := load.Raw()
+			if len(raw) < 24 || file.ByteOrder.Uint32(raw[0:4]) != machoLoadCmdUUID {
+				continue
+			}
+
+			id := raw[8:24]
+			uuids = append(uuids, DSYM{
+				UUID: fmt.Sprintf("%X-%X-%X-%X-%X", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]),
+				Arch: machoArch(file.Cpu),
+			})
+		}
+	}
+
+	if len(uuids) == 0 {
+		return nil, fmt.Errorf("no uuid found")
+	}
+
+	return uuids, nil
+}
+
+// machoArch: the name apple's tools give a cpu type
+func machoArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.Cpu386:
+		return "i386"
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.CpuArm:
+		return "armv7"
+	case macho.CpuArm64:
+		return "arm64"
+	}
+
+	return strings.ToLower(strings.TrimPrefix(cpu.String(), "Cpu"))
+}
+
+// dsymArchives: a zip of each dSYM bundle among the components, as symbol
+// uploaders take them. .dSYM.zip components are used as they are, while
+// .dSYM.tar.gz archives and the files of .dSYM directories are zipped into dir
+func dsymArchives(dir string, components []Component) ([]string, error) {
+	archives := make([]string, 0)
+	bundles := make(map[string][]Component)
+	bundleOrder := make([]string, 0)
+
+	for _, component := range components {
+		lower := strings.ToLower(component.Filepath)
+
+		switch {
+		case strings.HasSuffix(lower, ".dsym.zip"):
+			archive := component.contentsFilepath()
+			if !component.hasLocalFile() {
+				archive = filepath.Join(dir, fmt.Sprintf("%d-%s", len(archives), path.Base(component.Filepath)))
+				if err := component.writeContents(archive); err != nil {
+					return nil, fmt.Errorf("%s: %v", component.Filepath, err)
+				}
+			}
+			archives = append(archives, archive)
+
+		case strings.HasSuffix(lower, ".dsym.tar.gz"):
+			archive := filepath.Join(dir, fmt.Sprintf("%d-%s.zip", len(archives), strings.TrimSuffix(path.Base(component.Filepath), ".tar.gz")))
+			if err := zipTarGz(component, archive); err != nil {
+				return nil, fmt.Errorf("%s: %v", component.Filepath, err)
+			}
+			archives = append(archives, archive)
+
+		case dsymBundle(component.Filepath) != "":
+			bundle := dsymBundle(component.Filepath)
+			if _, ok := bundles[bundle]; !ok {
+				bundleOrder = append(bundleOrder, bundle)
+			}
+			bundles[bundle] = append(bundles[bundle], component)
+		}
+	}
+
+	// bundles are zipped from the directory holding them, so the zip holds
+	// the Foo.app.dSYM directory itself
+	for _, bundle := range bundleOrder {
+		archive := filepath.Join(dir, fmt.Sprintf("%d-%s.zip", len(archives), path.Base(bundle)))
+		parent := path.Dir(bundle) + "/"
+
+		members := make(map[string]Component, len(bundles[bundle]))
+		for _, component := range bundles[bundle] {
+			members[strings.TrimPrefix(component.Filepath, parent)] = component
+		}
+
+		if err := writeZip(archive, members); err != nil {
+			return nil, fmt.Errorf("%s: %v", bundle, err)
+		}
+		archives = append(archives, archive)
+	}
+
+	return archives, nil
+}
+
+// zipTarGz: repackage the regular files of a .tar.gz component as a zip
+func zipTarGz(src Component, dst string) error {
+	file, err := src.openContents()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := zip.NewWriter(out)
+	reader := tar.NewReader(gzipReader)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		memberWriter, err := writer.Create(strings.TrimPrefix(header.Name, "./"))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(memberWriter, reader); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// writeZip: write a zip holding the contents of each member component
+func writeZip(dst string, members map[string]Component) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writer := zip.NewWriter(out)
+	for _, name := range names {
+		byts, err := members[name].readContents()
+		if err != nil {
+			return err
+		}
+
+		memberWriter, err := writer.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := memberWriter.Write(byts); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,282 @@
+package artifactor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archive extensions which are extracted when downloading with extract set
+var extractableExtensions = []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz", ".tar.zst", ".tzst", ".zip"}
+
+// isExtractable: whether a component is an archive artifactor can extract
+func isExtractable(componentFilepath string) bool {
+	for _, extension := range extractableExtensions {
+		if strings.HasSuffix(componentFilepath, extension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// extractComponents: extract every archive among the downloaded components
+// into the directory it was downloaded to
+func extractComponents(components []Component, dest string, concurrency int) error {
+	archives := make([]Component, 0, len(components))
+	for _, component := range components {
+		if isExtractable(component.Filepath) {
+			archives = append(archives, component)
+		}
+	}
+
+	return forEachComponent(archives, concurrency, func(component Component) error {
+		target, err := componentTarget(dest, component)
+		if err != nil {
+			return err
+		}
+
+		if err := extractArchive(target, filepath.Dir(target)); err != nil {
+			return fmt.Errorf("%s: %v", component.Filepath, err)
+		}
+
+		return nil
+	})
+}
+
+// extractArchive: extract a tar or zip archive into dir, restoring the
+// permissions recorded for each file. Entries whose paths or link targets
+// would land outside of dir are refused
+func extractArchive(archive string, dir string) error {
+	if strings.HasSuffix(archive, ".zip") {
+		return extractZip(archive, dir)
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	switch {
+	case strings.HasSuffix(archive, ".gz"), strings.HasSuffix(archive, ".tgz"):
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	case strings.HasSuffix(archive, ".bz2"), strings.HasSuffix(archive, ".tbz"):
+		reader = bzip2.NewReader(file)
+	case strings.HasSuffix(archive, ".zst"), strings.HasSuffix(archive, ".tzst"):
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+
+		reader = decoder
+	}
+
+	return extractTar(tar.NewReader(reader), dir)
+}
+
+func extractTar(reader *tar.Reader, dir string) error {
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := extractTarget(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+
+			if err := os.Chmod(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := extractFile(target, reader, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := extractSymlink(dir, target, header.Linkname); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := extractTarget(dir, header.Linkname)
+			if err != nil {
+				return err
+			}
+
+			os.Remove(target)
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: unsupported entry type %q", header.Name, header.Typeflag)
+		}
+	}
+}
+
+func extractZip(archive string, dir string) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		target, err := extractTarget(dir, file.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()|0700); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			linkname, err := readZipFile(file)
+			if err != nil {
+				return err
+			}
+
+			if err := extractSymlink(dir, target, linkname); err != nil {
+				return err
+			}
+		default:
+			contents, err := file.Open()
+			if err != nil {
+				return err
+			}
+
+			err = extractFile(target, contents, mode.Perm())
+			contents.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func readZipFile(file *zip.File) (string, error) {
+	contents, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer contents.Close()
+
+	var builder strings.Builder
+	if _, err := io.Copy(&builder, contents); err != nil {
+		return "", err
+	}
+
+	return builder.String(), nil
+}
+
+// extractTarget: where an archive entry is extracted to, refusing absolute
+// paths, paths which climb out of dir, and paths beneath a symlink, which
+// could otherwise be chained to escape dir
+func extractTarget(dir string, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("%s: archive entry has an absolute path", name)
+	}
+
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: archive entry escapes %s", name, dir)
+	}
+
+	parent := dir
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		parent = filepath.Join(parent, part)
+
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%s: archive entry is beneath the symlink %s", name, parent)
+		}
+	}
+
+	return target, nil
+}
+
+// extractFile: write an archive entry with the recorded permissions, replacing
+// whatever was there. Replacing rather than truncating means an existing
+// symlink is never written through
+func extractFile(target string, reader io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	os.Remove(target)
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode|0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// the umask applied when creating the file is undone
+	return os.Chmod(target, mode)
+}
+
+// extractSymlink: create a relative symlink whose target stays inside dir
+func extractSymlink(dir string, target string, linkname string) error {
+	if filepath.IsAbs(linkname) {
+		return fmt.Errorf("%s: symlink to absolute path %s", target, linkname)
+	}
+
+	rel, err := filepath.Rel(dir, filepath.Join(filepath.Dir(target), filepath.FromSlash(linkname)))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s: symlink to %s escapes %s", target, linkname, dir)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	os.Remove(target)
+	return os.Symlink(linkname, target)
+}
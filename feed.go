@@ -0,0 +1,194 @@
+package artifactor
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// number of most recent versions included in a feed
+const feedEntries = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Rights  string      `xml:"rights,omitempty"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	URI   string `xml:"uri,omitempty"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+// recentVersions: the most recently published versions in an index, newest
+// first
+func recentVersions(index ProjectIndex) []IndexVersion {
+	versions := make([]IndexVersion, 0, feedEntries)
+	for idx := len(index.Versions) - 1; idx >= 0 && len(versions) < feedEntries; idx-- {
+		versions = append(versions, index.Versions[idx])
+	}
+
+	return versions
+}
+
+// feedSummary: the summary of a version in a feed, followed by why it was
+// yanked and any advisories attached to it since it was published
+func feedSummary(version IndexVersion) string {
+	summary := version.Summary
+	if version.Yanked != nil {
+		summary = summary + "\n\nYanked: " + version.Yanked.Reason
+	}
+
+	if len(version.Advisories) == 0 {
+		return summary
+	}
+
+	return summary + "\n\n" + advisoriesSummary(version.Advisories)
+}
+
+// writeAtomFeed: write an atom feed of the most recent versions in the index
+func writeAtomFeed(project Project, index ProjectIndex, filepath string) error {
+	feedURL := project.urlPrefix + filepath
+	feed := atomFeed{
+		ID:      feedURL,
+		Title:   project.name + " releases",
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: project.name},
+		Links: []atomLink{
+			{Href: feedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: project.urlPrefix, Rel: "alternate"},
+		},
+		Entries: make([]atomEntry, 0, feedEntries),
+	}
+
+	if index.License != "" {
+		feed.Rights = "License: " + index.License
+	}
+	if index.Homepage != "" {
+		feed.Author.URI = index.Homepage
+	}
+	if supportURL := index.SupportURL(); strings.HasPrefix(supportURL, "mailto:") {
+		feed.Author.Email = index.Support
+	}
+	if index.DocumentationURL != "" {
+		feed.Links = append(feed.Links, atomLink{Href: index.DocumentationURL, Rel: "related", Type: "text/html"})
+	}
+
+	for idx, version := range recentVersions(index) {
+		updated := version.Timestamp.UTC().Format(time.RFC3339)
+		if idx == 0 {
+			feed.Updated = updated
+		}
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      version.ManifestURL,
+			Title:   project.name + " " + version.Version,
+			Updated: updated,
+			Links: []atomLink{
+				{Href: project.urlPrefix + version.Version + "/", Rel: "alternate"},
+				{Href: version.ManifestURL, Rel: "related", Type: "application/json"},
+			},
+			Summary: feedSummary(version),
+		})
+	}
+
+	xmlBytes, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath, append([]byte(xml.Header), xmlBytes...), 0644)
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+type jsonFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+}
+
+// writeJSONFeed: write a json feed (https://jsonfeed.org) of the most recent
+// versions in the index
+func writeJSONFeed(project Project, index ProjectIndex, filepath string) error {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       project.name + " releases",
+		HomePageURL: project.urlPrefix,
+		FeedURL:     project.urlPrefix + filepath,
+		Items:       make([]jsonFeedItem, 0, feedEntries),
+	}
+
+	// the feed links to the project's homepage when it has one, rather than
+	// the directory its artifacts are published to
+	if index.Homepage != "" {
+		feed.HomePageURL = index.Homepage
+	}
+	if supportURL := index.SupportURL(); supportURL != "" {
+		feed.Authors = []jsonFeedAuthor{{Name: project.name, URL: supportURL}}
+	}
+
+	for _, version := range recentVersions(index) {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            version.ManifestURL,
+			URL:           project.urlPrefix + version.Version + "/",
+			Title:         project.name + " " + version.Version,
+			ContentText:   feedSummary(version),
+			Summary:       feedSummary(version),
+			DatePublished: version.Timestamp.UTC().Format(time.RFC3339),
+			Attachments: []jsonFeedAttachment{
+				{URL: version.ManifestURL, MimeType: "application/json"},
+			},
+		})
+	}
+
+	jsonBytes, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath, jsonBytes, 0644)
+}
@@ -0,0 +1,168 @@
+package artifactor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// GarbageReport: the orphaned objects and expired versions collecting a
+// project's garbage deleted, or would have. Recent lists orphans which were
+// left alone because they were written too recently
+type GarbageReport struct {
+	Orphaned []string `json:"orphaned"`
+	Expired  []string `json:"expired"`
+	Recent   []string `json:"recent"`
+}
+
+// CollectGarbage: delete the orphaned objects beneath a project which no
+// manifest or alias references, such as those left by publishes which failed
+// part way, along with expired versions no alias serves. Orphans written less
+// than minAge ago are left alone, since they may belong to a publish still in
+// progress, and each is only deleted if it hasn't been rewritten since it was
+// found. With dryRun set nothing is deleted
+func CollectGarbage(project Project, minAge time.Duration, dryRun bool, concurrency int) (GarbageReport, error) {
+	report := GarbageReport{Orphaned: make([]string, 0), Expired: make([]string, 0), Recent: make([]string, 0)}
+
+	manifests, err := listManifests(project, concurrency)
+	if err != nil {
+		return report, err
+	}
+
+	aliases, err := listAliases(project, concurrency)
+	if err != nil {
+		return report, err
+	}
+
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	objects, err := store.ListObjects(ctx, project.gcsPrefix)
+	if err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	generations, recent, err := orphanGenerations(orphanedObjects(project, manifests, aliases, objects), now.Add(-minAge), concurrency)
+	if err != nil {
+		return report, err
+	}
+
+	for gcsPath := range generations {
+		report.Orphaned = append(report.Orphaned, gcsPath)
+	}
+	sort.Strings(report.Orphaned)
+	report.Recent = recent
+
+	served := make(map[string]bool, len(aliases))
+	aliasNames := make([]string, 0, len(aliases))
+	for alias, version := range aliases {
+		served[version] = true
+		aliasNames = append(aliasNames, alias)
+	}
+	sort.Strings(aliasNames)
+
+	for _, manifest := range manifests {
+		if manifest.Expired(now) && !served[manifest.Version] {
+			report.Expired = append(report.Expired, manifest.Version)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	// only what was actually deleted is reported from here on
+	collected := GarbageReport{Orphaned: make([]string, 0, len(report.Orphaned)), Expired: make([]string, 0, len(report.Expired)), Recent: report.Recent}
+	for _, gcsPath := range report.Orphaned {
+		err := store.Delete(ctx, gcsPath, storage.Conditions{GenerationMatch: generations[gcsPath]})
+		if err != nil && err != storage.ErrObjectNotExist {
+			return collected, fmt.Errorf("%s: %v", gcsPath, err)
+		}
+
+		collected.Orphaned = append(collected.Orphaned, gcsPath)
+	}
+
+	// the aliases are checked again as each version is deleted, in case one
+	// was pointed at it since they were listed
+	for _, version := range report.Expired {
+		if _, err := DeleteVersion(project, version, aliasNames, false); err != nil {
+			return collected, fmt.Errorf("%s: %v", version, err)
+		}
+
+		collected.Expired = append(collected.Expired, version)
+	}
+
+	return collected, nil
+}
+
+// orphanGenerations: the generation of each orphan last written before the
+// cutoff, and the paths of those written since, stat'ing up to concurrency
+// at once. Orphans deleted in the meantime are left out of both
+func orphanGenerations(orphans []string, cutoff time.Time, concurrency int) (map[string]int64, []string, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	errCh := make(chan error, len(orphans))
+	semaphore := make(chan struct{}, concurrency)
+
+	generations := make(map[string]int64, len(orphans))
+	recent := make([]string, 0)
+
+	for _, gcsPath := range orphans {
+		wg.Add(1)
+
+		go func(gcsPath string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			attrs, err := store.Attrs(ctx, gcsPath)
+			if err == storage.ErrObjectNotExist {
+				return
+			}
+			if err != nil {
+				errCh <- fmt.Errorf("%s: %v", gcsPath, err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if attrs.Updated.After(cutoff) {
+				recent = append(recent, gcsPath)
+				return
+			}
+
+			generations[gcsPath] = attrs.Generation
+		}(gcsPath)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return nil, nil, err
+	default:
+	}
+
+	sort.Strings(recent)
+	return generations, recent, nil
+}
@@ -0,0 +1,82 @@
+package artifactor
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+// fetchGenerations: look up the current generation of each object, recording
+// a generation of 0 for objects that do not exist yet. Up to
+// DefaultConcurrency objects are looked up at once
+func fetchGenerations(gcsPaths []string) (map[string]int64, error) {
+	generations := make(map[string]int64, len(gcsPaths))
+	if len(gcsPaths) == 0 {
+		return generations, nil
+	}
+
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(gcsPaths))
+	sem := make(chan struct{}, DefaultConcurrency)
+
+	for _, gcsPath := range gcsPaths {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(gcsPath string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			generation := int64(0)
+
+			attrs, err := store.Attrs(ctx, gcsPath)
+			switch {
+			case err == storage.ErrObjectNotExist:
+			case err != nil:
+				errCh <- err
+				return
+			default:
+				generation = attrs.Generation
+			}
+
+			mu.Lock()
+			generations[gcsPath] = generation
+			mu.Unlock()
+		}(gcsPath)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	return generations, nil
+}
+
+// conditions: guard writes to an object with the generation it was observed
+// at, so a concurrent publisher can't be silently overwritten. A generation of
+// 0 requires that the object does not exist yet, and objects without a
+// recorded generation are written unconditionally
+func conditions(gcsPath string, generations map[string]int64) storage.Conditions {
+	generation, ok := generations[gcsPath]
+	if !ok {
+		return storage.Conditions{}
+	}
+
+	if generation == 0 {
+		return storage.Conditions{DoesNotExist: true}
+	}
+
+	return storage.Conditions{GenerationMatch: generation}
+}
@@ -0,0 +1,200 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// gitHubRelease: the fields of a GitHub release used when mirroring a version
+type gitHubRelease struct {
+	ID        int64  `json:"id"`
+	UploadURL string `json:"upload_url"`
+	HTMLURL   string `json:"html_url"`
+	Assets    []struct {
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	} `json:"assets"`
+}
+
+// gitHubAPIURL: the GitHub api, or the GitHub Enterprise api the current
+// actions run belongs to
+func gitHubAPIURL() string {
+	if apiURL := os.Getenv("GITHUB_API_URL"); apiURL != "" {
+		return strings.TrimSuffix(apiURL, "/")
+	}
+
+	return "https://api.github.com"
+}
+
+// gitHubAssetName: the release asset name of a component. Assets can't be in
+// directories, so the separators of its path are replaced with _
+func gitHubAssetName(filepath string) string {
+	return strings.Replace(filepath, "/", "_", -1)
+}
+
+// mirrorGitHubRelease: create a GitHub release of the version in the
+// repository, or reuse the one already tagged with it, and attach every
+// component to it. Assets the release already has are left alone, so a
+// publish can be retried
+func mirrorGitHubRelease(repository string, opts *Options, components []Component) (string, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return "", fmt.Errorf("GITHUB_TOKEN is required to create a github release")
+	}
+
+	names := make(map[string]string, len(components))
+	for _, component := range components {
+		name := gitHubAssetName(component.Filepath)
+		if other, ok := names[name]; ok {
+			return "", fmt.Errorf("%s and %s would both be attached to the github release as %s", other, component.Filepath, name)
+		}
+		names[name] = component.Filepath
+	}
+
+	release, err := createGitHubRelease(repository, token, opts)
+	if err != nil {
+		return "", err
+	}
+
+	existing := make(map[string]int64, len(release.Assets))
+	for _, asset := range release.Assets {
+		existing[asset.Name] = asset.Size
+	}
+
+	uploadURL := release.UploadURL
+	if idx := strings.Index(uploadURL, "{"); idx >= 0 {
+		uploadURL = uploadURL[:idx]
+	}
+
+	uploads := make([]Component, 0, len(components))
+	for _, component := range components {
+		name := gitHubAssetName(component.Filepath)
+		size, ok := existing[name]
+		if !ok {
+			uploads = append(uploads, component)
+		} else if size != component.Bytes {
+			return "", fmt.Errorf("%s: release asset %s already exists with a different size", repository, name)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(uploads))
+
+	for _, component := range uploads {
+		name := gitHubAssetName(component.Filepath)
+		wg.Add(1)
+
+		go func(component Component, name string) {
+			defer wg.Done()
+
+			if err := uploadGitHubAsset(uploadURL, token, name, component); err != nil {
+				errCh <- err
+			}
+		}(component, name)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return "", err
+	default:
+	}
+
+	return release.HTMLURL, nil
+}
+
+// createGitHubRelease: create the release of the version, marking it a
+// prerelease when it was published to a channel, or fetch the existing one
+func createGitHubRelease(repository, token string, opts *Options) (gitHubRelease, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"tag_name":         opts.Version,
+		"target_commitish": os.Getenv("GITHUB_SHA"),
+		"name":             opts.Version,
+		"body":             opts.ReleaseNotes,
+		"prerelease":       opts.Channel != "",
+	})
+	if err != nil {
+		return gitHubRelease{}, err
+	}
+
+	var release gitHubRelease
+	status, err := gitHubRequest("POST", gitHubAPIURL()+"/repos/"+repository+"/releases", token, "application/json", bytes.NewReader(body), int64(len(body)), &release)
+	if err != nil {
+		return gitHubRelease{}, err
+	}
+
+	switch status {
+	case http.StatusCreated:
+		return release, nil
+	case http.StatusUnprocessableEntity:
+		// the release already exists
+	default:
+		return gitHubRelease{}, fmt.Errorf("%s: creating release %s: unexpected status %d", repository, opts.Version, status)
+	}
+
+	status, err = gitHubRequest("GET", gitHubAPIURL()+"/repos/"+repository+"/releases/tags/"+url.PathEscape(opts.Version), token, "", nil, 0, &release)
+	if err != nil {
+		return gitHubRelease{}, err
+	}
+	if status != http.StatusOK {
+		return gitHubRelease{}, fmt.Errorf("%s: fetching release %s: unexpected status %d", repository, opts.Version, status)
+	}
+
+	return release, nil
+}
+
+// uploadGitHubAsset: attach a component to a release
+func uploadGitHubAsset(uploadURL, token, name string, component Component) error {
+	fh, err := component.openContents()
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	status, err := gitHubRequest("POST", uploadURL+"?name="+url.QueryEscape(name), token, "application/octet-stream", fh, component.Bytes, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("%s: uploading release asset: unexpected status %d", component.Filepath, status)
+	}
+
+	return nil
+}
+
+// gitHubRequest: make an authenticated request to the GitHub api, decoding
+// successful responses into v when it is set
+func gitHubRequest(method, requestURL, token, contentType string, body io.Reader, size int64, v interface{}) (int, error) {
+	req, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if v != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return 0, fmt.Errorf("%s: %v", requestURL, err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,176 @@
+package artifactor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	modzip "golang.org/x/mod/zip"
+)
+
+// goModuleInfo: the contents of a version's .info file in the GOPROXY protocol
+type goModuleInfo struct {
+	Version string
+	Time    time.Time
+}
+
+// goModulePrefix: where a module's GOPROXY files live under the project, so
+// that the project prefix can be used as a GOPROXY origin
+func goModulePrefix(modulePath string) (string, error) {
+	escapedPath, err := module.EscapePath(modulePath)
+	if err != nil {
+		return "", err
+	}
+
+	return escapedPath + "/@v/", nil
+}
+
+// publishGoModule: publish the module in moduleDir as the version's .info,
+// .mod and .zip files in GOPROXY layout, then add the version to the
+// module's @v/list
+func publishGoModule(project Project, modulePath, moduleDir, version string, ts time.Time) ([]PublishedObject, error) {
+	if err := module.Check(modulePath, version); err != nil {
+		return nil, err
+	}
+
+	modulePrefix, err := goModulePrefix(modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := newScratchDir("artifactor-gomodule")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	infoBytes, err := json.Marshal(goModuleInfo{Version: version, Time: ts.UTC()})
+	if err != nil {
+		return nil, err
+	}
+
+	modBytes, err := ioutil.ReadFile(filepath.Join(moduleDir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		escapedVersion + ".info": infoBytes,
+		escapedVersion + ".mod":  modBytes,
+	}
+	for filename, byts := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, filename), byts, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	zipFile, err := os.Create(filepath.Join(tmpDir, escapedVersion+".zip"))
+	if err != nil {
+		return nil, err
+	}
+	err = modzip.CreateFromDir(zipFile, module.Version{Path: modulePath, Version: version}, moduleDir)
+	zipFile.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	components := make([]Component, 0, 3)
+	for _, extension := range []string{".info", ".mod", ".zip"} {
+		component, err := newTempComponent(tmpDir, escapedVersion+extension, project.gcsPrefix+modulePrefix, project.urlPrefix+modulePrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, component)
+	}
+
+	// a published module version is immutable, so its files must not exist
+	generations := make(map[string]int64, len(components))
+	for _, component := range components {
+		generations[component.GCSFilepath] = 0
+	}
+
+	objects, err := uploadComponents(project.gcsPrefix, components, generations, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		var listObjects []PublishedObject
+
+		listObjects, err = tryUpdateGoModuleList(project, modulePrefix, tmpDir, version)
+		if err == nil {
+			return append(objects, retried(listObjects, attempt)...), nil
+		}
+
+		if !isPreconditionFailed(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// tryUpdateGoModuleList: add a version to the module's @v/list, guarded by the
+// generation the list was read at
+func tryUpdateGoModuleList(project Project, modulePrefix, tmpDir, version string) ([]PublishedObject, error) {
+	listGCSPath := project.gcsPrefix + modulePrefix + "list"
+
+	byts, generation, err := fetchObject(listGCSPath)
+	if err == storage.ErrObjectNotExist {
+		byts, generation, err = nil, 0, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{version}
+	for _, line := range strings.Split(string(byts), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && line != version {
+			versions = append(versions, line)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) < 0
+	})
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "list"), []byte(strings.Join(versions, "\n")+"\n"), 0644); err != nil {
+		return nil, err
+	}
+
+	component, err := newTempComponent(tmpDir, "list", project.gcsPrefix+modulePrefix, project.urlPrefix+modulePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploadComponents(project.gcsPrefix, []Component{component}, map[string]int64{listGCSPath: generation}, false)
+}
+
+// newTempComponent: create a component for a file written outside of the
+// version's directory, naming it relative to that directory
+func newTempComponent(dir, filename, gcsPrefix, urlPrefix string) (Component, error) {
+	component, err := NewComponent(path.Join(dir, filename), "", "")
+	if err != nil {
+		return Component{}, err
+	}
+
+	component.Filepath = filename
+	component.GCSFilepath = gcsPrefix + filename
+	component.URL = urlPrefix + filename
+	component.localFilepath = path.Join(dir, filename)
+	return component, nil
+}
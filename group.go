@@ -0,0 +1,157 @@
+package artifactor
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ComponentGroup: a named group of the components matching a pattern, such
+// as binaries for bin/*, recorded in the manifest so consumers can fetch just
+// the group
+type ComponentGroup struct {
+	Name    string
+	Pattern string
+}
+
+// ComponentFilter: the components of a version to download. Components must
+// match any of the patterns, when there are any, belong to any of the groups,
+// when there are any, and have any of the roles, when there are any. An empty
+// filter matches every component
+type ComponentFilter struct {
+	Patterns []string
+	Groups   []string
+	Roles    []string
+}
+
+// matchesFilepath: whether a glob pattern matches a component filepath, its
+// base name, or any of its directories, so that linux/* matches every
+// component under linux/amd64/
+func matchesFilepath(pattern string, filepath string) bool {
+	if matched, _ := path.Match(pattern, path.Base(filepath)); matched {
+		return true
+	}
+
+	for dir := filepath; dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+		if matched, _ := path.Match(pattern, dir); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate: check every pattern is a valid glob
+func (f ComponentFilter) validate() error {
+	for _, pattern := range f.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%s: %v", pattern, err)
+		}
+	}
+
+	for _, role := range f.Roles {
+		if !isRole(role) {
+			return fmt.Errorf("unknown role %s, expected one of %s", role, strings.Join(Roles, ", "))
+		}
+	}
+
+	return nil
+}
+
+func (f ComponentFilter) matches(component Component) bool {
+	if len(f.Patterns) > 0 {
+		matched := false
+		for _, pattern := range f.Patterns {
+			matched = matched || matchesFilepath(pattern, component.Filepath)
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	if len(f.Groups) > 0 {
+		matched := false
+		for _, group := range f.Groups {
+			for _, componentGroup := range component.Groups {
+				matched = matched || group == componentGroup
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	if len(f.Roles) > 0 {
+		matched := false
+		for _, role := range f.Roles {
+			matched = matched || role == component.Role
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filter: the components matching the filter, failing when none do so that a
+// mistyped pattern doesn't look like a successful download
+func (f ComponentFilter) filter(components []Component) ([]Component, error) {
+	if len(f.Patterns) == 0 && len(f.Groups) == 0 && len(f.Roles) == 0 {
+		return components, nil
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	filtered := make([]Component, 0, len(components))
+	for _, component := range components {
+		if f.matches(component) {
+			filtered = append(filtered, component)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no components match %v in groups %v with roles %v", f.Patterns, f.Groups, f.Roles)
+	}
+
+	return filtered, nil
+}
+
+// groupComponents: return a copy of the components listing the groups each
+// belongs to
+func groupComponents(components []Component, groups []ComponentGroup) ([]Component, error) {
+	for _, group := range groups {
+		if group.Name == "" {
+			return nil, fmt.Errorf("group with pattern %s has no name", group.Pattern)
+		}
+		if _, err := path.Match(group.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("group %s: %s: %v", group.Name, group.Pattern, err)
+		}
+	}
+
+	grouped := make([]Component, 0, len(components))
+	for _, component := range components {
+		names := make(map[string]bool)
+		for _, group := range groups {
+			if matchesFilepath(group.Pattern, component.Filepath) {
+				names[group.Name] = true
+			}
+		}
+
+		component.Groups = nil
+		for name := range names {
+			component.Groups = append(component.Groups, name)
+		}
+		sort.Strings(component.Groups)
+
+		grouped = append(grouped, component)
+	}
+
+	return grouped, nil
+}
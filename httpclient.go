@@ -0,0 +1,78 @@
+package artifactor
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+var (
+	httpClientMu     sync.Mutex
+	customHTTPClient *http.Client
+)
+
+// SetHTTPClient: make every request to storage backends, signers, notifiers,
+// symbol uploaders and registries with client, such as one presenting a
+// client certificate, trusting a private CA or wrapping its transport in
+// tracing middleware. Google Cloud Storage requests are authenticated on top
+// of the client's transport, and proxies and CA certificates are left to it
+// rather than SetProxy and SetCACertificates. A nil client goes back to http.DefaultClient. Storage opened
+// before the client is set keeps the one it was opened with
+func SetHTTPClient(client *http.Client) {
+	httpClientMu.Lock()
+	customHTTPClient = client
+	httpClientMu.Unlock()
+}
+
+// httpClient: the client requests are made with, http.DefaultClient unless
+// SetHTTPClient has been given one
+func httpClient() *http.Client {
+	if client := injectedHTTPClient(); client != nil {
+		return client
+	}
+
+	return http.DefaultClient
+}
+
+// injectedHTTPClient: the client given to SetHTTPClient, or nil
+func injectedHTTPClient() *http.Client {
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+
+	return customHTTPClient
+}
+
+// newGCSClient: a Google Cloud Storage client with the options. With a client
+// set by SetHTTPClient, its transport is wrapped with the authentication the
+// options give, since the storage client doesn't authenticate a client it's
+// handed itself
+func newGCSClient(ctx context.Context, opts ...option.ClientOption) (*storage.Client, error) {
+	client := injectedHTTPClient()
+	if client == nil {
+		return storage.NewClient(ctx, opts...)
+	}
+
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	transportOpts := append([]option.ClientOption{option.WithScopes(storage.ScopeFullControl)}, opts...)
+	transport, err := htransport.NewTransport(ctx, base, transportOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticated := &http.Client{
+		Transport:     transport,
+		CheckRedirect: client.CheckRedirect,
+		Jar:           client.Jar,
+		Timeout:       client.Timeout,
+	}
+
+	return storage.NewClient(ctx, append(opts, option.WithHTTPClient(authenticated))...)
+}
@@ -0,0 +1,409 @@
+package artifactor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// httpStorage: Storage which publishes with plain http PUTs, for Artifactory,
+// Nexus and WebDAV servers, with objects addressed by their url. Each request
+// carries the configured headers, such as an Authorization header. Write
+// preconditions are sent as If-Match and If-None-Match headers on the etag the
+// generation was read at, which servers may or may not enforce
+type httpStorage struct {
+	client  *http.Client
+	headers http.Header
+}
+
+// NewHTTPStorage: create a Storage which publishes to http(s) urls with PUT,
+// sending the headers with every request. Register it for the http and https
+// schemes with RegisterStorage to configure the headers
+func NewHTTPStorage(headers http.Header) Storage {
+	return httpStorage{client: httpClient(), headers: headers}
+}
+
+// openHTTPStorage: an http storage without any headers
+func openHTTPStorage(ctx context.Context) (Storage, error) {
+	return NewHTTPStorage(nil), nil
+}
+
+func (h httpStorage) do(ctx context.Context, method, objectURL string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, objectURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	for key, values := range h.headers {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, storage.ErrObjectNotExist
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		resp.Body.Close()
+		return nil, &googleapi.Error{Code: http.StatusPreconditionFailed, Message: objectURL + ": precondition failed"}
+	case resp.StatusCode >= 300:
+		resp.Body.Close()
+		return nil, &googleapi.Error{Code: resp.StatusCode, Message: fmt.Sprintf("%s %s: unexpected status %s", method, objectURL, resp.Status)}
+	}
+
+	return resp, nil
+}
+
+func (h httpStorage) Attrs(ctx context.Context, objectURL string) (*storage.ObjectAttrs, error) {
+	resp, err := h.do(ctx, "HEAD", objectURL, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return httpObjectAttrs(objectURL, resp), nil
+}
+
+func (h httpStorage) NewRangeReader(ctx context.Context, objectURL string, generation int64, offset int64, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	header := make(http.Header)
+	switch {
+	case length > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := h.do(ctx, "GET", objectURL, nil, 0, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// servers ignoring the range header send the whole object
+	if header.Get("Range") != "" && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: range requests aren't supported", objectURL)
+	}
+
+	if generation != 0 && httpObjectAttrs(objectURL, resp).Generation != generation {
+		resp.Body.Close()
+		return nil, storage.ErrObjectNotExist
+	}
+
+	return resp.Body, nil
+}
+
+// conditionHeader: the headers guarding a write with the conditions
+func (h httpStorage) conditionHeader(ctx context.Context, objectURL string, conds storage.Conditions) (http.Header, error) {
+	header := make(http.Header)
+
+	if conds.DoesNotExist {
+		header.Set("If-None-Match", "*")
+	}
+
+	if conds.GenerationMatch != 0 {
+		attrs, err := h.Attrs(ctx, objectURL)
+		if err == storage.ErrObjectNotExist || (err == nil && attrs.Generation != conds.GenerationMatch) {
+			return nil, &googleapi.Error{Code: http.StatusPreconditionFailed, Message: objectURL + ": precondition failed"}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if attrs.Etag != "" {
+			header.Set("If-Match", attrs.Etag)
+		}
+	}
+
+	return header, nil
+}
+
+func (h httpStorage) Write(ctx context.Context, objectURL string, byts []byte, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	md5Sum := md5.Sum(byts)
+	attrs.Size = int64(len(byts))
+	attrs.MD5 = md5Sum[:]
+
+	return h.WriteFrom(ctx, objectURL, bytesOpener(byts), attrs, conds)
+}
+
+// WriteFrom: stream an object to the server with a PUT. The md5 the server
+// checks the contents against is sent as a header, so it's computed with an
+// extra read of the contents unless attrs.MD5 is given
+func (h httpStorage) WriteFrom(ctx context.Context, objectURL string, open func() (io.ReadCloser, error), attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	header, err := h.conditionHeader(ctx, objectURL, conds)
+	if err != nil {
+		return nil, err
+	}
+
+	md5Sum := attrs.MD5
+	if len(md5Sum) == 0 {
+		md5Sum, err = md5Contents(open)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Content-MD5 is checked by most servers, and X-Checksum-Md5 by
+	// Artifactory, which then stores the checksum with the object
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum))
+	header.Set("X-Checksum-Md5", hex.EncodeToString(md5Sum))
+	if attrs.CacheControl != "" {
+		header.Set("Cache-Control", attrs.CacheControl)
+	}
+
+	put := func() (*http.Response, error) {
+		reader, err := open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		// the content type is sniffed from the start of the contents as
+		// they're sent
+		body := bufio.NewReaderSize(reader, 512)
+		if attrs.ContentType == "" {
+			sniffed, err := body.Peek(512)
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			attrs.ContentType = http.DetectContentType(sniffed)
+		}
+		header.Set("Content-Type", attrs.ContentType)
+
+		return h.do(ctx, "PUT", objectURL, body, attrs.Size, header)
+	}
+
+	resp, err := put()
+	if isHTTPStatus(err, http.StatusConflict) {
+		// webdav servers refuse puts into collections which don't exist yet
+		if err := h.makeCollections(ctx, objectURL); err != nil {
+			return nil, err
+		}
+		resp, err = put()
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	// the etag and modification time of the write are only known by asking
+	written, err := h.Attrs(ctx, objectURL)
+	if err != nil {
+		return nil, err
+	}
+	written.MD5 = md5Sum
+	written.PredefinedACL = attrs.PredefinedACL
+
+	return written, nil
+}
+
+// md5Contents: the md5 of the contents open returns, read through once
+func md5Contents(open func() (io.ReadCloser, error)) ([]byte, error) {
+	reader, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	md5Hash := md5.New()
+	if _, err := io.Copy(md5Hash, reader); err != nil {
+		return nil, err
+	}
+
+	return md5Hash.Sum(nil), nil
+}
+
+// makeCollections: create each collection above an object with MKCOL,
+// ignoring those which already exist
+func (h httpStorage) makeCollections(ctx context.Context, objectURL string) error {
+	u, err := url.Parse(objectURL)
+	if err != nil {
+		return err
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for idx := range segments[:len(segments)-1] {
+		collection := *u
+		collection.Path = "/" + strings.Join(segments[:idx+1], "/") + "/"
+
+		resp, err := h.do(ctx, "MKCOL", collection.String(), nil, 0, nil)
+		if err != nil && !isHTTPStatus(err, http.StatusMethodNotAllowed) {
+			return err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+
+	return nil
+}
+
+func (h httpStorage) Copy(ctx context.Context, srcURL string, dstURL string, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	// conditional headers on a webdav copy apply to its source, so the
+	// destination's generation is checked up front, and Overwrite: F has the
+	// server refuse to replace an existing destination
+	if _, err := h.conditionHeader(ctx, dstURL, conds); err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	header.Set("Destination", dstURL)
+	header.Set("Overwrite", "T")
+	if conds.DoesNotExist {
+		header.Set("Overwrite", "F")
+	}
+
+	resp, err := h.do(ctx, "COPY", srcURL, nil, 0, header)
+	if isHTTPStatus(err, http.StatusConflict) {
+		if err := h.makeCollections(ctx, dstURL); err != nil {
+			return nil, err
+		}
+		resp, err = h.do(ctx, "COPY", srcURL, nil, 0, header)
+	}
+
+	switch {
+	case isHTTPStatus(err, http.StatusMethodNotAllowed), isHTTPStatus(err, http.StatusNotImplemented):
+		// servers without webdav copies are copied through the client
+		byts, err := h.read(ctx, srcURL)
+		if err != nil {
+			return nil, err
+		}
+
+		return h.Write(ctx, dstURL, byts, attrs, conds)
+	case err != nil:
+		return nil, err
+	}
+	resp.Body.Close()
+
+	copied, err := h.Attrs(ctx, dstURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// servers which don't report checksums have the copy read back, so it
+	// can still be verified against its source
+	if copied.MD5 == nil {
+		byts, err := h.read(ctx, dstURL)
+		if err != nil {
+			return nil, err
+		}
+
+		md5Sum := md5.Sum(byts)
+		copied.MD5 = md5Sum[:]
+	}
+
+	return copied, nil
+}
+
+// read: the whole contents of an object
+func (h httpStorage) read(ctx context.Context, objectURL string) ([]byte, error) {
+	reader, err := h.NewRangeReader(ctx, objectURL, 0, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func (h httpStorage) Delete(ctx context.Context, objectURL string, conds storage.Conditions) error {
+	header, err := h.conditionHeader(ctx, objectURL, conds)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.do(ctx, "DELETE", objectURL, nil, 0, header)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func (h httpStorage) SignedURL(objectURL string, expiresAt time.Time) (string, error) {
+	return "", fmt.Errorf("%s: signed urls aren't supported over http", objectURL)
+}
+
+func (h httpStorage) ListPrefixes(ctx context.Context, objectURL string) ([]string, error) {
+	return nil, fmt.Errorf("%s: listing isn't supported over http", objectURL)
+}
+
+func (h httpStorage) ListObjects(ctx context.Context, objectURL string) ([]string, error) {
+	return nil, fmt.Errorf("%s: listing isn't supported over http", objectURL)
+}
+
+// httpObjectAttrs: the attributes of an object from the headers of a response
+// for it. Generations are derived from the object's etag, or from its
+// modification time when the server doesn't send one
+func httpObjectAttrs(objectURL string, resp *http.Response) *storage.ObjectAttrs {
+	attrs := &storage.ObjectAttrs{
+		Name:           objectURL,
+		ContentType:    resp.Header.Get("Content-Type"),
+		CacheControl:   resp.Header.Get("Cache-Control"),
+		Etag:           resp.Header.Get("ETag"),
+		Metageneration: 1,
+	}
+
+	attrs.Size, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		if separator := strings.LastIndex(contentRange, "/"); separator >= 0 {
+			attrs.Size, _ = strconv.ParseInt(contentRange[separator+1:], 10, 64)
+		}
+	}
+
+	if md5Sum, err := hex.DecodeString(resp.Header.Get("X-Checksum-Md5")); err == nil && len(md5Sum) == md5.Size {
+		attrs.MD5 = md5Sum
+	}
+
+	if updated, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		attrs.Created, attrs.Updated = updated, updated
+		attrs.Generation = updated.UnixNano()
+	}
+
+	if attrs.Etag != "" {
+		hash := fnv.New64a()
+		hash.Write([]byte(attrs.Etag))
+		attrs.Generation = int64(hash.Sum64() >> 1)
+	}
+
+	if attrs.Generation == 0 {
+		attrs.Generation = 1
+	}
+
+	return attrs
+}
+
+// isHTTPStatus: whether a request failed with the given status
+func isHTTPStatus(err error, status int) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == status
+}
@@ -0,0 +1,336 @@
+package artifactor
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// ImportVersions: bring versions published to a project before artifactor
+// managed it under manifest management, by generating and uploading a signed
+// manifest.json and checksums for each. Every version directory without a
+// manifest.json is imported, or only the given versions when there are any.
+// Each object is read to compute its checksums, which are checked against
+// the size and md5 in its metadata. With dryRun set nothing is uploaded.
+// Returns the versions imported, or which would be
+func ImportVersions(project Project, opts *Options, versions []string, dryRun bool, concurrency int) ([]string, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	explicit := len(versions) > 0
+	if !explicit {
+		prefixes, err := store.ListPrefixes(ctx, project.gcsPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, prefix := range prefixes {
+			// components staged for a version aren't a version of their own
+			if prefix == project.gcsPrefix+stagingDir {
+				continue
+			}
+
+			versions = append(versions, strings.TrimSuffix(strings.TrimPrefix(prefix, project.gcsPrefix), "/"))
+		}
+		sort.Strings(versions)
+	}
+
+	imported := make([]string, 0, len(versions))
+	for _, version := range versions {
+		_, err := store.Attrs(ctx, project.gcsPrefix+version+"/manifest.json")
+		if err != nil && err != storage.ErrObjectNotExist {
+			return imported, err
+		}
+
+		// versions which already have a manifest, such as those published by
+		// artifactor, are only an error when asked for
+		if err == nil {
+			if explicit {
+				return imported, fmt.Errorf("%s: already has a manifest.json", version)
+			}
+			continue
+		}
+
+		gcsPaths, err := versionObjects(ctx, store, project, version)
+		if err != nil {
+			return imported, fmt.Errorf("%s: %v", version, err)
+		}
+
+		if len(gcsPaths) == 0 {
+			if explicit {
+				return imported, fmt.Errorf("%s: no objects found", version)
+			}
+			continue
+		}
+
+		if !dryRun {
+			if err := importVersion(ctx, store, project, opts, version, gcsPaths, concurrency); err != nil {
+				return imported, fmt.Errorf("%s: %v", version, err)
+			}
+		}
+
+		imported = append(imported, version)
+	}
+
+	return imported, nil
+}
+
+// versionObjects: the objects of a version directory which would become its
+// components, leaving out any files artifactor manages itself
+func versionObjects(ctx context.Context, store Storage, project Project, version string) ([]string, error) {
+	versionGCSPrefix := project.gcsPrefix + version + "/"
+
+	objects, err := store.ListObjects(ctx, versionGCSPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	gcsPaths := make([]string, 0, len(objects))
+	for _, gcsPath := range objects {
+		filepath := strings.TrimPrefix(gcsPath, versionGCSPrefix)
+
+		// placeholder objects some tools create for directories
+		if filepath == "" || strings.HasSuffix(filepath, "/") {
+			continue
+		}
+
+		if isManagedFilepath(filepath) {
+			continue
+		}
+
+		gcsPaths = append(gcsPaths, gcsPath)
+	}
+	sort.Strings(gcsPaths)
+
+	return gcsPaths, nil
+}
+
+// importVersion: read every object of a version, then write, sign and upload
+// its manifest and checksums. The manifest is timestamped with when the newest
+// object was created, so the version sorts among the others as it was
+// published
+func importVersion(ctx context.Context, store Storage, project Project, opts *Options, version string, gcsPaths []string, concurrency int) error {
+	versionGCSPrefix := project.gcsPrefix + version + "/"
+	versionURLPrefix := project.urlPrefix + version + "/"
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(gcsPaths))
+	semaphore := make(chan struct{}, concurrency)
+
+	components := make([]Component, 0, len(gcsPaths))
+	ts := time.Time{}
+
+	for _, gcsPath := range gcsPaths {
+		wg.Add(1)
+
+		go func(gcsPath string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			filepath := strings.TrimPrefix(gcsPath, versionGCSPrefix)
+			component, created, err := readObjectComponent(ctx, store, gcsPath, filepath, versionURLPrefix+filepath)
+			if err != nil {
+				errCh <- err
+				return
+			}
+
+			mu.Lock()
+			components = append(components, component)
+			if created.After(ts) {
+				ts = created
+			}
+			mu.Unlock()
+		}(gcsPath)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Filepath < components[j].Filepath
+	})
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	licenses := make([]string, 0)
+	for _, component := range components {
+		if isLicenseFilepath(component.Filepath) {
+			licenses = append(licenses, component.Filepath)
+		}
+	}
+
+	tmpDir, err := newScratchDir("artifactor-import")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest := NewComponentManifest(tmpDir, project.name, version, ts, components)
+	manifest.Licenses = licenses
+	manifest.ProjectMetadata = opts.Metadata
+	publisher, err := newPublisher(opts)
+	if err != nil {
+		return err
+	}
+	manifest.PublishedBy = &publisher
+	if err := manifest.write(); err != nil {
+		return err
+	}
+
+	checksumManifest := NewChecksumManifest(components)
+	checksumManifest.manifestFilepath = filepath.Join(tmpDir, checksumManifest.manifestFilepath)
+	checksumManifest.signatureFilepath = filepath.Join(tmpDir, checksumManifest.signatureFilepath)
+	if err := checksumManifest.write(); err != nil {
+		return err
+	}
+
+	manifestComponents := make([]Component, 0, len(managedFilepaths))
+	gcsManifestPaths := make([]string, 0, len(managedFilepaths))
+	for _, filename := range managedFilepaths {
+		component, err := newTempComponent(tmpDir, filename, versionGCSPrefix, versionURLPrefix)
+		if err != nil {
+			return err
+		}
+
+		manifestComponents = append(manifestComponents, component)
+		gcsManifestPaths = append(gcsManifestPaths, component.GCSFilepath)
+	}
+
+	// the manifests are written only if they still don't exist, so an import
+	// never overwrites a version published meanwhile
+	generations, err := fetchGenerations(gcsManifestPaths)
+	if err != nil {
+		return err
+	}
+
+	if _, err := uploadComponents(versionGCSPrefix, manifestComponents, generations, false); err != nil {
+		return err
+	}
+
+	if opts.Index || opts.Feed {
+		if _, err := updateIndex(project, NewIndexVersion(project, manifest, ""), opts.Feed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readObjectComponent: read an object to describe it as a component, along
+// with when it was created. The generation read is pinned, and its size and
+// checksums are checked against the object's metadata
+func readObjectComponent(ctx context.Context, store Storage, gcsPath, filepath, url string) (Component, time.Time, error) {
+	attrs, err := store.Attrs(ctx, gcsPath)
+	if err != nil {
+		return Component{}, time.Time{}, err
+	}
+
+	reader, err := store.NewRangeReader(ctx, gcsPath, attrs.Generation, 0, -1)
+	if err != nil {
+		return Component{}, time.Time{}, err
+	}
+	defer reader.Close()
+
+	hashes := []hash.Hash{
+		md5.New(),
+		sha256.New(),
+		sha512.New384(),
+		sha512.New512_256(),
+		crc32.New(crc32.MakeTable(crc32.Castagnoli)),
+	}
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+
+	header := &headerWriter{limit: binaryHeaderSize}
+	written, err := io.Copy(io.MultiWriter(append(writers, header)...), reader)
+	if err != nil {
+		return Component{}, time.Time{}, err
+	}
+
+	component := Component{
+		Filepath:    filepath,
+		GCSFilepath: gcsPath,
+		URL:         url,
+		Bytes:       written,
+
+		Md5Checksum:    fmt.Sprintf("%x", hashes[0].Sum(nil)),
+		Sha256Checksum: fmt.Sprintf("%x", hashes[1].Sum(nil)),
+		Sha384Checksum: fmt.Sprintf("%x", hashes[2].Sum(nil)),
+		Sha512Checksum: fmt.Sprintf("%x", hashes[3].Sum(nil)),
+		Crc32cChecksum: fmt.Sprintf("%x", hashes[4].Sum(nil)),
+	}
+
+	// objects uploaded in parts, such as large s3 objects, have no md5
+	checked := component
+	if len(attrs.MD5) == 0 {
+		checked.Md5Checksum = ""
+	}
+	if err := verifyObjectAttrs(attrs, checked); err != nil {
+		return Component{}, time.Time{}, err
+	}
+
+	component.Role = classifyFilepath(filepath)
+	if component.Role == "" {
+		component.Role = RoleOther
+		if hasBinaryMagic(header.byts) {
+			component.Role = RoleBinary
+		}
+	}
+
+	created := attrs.Created
+	if created.IsZero() {
+		created = attrs.Updated
+	}
+
+	return component, created, nil
+}
+
+// headerWriter: keeps the first limit bytes written to it, such as to check
+// the magic number of a file as it's streamed elsewhere
+type headerWriter struct {
+	limit int
+	byts  []byte
+}
+
+func (h *headerWriter) Write(p []byte) (int, error) {
+	if remaining := h.limit - len(h.byts); remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
+		}
+		h.byts = append(h.byts, p[:remaining]...)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,310 @@
+package artifactor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// files written when maintaining a project's index and feeds
+var indexFilepaths = []string{"index.json", "index.json.asc.sig", "feed.atom", "feed.json"}
+
+// number of times a project index update is retried when a concurrent
+// publisher updates the index first
+const indexUpdateAttempts = 5
+
+// IndexVersion: a version as listed in the project index
+type IndexVersion struct {
+	Version       string     `json:"version"`
+	ManifestURL   string     `json:"manifest_url"`
+	Timestamp     time.Time  `json:"timestamp"`
+	UnixTimestamp int        `json:"unix_timestamp"`
+	Components    int        `json:"components"`
+	Bytes         int64      `json:"bytes"`
+	Summary       string     `json:"summary,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	Advisories    []Advisory `json:"advisories,omitempty"`
+	Yanked        *Yank      `json:"yanked,omitempty"`
+
+	metadata ProjectMetadata
+}
+
+// NewIndexVersion: describe a published version for the project index. When
+// no release notes summary is given, one is generated from the manifest
+func NewIndexVersion(project Project, manifest ComponentManifest, summary string) IndexVersion {
+	bytes := int64(0)
+	for _, component := range manifest.Components {
+		bytes += component.Bytes
+	}
+
+	if summary == "" {
+		summary = fmt.Sprintf("%s %s: %d components, %s", manifest.Project, manifest.Version, len(manifest.Components), humanBytes(bytes))
+	}
+
+	return IndexVersion{
+		Version:       manifest.Version,
+		ManifestURL:   project.urlPrefix + manifest.Version + "/manifest.json",
+		Timestamp:     manifest.Timestamp,
+		UnixTimestamp: manifest.UnixTimestamp,
+		Components:    len(manifest.Components),
+		Bytes:         bytes,
+		Summary:       summary,
+		ExpiresAt:     manifest.ExpiresAt,
+
+		metadata: manifest.ProjectMetadata,
+	}
+}
+
+// ProjectIndex: a signed list of every version published to a project, or to
+// one of its channels, ordered by when they were published
+type ProjectIndex struct {
+	Project  string         `json:"project"`
+	Versions []IndexVersion `json:"versions"`
+
+	// ProjectMetadata is that of the newest version published with any
+	ProjectMetadata
+
+	manifestFilepath  string
+	signatureFilepath string
+}
+
+// NewProjectIndex: create a project index from a previously published one,
+// adding or replacing a version
+func NewProjectIndex(project Project, previous ProjectIndex, version IndexVersion) ProjectIndex {
+	index := ProjectIndex{
+		Project:         project.name,
+		Versions:        make([]IndexVersion, 0, len(previous.Versions)+1),
+		ProjectMetadata: previous.ProjectMetadata,
+
+		manifestFilepath:  indexFilepaths[0],
+		signatureFilepath: indexFilepaths[1],
+	}
+
+	for _, previousVersion := range previous.Versions {
+		if previousVersion.Version != version.Version {
+			index.Versions = append(index.Versions, previousVersion)
+		}
+	}
+	index.Versions = append(index.Versions, version)
+
+	sort.SliceStable(index.Versions, func(i, j int) bool {
+		return index.Versions[i].Timestamp.Before(index.Versions[j].Timestamp)
+	})
+
+	// versions added back to the index, such as when an advisory is attached
+	// or they're yanked, don't replace the metadata of those published since
+	if !version.metadata.IsZero() && index.Versions[len(index.Versions)-1].Version == version.Version {
+		index.ProjectMetadata = version.metadata
+	}
+
+	return index
+}
+
+func (p ProjectIndex) write() error {
+	jsonBytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(p.manifestFilepath, jsonBytes, 0644); err != nil {
+		return err
+	}
+
+	return createSigFile(p.manifestFilepath, p.signatureFilepath)
+}
+
+// fetchIndex: download the project index, returning an empty index if the
+// project doesn't have one yet
+func fetchIndex(project Project) (ProjectIndex, error) {
+	byts, _, err := fetchObject(project.gcsPrefix + indexFilepaths[0])
+	if err == storage.ErrObjectNotExist {
+		return ProjectIndex{Project: project.name}, nil
+	}
+	if err != nil {
+		return ProjectIndex{}, err
+	}
+
+	var index ProjectIndex
+	if err := json.Unmarshal(byts, &index); err != nil {
+		return ProjectIndex{}, err
+	}
+
+	return index, nil
+}
+
+// updateIndex: add a version to the project index, and regenerate the
+// project's feeds when asked to. Every file is written guarded by the
+// generation it was read at, and the whole update is retried if a concurrent
+// publisher gets there first
+func updateIndex(project Project, version IndexVersion, feeds bool) ([]PublishedObject, error) {
+	var err error
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		var objects []PublishedObject
+
+		objects, err = tryUpdateIndex(project, version, feeds)
+		if err == nil {
+			return retried(objects, attempt), nil
+		}
+
+		if !isPreconditionFailed(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func tryUpdateIndex(project Project, version IndexVersion, feeds bool) ([]PublishedObject, error) {
+	filepaths := indexFilepaths[:2]
+	if feeds {
+		filepaths = indexFilepaths
+	}
+
+	gcsPaths := make([]string, 0, len(filepaths))
+	for _, filepath := range filepaths {
+		gcsPaths = append(gcsPaths, project.gcsPrefix+filepath)
+	}
+
+	// generations are read before the index, so a concurrent update between
+	// the two reads fails the write rather than being lost
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := fetchIndex(project)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := newScratchDir("artifactor-index")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	index := NewProjectIndex(project, previous, version)
+	components, err := writeIndex(project, index, tmpDir, filepaths)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploadComponents(project.gcsPrefix, components, generations, false)
+}
+
+// writeIndex: write and sign the index into dir, along with the feeds when
+// filepaths includes them, returning the components to upload
+func writeIndex(project Project, index ProjectIndex, dir string, filepaths []string) ([]Component, error) {
+	index.manifestFilepath = filepath.Join(dir, indexFilepaths[0])
+	index.signatureFilepath = filepath.Join(dir, indexFilepaths[1])
+	if err := index.write(); err != nil {
+		return nil, err
+	}
+
+	if len(filepaths) > 2 {
+		if err := writeAtomFeed(project, index, filepath.Join(dir, indexFilepaths[2])); err != nil {
+			return nil, err
+		}
+
+		if err := writeJSONFeed(project, index, filepath.Join(dir, indexFilepaths[3])); err != nil {
+			return nil, err
+		}
+	}
+
+	components := make([]Component, 0, len(filepaths))
+	for _, filename := range filepaths {
+		component, err := newTempComponent(dir, filename, project.gcsPrefix, project.urlPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, component)
+	}
+
+	return components, nil
+}
+
+// isPreconditionFailed: whether a write failed because of a generation
+// precondition
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// removeFromIndex: remove a version from the project index and any feeds
+// published alongside it, retrying like updateIndex. Projects without an
+// index, or whose index doesn't list the version, are left alone
+func removeFromIndex(project Project, version string) error {
+	var err error
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		err = tryRemoveFromIndex(project, version)
+		if err == nil || !isPreconditionFailed(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func tryRemoveFromIndex(project Project, version string) error {
+	gcsPaths := make([]string, 0, len(indexFilepaths))
+	for _, filepath := range indexFilepaths {
+		gcsPaths = append(gcsPaths, project.gcsPrefix+filepath)
+	}
+
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return err
+	}
+
+	previous, err := fetchIndex(project)
+	if err != nil {
+		return err
+	}
+
+	index := ProjectIndex{
+		Project:  project.name,
+		Versions: make([]IndexVersion, 0, len(previous.Versions)),
+
+		manifestFilepath:  indexFilepaths[0],
+		signatureFilepath: indexFilepaths[1],
+	}
+	for _, previousVersion := range previous.Versions {
+		if previousVersion.Version != version {
+			index.Versions = append(index.Versions, previousVersion)
+		}
+	}
+
+	if len(index.Versions) == len(previous.Versions) {
+		return nil
+	}
+
+	// feeds are only regenerated when the project already publishes them
+	filepaths := indexFilepaths[:2]
+	if generations[project.gcsPrefix+indexFilepaths[2]] != 0 {
+		filepaths = indexFilepaths
+	}
+
+	tmpDir, err := newScratchDir("artifactor-index")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	components, err := writeIndex(project, index, tmpDir, filepaths)
+	if err != nil {
+		return err
+	}
+
+	_, err = uploadComponents(project.gcsPrefix, components, generations, false)
+	return err
+}
@@ -0,0 +1,371 @@
+package artifactor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// files written when maintaining a project's signing keys
+var keyRingFilepaths = []string{"keys.json", "keys.json.asc.sig", "public_key.asc"}
+
+// fingerprintPattern: a full gpg fingerprint. Short key ids aren't accepted
+// anywhere trust is decided, as colliding with one is cheap
+var fingerprintPattern = regexp.MustCompile("^[0-9A-Fa-f]{40}$")
+
+// checkFingerprint: refuse anything but a full 40 hex digit fingerprint
+func checkFingerprint(fingerprint string) error {
+	if !fingerprintPattern.MatchString(fingerprint) {
+		return fmt.Errorf("%q is not a full 40 hex digit key fingerprint", fingerprint)
+	}
+
+	return nil
+}
+
+// SigningKey: a gpg key whose signatures are accepted for a project. Keys
+// being rotated out expire at the end of their transition window
+type SigningKey struct {
+	Fingerprint  string     `json:"fingerprint"`
+	PublicKeyURL string     `json:"public_key_url"`
+	AddedAt      time.Time  `json:"added_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// KeyRing: the signed list of keys accepted for a project, published as
+// keys.json alongside its public keys
+type KeyRing struct {
+	Project string       `json:"project"`
+	Keys    []SigningKey `json:"keys"`
+
+	manifestFilepath  string
+	signatureFilepath string
+
+	// anyKey: accept every key, when no fingerprints are trusted
+	anyKey bool
+}
+
+// NewKeyRing: create a key ring from a previously published one, rotating from
+// oldKey to newKey. The old key remains accepted until the end of the window
+func NewKeyRing(project Project, previous KeyRing, oldKey string, newKey string, ts time.Time, window time.Duration) KeyRing {
+	keyRing := KeyRing{
+		Project: project.name,
+		Keys:    make([]SigningKey, 0, len(previous.Keys)+2),
+
+		manifestFilepath:  keyRingFilepaths[0],
+		signatureFilepath: keyRingFilepaths[1],
+	}
+
+	expiresAt := ts.Add(window)
+	foundOldKey := false
+	for _, key := range previous.Keys {
+		if key.Fingerprint == newKey {
+			continue
+		}
+
+		if key.Fingerprint == oldKey {
+			foundOldKey = true
+			if key.ExpiresAt == nil || key.ExpiresAt.After(expiresAt) {
+				key.ExpiresAt = &expiresAt
+			}
+		}
+
+		keyRing.Keys = append(keyRing.Keys, key)
+	}
+
+	if !foundOldKey {
+		keyRing.Keys = append(keyRing.Keys, SigningKey{
+			Fingerprint:  oldKey,
+			PublicKeyURL: project.urlPrefix + "keys/" + oldKey + ".asc",
+			AddedAt:      ts,
+			ExpiresAt:    &expiresAt,
+		})
+	}
+
+	keyRing.Keys = append(keyRing.Keys, SigningKey{
+		Fingerprint:  newKey,
+		PublicKeyURL: project.urlPrefix + "keys/" + newKey + ".asc",
+		AddedAt:      ts,
+	})
+
+	return keyRing
+}
+
+// accepts: whether a signature made by the key with the given fingerprint is
+// accepted at the given time
+func (k KeyRing) accepts(fingerprint string, now time.Time) bool {
+	if k.anyKey {
+		return true
+	}
+
+	for _, key := range k.Keys {
+		if !strings.EqualFold(fingerprint, key.Fingerprint) {
+			continue
+		}
+
+		if key.ExpiresAt == nil || now.Before(*key.ExpiresAt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate: check that every key is given by its full fingerprint
+func (k KeyRing) validate() error {
+	for _, key := range k.Keys {
+		if err := checkFingerprint(key.Fingerprint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write: write and sign the key ring with every given key
+func (k KeyRing) write(keys ...string) error {
+	jsonBytes, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(k.manifestFilepath, jsonBytes, 0644); err != nil {
+		return err
+	}
+
+	return createSigFile(k.manifestFilepath, k.signatureFilepath, keys...)
+}
+
+// RotateKey: rotate the key used to sign a project from oldKey to newKey. The
+// new public key is published under keys/, and keys.json, along with the
+// project root, are re-signed with both keys so that consumers trusting either
+// key can verify them. Verification accepts signatures from the old key until
+// the transition window ends
+func RotateKey(project Project, oldKey string, newKey string, window time.Duration) error {
+	ts := time.Now()
+
+	for _, key := range []string{oldKey, newKey} {
+		if err := checkFingerprint(key); err != nil {
+			return err
+		}
+	}
+
+	previous, keyRingGeneration, err := fetchKeyRing(project)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := currentSigner().PublicKey(newKey)
+	if err != nil {
+		return err
+	}
+	if len(publicKey) == 0 {
+		return fmt.Errorf("no public key found for %s", newKey)
+	}
+
+	tmpDir, err := newScratchDir("artifactor-keys")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, keyRingFilepaths[2]), publicKey, 0644); err != nil {
+		return err
+	}
+
+	keyRing := NewKeyRing(project, previous, oldKey, newKey, ts, window)
+	keyRing.manifestFilepath = filepath.Join(tmpDir, keyRingFilepaths[0])
+	keyRing.signatureFilepath = filepath.Join(tmpDir, keyRingFilepaths[1])
+	if err := keyRing.write(oldKey, newKey); err != nil {
+		return err
+	}
+
+	components := make([]Component, 0, 4)
+	for _, filename := range keyRingFilepaths {
+		component, err := newTempComponent(tmpDir, filename, project.gcsPrefix, project.urlPrefix)
+		if err != nil {
+			return err
+		}
+
+		if filename == keyRingFilepaths[2] {
+			component.GCSFilepath = project.gcsPrefix + "keys/" + newKey + ".asc"
+		}
+
+		components = append(components, component)
+	}
+
+	// the root is re-signed as is, so its contents and digest never change
+	_, rootBytes, _, err := fetchRoot(project)
+	if err != nil {
+		return err
+	}
+
+	if len(rootBytes) > 0 {
+		rootFilepath := filepath.Join(tmpDir, rootFilepaths[0])
+		if err := ioutil.WriteFile(rootFilepath, rootBytes, 0644); err != nil {
+			return err
+		}
+
+		if err := createSigFile(rootFilepath, filepath.Join(tmpDir, rootFilepaths[1]), oldKey, newKey); err != nil {
+			return err
+		}
+
+		component, err := newTempComponent(tmpDir, rootFilepaths[1], project.gcsPrefix, project.urlPrefix)
+		if err != nil {
+			return err
+		}
+
+		components = append(components, component)
+	}
+
+	gcsPaths := make([]string, 0, len(components))
+	for _, component := range components {
+		gcsPaths = append(gcsPaths, component.GCSFilepath)
+	}
+
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return err
+	}
+	generations[project.gcsPrefix+keyRingFilepaths[0]] = keyRingGeneration
+
+	_, err = uploadComponents(project.gcsPrefix, components, generations, false)
+	return err
+}
+
+// VerifyRoot: verify the signature of a project's root. The published key
+// ring is trusted if it is signed by any of the trusted keys, and the root is
+// accepted if it is signed by any key the key ring currently accepts
+func VerifyRoot(project Project, trustedKeys []string) error {
+	now := time.Now()
+
+	keyRing, _, err := fetchKeyRing(project)
+	if err != nil {
+		return err
+	}
+
+	trustedKeyRing := KeyRing{Keys: make([]SigningKey, 0, len(trustedKeys))}
+	for _, key := range trustedKeys {
+		if err := checkFingerprint(key); err != nil {
+			return err
+		}
+		trustedKeyRing.Keys = append(trustedKeyRing.Keys, SigningKey{Fingerprint: key})
+	}
+
+	if len(keyRing.Keys) == 0 {
+		keyRing = trustedKeyRing
+	} else if err := verifyObjectSignature(project.gcsPrefix+keyRingFilepaths[0], trustedKeyRing, now); err != nil {
+		return err
+	}
+
+	return verifyObjectSignature(project.gcsPrefix+rootFilepaths[0], keyRing, now)
+}
+
+// fetchKeyRing: download the project's key ring and its generation. A missing
+// key ring returns an empty key ring at generation 0
+func fetchKeyRing(project Project) (KeyRing, int64, error) {
+	byts, generation, err := fetchObject(project.gcsPrefix + keyRingFilepaths[0])
+	if err == storage.ErrObjectNotExist {
+		return KeyRing{}, 0, nil
+	}
+	if err != nil {
+		return KeyRing{}, 0, err
+	}
+
+	var keyRing KeyRing
+	if err := json.Unmarshal(byts, &keyRing); err != nil {
+		return KeyRing{}, 0, err
+	}
+
+	if err := keyRing.validate(); err != nil {
+		return KeyRing{}, 0, fmt.Errorf("%s: %v", project.gcsPrefix+keyRingFilepaths[0], err)
+	}
+
+	return keyRing, generation, nil
+}
+
+// verifyObjectSignature: download an object and its .asc.sig and verify that
+// it carries a valid signature from a key accepted by the key ring
+func verifyObjectSignature(gcsPath string, keyRing KeyRing, now time.Time) error {
+	byts, _, err := fetchObject(gcsPath)
+	if err != nil {
+		return err
+	}
+
+	sigBytes, _, err := fetchObject(gcsPath + ".asc.sig")
+	if err != nil {
+		return err
+	}
+
+	if err := verifySigBytes(byts, sigBytes, keyRing, now, 1); err != nil {
+		return fmt.Errorf("%s: %v", gcsPath, err)
+	}
+
+	return nil
+}
+
+// verifySignature: verify a detached signature made by any of the trusted
+// keys, or by any key in the local gpg keyring when none are given
+func verifySignature(byts []byte, sigBytes []byte, trustedKeys []string) error {
+	return TrustPolicy{Fingerprints: trustedKeys, MinimumSignatures: 1}.verifySignature(byts, sigBytes)
+}
+
+// verifySigBytes: verify a detached signature held in memory
+func verifySigBytes(byts []byte, sigBytes []byte, keyRing KeyRing, now time.Time, minimum int) error {
+	input, err := ioutil.TempFile(scratchDir, "artifactor")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(input.Name())
+	input.Close()
+
+	signature, err := ioutil.TempFile(scratchDir, "artifactor")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(signature.Name())
+	signature.Close()
+
+	if err := ioutil.WriteFile(input.Name(), byts, 0644); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(signature.Name(), sigBytes, 0644); err != nil {
+		return err
+	}
+
+	return verifySigFile(input.Name(), signature.Name(), keyRing, now, minimum)
+}
+
+// verifySigFile: verify a detached signature with the current signer,
+// succeeding if at least minimum of the signatures it holds are valid and
+// made by distinct keys the key ring accepts. A signature is accepted by
+// either its subkey or its primary key, and counted once by its primary key
+func verifySigFile(input, signature string, keyRing KeyRing, now time.Time, minimum int) error {
+	signatures, err := currentSigner().Verify(input, signature)
+	if err != nil {
+		return err
+	}
+
+	accepted := make(map[string]bool, len(signatures))
+	for _, signature := range signatures {
+		if keyRing.accepts(signature.Subkey, now) || keyRing.accepts(signature.Primary, now) {
+			accepted[strings.ToUpper(signature.Primary)] = true
+		}
+	}
+
+	if len(accepted) >= minimum && len(accepted) > 0 {
+		return nil
+	}
+	if minimum > 1 {
+		return fmt.Errorf("valid signatures from %d accepted keys, %d required", len(accepted), minimum)
+	}
+
+	return fmt.Errorf("no valid signature from an accepted key")
+}
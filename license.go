@@ -0,0 +1,116 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path"
+	"strings"
+)
+
+// basename prefixes of license and notice files, which may carry any
+// extension such as LICENSE.txt or NOTICE.md
+var licensePrefixes = []string{"LICENSE", "LICENCE", "COPYING", "NOTICE"}
+
+// magic numbers at the start of elf and mach-o executables and shared
+// libraries. Windows executables and fat mach-o binaries share their magic
+// numbers with other formats, so are told apart by hasBinaryMagic
+var binaryMagics = [][]byte{
+	[]byte("\x7fELF"),
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xcf, 0xfa, 0xed, 0xfe},
+}
+
+// bytes read from the start of a file to tell whether it's a binary, enough to
+// reach the pe header of a windows executable
+const binaryHeaderSize = 1024
+
+// a fat mach-o binary starts with the same magic number as a java class file,
+// followed by its count of architectures where a class file has its version,
+// which is at least 45
+const maxFatArchitectures = 30
+
+// isLicenseFilepath: whether a component is a license or notice file
+func isLicenseFilepath(filepath string) bool {
+	name := strings.ToUpper(path.Base(filepath))
+	for _, prefix := range licensePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isBinaryFile: whether a file is an executable or shared library, judging by
+// its magic number
+func isBinaryFile(component Component) (bool, error) {
+	file, err := component.openContents()
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, binaryHeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+
+	return hasBinaryMagic(header[:n]), nil
+}
+
+// hasBinaryMagic: whether the start of a file is the magic number of an
+// executable or shared library
+func hasBinaryMagic(header []byte) bool {
+	for _, magic := range binaryMagics {
+		if bytes.HasPrefix(header, magic) {
+			return true
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte("MZ")):
+		// the dos header's e_lfanew, at 0x3c, holds the offset of the pe header
+		if len(header) < 0x40 {
+			return false
+		}
+		offset := int64(binary.LittleEndian.Uint32(header[0x3c:]))
+		return offset+4 <= int64(len(header)) && bytes.Equal(header[offset:offset+4], []byte("PE\x00\x00"))
+	case bytes.HasPrefix(header, []byte{0xca, 0xfe, 0xba, 0xbe}):
+		if len(header) < 8 {
+			return false
+		}
+		architectures := binary.BigEndian.Uint32(header[4:])
+		return architectures > 0 && architectures < maxFatArchitectures
+	}
+
+	return false
+}
+
+// detectLicenses: find the license and notice files among the components, and
+// the binaries they would need to cover
+func detectLicenses(components []Component) ([]string, []string, error) {
+	licenses := make([]string, 0)
+	binaries := make([]string, 0)
+
+	for _, component := range components {
+		if isLicenseFilepath(component.Filepath) {
+			licenses = append(licenses, component.Filepath)
+			continue
+		}
+
+		isBinary, err := isBinaryFile(component)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if isBinary {
+			binaries = append(binaries, component.Filepath)
+		}
+	}
+
+	return licenses, binaries, nil
+}
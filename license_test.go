@@ -0,0 +1,38 @@
+package artifactor
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// testPE: the start of a windows executable, its dos header pointing at a pe
+// header at offset
+func testPE(offset uint32) []byte {
+	header := make([]byte, 0x100)
+	copy(header, "MZ")
+	binary.LittleEndian.PutUint32(header[0x3c:], offset)
+	copy(header[0x80:], "PE\x00\x00")
+	return header
+}
+
+func TestHasBinaryMagic(t *testing.T) {
+	for name, test := range map[string]struct {
+		header []byte
+		binary bool
+	}{
+		"elf":                 {[]byte("\x7fELF\x02\x01\x01"), true},
+		"mach-o":              {[]byte{0xcf, 0xfa, 0xed, 0xfe, 7, 0, 0, 1}, true},
+		"pe":                  {testPE(0x80), true},
+		"pe offset elsewhere": {testPE(0x90), false},
+		"pe offset past read": {testPE(binaryHeaderSize), false},
+		"mz text":             {[]byte("MZ is a postal code prefix in this readme"), false},
+		"short mz":            {[]byte("MZ"), false},
+		"fat mach-o":          {[]byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 2}, true},
+		"java class":          {[]byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 52}, false},
+		"text":                {[]byte("hello"), false},
+	} {
+		if got := hasBinaryMagic(test.header); got != test.binary {
+			t.Errorf("%s: expected %v, got %v", name, test.binary, got)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package artifactor
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/mod/semver"
+)
+
+// directory of the project's maven2 repository
+const mavenRepositoryDir = "maven/"
+
+// mavenPom: the coordinates of an artifact, as declared in its pom
+type mavenPom struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Parent     struct {
+		GroupID string `xml:"groupId"`
+		Version string `xml:"version"`
+	} `xml:"parent"`
+}
+
+// mavenMetadata: an artifact's maven-metadata.xml, listing its versions
+type mavenMetadata struct {
+	XMLName    xml.Name `xml:"metadata"`
+	GroupID    string   `xml:"groupId"`
+	ArtifactID string   `xml:"artifactId"`
+	Versioning struct {
+		Latest      string   `xml:"latest"`
+		Release     string   `xml:"release,omitempty"`
+		Versions    []string `xml:"versions>version"`
+		LastUpdated string   `xml:"lastUpdated"`
+	} `xml:"versioning"`
+}
+
+// mavenArtifact: a pom along with the jars and other files published with it
+type mavenArtifact struct {
+	pom        mavenPom
+	components []Component
+}
+
+// artifactDir: the artifact's directory in the repository, such as
+// maven/house/jm/example/
+func (m mavenArtifact) artifactDir() string {
+	return mavenRepositoryDir + strings.Replace(m.pom.GroupID, ".", "/", -1) + "/" + m.pom.ArtifactID + "/"
+}
+
+// mavenArtifacts: find the poms among the components, and the files alongside
+// each of them named after its artifactId and version, such as
+// example-1.2.0.jar and example-1.2.0-sources.jar
+func mavenArtifacts(components []Component) ([]mavenArtifact, error) {
+	artifacts := make([]mavenArtifact, 0)
+
+	for _, component := range components {
+		if !strings.HasSuffix(component.Filepath, ".pom") {
+			continue
+		}
+
+		byts, err := component.readContents()
+		if err != nil {
+			return nil, err
+		}
+
+		var pom mavenPom
+		if err := xml.Unmarshal(byts, &pom); err != nil {
+			return nil, fmt.Errorf("%s: %v", component.Filepath, err)
+		}
+
+		if pom.GroupID == "" {
+			pom.GroupID = pom.Parent.GroupID
+		}
+		if pom.Version == "" {
+			pom.Version = pom.Parent.Version
+		}
+		if pom.GroupID == "" || pom.ArtifactID == "" || pom.Version == "" {
+			return nil, fmt.Errorf("%s: missing groupId, artifactId or version", component.Filepath)
+		}
+
+		artifact := mavenArtifact{pom: pom}
+		prefix := pom.ArtifactID + "-" + pom.Version
+		for _, other := range components {
+			filename := path.Base(other.Filepath)
+			if path.Dir(other.Filepath) != path.Dir(component.Filepath) || !strings.HasPrefix(filename, prefix) {
+				continue
+			}
+
+			if rest := filename[len(prefix):]; strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "-") {
+				artifact.components = append(artifact.components, other)
+			}
+		}
+
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts, nil
+}
+
+// publishMaven: copy the version's poms and jars server side into maven2
+// repository layout under the project, upload their checksum files and add
+// the version to each artifact's maven-metadata.xml
+func publishMaven(project Project, components []Component, ts time.Time) ([]PublishedObject, error) {
+	artifacts, err := mavenArtifacts(components)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]PublishedObject, 0)
+	for _, artifact := range artifacts {
+		artifactObjects, err := publishMavenArtifact(project, artifact, ts)
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, artifactObjects...)
+	}
+
+	return objects, nil
+}
+
+func publishMavenArtifact(project Project, artifact mavenArtifact, ts time.Time) ([]PublishedObject, error) {
+	versionDir := artifact.artifactDir() + artifact.pom.Version + "/"
+
+	tmpDir, err := newScratchDir("artifactor-maven")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// released versions are immutable, while snapshots are overwritten by
+	// every publish
+	generations := make(map[string]int64)
+	immutable := !strings.HasSuffix(artifact.pom.Version, "-SNAPSHOT")
+
+	copies := make([]componentCopy, 0, len(artifact.components))
+	checksumComponents := make([]Component, 0, len(artifact.components)*2)
+	for _, component := range artifact.components {
+		filename := path.Base(component.Filepath)
+
+		dst := component
+		dst.GCSFilepath = project.gcsPrefix + versionDir + filename
+		dst.URL = project.urlPrefix + versionDir + filename
+		copies = append(copies, componentCopy{src: component.GCSFilepath, dst: dst})
+
+		byts, err := component.readContents()
+		if err != nil {
+			return nil, err
+		}
+
+		checksumFilenames, err := writeMavenChecksums(tmpDir, filename, byts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, checksumFilename := range checksumFilenames {
+			checksumComponent, err := newTempComponent(tmpDir, checksumFilename, project.gcsPrefix+versionDir, project.urlPrefix+versionDir)
+			if err != nil {
+				return nil, err
+			}
+
+			checksumComponents = append(checksumComponents, checksumComponent)
+		}
+	}
+
+	if immutable {
+		for _, cp := range copies {
+			generations[cp.dst.GCSFilepath] = 0
+		}
+		for _, component := range checksumComponents {
+			generations[component.GCSFilepath] = 0
+		}
+	}
+
+	objects, err := copyComponents(project.gcsPrefix, copies, generations, false)
+	if err != nil {
+		return nil, err
+	}
+
+	checksumObjects, err := uploadComponents(project.gcsPrefix, checksumComponents, generations, false)
+	if err != nil {
+		return nil, err
+	}
+	objects = append(objects, checksumObjects...)
+
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		var metadataObjects []PublishedObject
+
+		metadataObjects, err = tryUpdateMavenMetadata(project, artifact, tmpDir, ts)
+		if err == nil {
+			return append(objects, retried(metadataObjects, attempt)...), nil
+		}
+
+		if !isPreconditionFailed(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// writeMavenChecksums: write the .md5 and .sha1 files maven clients verify
+// downloads against, returning their filenames
+func writeMavenChecksums(dir string, filename string, byts []byte) ([]string, error) {
+	checksums := map[string]string{
+		filename + ".md5":  fmt.Sprintf("%x", md5.Sum(byts)),
+		filename + ".sha1": fmt.Sprintf("%x", sha1.Sum(byts)),
+	}
+
+	filenames := make([]string, 0, len(checksums))
+	for checksumFilename, checksum := range checksums {
+		if err := ioutil.WriteFile(filepath.Join(dir, checksumFilename), []byte(checksum), 0644); err != nil {
+			return nil, err
+		}
+
+		filenames = append(filenames, checksumFilename)
+	}
+
+	return filenames, nil
+}
+
+// setMavenVersioning: sort the metadata's versions oldest first, and point
+// latest at the newest of them and release at the newest which isn't a
+// snapshot, so publishing a backport never moves either backwards
+func setMavenVersioning(metadata *mavenMetadata) {
+	versions := metadata.Versioning.Versions
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareMavenVersions(versions[i], versions[j]) < 0
+	})
+
+	for _, version := range versions {
+		metadata.Versioning.Latest = version
+		if !strings.HasSuffix(version, "-SNAPSHOT") {
+			metadata.Versioning.Release = version
+		}
+	}
+}
+
+// compareMavenVersions: order two versions by semver, such as 1.2.9 before
+// 2.0.0. Versions which aren't semver sort before those which are, and by
+// name amongst themselves
+func compareMavenVersions(a, b string) int {
+	semverA, semverB := "v"+a, "v"+b
+	validA, validB := semver.IsValid(semverA), semver.IsValid(semverB)
+
+	switch {
+	case validA && validB:
+		return semver.Compare(semverA, semverB)
+	case validA != validB:
+		if validA {
+			return 1
+		}
+		return -1
+	}
+
+	return strings.Compare(a, b)
+}
+
+// tryUpdateMavenMetadata: add the version to the artifact's
+// maven-metadata.xml, guarded by the generation it was read at
+func tryUpdateMavenMetadata(project Project, artifact mavenArtifact, tmpDir string, ts time.Time) ([]PublishedObject, error) {
+	artifactDir := artifact.artifactDir()
+	metadataGCSPath := project.gcsPrefix + artifactDir + "maven-metadata.xml"
+
+	gcsPaths := []string{metadataGCSPath, metadataGCSPath + ".md5", metadataGCSPath + ".sha1"}
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata mavenMetadata
+	byts, _, err := fetchObject(metadataGCSPath)
+	switch {
+	case err == storage.ErrObjectNotExist:
+	case err != nil:
+		return nil, err
+	default:
+		if err := xml.Unmarshal(byts, &metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata.GroupID = artifact.pom.GroupID
+	metadata.ArtifactID = artifact.pom.ArtifactID
+	if !containsString(metadata.Versioning.Versions, artifact.pom.Version) {
+		metadata.Versioning.Versions = append(metadata.Versioning.Versions, artifact.pom.Version)
+	}
+	setMavenVersioning(&metadata)
+	metadata.Versioning.LastUpdated = ts.UTC().Format("20060102150405")
+
+	metadataBytes, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	metadataBytes = append([]byte(xml.Header), metadataBytes...)
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "maven-metadata.xml"), metadataBytes, 0644); err != nil {
+		return nil, err
+	}
+
+	checksumFilenames, err := writeMavenChecksums(tmpDir, "maven-metadata.xml", metadataBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	filenames := append([]string{"maven-metadata.xml"}, checksumFilenames...)
+	components := make([]Component, 0, len(filenames))
+	for _, filename := range filenames {
+		component, err := newTempComponent(tmpDir, filename, project.gcsPrefix+artifactDir, project.urlPrefix+artifactDir)
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, component)
+	}
+
+	return uploadComponents(project.gcsPrefix, components, generations, false)
+}
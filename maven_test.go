@@ -0,0 +1,32 @@
+package artifactor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetMavenVersioning(t *testing.T) {
+	for _, tc := range []struct {
+		versions        []string
+		sorted          []string
+		latest, release string
+	}{
+		{[]string{"1.0.0"}, []string{"1.0.0"}, "1.0.0", "1.0.0"},
+		{[]string{"1.2.0", "2.0.0", "1.2.9"}, []string{"1.2.0", "1.2.9", "2.0.0"}, "2.0.0", "2.0.0"},
+		{[]string{"1.10.0", "1.9.0"}, []string{"1.9.0", "1.10.0"}, "1.10.0", "1.10.0"},
+		{[]string{"2.0.0", "2.1.0-SNAPSHOT", "1.5.0"}, []string{"1.5.0", "2.0.0", "2.1.0-SNAPSHOT"}, "2.1.0-SNAPSHOT", "2.0.0"},
+		{[]string{"2.0.0", "2.0.0-SNAPSHOT"}, []string{"2.0.0-SNAPSHOT", "2.0.0"}, "2.0.0", "2.0.0"},
+		{[]string{"1.0.0", "nightly"}, []string{"nightly", "1.0.0"}, "1.0.0", "1.0.0"},
+	} {
+		var metadata mavenMetadata
+		metadata.Versioning.Versions = append([]string(nil), tc.versions...)
+		setMavenVersioning(&metadata)
+
+		if !reflect.DeepEqual(metadata.Versioning.Versions, tc.sorted) {
+			t.Errorf("%v: expected versions %v, found %v", tc.versions, tc.sorted, metadata.Versioning.Versions)
+		}
+		if metadata.Versioning.Latest != tc.latest || metadata.Versioning.Release != tc.release {
+			t.Errorf("%v: expected latest %s and release %s, found %s and %s", tc.versions, tc.latest, tc.release, metadata.Versioning.Latest, metadata.Versioning.Release)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package artifactor
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ProjectMetadata: describes the project a version belongs to, for index
+// pages and feeds to link to. Every field is optional
+type ProjectMetadata struct {
+	Homepage         string `json:"homepage,omitempty"`
+	DocumentationURL string `json:"documentation_url,omitempty"`
+
+	// Support is a contact for help with the project, such as an email
+	// address or an issue tracker url
+	Support string `json:"support,omitempty"`
+
+	// License is the spdx identifier of the project's license, such as
+	// Apache-2.0
+	License string `json:"license,omitempty"`
+}
+
+// IsZero: whether none of the metadata is set
+func (m ProjectMetadata) IsZero() bool {
+	return m == ProjectMetadata{}
+}
+
+// Validate: check that the homepage and documentation are http urls, and the
+// license looks like an spdx expression
+func (m ProjectMetadata) Validate() error {
+	for _, link := range []struct{ name, value string }{{"homepage", m.Homepage}, {"documentation url", m.DocumentationURL}} {
+		if link.value == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(link.value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s must be an http or https url: %s", link.name, link.value)
+		}
+	}
+
+	if strings.ContainsAny(m.License, "\t\n\"") {
+		return fmt.Errorf("license must be an spdx identifier, such as Apache-2.0: %s", m.License)
+	}
+
+	return nil
+}
+
+// SupportURL: the support contact as a link, a mailto: url for an email
+// address, or empty when it's neither a url nor an email address
+func (m ProjectMetadata) SupportURL() string {
+	switch {
+	case strings.Contains(m.Support, "://"):
+		return m.Support
+	case strings.Contains(m.Support, "@"):
+		return "mailto:" + m.Support
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,287 @@
+package artifactor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mirror: another storage prefix a version is published to along with the
+// primary one, such as a disaster recovery bucket, and the url it is served
+// from
+type Mirror struct {
+	GcsPrefix, UrlPrefix string
+}
+
+// MirrorReport: what was written to one mirror while publishing a version
+type MirrorReport struct {
+	GcsPrefix string            `json:"gcs_prefix"`
+	UrlPrefix string            `json:"url_prefix"`
+	Succeeded bool              `json:"succeeded"`
+	Error     string            `json:"error,omitempty"`
+	Objects   []PublishedObject `json:"objects"`
+}
+
+// mirrorPath: the path of a primary object in the mirror. Objects keep their
+// name relative to the storage prefix
+func (m Mirror) mirrorPath(opts *Options, gcsPath string) string {
+	return m.GcsPrefix + strings.TrimPrefix(gcsPath, opts.GcsPrefix)
+}
+
+// mirrorURL: the url a primary object is served from by the mirror
+func (m Mirror) mirrorURL(opts *Options, gcsPath string) string {
+	return m.UrlPrefix + strings.TrimPrefix(gcsPath, opts.GcsPrefix)
+}
+
+// mirrorComponents: the components as they're published to the mirror
+func (m Mirror) mirrorComponents(opts *Options, components []Component) []Component {
+	mirrored := make([]Component, 0, len(components))
+	for _, component := range components {
+		component.URL = m.mirrorURL(opts, component.GCSFilepath)
+		component.GCSFilepath = m.mirrorPath(opts, component.GCSFilepath)
+		component.Mirrors = nil
+		mirrored = append(mirrored, component)
+	}
+
+	return mirrored
+}
+
+// mirrorURLs: return a copy of the components listing the url each mirror
+// serves them from, so the manifest names every copy of a component
+func mirrorURLs(opts *Options, components []Component) []Component {
+	listed := make([]Component, 0, len(components))
+	for _, component := range components {
+		component.Mirrors = make([]string, 0, len(opts.Mirrors))
+		for _, mirror := range opts.Mirrors {
+			component.Mirrors = append(component.Mirrors, mirror.mirrorURL(opts, component.GCSFilepath))
+		}
+
+		listed = append(listed, component)
+	}
+
+	return listed
+}
+
+// mirrorPaths: the path of each of the primary paths in every mirror
+func mirrorPaths(opts *Options, gcsPaths []string) []string {
+	paths := make([]string, 0, len(gcsPaths)*len(opts.Mirrors))
+	for _, mirror := range opts.Mirrors {
+		for _, gcsPath := range gcsPaths {
+			paths = append(paths, mirror.mirrorPath(opts, gcsPath))
+		}
+	}
+
+	return paths
+}
+
+// uploadMirrors: upload the components to every mirror concurrently,
+// recording what was written to each in the report. Every mirror is uploaded
+// to even when another fails, and the error names each mirror that failed
+func uploadMirrors(opts *Options, components []Component, generations map[string]int64, report *PublishReport, settings uploadSettings) error {
+	if len(opts.Mirrors) == 0 {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	objects := make([][]PublishedObject, len(opts.Mirrors))
+	errs := make([]error, len(opts.Mirrors))
+
+	for idx, mirror := range opts.Mirrors {
+		wg.Add(1)
+
+		go func(idx int, mirror Mirror) {
+			defer wg.Done()
+			objects[idx], errs[idx] = uploadComponentsWithProgress(mirror.GcsPrefix, mirror.mirrorComponents(opts, components), generations, opts.FailFast, nil, settings)
+		}(idx, mirror)
+	}
+
+	wg.Wait()
+
+	failures := make([]string, 0)
+	for idx, mirror := range opts.Mirrors {
+		report.mirror(mirror, objects[idx], errs[idx])
+		if errs[idx] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", mirror.GcsPrefix, errs[idx]))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("publishing to mirrors failed: %s", strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// MirroredVersion: the objects of a version copied to a mirror, and those the
+// mirror already held
+type MirroredVersion struct {
+	Version           string
+	Copied, Unchanged int
+}
+
+// MirrorVersions: replicate published versions of a project to another
+// bucket, such as one in another region, with server side copies driven by
+// each version's manifest. Objects the destination already holds, by size and
+// md5, are left alone and every copy is verified against the checksums of its
+// source, so mirroring can be run again to pick up newly published versions.
+// Every version is mirrored when none are given, followed by the project's
+// aliases and project wide files such as its index, so that they never name
+// a version the mirror doesn't hold yet. These are reported last, with an
+// empty Version. Up to concurrency versions are mirrored at once
+func MirrorVersions(src, dst Project, versions []string, concurrency int) ([]MirroredVersion, error) {
+	whole := len(versions) == 0
+	if whole {
+		manifests, err := listManifests(src, concurrency)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, manifest := range manifests {
+			versions = append(versions, manifest.Version)
+		}
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	mirrored := make([]MirroredVersion, len(versions))
+	errs := make([]error, len(versions))
+	semaphore := make(chan struct{}, concurrency)
+
+	for idx, version := range versions {
+		wg.Add(1)
+
+		go func(idx int, version string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			mirrored[idx], errs[idx] = mirrorVersion(src, dst, version)
+		}(idx, version)
+	}
+
+	wg.Wait()
+
+	failures := make([]string, 0)
+	for idx, version := range versions {
+		if errs[idx] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", version, errs[idx]))
+		}
+	}
+
+	if len(failures) > 0 {
+		return mirrored, fmt.Errorf("mirroring failed: %s", strings.Join(failures, "; "))
+	}
+
+	if !whole {
+		return mirrored, nil
+	}
+
+	copies, err := projectCopies(src, dst, concurrency)
+	if err != nil {
+		return mirrored, err
+	}
+
+	project := MirroredVersion{}
+	project.Copied, project.Unchanged, err = mirrorCopies(dst, copies)
+	return append(mirrored, project), err
+}
+
+// mirrorVersion: copy a version's components and optional files to the
+// mirror, and then its manifests, so that a mirror interrupted part way never
+// serves a manifest listing components it doesn't hold
+func mirrorVersion(src, dst Project, version string) (MirroredVersion, error) {
+	copies, err := versionCopies(src, dst, version)
+	if err != nil {
+		return MirroredVersion{}, err
+	}
+
+	dstPrefix := dst.gcsPrefix + version + "/"
+	manifests := make([]componentCopy, 0, len(managedFilepaths))
+	rest := make([]componentCopy, 0, len(copies))
+	for _, cp := range copies {
+		if isManagedFilepath(strings.TrimPrefix(cp.dst.GCSFilepath, dstPrefix)) {
+			manifests = append(manifests, cp)
+			continue
+		}
+
+		rest = append(rest, cp)
+	}
+
+	mirrored := MirroredVersion{Version: version}
+	for _, group := range [][]componentCopy{rest, manifests} {
+		copied, unchanged, err := mirrorCopies(dst, group)
+		mirrored.Copied += copied
+		mirrored.Unchanged += unchanged
+		if err != nil {
+			return mirrored, err
+		}
+	}
+
+	return mirrored, nil
+}
+
+// mirrorCopies: make the copies whose destination doesn't already hold the
+// object, guarded by the destination's current generations, returning how
+// many were copied and how many were already there
+func mirrorCopies(dst Project, copies []componentCopy) (int, int, error) {
+	copies, unchanged, err := skipUnchangedCopies(copies)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dstPaths := make([]string, 0, len(copies))
+	for _, cp := range copies {
+		dstPaths = append(dstPaths, cp.dst.GCSFilepath)
+	}
+
+	generations, err := fetchGenerations(dstPaths)
+	if err != nil {
+		return 0, len(unchanged), err
+	}
+
+	objects, err := copyComponents(dst.gcsPrefix, copies, generations, false)
+	return len(objects), len(unchanged), err
+}
+
+// projectCopies: the copies of a project's aliases, and whichever of its
+// project wide files it has, such as its index, root manifest and keyring
+func projectCopies(src, dst Project, concurrency int) ([]componentCopy, error) {
+	aliases, err := listAliases(src, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	aliasFilepaths := append(append([]string(nil), managedFilepaths...), aliasPointerFilepaths...)
+
+	copies := make([]componentCopy, 0)
+	for _, alias := range names {
+		aliasCopies, err := optionalCopies(src.gcsPrefix+alias+"/", dst.gcsPrefix+alias+"/", aliasFilepaths)
+		if err != nil {
+			return nil, err
+		}
+
+		copies = append(copies, aliasCopies...)
+	}
+
+	projectFilepaths := append(append([]string(nil), indexFilepaths...), rootFilepaths...)
+	projectFilepaths = append(projectFilepaths, keyRingFilepaths...)
+	projectFilepaths = append(projectFilepaths, aliasHistoryFilepaths...)
+
+	projectFileCopies, err := optionalCopies(src.gcsPrefix, dst.gcsPrefix, projectFilepaths)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(copies, projectFileCopies...), nil
+}
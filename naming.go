@@ -0,0 +1,114 @@
+package artifactor
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// default template of a component's object name, relative to the project
+const defaultObjectTemplate = "{version}/{path}"
+
+// NamingScheme: how component filepaths map to object names, for buckets
+// fronted by a CDN whose rules depend on a particular key structure
+type NamingScheme struct {
+	// Template is the object name relative to the project, where {version},
+	// {platform}, {dir}, {name} and {path} are replaced with the version, the
+	// component's os/arch platform (or "any"), its directory, its file name
+	// and its full filepath. Defaults to {version}/{path}
+	Template string
+
+	// Flatten drops directories from {path}, and Lowercase lowercases the
+	// whole object name
+	Flatten   bool
+	Lowercase bool
+
+	// DigestSuffix adds the first 12 characters of the sha256 of the
+	// component to its name, before the extension, such as
+	// artifactor-08c66345777b.tar.gz
+	DigestSuffix bool
+}
+
+// objectName: the object name of a component under the scheme, relative to
+// the project
+func (n NamingScheme) objectName(version string, component Component) string {
+	template := n.Template
+	if template == "" {
+		template = defaultObjectTemplate
+	}
+
+	dir, name := path.Split(component.Filepath)
+	dir = strings.TrimSuffix(dir, "/")
+
+	if n.DigestSuffix && len(component.Sha256Checksum) >= 12 {
+		base, extension := splitExtension(name)
+		name = base + "-" + component.Sha256Checksum[:12] + extension
+	}
+
+	filepath := path.Join(dir, name)
+	if n.Flatten {
+		filepath = name
+	}
+
+	platform := componentPlatform(component.Filepath)
+	if platform == "" {
+		platform = "any"
+	}
+
+	objectName := strings.NewReplacer(
+		"{version}", version,
+		"{platform}", platform,
+		"{dir}", dir,
+		"{name}", name,
+		"{path}", filepath,
+	).Replace(template)
+
+	// an empty {dir} shouldn't leave an empty path segment behind
+	objectName = path.Clean("/" + objectName)[1:]
+
+	if n.Lowercase {
+		objectName = strings.ToLower(objectName)
+	}
+
+	return objectName
+}
+
+// splitExtension: split a file name into its base and its extension, keeping
+// compound extensions such as .tar.gz together
+func splitExtension(name string) (string, string) {
+	if idx := strings.Index(name, ".tar."); idx > 0 {
+		return name[:idx], name[idx:]
+	}
+
+	extension := path.Ext(name)
+	if extension == name {
+		return name, ""
+	}
+
+	return strings.TrimSuffix(name, extension), extension
+}
+
+// nameComponents: name each component's object under the project according
+// to the scheme, failing if two components would share an object or one
+// would collide with the version's manifests
+func nameComponents(project Project, version string, components []Component, scheme NamingScheme) ([]Component, error) {
+	reserved := make(map[string]string, len(components)+len(managedFilepaths))
+	for _, filepath := range managedFilepaths {
+		reserved[version+"/"+filepath] = filepath
+	}
+
+	named := make([]Component, 0, len(components))
+	for _, component := range components {
+		objectName := scheme.objectName(version, component)
+		if other, ok := reserved[objectName]; ok {
+			return nil, fmt.Errorf("%s and %s are both named %s", component.Filepath, other, objectName)
+		}
+		reserved[objectName] = component.Filepath
+
+		component.GCSFilepath = project.gcsPrefix + objectName
+		component.URL = project.urlPrefix + objectName
+		named = append(named, component)
+	}
+
+	return named, nil
+}
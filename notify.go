@@ -0,0 +1,179 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// kinds of events sent to notifiers
+const (
+	EventPublished     = "published"
+	EventPublishFailed = "publish_failed"
+	EventYanked        = "yanked"
+	EventCorruption    = "corruption"
+)
+
+// Event: something that happened to a version of a project
+type Event struct {
+	Kind      string    `json:"kind"`
+	Project   string    `json:"project"`
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	Summary   string    `json:"summary"`
+	Details   []string  `json:"details"`
+}
+
+// Notifier: told about events, such as a version being published
+type Notifier interface {
+	Notify(Event) error
+}
+
+// notify: send an event to every notifier. Notification failures are logged
+// rather than returned, since the event has already happened
+func notify(notifiers []Notifier, event Event) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(event); err != nil {
+			log.Println(fmt.Sprintf("warning: failed to notify %s %s %s: %v", event.Project, event.Version, event.Kind, err))
+		}
+	}
+}
+
+// publishedEvent: describe a successful publish
+func publishedEvent(project Project, manifest ComponentManifest, report PublishReport) Event {
+	bytes := int64(0)
+	for _, component := range manifest.Components {
+		bytes += component.Bytes
+	}
+
+	details := []string{
+		fmt.Sprintf("manifest: %smanifest.json", project.urlPrefix+manifest.Version+"/"),
+		fmt.Sprintf("components: %d (%s)", len(manifest.Components), humanBytes(bytes)),
+		fmt.Sprintf("objects written: %d", len(report.Objects)),
+	}
+	if manifest.ExpiresAt != nil {
+		details = append(details, fmt.Sprintf("expires: %s", manifest.ExpiresAt.Format(time.RFC3339)))
+	}
+	for _, component := range manifest.Components {
+		details = append(details, fmt.Sprintf("  %s %s %s", component.Filepath, humanBytes(component.Bytes), component.Sha256Checksum))
+	}
+
+	return Event{
+		Kind:      EventPublished,
+		Project:   manifest.Project,
+		Version:   manifest.Version,
+		Timestamp: manifest.Timestamp,
+		Summary:   fmt.Sprintf("%s %s was published", manifest.Project, manifest.Version),
+		Details:   details,
+	}
+}
+
+// publishFailedEvent: describe a failed publish
+func publishFailedEvent(project Project, version string, err error) Event {
+	return Event{
+		Kind:      EventPublishFailed,
+		Project:   project.name,
+		Version:   version,
+		Timestamp: time.Now(),
+		Summary:   fmt.Sprintf("publishing %s %s failed: %v", project.name, version, err),
+		Details:   []string{err.Error()},
+	}
+}
+
+// ExecNotifier: runs a command for each event, passing the event as json on
+// stdin and its kind, project and version in the environment
+type ExecNotifier struct {
+	Command []string
+}
+
+func (e ExecNotifier) Notify(event Event) error {
+	if len(e.Command) == 0 {
+		return fmt.Errorf("no command to run")
+	}
+
+	jsonBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(e.Command[0], e.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(jsonBytes)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"ARTIFACTOR_EVENT_KIND="+event.Kind,
+		"ARTIFACTOR_EVENT_PROJECT="+event.Project,
+		"ARTIFACTOR_EVENT_VERSION="+event.Version,
+		"ARTIFACTOR_EVENT_SUMMARY="+event.Summary,
+	)
+
+	return cmd.Run()
+}
+
+// WebhookNotifier: posts each event as json to a url, such as an alerting
+// service's webhook integration
+type WebhookNotifier struct {
+	URL string
+}
+
+func (w WebhookNotifier) Notify(event Event) error {
+	jsonBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient().Post(w.URL, "application/json", bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %s", w.URL, resp.Status)
+	}
+
+	return nil
+}
+
+// SMTPNotifier: emails events to a list of addresses
+type SMTPNotifier struct {
+	// Addr is the host:port of the smtp server
+	Addr string
+	From string
+	To   []string
+
+	// Username and Password, when set, authenticate with the server
+	Username, Password string
+}
+
+func (s SMTPNotifier) Notify(event Event) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [artifactor] %s %s %s\r\n", event.Project, event.Version, event.Kind)
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.Timestamp.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", event.Summary)
+	for _, detail := range event.Details {
+		fmt.Fprintf(&msg, "%s\r\n", detail)
+	}
+
+	return smtp.SendMail(s.Addr, auth, s.From, s.To, msg.Bytes())
+}
@@ -0,0 +1,93 @@
+package artifactor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// VerifyObjects: stat every component of a manifest in the storage bucket, up
+// to concurrency at once, and confirm its size, md5 and crc32c match the
+// manifest without downloading it. Every mismatch or missing object is
+// reported to the alerters as corruption, and returned together as an error
+func VerifyObjects(manifest ComponentManifest, concurrency int, alerters []Notifier) error {
+	missing, mismatched, err := checkObjects(manifest.Components, concurrency)
+	if err != nil {
+		return err
+	}
+
+	problems := make([]string, 0, len(missing)+len(mismatched))
+	for _, gcsPath := range missing {
+		problems = append(problems, fmt.Sprintf("%s: missing", gcsPath))
+	}
+	problems = append(problems, mismatched...)
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.Strings(problems)
+	notify(alerters, Event{
+		Kind:      EventCorruption,
+		Project:   manifest.Project,
+		Version:   manifest.Version,
+		Timestamp: time.Now(),
+		Summary:   fmt.Sprintf("%d of %d objects of %s %s don't match its manifest", len(problems), len(manifest.Components), manifest.Project, manifest.Version),
+		Details:   problems,
+	})
+
+	return fmt.Errorf("%d of %d objects don't match the manifest:\n%s", len(problems), len(manifest.Components), strings.Join(problems, "\n"))
+}
+
+// checkObjects: stat every component, up to concurrency at once, returning
+// the paths of those which don't exist and a description of each whose size
+// or checksums don't match
+func checkObjects(components []Component, concurrency int) ([]string, []string, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	missingCh := make(chan string, len(components))
+	mismatchedCh := make(chan string, len(components))
+	err = forEachComponent(components, concurrency, func(component Component) error {
+		attrs, err := store.Attrs(ctx, component.GCSFilepath)
+		if err == storage.ErrObjectNotExist {
+			missingCh <- component.GCSFilepath
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", component.GCSFilepath, err)
+		}
+
+		if err := verifyObjectAttrs(attrs, component); err != nil {
+			mismatchedCh <- err.Error()
+		}
+
+		return nil
+	})
+	close(missingCh)
+	close(mismatchedCh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	missing := make([]string, 0, len(missingCh))
+	for gcsPath := range missingCh {
+		missing = append(missing, gcsPath)
+	}
+	sort.Strings(missing)
+
+	mismatched := make([]string, 0, len(mismatchedCh))
+	for problem := range mismatchedCh {
+		mismatched = append(mismatched, problem)
+	}
+	sort.Strings(mismatched)
+
+	return missing, mismatched, nil
+}
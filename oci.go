@@ -0,0 +1,422 @@
+package artifactor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// media types of the oci artifact a version is pushed as
+const (
+	ociManifestMediaType  = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyMediaType     = "application/vnd.oci.empty.v1+json"
+	ociArtifactType       = "application/vnd.artifactor.version.v1"
+	ociComponentMediaType = "application/vnd.artifactor.component.v1"
+)
+
+var ociTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)
+
+// ociDescriptor: a reference to a blob in an oci manifest
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest: an oci image manifest describing an artifact, in the layout
+// oras uses, with one layer per file titled by its path
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ociRegistry: a client for pushing to one repository of an oci registry,
+// authenticating with the local docker credentials
+type ociRegistry struct {
+	host, repository string
+	client           *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// newOCIRegistry: a client for a repository such as ghcr.io/org/project
+func newOCIRegistry(reference string) (*ociRegistry, error) {
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) != 2 || !strings.ContainsAny(parts[0], ".:") {
+		return nil, fmt.Errorf("oci repository %q must be of the form registry.example.com/repository", reference)
+	}
+
+	host := parts[0]
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+
+	return &ociRegistry{host: host, repository: parts[1], client: httpClient()}, nil
+}
+
+// pushOCIArtifact: push the components and the version's manifests to an oci
+// registry as a single artifact, tagged with the version and each alias, so
+// registries' auth, replication and retention can be reused for artifacts
+func pushOCIArtifact(reference string, components []Component, tags []string, ts time.Time) error {
+	version := tags[0]
+	for idx, tag := range tags {
+		// build metadata isn't allowed in tags, so + is replaced with _ as
+		// helm does
+		tags[idx] = strings.Replace(tag, "+", "_", -1)
+		if !ociTagPattern.MatchString(tags[idx]) {
+			return fmt.Errorf("%s: %q isn't a valid oci tag", reference, tag)
+		}
+	}
+
+	registry, err := newOCIRegistry(reference)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(components))
+	layers := make([]ociDescriptor, len(components))
+
+	for idx, component := range components {
+		wg.Add(1)
+
+		go func(idx int, component Component) {
+			defer wg.Done()
+
+			layers[idx] = ociDescriptor{
+				MediaType:   ociComponentMediaType,
+				Digest:      "sha256:" + component.Sha256Checksum,
+				Size:        component.Bytes,
+				Annotations: map[string]string{"org.opencontainers.image.title": component.Filepath},
+			}
+
+			if err := registry.pushBlob(layers[idx], func() (io.ReadCloser, error) {
+				return component.openContents()
+			}); err != nil {
+				errCh <- err
+			}
+		}(idx, component)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+	}
+
+	emptyConfig := []byte("{}")
+	config := ociDescriptor{
+		MediaType: ociEmptyMediaType,
+		Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(emptyConfig)),
+		Size:      int64(len(emptyConfig)),
+	}
+	if err := registry.pushBlob(config, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(emptyConfig)), nil
+	}); err != nil {
+		return err
+	}
+
+	manifest, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  ociArtifactType,
+		Config:        config,
+		Layers:        layers,
+		Annotations: map[string]string{
+			"org.opencontainers.image.version": version,
+			"org.opencontainers.image.created": ts.UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := registry.pushManifest(tag, manifest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushBlob: upload a blob in a single request, unless the registry has it
+func (r *ociRegistry) pushBlob(blob ociDescriptor, open func() (io.ReadCloser, error)) error {
+	resp, err := r.do("HEAD", r.url("blobs/"+blob.Digest), nil, 0, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = r.do("POST", r.url("blobs/uploads/"), nil, 0, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("%s: starting upload of %s: unexpected status %s", r.repository, blob.Digest, resp.Status)
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	body, err := open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	resp, err = r.do("PUT", location.String(), body, blob.Size, "application/octet-stream")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s: uploading %s: unexpected status %s", r.repository, blob.Digest, resp.Status)
+	}
+
+	return nil
+}
+
+// pushManifest: upload a manifest, tagging it
+func (r *ociRegistry) pushManifest(tag string, manifest []byte) error {
+	resp, err := r.do("PUT", r.url("manifests/"+tag), bytes.NewReader(manifest), int64(len(manifest)), ociManifestMediaType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s:%s: pushing manifest: unexpected status %s", r.repository, tag, resp.Status)
+	}
+
+	return nil
+}
+
+func (r *ociRegistry) url(path string) string {
+	return "https://" + r.host + "/v2/" + r.repository + "/" + path
+}
+
+// do: make a request to the registry, authenticating with a bearer token
+// from the registry's token service when it asks for one. Bodies which can't
+// be replayed are only sent once a token has been obtained
+func (r *ociRegistry) do(method, requestURL string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(method, requestURL, body)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = size
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		r.mu.Lock()
+		token := r.token
+		r.mu.Unlock()
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if username, password, ok := ociCredentials(r.host); ok {
+			req.SetBasicAuth(username, password)
+		}
+
+		return req, nil
+	}
+
+	if body != nil && r.currentToken() == "" {
+		// the registry is asked for a token before a body is sent, so
+		// that it never has to be sent twice
+		resp, err := r.do("GET", "https://"+r.host+"/v2/", nil, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || body != nil {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	if err := r.authenticate(resp.Header.Get("WWW-Authenticate")); err != nil {
+		return nil, err
+	}
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.client.Do(req)
+}
+
+func (r *ociRegistry) currentToken() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.token
+}
+
+// authenticate: fetch a bearer token for pushing to the repository from the
+// token service named in a WWW-Authenticate challenge
+func (r *ociRegistry) authenticate(challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("%s: unauthorized, check the docker credentials for %s", r.repository, r.host)
+	}
+
+	params := make(map[string]string)
+	for _, match := range regexp.MustCompile(`(\w+)="([^"]*)"`).FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil {
+		return err
+	}
+	query := tokenURL.Query()
+	query.Set("service", params["service"])
+	query.Set("scope", "repository:"+r.repository+":pull,push")
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if username, password, ok := ociCredentials(r.host); ok {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: fetching a registry token: unexpected status %s", r.repository, resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	r.mu.Lock()
+	r.token = token.Token
+	r.mu.Unlock()
+
+	return nil
+}
+
+// ociCredentials: the credentials docker has for a registry, from its
+// config.json or from the credential helper it names
+func ociCredentials(host string) (string, string, bool) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	byts, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return "", "", false
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(byts, &config); err != nil {
+		return "", "", false
+	}
+
+	serverURL := host
+	if host == "registry-1.docker.io" {
+		serverURL = "https://index.docker.io/v1/"
+	}
+
+	helper := config.CredHelpers[serverURL]
+	if helper == "" {
+		helper = config.CredsStore
+	}
+	if helper != "" {
+		cmd := exec.Command("docker-credential-"+helper, "get")
+		cmd.Stdin = strings.NewReader(serverURL)
+
+		output, err := cmd.Output()
+		if err == nil {
+			var credentials struct {
+				Username, Secret string
+			}
+			if json.Unmarshal(output, &credentials) == nil {
+				return credentials.Username, credentials.Secret, true
+			}
+		}
+	}
+
+	for _, key := range []string{serverURL, "https://" + serverURL} {
+		auth, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", false
+		}
+
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) == 2 {
+			return parts[0], parts[1], true
+		}
+	}
+
+	return "", "", false
+}
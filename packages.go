@@ -0,0 +1,49 @@
+package artifactor
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// signPackages: sign the .deb and .rpm components with the given gpg key,
+// using dpkg-sig and rpmsign, so that the packages themselves carry a
+// signature. Packages are copied into the scratch directory and signed there,
+// leaving the source directory untouched. Signing changes their contents, so
+// the signed components are returned with fresh checksums
+func signPackages(components []Component, key string, scratch string, gcsPrefix, urlPrefix string) ([]Component, error) {
+	signed := make([]Component, 0, len(components))
+
+	for _, component := range components {
+		signedFilepath := filepath.Join(scratch, component.Filepath)
+
+		var cmd *exec.Cmd
+		switch {
+		case strings.HasSuffix(component.Filepath, ".deb"):
+			cmd = exec.Command("dpkg-sig", "--sign", "builder", "-k", key, signedFilepath)
+		case strings.HasSuffix(component.Filepath, ".rpm"):
+			cmd = exec.Command("rpmsign", "--addsign", "--define", "_gpg_name "+key, signedFilepath)
+		default:
+			signed = append(signed, component)
+			continue
+		}
+
+		if err := component.writeContents(signedFilepath); err != nil {
+			return nil, err
+		}
+
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("signing %s: %v: %s", component.Filepath, err, strings.TrimSpace(string(output)))
+		}
+
+		signedComponent, err := newTempComponent(scratch, component.Filepath, gcsPrefix, urlPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		signed = append(signed, signedComponent)
+	}
+
+	return signed, nil
+}
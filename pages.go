@@ -0,0 +1,146 @@
+package artifactor
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// path under which static assets for the html pages are served
+const staticPathPrefix = "/_static/"
+
+// default templates for the html pages. Users may override any of them by
+// providing a file of the same name in a templates directory
+const defaultTemplates = `
+{{define "header.html"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+{{end}}
+
+{{define "footer.html"}}</body>
+</html>
+{{end}}
+
+{{define "version.html"}}{{template "header.html" .}}
+<h1>{{.Manifest.Project}} {{.Manifest.Version}}</h1>
+<p>Published {{.Manifest.Timestamp.Format "2006-01-02 15:04:05 MST"}}{{if .Manifest.ExpiresAt}}, expires {{.Manifest.ExpiresAt.Format "2006-01-02 15:04:05 MST"}}{{end}}</p>
+{{with .Manifest.ProjectMetadata}}{{if not .IsZero}}<p>{{if .Homepage}}<a href="{{.Homepage}}">homepage</a> {{end}}{{if .DocumentationURL}}<a href="{{.DocumentationURL}}">documentation</a> {{end}}{{if .Support}}support: {{if .SupportURL}}<a href="{{.SupportURL}}">{{.Support}}</a>{{else}}{{.Support}}{{end}} {{end}}{{if .License}}license: {{.License}}{{end}}</p>
+{{end}}{{end}}{{with .Yanked}}<p><strong>Yanked</strong> {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}: {{.Reason}} (<a href="yanked.json">yanked.json</a>)</p>
+{{end}}{{if .Advisories}}<h2>Advisories</h2>
+<ul>
+{{range .Advisories}}<li>{{if .URL}}<a href="{{.URL}}">{{.ID}}</a>{{else}}{{.ID}}{{end}} ({{.Severity}}){{if .Summary}}: {{.Summary}}{{end}}</li>
+{{end}}</ul>
+<p><a href="advisories.json">advisories.json</a> (<a href="advisories.json.asc.sig">signature</a>)</p>
+{{end}}<p><a href="manifest.json">manifest.json</a> (<a href="manifest.json.asc.sig">signature</a>), <a href="checksums">checksums</a> (<a href="checksums.asc.sig">signature</a>)</p>
+<table>
+<tr><th>file</th><th>role</th><th>size</th><th>sha256</th></tr>
+{{range .Manifest.Components}}<tr><td><a href="{{.Filepath}}">{{.Filepath}}</a></td><td>{{.Role}}</td><td>{{humanBytes .Bytes}}</td><td><code>{{.Sha256Checksum}}</code></td></tr>
+{{end}}</table>
+{{template "footer.html" .}}{{end}}
+
+{{define "directory.html"}}{{template "header.html" .}}
+<h1>{{.Title}}</h1>
+{{if .Path}}<p><a href="../">up</a></p>
+{{end}}{{if .Versions}}<h2>Versions</h2>
+<table>
+<tr><th>version</th><th>published</th><th>components</th><th>size</th></tr>
+{{range .Versions}}<tr><td><a href="{{.Version}}/">{{.Version}}</a></td><td>{{.Timestamp.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.Components}}</td><td>{{humanBytes .Bytes}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Aliases}}<h2>Aliases</h2>
+<ul>
+{{range .Aliases}}<li>{{.Alias}}: <a href="{{.Version}}/">{{.Version}}</a></li>
+{{end}}</ul>
+{{end}}{{if .Directories}}<h2>{{if .Path}}Channels{{else}}Projects{{end}}</h2>
+<ul>
+{{range .Directories}}<li><a href="{{.}}/">{{.}}</a></li>
+{{end}}</ul>
+{{end}}{{template "footer.html" .}}{{end}}
+`
+
+// DirectoryPage: the data rendered by the directory.html template, listing
+// what's published beneath the bucket root, a project or a channel
+type DirectoryPage struct {
+	Title       string
+	Path        string
+	Versions    []DirectoryVersion
+	Aliases     []DirectoryAlias
+	Directories []string
+}
+
+// DirectoryVersion: a version listed on a directory page
+type DirectoryVersion struct {
+	Version    string
+	Timestamp  time.Time
+	Components int
+	Bytes      int64
+}
+
+// DirectoryAlias: an alias listed on a directory page, and the version it
+// serves
+type DirectoryAlias struct {
+	Alias   string
+	Version string
+}
+
+// VersionPage: the data rendered by the version.html template
+type VersionPage struct {
+	Title      string
+	Manifest   ComponentManifest
+	Advisories []Advisory
+	Yanked     *Yank
+}
+
+// parseTemplates: parse the default templates, overridden by any .html files
+// in the templates directory
+func parseTemplates(templatesDir string) (*template.Template, error) {
+	templates, err := template.New("artifactor").Funcs(template.FuncMap{
+		"humanBytes": humanBytes,
+	}).Parse(defaultTemplates)
+	if err != nil {
+		return nil, err
+	}
+
+	if templatesDir == "" {
+		return templates, nil
+	}
+
+	filepaths, err := filepath.Glob(filepath.Join(templatesDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	if len(filepaths) == 0 {
+		return templates, nil
+	}
+
+	return templates.ParseFiles(filepaths...)
+}
+
+// renderPage: execute a template into the response
+func (s *Server) renderPage(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// humanBytes: format a byte count using binary units
+func humanBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
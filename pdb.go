@@ -0,0 +1,215 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// msfMagic: the magic number a pdb 7.0 multi-stream file starts with
+var msfMagic = []byte("Microsoft C/C++ MSF 7.00\r\n\x1aDS\x00\x00\x00")
+
+// the streams of a pdb holding its guid and age
+const (
+	pdbInfoStream = 1
+	pdbDBIStream  = 3
+)
+
+// symbolServerPath: where a symbol server looks a pdb up beneath its root,
+// name/KEY/name, where the key is the pdb's guid followed by its age
+func symbolServerPath(component Component) (string, error) {
+	key, err := pdbSymbolKey(component)
+	if err != nil {
+		return "", err
+	}
+
+	name := path.Base(component.Filepath)
+	return name + "/" + key + "/" + name, nil
+}
+
+// pdbSymbolKey: the key a symbol server files a pdb under, its guid in upper
+// case hex followed by its age, read from the streams of a pdb 7.0 file. The
+// age is taken from the dbi stream, which is the age executables record, and
+// from the info stream of pdbs without one. A pdb in an archive, or staged
+// to the bucket, is read into memory, since its streams are read out of order
+func pdbSymbolKey(component Component) (string, error) {
+	var reader io.ReaderAt
+	var size int64
+	if !component.hasLocalFile() {
+		byts, err := component.readContents()
+		if err != nil {
+			return "", err
+		}
+		reader, size = bytes.NewReader(byts), int64(len(byts))
+	} else {
+		file, err := os.Open(component.contentsFilepath())
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return "", err
+		}
+		reader, size = file, info.Size()
+	}
+
+	msf, err := readMSF(reader, size)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", component.Filepath, err)
+	}
+
+	infoStream, err := msf.readStream(pdbInfoStream, 28)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", component.Filepath, err)
+	}
+
+	age := binary.LittleEndian.Uint32(infoStream[8:12])
+	guid := infoStream[12:28]
+
+	if dbiStream, err := msf.readStream(pdbDBIStream, 12); err == nil {
+		age = binary.LittleEndian.Uint32(dbiStream[8:12])
+	}
+
+	return fmt.Sprintf("%08X%04X%04X%X%X",
+		binary.LittleEndian.Uint32(guid[0:4]),
+		binary.LittleEndian.Uint16(guid[4:6]),
+		binary.LittleEndian.Uint16(guid[6:8]),
+		guid[8:16],
+		age,
+	), nil
+}
+
+// msfFile: the stream directory of a multi-stream file, giving the size and
+// blocks of each stream
+type msfFile struct {
+	reader       io.ReaderAt
+	blockSize    int64
+	streamSizes  []uint32
+	streamBlocks [][]uint32
+}
+
+// readMSF: read the superblock and stream directory of a multi-stream file
+func readMSF(reader io.ReaderAt, size int64) (msfFile, error) {
+	superblock := make([]byte, 56)
+	if _, err := reader.ReadAt(superblock, 0); err != nil {
+		return msfFile{}, fmt.Errorf("not a pdb 7.0 file")
+	}
+
+	if !bytes.Equal(superblock[:len(msfMagic)], msfMagic) {
+		// portable pdbs, written by the .net compilers, are a different
+		// format altogether
+		return msfFile{}, fmt.Errorf("not a pdb 7.0 file")
+	}
+
+	blockSize := int64(binary.LittleEndian.Uint32(superblock[32:36]))
+	directoryBytes := int64(binary.LittleEndian.Uint32(superblock[44:48]))
+	blockMapBlock := int64(binary.LittleEndian.Uint32(superblock[52:56]))
+
+	switch blockSize {
+	case 512, 1024, 2048, 4096:
+	default:
+		return msfFile{}, fmt.Errorf("invalid block size %d", blockSize)
+	}
+
+	if directoryBytes < 4 || directoryBytes > size {
+		return msfFile{}, fmt.Errorf("invalid stream directory size %d", directoryBytes)
+	}
+
+	msf := msfFile{reader: reader, blockSize: blockSize}
+
+	// the block map lists the blocks the stream directory is spread over
+	directoryBlockCount := (directoryBytes + blockSize - 1) / blockSize
+	blockMap := make([]byte, directoryBlockCount*4)
+	if _, err := reader.ReadAt(blockMap, blockMapBlock*blockSize); err != nil {
+		return msfFile{}, fmt.Errorf("reading block map: %v", err)
+	}
+
+	directoryBlocks := make([]uint32, directoryBlockCount)
+	for idx := range directoryBlocks {
+		directoryBlocks[idx] = binary.LittleEndian.Uint32(blockMap[idx*4:])
+	}
+
+	directory, err := msf.readBlocks(directoryBlocks, directoryBytes)
+	if err != nil {
+		return msfFile{}, fmt.Errorf("reading stream directory: %v", err)
+	}
+
+	streamCount := int64(binary.LittleEndian.Uint32(directory[0:4]))
+	offset := int64(4)
+	if offset+streamCount*4 > directoryBytes {
+		return msfFile{}, fmt.Errorf("invalid stream count %d", streamCount)
+	}
+
+	msf.streamSizes = make([]uint32, streamCount)
+	for idx := range msf.streamSizes {
+		msf.streamSizes[idx] = binary.LittleEndian.Uint32(directory[offset:])
+		offset += 4
+
+		// deleted streams are given a size of -1
+		if msf.streamSizes[idx] == 0xffffffff {
+			msf.streamSizes[idx] = 0
+		}
+	}
+
+	msf.streamBlocks = make([][]uint32, streamCount)
+	for idx, streamSize := range msf.streamSizes {
+		blockCount := (int64(streamSize) + blockSize - 1) / blockSize
+		if offset+blockCount*4 > directoryBytes {
+			return msfFile{}, fmt.Errorf("stream %d: invalid size %d", idx, streamSize)
+		}
+
+		msf.streamBlocks[idx] = make([]uint32, blockCount)
+		for block := range msf.streamBlocks[idx] {
+			msf.streamBlocks[idx][block] = binary.LittleEndian.Uint32(directory[offset:])
+			offset += 4
+		}
+	}
+
+	return msf, nil
+}
+
+// readStream: the first length bytes of a stream
+func (m msfFile) readStream(stream int, length int64) ([]byte, error) {
+	if stream >= len(m.streamSizes) || int64(m.streamSizes[stream]) < length {
+		return nil, fmt.Errorf("stream %d: missing or truncated", stream)
+	}
+
+	return m.readBlocks(m.streamBlocks[stream], length)
+}
+
+// readBlocks: the first length bytes of the given blocks, read in order
+func (m msfFile) readBlocks(blocks []uint32, length int64) ([]byte, error) {
+	byts := make([]byte, 0, length)
+	for _, block := range blocks {
+		if int64(len(byts)) >= length {
+			break
+		}
+
+		chunk := make([]byte, m.blockSize)
+		if remaining := length - int64(len(byts)); remaining < m.blockSize {
+			chunk = chunk[:remaining]
+		}
+
+		if _, err := m.reader.ReadAt(chunk, int64(block)*m.blockSize); err != nil {
+			return nil, err
+		}
+		byts = append(byts, chunk...)
+	}
+
+	if int64(len(byts)) < length {
+		return nil, fmt.Errorf("truncated")
+	}
+
+	return byts, nil
+}
+
+// isPDBFilepath: whether a path is a windows pdb
+func isPDBFilepath(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".pdb")
+}
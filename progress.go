@@ -0,0 +1,98 @@
+package artifactor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// kinds of progress events sent while publishing
+const (
+	ProgressStarted           = "started"
+	ProgressUploading         = "uploading"
+	ProgressObjectWritten     = "object_written"
+	ProgressManifestPublished = "manifest_published"
+	ProgressSucceeded         = "succeeded"
+	ProgressFailed            = "failed"
+)
+
+// ProgressEvent: a step of a publish, for tools wrapping artifactor to show
+// its status as it happens. Completed and Total count the components written
+// so far out of those being uploaded or copied
+type ProgressEvent struct {
+	Kind      string    `json:"kind"`
+	Project   string    `json:"project"`
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Filepath  string `json:"filepath,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Outcome   string `json:"outcome,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+	Completed int    `json:"completed,omitempty"`
+	Total     int    `json:"total,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// ProgressReporter: told about each step of a publish as it happens
+type ProgressReporter interface {
+	Progress(ProgressEvent)
+}
+
+// reportProgress: send an event to the reporter, if there is one
+func reportProgress(reporter ProgressReporter, event ProgressEvent) {
+	if reporter == nil {
+		return
+	}
+
+	event.Timestamp = time.Now()
+	reporter.Progress(event)
+}
+
+// SocketProgress: streams progress events as json lines to a unix socket,
+// which the wrapping tool listens on
+type SocketProgress struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	failed bool
+}
+
+// DialProgressSocket: connect to the unix socket progress is streamed to
+func DialProgressSocket(socketPath string) (*SocketProgress, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SocketProgress{conn: conn}, nil
+}
+
+// Progress: write the event as a line of json. A listener going away doesn't
+// fail the publish, so the first failed write is logged and the rest skipped
+func (s *SocketProgress) Progress(event ProgressEvent) {
+	jsonBytes, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed {
+		return
+	}
+
+	if _, err := s.conn.Write(append(jsonBytes, '\n')); err != nil {
+		log.Println(fmt.Sprintf("warning: streaming progress: %v", err))
+		s.failed = true
+	}
+}
+
+// Close: disconnect from the socket
+func (s *SocketProgress) Close() error {
+	return s.conn.Close()
+}
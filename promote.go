@@ -0,0 +1,352 @@
+package artifactor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"cloud.google.com/go/storage"
+)
+
+// CopyVersion: copy a published version, including its manifests and
+// signatures, from one project location to another using server side
+// rewrites. Every copied object is verified against the checksums of its
+// source, so promoting or mirroring a version never requires downloading it
+func CopyVersion(src, dst Project, version string) error {
+	copies, err := versionCopies(src, dst, version)
+	if err != nil {
+		return err
+	}
+
+	dstPaths := make([]string, 0, len(copies))
+	for _, cp := range copies {
+		dstPaths = append(dstPaths, cp.dst.GCSFilepath)
+	}
+
+	generations, err := fetchGenerations(dstPaths)
+	if err != nil {
+		return err
+	}
+
+	_, err = copyComponents(dst.gcsPrefix, copies, generations, false)
+	return err
+}
+
+// versionCopies: the copies of every object of a published version, its
+// components followed by its manifests and whichever optional files it has,
+// from one project location to another
+func versionCopies(src, dst Project, version string) ([]componentCopy, error) {
+	srcPrefix := src.gcsPrefix + version + "/"
+	dstPrefix := dst.gcsPrefix + version + "/"
+
+	manifest, err := fetchManifest(srcPrefix + "manifest.json")
+	if err != nil {
+		return nil, err
+	}
+
+	copies := make([]componentCopy, 0, len(manifest.Components)+len(managedFilepaths))
+	for _, component := range manifest.Components {
+		dstComponent := component
+		dstComponent.GCSFilepath = dstPrefix + component.Filepath
+
+		copies = append(copies, componentCopy{
+			src: component.GCSFilepath,
+			dst: dstComponent,
+		})
+	}
+
+	// the managed files are not listed in the manifest, so their expected
+	// checksums come from the source object attributes instead
+	for _, filepath := range managedFilepaths {
+		component, err := statComponent(srcPrefix, filepath)
+		if err != nil {
+			return nil, err
+		}
+
+		dstComponent := component
+		dstComponent.GCSFilepath = dstPrefix + filepath
+
+		copies = append(copies, componentCopy{
+			src: component.GCSFilepath,
+			dst: dstComponent,
+		})
+	}
+
+	// the compressed manifest, sigstore bundle, advisories, yank and dSYM
+	// index are only copied when the version has them
+	optionalFilepaths := append([]string{sigstoreBundleFilepath, yankedSigstoreBundleFilepath}, compressedManifestFilepaths...)
+	optionalFilepaths = append(optionalFilepaths, advisoryFilepaths...)
+	optionalFilepaths = append(optionalFilepaths, yankFilepaths...)
+	optionalFilepaths = append(optionalFilepaths, dsymIndexFilepaths...)
+	optional, err := optionalCopies(srcPrefix, dstPrefix, optionalFilepaths)
+	if err != nil {
+		return nil, err
+	}
+	copies = append(copies, optional...)
+
+	// a sharded manifest's index and shards are copied along with it, when
+	// the version has them
+	shardCopies, err := manifestShardCopies(srcPrefix, dstPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(copies, shardCopies...), nil
+}
+
+// optionalCopies: the copies of whichever of the files the version has
+func optionalCopies(srcPrefix, dstPrefix string, filepaths []string) ([]componentCopy, error) {
+	copies := make([]componentCopy, 0, len(filepaths))
+	for _, filepath := range filepaths {
+		component, err := statComponent(srcPrefix, filepath)
+		if err == storage.ErrObjectNotExist {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		dstComponent := component
+		dstComponent.GCSFilepath = dstPrefix + filepath
+
+		copies = append(copies, componentCopy{
+			src: component.GCSFilepath,
+			dst: dstComponent,
+		})
+	}
+
+	return copies, nil
+}
+
+// PromoteVersion: copy a published version to another location, such as from
+// a staging bucket to a production one, using server side rewrites verified
+// against the manifest's checksums. When resign is set, the version's
+// manifests are rewritten to point at their new location and signed with the
+// current signing key, rather than keeping the source's signatures
+func PromoteVersion(src, dst Project, version string, resign bool) error {
+	if err := CopyVersion(src, dst, version); err != nil {
+		return err
+	}
+
+	if !resign {
+		return nil
+	}
+
+	return resignVersion(dst, version)
+}
+
+// resignVersion: rewrite a copied version's manifest, checksums, compressed
+// manifest, shards and dSYM index to list the components at the project's
+// location, and sign them along with any advisories and yank using the current
+// signing key. A sigstore bundle can't be reissued here, so a copied one is
+// removed rather than left signing the old manifest
+func resignVersion(project Project, version string) error {
+	versionGCSPrefix := project.gcsPrefix + version + "/"
+	versionURLPrefix := project.urlPrefix + version + "/"
+
+	manifest, err := fetchManifest(versionGCSPrefix + "manifest.json")
+	if err != nil {
+		return err
+	}
+
+	for idx, component := range manifest.Components {
+		manifest.Components[idx].GCSFilepath = versionGCSPrefix + component.Filepath
+		manifest.Components[idx].URL = versionURLPrefix + component.Filepath
+	}
+
+	tmpDir, err := newScratchDir("artifactor-promote")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest.manifestFilepath = filepath.Join(tmpDir, "manifest.json")
+	manifest.signatureFilepath = manifest.manifestFilepath + ".asc.sig"
+	if err := manifest.write(); err != nil {
+		return err
+	}
+
+	checksumManifest := NewChecksumManifest(manifest.Components)
+	checksumManifest.manifestFilepath = filepath.Join(tmpDir, checksumManifest.manifestFilepath)
+	checksumManifest.signatureFilepath = checksumManifest.manifestFilepath + ".asc.sig"
+	if err := checksumManifest.write(); err != nil {
+		return err
+	}
+
+	filenames := append([]string(nil), managedFilepaths...)
+
+	_, err = statComponent(versionGCSPrefix, compressedManifestFilepaths[0])
+	if err != nil && err != storage.ErrObjectNotExist {
+		return err
+	}
+	if err == nil {
+		if err := writeCompressedManifest(manifest.manifestFilepath); err != nil {
+			return err
+		}
+
+		filenames = append(filenames, compressedManifestFilepaths...)
+	}
+
+	// advisories and yanks are signed as they are
+	for _, signedFilepaths := range [][]string{advisoryFilepaths, yankFilepaths} {
+		byts, _, err := fetchObject(versionGCSPrefix + signedFilepaths[0])
+		if err == storage.ErrObjectNotExist {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		localFilepath := filepath.Join(tmpDir, signedFilepaths[0])
+		if err := ioutil.WriteFile(localFilepath, byts, 0644); err != nil {
+			return err
+		}
+
+		if err := createSigFile(localFilepath, filepath.Join(tmpDir, signedFilepaths[1])); err != nil {
+			return err
+		}
+
+		filenames = append(filenames, signedFilepaths...)
+	}
+
+	dsymIndexBytes, _, err := fetchObject(versionGCSPrefix + dsymIndexFilepaths[0])
+	if err != nil && err != storage.ErrObjectNotExist {
+		return err
+	}
+	if err == nil {
+		var index DSYMIndex
+		if err := json.Unmarshal(dsymIndexBytes, &index); err != nil {
+			return err
+		}
+
+		// symbols stay where they were published, so only dSYMs among the
+		// components move
+		relocated := make(map[string]Component, len(manifest.Components))
+		for _, component := range manifest.Components {
+			relocated[component.Filepath] = component
+		}
+		for idx, dsym := range index.DSYMs {
+			if component, ok := relocated[dsym.Filepath]; ok {
+				index.DSYMs[idx].GCSFilepath = component.GCSFilepath
+				index.DSYMs[idx].URL = component.URL
+			}
+		}
+
+		if err := writeDSYMIndex(tmpDir, index); err != nil {
+			return err
+		}
+
+		filenames = append(filenames, dsymIndexFilepaths...)
+	}
+
+	components := make([]Component, 0, len(filenames))
+	gcsPaths := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		component, err := newTempComponent(tmpDir, filename, versionGCSPrefix, versionURLPrefix)
+		if err != nil {
+			return err
+		}
+
+		components = append(components, component)
+		gcsPaths = append(gcsPaths, component.GCSFilepath)
+	}
+
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return err
+	}
+
+	if _, err := uploadComponents(project.gcsPrefix, components, generations, false); err != nil {
+		return err
+	}
+
+	if _, err := deleteObjects([]string{versionGCSPrefix + sigstoreBundleFilepath}); err != nil {
+		return err
+	}
+
+	// the shards are cut at the size of the first, which is always full
+	indexBytes, _, err := fetchObject(versionGCSPrefix + manifestIndexFilepaths[0])
+	if err == storage.ErrObjectNotExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var index ManifestIndex
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return err
+	}
+	if len(index.Shards) == 0 {
+		return nil
+	}
+
+	_, err = publishManifestShards(project, manifest, index.Shards[0].Components)
+	return err
+}
+
+// manifestShardCopies: the copies of a version's manifest index and shards,
+// or none when it doesn't have a sharded manifest
+func manifestShardCopies(srcPrefix, dstPrefix string) ([]componentCopy, error) {
+	indexBytes, _, err := fetchObject(srcPrefix + manifestIndexFilepaths[0])
+	if err == storage.ErrObjectNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var index ManifestIndex
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, err
+	}
+
+	filepaths := append([]string(nil), manifestIndexFilepaths...)
+	for _, shard := range index.Shards {
+		filepaths = append(filepaths, shard.Filepath)
+	}
+
+	copies := make([]componentCopy, 0, len(filepaths))
+	for _, filepath := range filepaths {
+		component, err := statComponent(srcPrefix, filepath)
+		if err != nil {
+			return nil, err
+		}
+
+		dstComponent := component
+		dstComponent.GCSFilepath = dstPrefix + filepath
+
+		copies = append(copies, componentCopy{
+			src: component.GCSFilepath,
+			dst: dstComponent,
+		})
+	}
+
+	return copies, nil
+}
+
+// statComponent: build a component from the attributes of an already stored
+// object
+func statComponent(gcsPrefix, filepath string) (Component, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return Component{}, err
+	}
+
+	attrs, err := store.Attrs(ctx, gcsPrefix+filepath)
+	if err != nil {
+		return Component{}, err
+	}
+
+	return Component{
+		Filepath:    filepath,
+		GCSFilepath: gcsPrefix + filepath,
+		Bytes:       attrs.Size,
+
+		Md5Checksum: fmt.Sprintf("%x", attrs.MD5),
+	}, nil
+}
@@ -0,0 +1,57 @@
+package artifactor
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyFunc: how requests find their proxy, from HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY unless SetProxy has been given one
+var proxyFunc = http.ProxyFromEnvironment
+
+// SetProxy: send requests to every backend, signer and notifier through the
+// proxy at proxyURL, such as http://proxy.internal:3128, rather than the one
+// HTTPS_PROXY and HTTP_PROXY give. Hosts in NO_PROXY still bypass it, and an
+// empty url goes back to the environment's. Since the storage clients take
+// their transport from http.DefaultTransport, the proxy is set there, and
+// must be set before any storage is opened
+func SetProxy(proxyURL string) error {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != "" {
+		parsed, err := url.Parse(proxyURL)
+		if err != nil {
+			return err
+		}
+		switch parsed.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy %q must be an http://, https:// or socks5:// url", proxyURL)
+		}
+
+		config := httpproxy.Config{HTTPProxy: proxyURL, HTTPSProxy: proxyURL, NoProxy: noProxy()}
+		proxyForURL := config.ProxyFunc()
+		proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyForURL(req.URL)
+		}
+	}
+
+	proxyFunc = proxy
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.Proxy = proxy
+	}
+
+	return nil
+}
+
+// noProxy: the hosts which bypass the proxy, from NO_PROXY or no_proxy
+func noProxy() string {
+	if hosts := os.Getenv("NO_PROXY"); hosts != "" {
+		return hosts
+	}
+
+	return os.Getenv("no_proxy")
+}
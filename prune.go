@@ -0,0 +1,68 @@
+package artifactor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PruneVersions: delete the versions of a project beyond the newest keep, and
+// those published more than olderThan ago. Either limit may be zero to leave
+// it out, and when both are set a version must be beyond both to be deleted.
+// Versions served by an alias are never deleted. With dryRun set nothing is
+// deleted. Returns the versions pruned, or which would be, oldest first
+func PruneVersions(project Project, keep int, olderThan time.Duration, dryRun bool, concurrency int) ([]string, error) {
+	if keep <= 0 && olderThan <= 0 {
+		return nil, fmt.Errorf("a number of versions to keep or a maximum age is required")
+	}
+
+	manifests, err := listManifests(project, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases, err := listAliases(project, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	served := make(map[string]bool, len(aliases))
+	aliasNames := make([]string, 0, len(aliases))
+	for alias, version := range aliases {
+		served[version] = true
+		aliasNames = append(aliasNames, alias)
+	}
+	sort.Strings(aliasNames)
+
+	cutoff := time.Now().Add(-olderThan)
+	pruned := make([]string, 0)
+	for idx, manifest := range manifests {
+		if keep > 0 && idx >= len(manifests)-keep {
+			break
+		}
+
+		if olderThan > 0 && !manifest.Timestamp.Before(cutoff) {
+			continue
+		}
+
+		if served[manifest.Version] {
+			continue
+		}
+
+		pruned = append(pruned, manifest.Version)
+	}
+
+	if dryRun {
+		return pruned, nil
+	}
+
+	// the aliases are checked again as each version is deleted, in case one
+	// was pointed at it since they were listed
+	for idx, version := range pruned {
+		if _, err := DeleteVersion(project, version, aliasNames, false); err != nil {
+			return pruned[:idx], fmt.Errorf("%s: %v", version, err)
+		}
+	}
+
+	return pruned, nil
+}
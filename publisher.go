@@ -0,0 +1,152 @@
+package artifactor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ciClaimEnvironment: the environment variables of known ci systems recorded
+// as claims when no identity token is given, keyed by claim
+var ciClaimEnvironment = map[string]string{
+	"github_repository":   "GITHUB_REPOSITORY",
+	"github_workflow_ref": "GITHUB_WORKFLOW_REF",
+	"github_run_id":       "GITHUB_RUN_ID",
+	"github_sha":          "GITHUB_SHA",
+	"github_ref":          "GITHUB_REF",
+	"gitlab_project_path": "CI_PROJECT_PATH",
+	"gitlab_pipeline_id":  "CI_PIPELINE_ID",
+	"gitlab_job_id":       "CI_JOB_ID",
+	"gitlab_commit_sha":   "CI_COMMIT_SHA",
+}
+
+// identity token claims which describe the token rather than the publisher
+var ignoredTokenClaims = map[string]bool{"exp": true, "iat": true, "nbf": true, "jti": true}
+
+// Publisher: who published a version, recorded in its manifest so that audits
+// don't need to correlate bucket access logs. The claims are taken from a ci
+// identity token or the ci environment as is, and are only as trustworthy as
+// the manifest's signature
+type Publisher struct {
+	Name            string            `json:"name,omitempty"`
+	KeyFingerprints []string          `json:"key_fingerprints,omitempty"`
+	Claims          map[string]string `json:"claims,omitempty"`
+}
+
+// newPublisher: describe who is publishing. The key fingerprints are found by
+// signing and verifying a probe file, so they're those of whichever key the
+// manifest will be signed with
+func newPublisher(opts *Options) (Publisher, error) {
+	publisher := Publisher{Name: opts.PublishedBy}
+	if publisher.Name == "" {
+		publisher.Name = opts.Actor
+	}
+
+	fingerprints, err := signingFingerprints()
+	if err != nil {
+		return Publisher{}, err
+	}
+	publisher.KeyFingerprints = fingerprints
+
+	if opts.IdentityTokenFilepath != "" {
+		publisher.Claims, err = identityTokenClaims(opts.IdentityTokenFilepath)
+		if err != nil {
+			return Publisher{}, err
+		}
+		return publisher, nil
+	}
+
+	for claim, env := range ciClaimEnvironment {
+		if value := os.Getenv(env); value != "" {
+			if publisher.Claims == nil {
+				publisher.Claims = make(map[string]string)
+			}
+			publisher.Claims[claim] = value
+		}
+	}
+
+	return publisher, nil
+}
+
+// signingFingerprints: the fingerprints of the key signatures are made with
+func signingFingerprints() ([]string, error) {
+	tmpDir, err := newScratchDir("artifactor-publisher")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	probeFilepath := filepath.Join(tmpDir, "probe")
+	if err := ioutil.WriteFile(probeFilepath, []byte("artifactor"), 0644); err != nil {
+		return nil, err
+	}
+
+	if err := createSigFile(probeFilepath, probeFilepath+".asc.sig"); err != nil {
+		return nil, err
+	}
+
+	signatures, err := currentSigner().Verify(probeFilepath, probeFilepath+".asc.sig")
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints := make([]string, 0, len(signatures))
+	for _, signature := range signatures {
+		fingerprints = append(fingerprints, signature.Subkey)
+		if signature.Primary != signature.Subkey {
+			fingerprints = append(fingerprints, signature.Primary)
+		}
+	}
+
+	return fingerprints, nil
+}
+
+// identityTokenClaims: the claims of a ci identity token, such as a github
+// actions oidc token, read from a file. The token's signature isn't checked,
+// as the claims are only recorded, and every claim but those describing the
+// token itself is kept
+func identityTokenClaims(tokenFilepath string) (map[string]string, error) {
+	tokenBytes, err := ioutil.ReadFile(tokenFilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(strings.TrimSpace(string(tokenBytes)), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%s: not a jwt", tokenFilepath)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", tokenFilepath, err)
+	}
+
+	var rawClaims map[string]interface{}
+	if err := json.Unmarshal(payload, &rawClaims); err != nil {
+		return nil, fmt.Errorf("%s: %v", tokenFilepath, err)
+	}
+
+	claims := make(map[string]string, len(rawClaims))
+	for claim, value := range rawClaims {
+		if ignoredTokenClaims[claim] {
+			continue
+		}
+
+		switch value := value.(type) {
+		case string:
+			claims[claim] = value
+		default:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			claims[claim] = string(encoded)
+		}
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,325 @@
+package artifactor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// outcomes of a component in a publish report
+const (
+	OutcomeUploaded     = "uploaded"
+	OutcomeCopied       = "copied"
+	OutcomeNotPublished = "not_published"
+
+	// OutcomeUnchanged: an alias object already identical to the version's,
+	// which was left in place rather than rewritten
+	OutcomeUnchanged = "unchanged"
+)
+
+// PublishedObject: an object written to the storage bucket during a publish,
+// along with the generation it was written at. Comparing the generation of
+// the object currently served against this confirms it is the exact object
+// that was published
+type PublishedObject struct {
+	GCSFilepath    string `json:"gcs_filepath"`
+	URL            string `json:"url"`
+	Outcome        string `json:"outcome"`
+	Generation     int64  `json:"generation"`
+	Metageneration int64  `json:"metageneration"`
+
+	// DurationMillis is how long the write took, and Attempts how many
+	// times it was made because a concurrent publisher got there first
+	DurationMillis int64 `json:"duration_millis"`
+	Attempts       int   `json:"attempts"`
+
+	// Bytes is the size of the object written
+	Bytes int64 `json:"bytes"`
+
+	started time.Time
+}
+
+func newPublishedObject(component Component, outcome string, attrs *storage.ObjectAttrs, started time.Time) PublishedObject {
+	return PublishedObject{
+		GCSFilepath:    component.GCSFilepath,
+		URL:            component.URL,
+		Outcome:        outcome,
+		Generation:     attrs.Generation,
+		Metageneration: attrs.Metageneration,
+		DurationMillis: int64(time.Since(started) / time.Millisecond),
+		Attempts:       1,
+		Bytes:          attrs.Size,
+		started:        started,
+	}
+}
+
+// retried: record that objects were written on the given attempt of an
+// update that is retried when a concurrent publisher gets there first
+func retried(objects []PublishedObject, attempt int) []PublishedObject {
+	for idx := range objects {
+		objects[idx].Attempts = attempt + 1
+	}
+
+	return objects
+}
+
+// collectPublishedObjects: drain a closed channel of published objects
+func collectPublishedObjects(objectCh <-chan PublishedObject) []PublishedObject {
+	objects := make([]PublishedObject, 0, len(objectCh))
+	for object := range objectCh {
+		objects = append(objects, object)
+	}
+
+	return objects
+}
+
+// ComponentOutcome: what happened to one of the version's components
+type ComponentOutcome struct {
+	Filepath string `json:"filepath"`
+	URL      string `json:"url"`
+	Bytes    int64  `json:"bytes"`
+	Outcome  string `json:"outcome"`
+
+	DurationMillis int64 `json:"duration_millis"`
+	Attempts       int   `json:"attempts"`
+}
+
+// PublishReport: a record of every object written while publishing a version,
+// written whether or not the publish succeeded
+type PublishReport struct {
+	Project        string             `json:"project"`
+	Version        string             `json:"version"`
+	Timestamp      time.Time          `json:"timestamp"`
+	UnixTimestamp  int                `json:"unix_timestamp"`
+	Succeeded      bool               `json:"succeeded"`
+	Error          string             `json:"error,omitempty"`
+	DurationMillis int64              `json:"duration_millis"`
+	Components     []ComponentOutcome `json:"components"`
+	Objects        []PublishedObject  `json:"objects"`
+
+	// Duplicates groups the filepaths of components with identical contents
+	Duplicates [][]string `json:"duplicates"`
+
+	// StaleAliases lists aliases which don't resolve to the version after
+	// being updated
+	StaleAliases []string `json:"stale_aliases"`
+
+	// Mirrors records the objects written to each mirror, and whether
+	// publishing to it succeeded
+	Mirrors []MirrorReport `json:"mirrors,omitempty"`
+
+	// Destinations breaks down the writes to each storage prefix the
+	// version was published to, so a slow mirror stands out
+	Destinations []DestinationStats `json:"destinations"`
+
+	components          []Component
+	destinationPrefixes []string
+}
+
+// DestinationStats: the writes made to one storage prefix of a publish, such
+// as the primary bucket, the symbols bucket or a mirror. Objects counts those
+// uploaded or copied, and Bytes those uploaded, since server side copies
+// aren't sent by the publisher. The latencies are of single writes, while
+// ElapsedMillis spans from the first write starting to the last one
+// finishing, and BytesPerSecond is the upload throughput over it
+type DestinationStats struct {
+	GcsPrefix         string `json:"gcs_prefix"`
+	Objects           int    `json:"objects"`
+	Bytes             int64  `json:"bytes"`
+	ElapsedMillis     int64  `json:"elapsed_millis"`
+	BytesPerSecond    int64  `json:"bytes_per_second"`
+	MeanLatencyMillis int64  `json:"mean_latency_millis"`
+	MaxLatencyMillis  int64  `json:"max_latency_millis"`
+}
+
+func NewPublishReport(project string, version string, ts time.Time) PublishReport {
+	return PublishReport{
+		Project:       project,
+		Version:       version,
+		Timestamp:     ts,
+		UnixTimestamp: int(ts.Unix()),
+		Components:    make([]ComponentOutcome, 0),
+		Objects:       make([]PublishedObject, 0),
+		Duplicates:    make([][]string, 0),
+		StaleAliases:  make([]string, 0),
+		Destinations:  make([]DestinationStats, 0),
+	}
+}
+
+// publishDestinations: the storage prefixes a publish writes to, the primary
+// followed by any symbols prefix and mirrors
+func publishDestinations(opts *Options) []string {
+	prefixes := []string{opts.GcsPrefix}
+	if opts.SymbolsPrefix != "" {
+		prefixes = append(prefixes, opts.SymbolsPrefix)
+	}
+
+	for _, mirror := range opts.Mirrors {
+		prefixes = append(prefixes, mirror.GcsPrefix)
+	}
+
+	return prefixes
+}
+
+// finish: record how the publish ended, along with the outcome of each of the
+// version's components
+func (p *PublishReport) finish(err error) {
+	p.Succeeded = err == nil
+	if err != nil {
+		p.Error = err.Error()
+	}
+	p.DurationMillis = int64(time.Since(p.Timestamp) / time.Millisecond)
+
+	objects := make(map[string]PublishedObject, len(p.Objects))
+	for _, object := range p.Objects {
+		objects[object.GCSFilepath] = object
+	}
+
+	p.Components = make([]ComponentOutcome, 0, len(p.components))
+	for _, component := range p.components {
+		outcome := ComponentOutcome{
+			Filepath: component.Filepath,
+			URL:      component.URL,
+			Bytes:    component.Bytes,
+			Outcome:  OutcomeNotPublished,
+		}
+
+		if object, ok := objects[component.GCSFilepath]; ok {
+			outcome.Outcome = object.Outcome
+			outcome.DurationMillis = object.DurationMillis
+			outcome.Attempts = object.Attempts
+		}
+
+		p.Components = append(p.Components, outcome)
+	}
+
+	written := append([]PublishedObject(nil), p.Objects...)
+	for _, mirror := range p.Mirrors {
+		written = append(written, mirror.Objects...)
+	}
+	p.Destinations = destinationStats(p.destinationPrefixes, written)
+}
+
+// destinationStats: the stats of the writes to each prefix, with each object
+// counted against the longest prefix it is beneath. Objects left unchanged
+// weren't written, and aren't counted
+func destinationStats(prefixes []string, objects []PublishedObject) []DestinationStats {
+	stats := make([]DestinationStats, len(prefixes))
+	first := make([]time.Time, len(prefixes))
+	last := make([]time.Time, len(prefixes))
+	latencies := make([]int64, len(prefixes))
+
+	for idx, prefix := range prefixes {
+		stats[idx].GcsPrefix = prefix
+	}
+
+	for _, object := range objects {
+		if object.Outcome == OutcomeUnchanged {
+			continue
+		}
+
+		idx := -1
+		for candidate, prefix := range prefixes {
+			if strings.HasPrefix(object.GCSFilepath, prefix) && (idx < 0 || len(prefix) > len(prefixes[idx])) {
+				idx = candidate
+			}
+		}
+		if idx < 0 {
+			continue
+		}
+
+		stats[idx].Objects++
+		if object.Outcome == OutcomeUploaded {
+			stats[idx].Bytes += object.Bytes
+		}
+
+		latencies[idx] += object.DurationMillis
+		if object.DurationMillis > stats[idx].MaxLatencyMillis {
+			stats[idx].MaxLatencyMillis = object.DurationMillis
+		}
+
+		finished := object.started.Add(time.Duration(object.DurationMillis) * time.Millisecond)
+		if first[idx].IsZero() || object.started.Before(first[idx]) {
+			first[idx] = object.started
+		}
+		if finished.After(last[idx]) {
+			last[idx] = finished
+		}
+	}
+
+	for idx := range stats {
+		if stats[idx].Objects == 0 {
+			continue
+		}
+
+		stats[idx].MeanLatencyMillis = latencies[idx] / int64(stats[idx].Objects)
+		stats[idx].ElapsedMillis = int64(last[idx].Sub(first[idx]) / time.Millisecond)
+		if stats[idx].ElapsedMillis > 0 {
+			stats[idx].BytesPerSecond = stats[idx].Bytes * 1000 / stats[idx].ElapsedMillis
+		}
+	}
+
+	return stats
+}
+
+// mirror: record the objects written to a mirror, merging them with those of
+// any earlier upload to it
+func (p *PublishReport) mirror(mirror Mirror, objects []PublishedObject, err error) {
+	for idx := range p.Mirrors {
+		if p.Mirrors[idx].GcsPrefix != mirror.GcsPrefix {
+			continue
+		}
+
+		p.Mirrors[idx].Objects = append(p.Mirrors[idx].Objects, objects...)
+		if err != nil {
+			p.Mirrors[idx].Succeeded = false
+			p.Mirrors[idx].Error = err.Error()
+		}
+		return
+	}
+
+	mirrorReport := MirrorReport{
+		GcsPrefix: mirror.GcsPrefix,
+		UrlPrefix: mirror.UrlPrefix,
+		Succeeded: err == nil,
+		Objects:   append(make([]PublishedObject, 0, len(objects)), objects...),
+	}
+	if err != nil {
+		mirrorReport.Error = err.Error()
+	}
+
+	p.Mirrors = append(p.Mirrors, mirrorReport)
+}
+
+// annotate: return a copy of the components with the generations they were
+// published at
+func (p PublishReport) annotate(components []Component) []Component {
+	objects := make(map[string]PublishedObject, len(p.Objects))
+	for _, object := range p.Objects {
+		objects[object.GCSFilepath] = object
+	}
+
+	annotated := make([]Component, 0, len(components))
+	for _, component := range components {
+		if object, ok := objects[component.GCSFilepath]; ok {
+			component.Generation = object.Generation
+			component.Metageneration = object.Metageneration
+		}
+
+		annotated = append(annotated, component)
+	}
+
+	return annotated
+}
+
+func (p PublishReport) write(filepath string) error {
+	jsonBytes, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath, jsonBytes, 0644)
+}
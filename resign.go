@@ -0,0 +1,120 @@
+package artifactor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"cloud.google.com/go/storage"
+)
+
+// the signed files of a version which are re-signed when present, besides
+// its manifest and checksums
+var optionalSignedFilepaths = []string{compressedManifestFilepaths[0], manifestIndexFilepaths[0], advisoryFilepaths[0], yankFilepaths[0], dsymIndexFilepaths[0]}
+
+// ResignVersion: refresh the detached signatures of a version's manifest,
+// checksums and other signed files with the current signing key, such as
+// after a key rotation, leaving the files themselves untouched. The aliases
+// serving the version are re-signed along with it, the copies of its files
+// held by copied aliases and the alias.json of pointer aliases. Every
+// existing signature must verify with one of the trusted keys first, so that
+// nothing is re-signed which wasn't signed before. Only the .asc.sig files are
+// uploaded, each guarded by the generation it was read at
+func ResignVersion(project Project, version string, trustedKeys []string) ([]PublishedObject, error) {
+	aliases, err := listAliases(project, DefaultConcurrency)
+	if err != nil {
+		return nil, fmt.Errorf("listing aliases: %v", err)
+	}
+
+	// the manifest and checksums are always signed, and come first
+	signedFilepaths := append([]string{managedFilepaths[0], managedFilepaths[2]}, optionalSignedFilepaths...)
+
+	objects, err := resignFiles(project.gcsPrefix+version+"/", project.urlPrefix+version+"/", signedFilepaths, 2, trustedKeys)
+	if err != nil {
+		return objects, err
+	}
+
+	aliasNames := make([]string, 0, len(aliases))
+	for alias, aliasVersion := range aliases {
+		if aliasVersion == version {
+			aliasNames = append(aliasNames, alias)
+		}
+	}
+	sort.Strings(aliasNames)
+
+	for _, alias := range aliasNames {
+		aliasGCSPrefix := project.gcsPrefix + alias + "/"
+		aliasURLPrefix := project.urlPrefix + alias + "/"
+
+		_, _, err := fetchObject(aliasGCSPrefix + aliasPointerFilepaths[0])
+		if err != nil && err != storage.ErrObjectNotExist {
+			return objects, fmt.Errorf("alias %s: %v", alias, err)
+		}
+
+		var aliasObjects []PublishedObject
+		if err == nil {
+			aliasObjects, err = resignFiles(aliasGCSPrefix, aliasURLPrefix, aliasPointerFilepaths[:1], 1, trustedKeys)
+		} else {
+			aliasObjects, err = resignFiles(aliasGCSPrefix, aliasURLPrefix, signedFilepaths, 2, trustedKeys)
+		}
+		objects = append(objects, aliasObjects...)
+		if err != nil {
+			return objects, fmt.Errorf("alias %s: %v", alias, err)
+		}
+	}
+
+	return objects, nil
+}
+
+// resignFiles: verify and refresh the signatures of the files under a prefix,
+// of which the first required must exist while the rest are re-signed when
+// present
+func resignFiles(gcsPrefix, urlPrefix string, filenames []string, required int, trustedKeys []string) ([]PublishedObject, error) {
+	tmpDir, err := newScratchDir("artifactor-resign")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	components := make([]Component, 0, len(filenames))
+	generations := make(map[string]int64, len(filenames))
+	for idx, filename := range filenames {
+		byts, _, err := fetchObject(gcsPrefix + filename)
+		if err == storage.ErrObjectNotExist && idx >= required {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", gcsPrefix+filename, err)
+		}
+
+		sigBytes, generation, err := fetchObject(gcsPrefix + filename + ".asc.sig")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", gcsPrefix+filename+".asc.sig", err)
+		}
+
+		if err := verifySignature(byts, sigBytes, trustedKeys); err != nil {
+			return nil, fmt.Errorf("%s: %v", gcsPrefix+filename, err)
+		}
+
+		localFilepath := filepath.Join(tmpDir, filename)
+		if err := ioutil.WriteFile(localFilepath, byts, 0644); err != nil {
+			return nil, err
+		}
+
+		if err := createSigFile(localFilepath, localFilepath+".asc.sig"); err != nil {
+			return nil, err
+		}
+
+		component, err := newTempComponent(tmpDir, filename+".asc.sig", gcsPrefix, urlPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, component)
+		generations[component.GCSFilepath] = generation
+	}
+
+	return uploadComponents(gcsPrefix, components, generations, false)
+}
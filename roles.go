@@ -0,0 +1,112 @@
+package artifactor
+
+import (
+	"path"
+	"strings"
+)
+
+// roles a component may be classified as, recorded in the manifest so that
+// consumers can fetch, or list, components by what they are
+const (
+	RoleBinary    = "binary"
+	RoleArchive   = "archive"
+	RolePackage   = "package"
+	RoleChecksum  = "checksum"
+	RoleSignature = "signature"
+	RoleSymbols   = "symbols"
+	RoleDocs      = "docs"
+	RoleOther     = "other"
+)
+
+// Roles: every role a component may be classified as
+var Roles = []string{RoleBinary, RoleArchive, RolePackage, RoleChecksum, RoleSignature, RoleSymbols, RoleDocs, RoleOther}
+
+// isRole: whether a role is one components are classified as
+func isRole(role string) bool {
+	for _, known := range Roles {
+		if role == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// basename prefixes and extensions identifying each role, checked in order
+// so that a signature of an archive, such as foo.tar.gz.asc, or of a checksum
+// list, such as SHA256SUMS.asc, is a signature
+var roleRules = []struct {
+	role       string
+	prefixes   []string
+	extensions []string
+}{
+	{RoleSignature, nil, []string{".asc", ".sig", ".minisig", ".p7s", ".sigstore", ".sigstore.json"}},
+	{RoleChecksum, []string{"SHA1SUMS", "SHA256SUMS", "SHA512SUMS", "MD5SUMS", "CHECKSUMS"}, []string{".sha1", ".sha256", ".sha384", ".sha512", ".md5", ".sha256sum", ".sha512sum"}},
+	{RoleSymbols, nil, []string{".pdb", ".debug", ".dbg", ".sym", ".dsym.zip", ".dsym.tar.gz"}},
+	{RolePackage, nil, []string{".deb", ".rpm", ".apk", ".msi", ".pkg", ".dmg", ".whl", ".jar", ".nupkg", ".snap", ".appimage", ".gem"}},
+	{RoleArchive, nil, []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz", ".tar.xz", ".txz", ".tar.zst", ".tzst", ".zip", ".7z", ".gz", ".bz2", ".xz", ".zst"}},
+	{RoleBinary, nil, []string{".exe", ".dll", ".so", ".dylib", ".wasm"}},
+	{RoleDocs, []string{"README", "CHANGELOG", "CHANGES", "AUTHORS"}, []string{".md", ".txt", ".rst", ".adoc", ".html", ".pdf"}},
+}
+
+// classifyFilepath: the role of a component judging by its filepath alone,
+// or an empty string when the filepath doesn't tell
+func classifyFilepath(filepath string) string {
+	// debug symbols for macos are bundles, published as the files within
+	if strings.Contains(filepath, ".dSYM/") {
+		return RoleSymbols
+	}
+
+	name := path.Base(filepath)
+	lowerName, upperName := strings.ToLower(name), strings.ToUpper(name)
+
+	for _, rule := range roleRules {
+		for _, prefix := range rule.prefixes {
+			if strings.HasPrefix(upperName, prefix) {
+				return rule.role
+			}
+		}
+
+		for _, extension := range rule.extensions {
+			if strings.HasSuffix(lowerName, extension) {
+				return rule.role
+			}
+		}
+	}
+
+	// versioned shared libraries, such as libfoo.so.1
+	if strings.Contains(lowerName, ".so.") {
+		return RoleBinary
+	}
+
+	if isLicenseFilepath(filepath) || strings.HasPrefix(filepath, "docs/") {
+		return RoleDocs
+	}
+
+	return ""
+}
+
+// classifyComponents: return a copy of the components recording the role of
+// each, by its filepath or else by whether its contents are an executable
+func classifyComponents(components []Component) ([]Component, error) {
+	classified := make([]Component, 0, len(components))
+	for _, component := range components {
+		component.Role = classifyFilepath(component.Filepath)
+
+		if component.Role == "" {
+			isBinary, err := isBinaryFile(component)
+			if err != nil {
+				return nil, err
+			}
+
+			component.Role = RoleOther
+			if isBinary {
+				component.Role = RoleBinary
+			}
+		}
+
+		classified = append(classified, component)
+	}
+
+	return classified, nil
+}
@@ -0,0 +1,165 @@
+package artifactor
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// files written when maintaining a project's root manifest
+var rootFilepaths = []string{"root.json", "root.json.asc.sig"}
+
+// RootVersion: the digest of a version's manifest.json, as recorded in the
+// project root at the time it was published
+type RootVersion struct {
+	Version        string     `json:"version"`
+	ManifestSha256 string     `json:"manifest_sha256"`
+	Timestamp      time.Time  `json:"timestamp"`
+	UnixTimestamp  int        `json:"unix_timestamp"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// Root: a signed project level document which records the digest of every
+// version's manifest, along with the digest of the root it replaced. Since
+// each root is archived under roots/ and chained to its predecessor,
+// rewriting an old version's manifest, or the root history itself, is
+// detectable by anyone holding an earlier root
+type Root struct {
+	Project            string        `json:"project"`
+	Sequence           int           `json:"sequence"`
+	PreviousRootSha256 string        `json:"previous_root_sha256"`
+	Versions           []RootVersion `json:"versions"`
+
+	manifestFilepath  string
+	signatureFilepath string
+}
+
+// NewRoot: create the next root in the chain by appending a version to the
+// previous root, whose raw bytes are hashed. An empty previous root starts a
+// new chain
+func NewRoot(project string, previous Root, previousBytes []byte, version RootVersion) Root {
+	root := Root{
+		Project:  project,
+		Sequence: 0,
+		Versions: make([]RootVersion, 0, len(previous.Versions)+1),
+
+		manifestFilepath:  rootFilepaths[0],
+		signatureFilepath: rootFilepaths[1],
+	}
+
+	if len(previousBytes) > 0 {
+		root.Sequence = previous.Sequence + 1
+		root.PreviousRootSha256 = fmt.Sprintf("%x", sha256.Sum256(previousBytes))
+	}
+
+	root.Versions = append(root.Versions, previous.Versions...)
+	root.Versions = append(root.Versions, version)
+	return root
+}
+
+func (r Root) write() error {
+	jsonBytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(r.manifestFilepath, jsonBytes, 0644); err != nil {
+		return err
+	}
+
+	return createSigFile(r.manifestFilepath, r.signatureFilepath)
+}
+
+// fetchRoot: download the current project root, returning its raw bytes and
+// generation. A missing root returns an empty root at generation 0
+func fetchRoot(project Project) (Root, []byte, int64, error) {
+	byts, generation, err := fetchObject(project.gcsPrefix + rootFilepaths[0])
+	if err == storage.ErrObjectNotExist {
+		return Root{}, nil, 0, nil
+	}
+	if err != nil {
+		return Root{}, nil, 0, err
+	}
+
+	var root Root
+	if err := json.Unmarshal(byts, &root); err != nil {
+		return Root{}, nil, 0, err
+	}
+
+	return root, byts, generation, nil
+}
+
+// updateRoot: append the version's manifest digest to the project root, and
+// upload the signed result both as root.json and as an immutable archived copy
+// under roots/. The write is guarded by the generation of the root that was
+// read, so concurrent publishers can't drop each other's versions
+func updateRoot(project Project, version string, manifestComponents []Component, ts time.Time, expiresAt *time.Time) ([]PublishedObject, error) {
+	manifestSha256 := ""
+	for _, component := range manifestComponents {
+		if component.Filepath == "manifest.json" {
+			manifestSha256 = component.Sha256Checksum
+		}
+	}
+	if manifestSha256 == "" {
+		return nil, fmt.Errorf("no manifest.json found for version %s", version)
+	}
+
+	// the signature's generation is read before the root, so a concurrent
+	// update between the two reads fails the write rather than being lost
+	signatureGCSPath := project.gcsPrefix + rootFilepaths[1]
+	signatureGenerations, err := fetchGenerations([]string{signatureGCSPath})
+	if err != nil {
+		return nil, err
+	}
+
+	previous, previousBytes, generation, err := fetchRoot(project)
+	if err != nil {
+		return nil, err
+	}
+
+	root := NewRoot(project.name, previous, previousBytes, RootVersion{
+		Version:        version,
+		ManifestSha256: manifestSha256,
+		Timestamp:      ts,
+		UnixTimestamp:  int(ts.Unix()),
+		ExpiresAt:      expiresAt,
+	})
+	tmpDir, err := newScratchDir("artifactor-root")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	root.manifestFilepath = filepath.Join(tmpDir, rootFilepaths[0])
+	root.signatureFilepath = filepath.Join(tmpDir, rootFilepaths[1])
+	if err := root.write(); err != nil {
+		return nil, err
+	}
+
+	generations := make(map[string]int64)
+	components := make([]Component, 0, len(rootFilepaths)*2)
+	for _, filename := range rootFilepaths {
+		component, err := newTempComponent(tmpDir, filename, project.gcsPrefix, project.urlPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		archivedComponent := component
+		archivedComponent.GCSFilepath = fmt.Sprintf("%sroots/%d/%s", project.gcsPrefix, root.Sequence, filename)
+
+		generations[component.GCSFilepath] = generation
+		if component.GCSFilepath == signatureGCSPath {
+			generations[component.GCSFilepath] = signatureGenerations[signatureGCSPath]
+		}
+		generations[archivedComponent.GCSFilepath] = 0
+		components = append(components, component, archivedComponent)
+	}
+
+	return uploadComponents(project.gcsPrefix, components, generations, false)
+}
@@ -0,0 +1,441 @@
+package artifactor
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"google.golang.org/api/googleapi"
+)
+
+// s3GenerationMetadata: the user metadata key each object's generation is
+// recorded under, since s3 has no numeric generations of its own
+const s3GenerationMetadata = "artifactor-generation"
+
+// s3Storage: Storage backed by Amazon S3, for s3://bucket/object paths. Write
+// preconditions are checked against the generation recorded in each object's
+// metadata, and enforced with s3's conditional writes on the etag the
+// generation was read at
+type s3Storage struct {
+	client *s3.Client
+}
+
+// openS3Storage: open an s3 client configured from the environment, such as
+// AWS_REGION and AWS_PROFILE. The aws sdk builds its own transport, so it's
+// given the proxy and CA certificates requests are made with, unless
+// SetHTTPClient has given a client to use instead
+func openS3Storage(ctx context.Context) (Storage, error) {
+	var client aws.HTTPClient = awshttp.NewBuildableClient().WithTransportOptions(func(transport *http.Transport) {
+		transport.Proxy = proxyFunc
+		configureTLS(transport)
+	})
+	if injected := injectedHTTPClient(); injected != nil {
+		client = injected
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithHTTPClient(client))
+	if err != nil {
+		return nil, err
+	}
+
+	return s3Storage{client: s3.NewFromConfig(cfg)}, nil
+}
+
+// head: the attributes and etag of the latest version of an object
+func (s s3Storage) head(ctx context.Context, gcsPath string) (*storage.ObjectAttrs, error) {
+	bucketName, objectName := splitGCSPath(gcsPath)
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	return &storage.ObjectAttrs{
+		Bucket:         bucketName,
+		Name:           objectName,
+		Size:           aws.ToInt64(output.ContentLength),
+		ContentType:    aws.ToString(output.ContentType),
+		CacheControl:   aws.ToString(output.CacheControl),
+		MD5:            s3ETagMD5(aws.ToString(output.ETag)),
+		Etag:           aws.ToString(output.ETag),
+		Generation:     s3Generation(output.Metadata, output.LastModified),
+		Metageneration: 1,
+		Created:        aws.ToTime(output.LastModified),
+		Updated:        aws.ToTime(output.LastModified),
+	}, nil
+}
+
+// etagCondition: the etag an object must still have for a write guarded by
+// the conditions to go ahead, or * when it must not exist
+func (s s3Storage) etagCondition(ctx context.Context, gcsPath string, conds storage.Conditions) (ifMatch, ifNoneMatch *string, err error) {
+	if conds.DoesNotExist {
+		return nil, aws.String("*"), nil
+	}
+
+	if conds.GenerationMatch == 0 {
+		return nil, nil, nil
+	}
+
+	attrs, err := s.head(ctx, gcsPath)
+	if err == storage.ErrObjectNotExist {
+		return nil, nil, s3PreconditionFailed(gcsPath)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if attrs.Generation != conds.GenerationMatch {
+		return nil, nil, s3PreconditionFailed(gcsPath)
+	}
+
+	return aws.String(attrs.Etag), nil, nil
+}
+
+func (s s3Storage) Attrs(ctx context.Context, gcsPath string) (*storage.ObjectAttrs, error) {
+	return s.head(ctx, gcsPath)
+}
+
+func (s s3Storage) NewRangeReader(ctx context.Context, gcsPath string, generation int64, offset int64, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	bucketName, objectName := splitGCSPath(gcsPath)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	}
+
+	switch {
+	case length > 0:
+		input.Range = aws.String("bytes=" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+length-1, 10))
+	case offset > 0:
+		input.Range = aws.String("bytes=" + strconv.FormatInt(offset, 10) + "-")
+	}
+
+	output, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	// an older generation has been replaced, as s3 keeps no history of them
+	// without bucket versioning
+	if generation != 0 && s3Generation(output.Metadata, output.LastModified) != generation {
+		output.Body.Close()
+		return nil, storage.ErrObjectNotExist
+	}
+
+	return output.Body, nil
+}
+
+func (s s3Storage) Write(ctx context.Context, gcsPath string, byts []byte, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	md5Sum := md5.Sum(byts)
+	attrs.Size = int64(len(byts))
+	attrs.MD5 = md5Sum[:]
+
+	return s.WriteFrom(ctx, gcsPath, bytesOpener(byts), attrs, conds)
+}
+
+// WriteFrom: stream an object to s3. Requests are signed over their body, so
+// contents which can't be seeked back to the start, such as the entries of an
+// archive, are read into memory first, and the md5 s3 checks them against is
+// computed with an extra read of the contents unless attrs.MD5 is given
+func (s s3Storage) WriteFrom(ctx context.Context, gcsPath string, open func() (io.ReadCloser, error), attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	ifMatch, ifNoneMatch, err := s.etagCondition(ctx, gcsPath, conds)
+	if err != nil {
+		return nil, err
+	}
+
+	md5Sum := attrs.MD5
+	if len(md5Sum) == 0 {
+		md5Sum, err = md5Contents(open)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reader, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	body, ok := reader.(io.ReadSeeker)
+	if !ok {
+		byts, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(byts)
+	}
+
+	// gcs sniffs the content type of objects written without one, and s3
+	// would otherwise default to binary/octet-stream
+	if attrs.ContentType == "" {
+		sniffed := make([]byte, 512)
+		n, err := io.ReadFull(body, sniffed)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		attrs.ContentType = http.DetectContentType(sniffed[:n])
+	}
+
+	generation := time.Now().UnixNano()
+
+	bucketName, objectName := splitGCSPath(gcsPath)
+	output, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(bucketName),
+		Key:           aws.String(objectName),
+		Body:          body,
+		ContentLength: aws.Int64(attrs.Size),
+		ContentMD5:    aws.String(base64.StdEncoding.EncodeToString(md5Sum)),
+		ContentType:   aws.String(attrs.ContentType),
+		CacheControl:  s3OptionalString(attrs.CacheControl),
+		ACL:           s3ACL(attrs.PredefinedACL),
+		Metadata:      map[string]string{s3GenerationMetadata: strconv.FormatInt(generation, 10)},
+		IfMatch:       ifMatch,
+		IfNoneMatch:   ifNoneMatch,
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	now := time.Now()
+	attrs.Bucket, attrs.Name = bucketName, objectName
+	attrs.MD5 = md5Sum
+	attrs.CRC32C = 0
+	attrs.Etag = aws.ToString(output.ETag)
+	attrs.Generation = generation
+	attrs.Metageneration = 1
+	attrs.Created = now
+	attrs.Updated = now
+
+	return &attrs, nil
+}
+
+func (s s3Storage) Copy(ctx context.Context, srcGCSPath string, dstGCSPath string, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	srcAttrs, err := s.head(ctx, srcGCSPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ifMatch, ifNoneMatch, err := s.etagCondition(ctx, dstGCSPath, conds)
+	if err != nil {
+		return nil, err
+	}
+
+	if attrs.ContentType == "" {
+		attrs.ContentType = srcAttrs.ContentType
+	}
+
+	generation := time.Now().UnixNano()
+	dstBucketName, dstObjectName := splitGCSPath(dstGCSPath)
+
+	// the metadata is replaced rather than copied, so that the cache control,
+	// acl and generation apply to the copy
+	output, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(dstBucketName),
+		Key:               aws.String(dstObjectName),
+		CopySource:        aws.String((&url.URL{Path: srcAttrs.Bucket + "/" + srcAttrs.Name}).EscapedPath()),
+		CopySourceIfMatch: aws.String(srcAttrs.Etag),
+		MetadataDirective: types.MetadataDirectiveReplace,
+		ContentType:       aws.String(attrs.ContentType),
+		CacheControl:      s3OptionalString(attrs.CacheControl),
+		ACL:               s3ACL(attrs.PredefinedACL),
+		Metadata:          map[string]string{s3GenerationMetadata: strconv.FormatInt(generation, 10)},
+		IfMatch:           ifMatch,
+		IfNoneMatch:       ifNoneMatch,
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	attrs.Bucket, attrs.Name = dstBucketName, dstObjectName
+	attrs.Size = srcAttrs.Size
+	attrs.MD5 = srcAttrs.MD5
+	attrs.Generation = generation
+	attrs.Metageneration = 1
+	if output.CopyObjectResult != nil {
+		attrs.Etag = aws.ToString(output.CopyObjectResult.ETag)
+		attrs.MD5 = s3ETagMD5(attrs.Etag)
+		attrs.Created = aws.ToTime(output.CopyObjectResult.LastModified)
+		attrs.Updated = attrs.Created
+	}
+
+	return &attrs, nil
+}
+
+func (s s3Storage) Delete(ctx context.Context, gcsPath string, conds storage.Conditions) error {
+	attrs, err := s.head(ctx, gcsPath)
+	if err != nil {
+		return err
+	}
+
+	if conds.DoesNotExist || (conds.GenerationMatch != 0 && attrs.Generation != conds.GenerationMatch) {
+		return s3PreconditionFailed(gcsPath)
+	}
+
+	bucketName, objectName := splitGCSPath(gcsPath)
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:  aws.String(bucketName),
+		Key:     aws.String(objectName),
+		IfMatch: aws.String(attrs.Etag),
+	})
+
+	return s3Error(err)
+}
+
+func (s s3Storage) ListPrefixes(ctx context.Context, gcsPrefix string) ([]string, error) {
+	bucketName, objectPrefix := splitGCSPath(gcsPrefix)
+	base := strings.TrimSuffix(gcsPrefix, objectPrefix)
+
+	prefixes := make([]string, 0)
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucketName),
+		Prefix:    aws.String(objectPrefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(err)
+		}
+
+		for _, prefix := range page.CommonPrefixes {
+			prefixes = append(prefixes, base+aws.ToString(prefix.Prefix))
+		}
+	}
+
+	return prefixes, nil
+}
+
+func (s s3Storage) ListObjects(ctx context.Context, gcsPrefix string) ([]string, error) {
+	bucketName, objectPrefix := splitGCSPath(gcsPrefix)
+	base := strings.TrimSuffix(gcsPrefix, objectPrefix)
+
+	gcsPaths := make([]string, 0)
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(objectPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(err)
+		}
+
+		for _, object := range page.Contents {
+			gcsPaths = append(gcsPaths, base+aws.ToString(object.Key))
+		}
+	}
+
+	return gcsPaths, nil
+}
+
+func (s s3Storage) SignedURL(gcsPath string, expiresAt time.Time) (string, error) {
+	bucketName, objectName := splitGCSPath(gcsPath)
+	request, err := s3.NewPresignClient(s.client).PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	}, s3.WithPresignExpires(time.Until(expiresAt)))
+	if err != nil {
+		return "", err
+	}
+
+	return request.URL, nil
+}
+
+// s3Generation: the generation recorded in an object's metadata, falling back
+// to its modification time for objects written by other tools
+func s3Generation(metadata map[string]string, lastModified *time.Time) int64 {
+	if generation, err := strconv.ParseInt(metadata[s3GenerationMetadata], 10, 64); err == nil && generation != 0 {
+		return generation
+	}
+
+	return aws.ToTime(lastModified).UnixNano()
+}
+
+// s3ETagMD5: the md5 of an object from its etag, which is only its md5 when
+// it was written in a single part
+func s3ETagMD5(etag string) []byte {
+	md5Sum, err := hex.DecodeString(strings.Trim(etag, "\""))
+	if err != nil || len(md5Sum) != md5.Size {
+		return nil
+	}
+
+	return md5Sum
+}
+
+// s3ACL: the canned s3 acl matching a predefined gcs acl
+func s3ACL(predefinedACL string) types.ObjectCannedACL {
+	switch predefinedACL {
+	case "publicRead":
+		return types.ObjectCannedACLPublicRead
+	case "private":
+		return types.ObjectCannedACLPrivate
+	case "bucketOwnerRead":
+		return types.ObjectCannedACLBucketOwnerRead
+	case "bucketOwnerFullControl":
+		return types.ObjectCannedACLBucketOwnerFullControl
+	case "authenticatedRead":
+		return types.ObjectCannedACLAuthenticatedRead
+	}
+
+	return ""
+}
+
+func s3OptionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return aws.String(value)
+}
+
+// s3Error: translate s3 errors into the errors the gcs client returns, so
+// that missing objects and failed preconditions are handled the same way
+func s3Error(err error) error {
+	var responseErr *awshttp.ResponseError
+	if err == nil || !errors.As(err, &responseErr) {
+		return err
+	}
+
+	switch responseErr.HTTPStatusCode() {
+	case http.StatusNotFound:
+		return storage.ErrObjectNotExist
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// s3 answers a conditional write racing another with a 409, which
+		// is retried the same way as a failed precondition
+		return &googleapi.Error{Code: http.StatusPreconditionFailed, Message: err.Error()}
+	}
+
+	return err
+}
+
+func s3PreconditionFailed(gcsPath string) error {
+	return &googleapi.Error{
+		Code:    http.StatusPreconditionFailed,
+		Message: gcsPath + ": precondition failed",
+	}
+}
@@ -0,0 +1,380 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestSchema: the json schema manifest.json is written to. Tooling reading
+// manifests can validate against it, and ValidateManifest interprets it along
+// with checking what a schema can't express
+const ManifestSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "artifactor manifest.json",
+  "type": "object",
+  "required": ["timestamp", "unix_timestamp", "project", "version", "gcs_prefix", "components", "licenses"],
+  "properties": {
+    "timestamp": {"type": "string", "format": "date-time"},
+    "unix_timestamp": {"type": "integer", "minimum": 0},
+    "project": {"type": "string", "minLength": 1},
+    "version": {"type": "string", "minLength": 1, "pattern": "^[^/]+$"},
+    "gcs_prefix": {"type": "string"},
+    "components": {"type": "array", "items": {"$ref": "#/$defs/component"}},
+    "licenses": {"type": ["array", "null"], "items": {"type": "string", "minLength": 1}},
+    "package_signing_key": {"type": "string"},
+    "expires_at": {"type": "string", "format": "date-time"},
+    "published_by": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "key_fingerprints": {"type": "array", "items": {"type": "string", "pattern": "^[0-9A-Fa-f]{16,40}$"}},
+        "claims": {"type": "object"}
+      }
+    },
+    "symbols": {"type": "array", "items": {"$ref": "#/$defs/component"}},
+    "homepage": {"type": "string", "format": "uri"},
+    "documentation_url": {"type": "string", "format": "uri"},
+    "support": {"type": "string"},
+    "license": {"type": "string"}
+  },
+  "$defs": {
+    "component": {
+      "type": "object",
+      "required": ["filepath", "gcs_filepath", "url", "bytes", "md5_checksum", "sha256_checksum", "sha384_checksum", "sha512_checksum"],
+      "properties": {
+        "filepath": {"type": "string", "minLength": 1, "pattern": "^[^/]"},
+        "gcs_filepath": {"type": "string", "pattern": "^(gcs|s3|https?)://[^/]+/.+[^/]$"},
+        "url": {"type": "string", "pattern": "^(https?://.+)?$"},
+        "bytes": {"type": "integer", "minimum": 0},
+        "md5_checksum": {"type": "string", "pattern": "^[0-9a-f]{32}$"},
+        "sha256_checksum": {"type": "string", "pattern": "^[0-9a-f]{64}$"},
+        "sha384_checksum": {"type": "string", "pattern": "^[0-9a-f]{96}$"},
+        "sha512_checksum": {"type": "string", "pattern": "^[0-9a-f]{64}$"},
+        "crc32c_checksum": {"type": "string", "pattern": "^[0-9a-f]{8}$"},
+        "generation": {"type": "integer", "minimum": 1},
+        "metageneration": {"type": "integer", "minimum": 1},
+        "mirrors": {"type": "array", "items": {"type": "string", "format": "uri"}},
+        "groups": {"type": "array", "items": {"type": "string", "minLength": 1}},
+        "role": {"enum": ["binary", "archive", "package", "checksum", "signature", "symbols", "docs", "other"]}
+      }
+    }
+  }
+}
+`
+
+// ValidateManifest: every problem with a manifest.json, checked against
+// ManifestSchema and then for consistency between its fields: that the
+// timestamps agree, that filepaths and storage paths are unique, that each
+// license is one of the components, and that each url names the same file as
+// the component's storage path. Each problem is prefixed with the json pointer
+// of the field it's found in. Manifests which aren't json are an error
+func ValidateManifest(byts []byte) ([]string, error) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(ManifestSchema), &schema); err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(byts))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	problems := validateSchema(schema, schema, value, "")
+	if len(problems) > 0 {
+		return problems, nil
+	}
+
+	var manifest ComponentManifest
+	if err := json.Unmarshal(byts, &manifest); err != nil {
+		return nil, err
+	}
+
+	return manifestProblems(manifest), nil
+}
+
+// manifestProblems: the inconsistencies between the fields of a manifest
+// which already matches the schema
+func manifestProblems(manifest ComponentManifest) []string {
+	problems := make([]string, 0)
+
+	if int64(manifest.UnixTimestamp) != manifest.Timestamp.Unix() {
+		problems = append(problems, fmt.Sprintf("/unix_timestamp: %d is not the timestamp %s", manifest.UnixTimestamp, manifest.Timestamp.Format(time.RFC3339)))
+	}
+
+	filepaths := make(map[string]string)
+	gcsFilepaths := make(map[string]string)
+	for _, field := range []struct {
+		name       string
+		components []Component
+	}{
+		{"components", manifest.Components},
+		{"symbols", manifest.Symbols},
+	} {
+		for idx, component := range field.components {
+			pointer := fmt.Sprintf("/%s/%d", field.name, idx)
+
+			if other, ok := filepaths[component.Filepath]; ok {
+				problems = append(problems, fmt.Sprintf("%s/filepath: %s is also the filepath of %s", pointer, component.Filepath, other))
+			}
+			filepaths[component.Filepath] = pointer
+
+			if other, ok := gcsFilepaths[component.GCSFilepath]; ok {
+				problems = append(problems, fmt.Sprintf("%s/gcs_filepath: %s is also the storage path of %s", pointer, component.GCSFilepath, other))
+			}
+			gcsFilepaths[component.GCSFilepath] = pointer
+
+			// only symbols published without a url prefix have no url
+			if component.URL == "" {
+				if field.name != "symbols" {
+					problems = append(problems, fmt.Sprintf("%s/url: is empty", pointer))
+				}
+			} else if problem := urlMismatch(component.URL, component.GCSFilepath); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s/url: %s", pointer, problem))
+			}
+
+			for mirrorIdx, mirrorURL := range component.Mirrors {
+				if problem := urlMismatch(mirrorURL, component.GCSFilepath); problem != "" {
+					problems = append(problems, fmt.Sprintf("%s/mirrors/%d: %s", pointer, mirrorIdx, problem))
+				}
+			}
+		}
+	}
+
+	for idx, license := range manifest.Licenses {
+		if pointer, ok := filepaths[license]; !ok || !strings.HasPrefix(pointer, "/components/") {
+			problems = append(problems, fmt.Sprintf("/licenses/%d: %s is not one of the components", idx, license))
+		}
+	}
+
+	return problems
+}
+
+// urlMismatch: why a url doesn't serve the object at a storage path, or empty
+// when it does. Urls may be laid out differently from the bucket, such as by
+// url templates, but always end in the object's file name
+func urlMismatch(rawURL, gcsFilepath string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err.Error()
+	}
+
+	if path.Base(parsed.Path) != path.Base(gcsFilepath) {
+		return fmt.Sprintf("%s names a different file than the storage path %s", rawURL, gcsFilepath)
+	}
+
+	return ""
+}
+
+// validateSchema: the problems with a json value decoded with UseNumber,
+// checked against a schema. Only the keywords ManifestSchema uses are
+// interpreted: $ref within the root schema, type, enum, required, properties,
+// items, minLength, pattern, format and minimum
+func validateSchema(root, schema map[string]interface{}, value interface{}, pointer string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := resolveSchemaRef(root, ref)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %v", pointerOrRoot(pointer), err)}
+		}
+
+		return validateSchema(root, resolved, value, pointer)
+	}
+
+	if types, ok := schema["type"]; ok && !matchesSchemaType(types, value) {
+		return []string{fmt.Sprintf("%s: must be of type %s, not %s", pointerOrRoot(pointer), schemaTypeNames(types), jsonTypeName(value))}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		allowed := make([]string, 0, len(enum))
+		matched := false
+		for _, option := range enum {
+			allowed = append(allowed, fmt.Sprintf("%v", option))
+			if fmt.Sprintf("%v", option) == fmt.Sprintf("%v", value) {
+				matched = true
+			}
+		}
+
+		if !matched {
+			return []string{fmt.Sprintf("%s: %v must be one of %s", pointerOrRoot(pointer), value, strings.Join(allowed, ", "))}
+		}
+	}
+
+	problems := make([]string, 0)
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, field := range required {
+				if _, ok := value[field.(string)]; !ok {
+					problems = append(problems, fmt.Sprintf("%s/%s: is required", pointer, field))
+				}
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		fields := make([]string, 0, len(value))
+		for field := range value {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			if property, ok := properties[field].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(root, property, value[field], pointer+"/"+field)...)
+			}
+		}
+
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for idx, item := range value {
+				problems = append(problems, validateSchema(root, items, item, fmt.Sprintf("%s/%d", pointer, idx))...)
+			}
+		}
+
+	case string:
+		if minLength, ok := schema["minLength"].(float64); ok && len(value) < int(minLength) {
+			if minLength == 1 {
+				problems = append(problems, fmt.Sprintf("%s: must not be empty", pointerOrRoot(pointer)))
+			} else {
+				problems = append(problems, fmt.Sprintf("%s: must be at least %d characters", pointerOrRoot(pointer), int(minLength)))
+			}
+		}
+
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return append(problems, fmt.Sprintf("%s: %v", pointerOrRoot(pointer), err))
+			}
+
+			if !re.MatchString(value) {
+				problems = append(problems, fmt.Sprintf("%s: %q does not match %s", pointerOrRoot(pointer), value, pattern))
+			}
+		}
+
+		if format, ok := schema["format"].(string); ok {
+			if err := checkSchemaFormat(format, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", pointerOrRoot(pointer), err))
+			}
+		}
+
+	case json.Number:
+		if minimum, ok := schema["minimum"].(float64); ok {
+			if number, err := value.Float64(); err == nil && number < minimum {
+				problems = append(problems, fmt.Sprintf("%s: %s is less than %v", pointerOrRoot(pointer), value, minimum))
+			}
+		}
+	}
+
+	return problems
+}
+
+// resolveSchemaRef: the schema a $ref within the root schema points to, such
+// as #/$defs/component
+func resolveSchemaRef(root map[string]interface{}, ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %s", ref)
+	}
+
+	schema := root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		next, ok := schema[part].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %s", ref)
+		}
+		schema = next
+	}
+
+	return schema, nil
+}
+
+// matchesSchemaType: whether a value is of a schema type, or one of a list of
+// them
+func matchesSchemaType(types interface{}, value interface{}) bool {
+	names, ok := types.([]interface{})
+	if !ok {
+		names = []interface{}{types}
+	}
+
+	for _, name := range names {
+		actual := jsonTypeName(value)
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schemaTypeNames: the names of a schema type, or list of them
+func schemaTypeNames(types interface{}) string {
+	names, ok := types.([]interface{})
+	if !ok {
+		return fmt.Sprintf("%v", types)
+	}
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%v", name))
+	}
+
+	return strings.Join(parts, " or ")
+}
+
+// jsonTypeName: the json schema type of a value decoded with UseNumber
+func jsonTypeName(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+
+	return "unknown"
+}
+
+// checkSchemaFormat: check a string against a schema format, ignoring formats
+// which aren't known
+func checkSchemaFormat(format, value string) error {
+	switch format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			return fmt.Errorf("%q is not an rfc 3339 date-time", value)
+		}
+
+	case "uri":
+		parsed, err := url.Parse(value)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("%q is not an absolute uri", value)
+		}
+	}
+
+	return nil
+}
+
+// pointerOrRoot: a json pointer, or / for the whole document
+func pointerOrRoot(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+
+	return pointer
+}
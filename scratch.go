@@ -0,0 +1,22 @@
+package artifactor
+
+import (
+	"io/ioutil"
+)
+
+// scratchDir: where intermediate files, such as manifests before they're
+// uploaded, are written. The system temporary directory is used when unset
+var scratchDir string
+
+// SetScratchDir: write intermediate files under dir rather than the system
+// temporary directory. Each operation uses its own directory within it, which
+// is removed once it's done
+func SetScratchDir(dir string) {
+	scratchDir = dir
+}
+
+// newScratchDir: create a directory for an operation's intermediate files,
+// which the caller removes once it's done
+func newScratchDir(prefix string) (string, error) {
+	return ioutil.TempDir(scratchDir, prefix)
+}
@@ -0,0 +1,583 @@
+package artifactor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/time/rate"
+)
+
+// Server: an http server which serves published artifacts out of the storage
+// bucket, supporting range requests and conditional requests so that large
+// downloads can be resumed
+type Server struct {
+	gcsPrefix string
+	store     Storage
+	opts      ServerOptions
+
+	// whether requests must authenticate, fixed when the server is created
+	// so that emptied credentials never open it up
+	authRequired bool
+
+	// shared by every response, limiting the server's total bandwidth
+	globalLimiter *rate.Limiter
+
+	templates *template.Template
+
+	mu        sync.Mutex
+	manifests map[string]cachedManifest
+
+	// components downloaded from each project since the server started,
+	// keyed by the project's path
+	downloads map[string]int64
+}
+
+type cachedManifest struct {
+	manifest  ComponentManifest
+	found     bool
+	fetchedAt time.Time
+}
+
+// ServerOptions: configuration for serving artifacts
+type ServerOptions struct {
+	// ConnectionBytesPerSecond limits the bandwidth of each response, and
+	// GlobalBytesPerSecond limits the bandwidth of all responses combined.
+	// Zero means unlimited
+	ConnectionBytesPerSecond int64
+	GlobalBytesPerSecond     int64
+
+	// AllowedNetworks, when set, restricts requests to clients within them
+	AllowedNetworks []*net.IPNet
+
+	// BasicAuthUsers maps usernames to bcrypt password hashes, and
+	// BearerTokens are accepted in an Authorization: Bearer header. When
+	// either is set, or RequireAuth is, every request must carry valid
+	// credentials
+	BasicAuthUsers map[string]string
+	BearerTokens   []string
+	RequireAuth    bool
+
+	// TemplatesDir holds .html templates overriding the defaults used to
+	// render pages, and StaticDir holds assets served under /_static/
+	TemplatesDir string
+	StaticDir    string
+
+	// Downloads is how objects are served: proxied through the server by
+	// default, redirected to the url in the manifest for components, or
+	// redirected to a signed url valid for SignedURLExpiry
+	Downloads       string
+	SignedURLExpiry time.Duration
+}
+
+// ways the server serves downloads
+const (
+	DownloadsProxy    = "proxy"
+	DownloadsRedirect = "redirect"
+	DownloadsSigned   = "signed"
+)
+
+// how long signed download urls are valid unless set otherwise
+const defaultSignedURLExpiry = 15 * time.Minute
+
+// NewServer: create a server for the artifacts stored under the gcs prefix
+func NewServer(gcsPrefix string, opts ServerOptions) (*Server, error) {
+	store, err := openStorage(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := parseTemplates(opts.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		gcsPrefix:     gcsPrefix,
+		store:         store,
+		opts:          opts,
+		authRequired:  opts.RequireAuth || len(opts.BasicAuthUsers) > 0 || len(opts.BearerTokens) > 0,
+		globalLimiter: newByteLimiter(opts.GlobalBytesPerSecond),
+		templates:     templates,
+		manifests:     make(map[string]cachedManifest),
+		downloads:     make(map[string]int64),
+	}, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	if s.opts.StaticDir != "" && strings.HasPrefix(r.URL.Path, staticPathPrefix) {
+		http.StripPrefix(staticPathPrefix, http.FileServer(http.Dir(s.opts.StaticDir))).ServeHTTP(w, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, badgePathPrefix) {
+		s.serveBadge(w, r, strings.TrimPrefix(path.Clean(r.URL.Path), badgePathPrefix))
+		return
+	}
+
+	objectPath := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if objectPath == "" || objectPath == "." {
+		s.serveDirectoryPage(w, r, "")
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/") {
+		s.serveVersionPage(w, r, objectPath)
+		return
+	}
+
+	w = throttle(r.Context(), w, s.globalLimiter, newByteLimiter(s.opts.ConnectionBytesPerSecond))
+	s.serveObject(w, r, objectPath)
+}
+
+// serveVersionPage: render the manifest of a version directory as html, or
+// list the directory when it isn't a version, such as a project or channel
+func (s *Server) serveVersionPage(w http.ResponseWriter, r *http.Request, versionPath string) {
+	manifest, found, err := s.manifest(r.Context(), versionPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if !found {
+		s.serveDirectoryPage(w, r, versionPath)
+		return
+	}
+
+	if manifest.Expired(time.Now()) {
+		http.Error(w, "version expired", http.StatusGone)
+		return
+	}
+
+	advisories, err := s.advisories(r.Context(), versionPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	yank, err := s.yank(r.Context(), versionPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	s.renderPage(w, "version.html", VersionPage{
+		Title:      manifest.Project + " " + manifest.Version,
+		Manifest:   manifest,
+		Advisories: advisories.Advisories,
+		Yanked:     yank,
+	})
+}
+
+// serveDirectoryPage: render what's published beneath a directory as html,
+// its versions newest first, its aliases and the version each serves, and
+// any other directories such as projects and channels. Expired versions are
+// left out, since they're no longer served
+func (s *Server) serveDirectoryPage(w http.ResponseWriter, r *http.Request, dirPath string) {
+	ctx := r.Context()
+
+	gcsPrefix := s.gcsPrefix
+	if dirPath != "" {
+		gcsPrefix = gcsPrefix + dirPath + "/"
+	}
+
+	prefixes, err := s.store.ListPrefixes(ctx, gcsPrefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	page := DirectoryPage{
+		Title:       strings.TrimPrefix(dirPath, "/"),
+		Path:        dirPath,
+		Versions:    make([]DirectoryVersion, 0),
+		Aliases:     make([]DirectoryAlias, 0),
+		Directories: make([]string, 0),
+	}
+	if page.Title == "" {
+		page.Title = "artifacts"
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(prefixes))
+	semaphore := make(chan struct{}, DefaultConcurrency)
+
+	for _, prefix := range prefixes {
+		wg.Add(1)
+
+		go func(name string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			entryPath := strings.TrimPrefix(path.Join(dirPath, name), "/")
+			manifest, found, err := s.manifest(ctx, entryPath)
+			if err != nil {
+				errCh <- err
+				return
+			}
+
+			target := ""
+			if !found {
+				target, err = s.aliasPointerTarget(ctx, entryPath)
+				if err != nil {
+					errCh <- err
+					return
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case found && manifest.Version == name:
+				if manifest.Expired(time.Now()) {
+					return
+				}
+
+				bytes := int64(0)
+				for _, component := range manifest.Components {
+					bytes += component.Bytes
+				}
+				page.Versions = append(page.Versions, DirectoryVersion{
+					Version:    manifest.Version,
+					Timestamp:  manifest.Timestamp,
+					Components: len(manifest.Components),
+					Bytes:      bytes,
+				})
+			case found:
+				page.Aliases = append(page.Aliases, DirectoryAlias{Alias: name, Version: manifest.Version})
+			case target != "":
+				page.Aliases = append(page.Aliases, DirectoryAlias{Alias: name, Version: target})
+			default:
+				page.Directories = append(page.Directories, name)
+			}
+		}(strings.TrimSuffix(strings.TrimPrefix(prefix, gcsPrefix), "/"))
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	default:
+	}
+
+	if len(page.Versions)+len(page.Aliases)+len(page.Directories) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	sort.Slice(page.Versions, func(i, j int) bool {
+		if page.Versions[i].Timestamp.Equal(page.Versions[j].Timestamp) {
+			return page.Versions[i].Version > page.Versions[j].Version
+		}
+
+		return page.Versions[i].Timestamp.After(page.Versions[j].Timestamp)
+	})
+	sort.Slice(page.Aliases, func(i, j int) bool {
+		return page.Aliases[i].Alias < page.Aliases[j].Alias
+	})
+	sort.Strings(page.Directories)
+
+	s.renderPage(w, "directory.html", page)
+}
+
+// aliasPointerTarget: the version a pointer alias directory points at, or
+// empty when the directory isn't one
+func (s *Server) aliasPointerTarget(ctx context.Context, aliasPath string) (string, error) {
+	reader, err := s.store.NewRangeReader(ctx, s.gcsPrefix+aliasPath+"/"+aliasPointerFilepaths[0], 0, 0, -1)
+	if err == storage.ErrObjectNotExist {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	var pointer AliasPointer
+	if err := json.NewDecoder(reader).Decode(&pointer); err != nil {
+		return "", err
+	}
+
+	return pointer.Version, nil
+}
+
+// advisories: the advisories attached to a version, if any
+func (s *Server) advisories(ctx context.Context, versionPath string) (VersionAdvisories, error) {
+	reader, err := s.store.NewRangeReader(ctx, s.gcsPrefix+versionPath+"/"+advisoryFilepaths[0], 0, 0, -1)
+	if err == storage.ErrObjectNotExist {
+		return VersionAdvisories{}, nil
+	}
+	if err != nil {
+		return VersionAdvisories{}, err
+	}
+	defer reader.Close()
+
+	var advisories VersionAdvisories
+	err = json.NewDecoder(reader).Decode(&advisories)
+	return advisories, err
+}
+
+// yank: why a version was yanked, or nil when it hasn't been
+func (s *Server) yank(ctx context.Context, versionPath string) (*Yank, error) {
+	reader, err := s.store.NewRangeReader(ctx, s.gcsPrefix+versionPath+"/"+yankFilepaths[0], 0, 0, -1)
+	if err == storage.ErrObjectNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var yank VersionYank
+	if err := json.NewDecoder(reader).Decode(&yank); err != nil {
+		return nil, err
+	}
+
+	return &yank.Yanked, nil
+}
+
+// serveObject: serve an object from the bucket, using the sha256 recorded in
+// its version's manifest as the etag when there is one
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, objectPath string) {
+	ctx := r.Context()
+	gcsPath := s.gcsPrefix + objectPath
+
+	manifest, found, err := s.manifest(ctx, path.Dir(objectPath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if found && manifest.Expired(time.Now()) {
+		http.Error(w, "version expired", http.StatusGone)
+		return
+	}
+
+	attrs, err := s.store.Attrs(ctx, gcsPath)
+	if err == storage.ErrObjectNotExist {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	etag := fmt.Sprintf("\"md5-%x\"", attrs.MD5)
+	componentURL := ""
+	if found {
+		for _, component := range manifest.Components {
+			if component.GCSFilepath == gcsPath || path.Join(path.Dir(objectPath), component.Filepath) == objectPath {
+				etag = fmt.Sprintf("\"%s\"", component.Sha256Checksum)
+				componentURL = component.URL
+				s.countDownload(r, path.Dir(objectPath))
+				break
+			}
+		}
+	}
+
+	if redirectURL, err := s.redirectURL(r, gcsPath, componentURL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	} else if redirectURL != "" {
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", attrs.CacheControl)
+	if attrs.ContentType != "" {
+		w.Header().Set("Content-Type", attrs.ContentType)
+	}
+
+	// reads are pinned to the generation that was stat'd, so an object
+	// replaced mid request can't mix contents across ranges
+	reader := &objectReadSeeker{
+		ctx:        ctx,
+		store:      s.store,
+		gcsPath:    gcsPath,
+		generation: attrs.Generation,
+		size:       attrs.Size,
+	}
+	defer reader.Close()
+
+	http.ServeContent(w, r, path.Base(objectPath), attrs.Updated, reader)
+}
+
+// redirectURL: where a download is redirected to rather than proxied, or
+// empty to proxy it. Components are only redirected to their url when it's
+// served by somewhere other than this server, which would loop
+func (s *Server) redirectURL(r *http.Request, gcsPath, componentURL string) (string, error) {
+	switch s.opts.Downloads {
+	case DownloadsRedirect:
+		parsed, err := url.Parse(componentURL)
+		if componentURL == "" || err != nil || parsed.Host == r.Host {
+			return "", nil
+		}
+
+		return componentURL, nil
+
+	case DownloadsSigned:
+		expiry := s.opts.SignedURLExpiry
+		if expiry <= 0 {
+			expiry = defaultSignedURLExpiry
+		}
+
+		return s.store.SignedURL(gcsPath, time.Now().Add(expiry))
+	}
+
+	return "", nil
+}
+
+// the most manifests a server keeps parsed at once
+const maxCachedManifests = 1024
+
+// manifest: look up the manifest of the version directory an object belongs
+// to, caching it for as long as published objects are cached. Only manifests
+// which exist are cached, since the version paths come from requests
+func (s *Server) manifest(ctx context.Context, versionPath string) (ComponentManifest, bool, error) {
+	s.mu.Lock()
+	cached, ok := s.manifests[versionPath]
+	s.mu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < CacheControlMaxAge*time.Second {
+		return cached.manifest, cached.found, nil
+	}
+
+	reader, err := s.store.NewRangeReader(ctx, s.gcsPrefix+versionPath+"/manifest.json", 0, 0, -1)
+	cached = cachedManifest{fetchedAt: time.Now()}
+
+	switch {
+	case err == storage.ErrObjectNotExist:
+	case err != nil:
+		return ComponentManifest{}, false, err
+	default:
+		defer reader.Close()
+		if err := json.NewDecoder(reader).Decode(&cached.manifest); err != nil {
+			return ComponentManifest{}, false, err
+		}
+		cached.found = true
+	}
+
+	if cached.found {
+		s.cacheManifest(versionPath, cached)
+	}
+
+	return cached.manifest, cached.found, nil
+}
+
+// cacheManifest: cache a parsed manifest, first dropping expired manifests
+// and then the oldest when the cache is full
+func (s *Server) cacheManifest(versionPath string, cached cachedManifest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.manifests[versionPath]; !ok && len(s.manifests) >= maxCachedManifests {
+		oldestPath := ""
+		for path, entry := range s.manifests {
+			if time.Since(entry.fetchedAt) >= CacheControlMaxAge*time.Second {
+				delete(s.manifests, path)
+				continue
+			}
+
+			if oldestPath == "" || entry.fetchedAt.Before(s.manifests[oldestPath].fetchedAt) {
+				oldestPath = path
+			}
+		}
+
+		if len(s.manifests) >= maxCachedManifests {
+			delete(s.manifests, oldestPath)
+		}
+	}
+
+	s.manifests[versionPath] = cached
+}
+
+// objectReadSeeker: an io.ReadSeeker over a stored object, which opens a
+// range read from the current offset whenever it is read after seeking
+type objectReadSeeker struct {
+	ctx        context.Context
+	store      Storage
+	gcsPath    string
+	generation int64
+	size       int64
+
+	offset int64
+	reader io.ReadCloser
+}
+
+func (o *objectReadSeeker) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.reader == nil {
+		reader, err := o.store.NewRangeReader(o.ctx, o.gcsPath, o.generation, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.reader = reader
+	}
+
+	n, err := o.reader.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *objectReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+
+	if offset != o.offset {
+		o.Close()
+		o.offset = offset
+	}
+
+	return o.offset, nil
+}
+
+func (o *objectReadSeeker) Close() error {
+	if o.reader == nil {
+		return nil
+	}
+
+	err := o.reader.Close()
+	o.reader = nil
+	return err
+}
@@ -0,0 +1,37 @@
+package artifactor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCacheManifestBounded(t *testing.T) {
+	s := &Server{manifests: make(map[string]cachedManifest)}
+
+	start := time.Now()
+	for i := 0; i < maxCachedManifests+10; i++ {
+		s.cacheManifest(fmt.Sprintf("p/v%d", i), cachedManifest{found: true, fetchedAt: start.Add(time.Duration(i) * time.Millisecond)})
+	}
+
+	if len(s.manifests) != maxCachedManifests {
+		t.Fatalf("expected %d cached manifests, found %d", maxCachedManifests, len(s.manifests))
+	}
+	if _, ok := s.manifests["p/v0"]; ok {
+		t.Fatal("expected the oldest manifest to be evicted")
+	}
+	if _, ok := s.manifests[fmt.Sprintf("p/v%d", maxCachedManifests+9)]; !ok {
+		t.Fatal("expected the newest manifest to be cached")
+	}
+
+	// expired manifests are dropped before any live one is evicted
+	for path, entry := range s.manifests {
+		entry.fetchedAt = start.Add(-2 * CacheControlMaxAge * time.Second)
+		s.manifests[path] = entry
+	}
+	s.cacheManifest("p/fresh", cachedManifest{found: true, fetchedAt: time.Now()})
+
+	if len(s.manifests) != 1 {
+		t.Fatalf("expected expired manifests to be dropped, found %d", len(s.manifests))
+	}
+}
@@ -0,0 +1,227 @@
+package artifactor
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// files written when publishing a sharded manifest. The shards themselves are
+// written under manifestShardsDir, and pinned by the signed index
+var manifestIndexFilepaths = []string{"manifest-index.json", "manifest-index.json.asc.sig"}
+
+const manifestShardsDir = "manifest-shards/"
+
+// ManifestIndex: a signed index of a version's components split into shards
+// ordered by filepath, so that a consumer after a single component only
+// downloads the small shard holding it rather than the whole manifest.json
+type ManifestIndex struct {
+	Timestamp     time.Time            `json:"timestamp"`
+	UnixTimestamp int                  `json:"unix_timestamp"`
+	Project       string               `json:"project"`
+	Version       string               `json:"version"`
+	Components    int                  `json:"components"`
+	Shards        []ManifestShardEntry `json:"shards"`
+}
+
+// ManifestShardEntry: a shard as listed in the manifest index. The filepath is
+// relative to the version, and the shard holds the components from
+// FirstFilepath to LastFilepath inclusive
+type ManifestShardEntry struct {
+	Filepath       string `json:"filepath"`
+	Sha256Checksum string `json:"sha256_checksum"`
+	Components     int    `json:"components"`
+	FirstFilepath  string `json:"first_filepath"`
+	LastFilepath   string `json:"last_filepath"`
+}
+
+// ManifestShard: a contiguous run of a version's components
+type ManifestShard struct {
+	Project    string      `json:"project"`
+	Version    string      `json:"version"`
+	Shard      int         `json:"shard"`
+	Components []Component `json:"components"`
+}
+
+// find: the entry of the shard which would hold a component
+func (m ManifestIndex) find(componentFilepath string) (ManifestShardEntry, bool) {
+	for _, shard := range m.Shards {
+		if componentFilepath >= shard.FirstFilepath && componentFilepath <= shard.LastFilepath {
+			return shard, true
+		}
+	}
+
+	return ManifestShardEntry{}, false
+}
+
+// writeManifestShards: split the components into shards of at most shardSize
+// components, and write them along with their signed index into dir. Returns
+// the filepaths written, relative to dir
+func writeManifestShards(dir string, manifest ComponentManifest, shardSize int) ([]string, error) {
+	components := append([]Component(nil), manifest.Components...)
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Filepath < components[j].Filepath
+	})
+
+	if err := os.MkdirAll(filepath.Join(dir, manifestShardsDir), 0755); err != nil {
+		return nil, err
+	}
+
+	index := ManifestIndex{
+		Timestamp:     manifest.Timestamp,
+		UnixTimestamp: manifest.UnixTimestamp,
+		Project:       manifest.Project,
+		Version:       manifest.Version,
+		Components:    len(components),
+	}
+	filepaths := make([]string, 0, len(components)/shardSize+3)
+
+	for start := 0; start < len(components); start += shardSize {
+		end := start + shardSize
+		if end > len(components) {
+			end = len(components)
+		}
+
+		shard := ManifestShard{
+			Project:    manifest.Project,
+			Version:    manifest.Version,
+			Shard:      len(index.Shards),
+			Components: components[start:end],
+		}
+
+		jsonBytes, err := json.Marshal(shard)
+		if err != nil {
+			return nil, err
+		}
+
+		shardFilepath := fmt.Sprintf("%s%04d.json", manifestShardsDir, shard.Shard)
+		if err := ioutil.WriteFile(filepath.Join(dir, shardFilepath), jsonBytes, 0644); err != nil {
+			return nil, err
+		}
+
+		index.Shards = append(index.Shards, ManifestShardEntry{
+			Filepath:       shardFilepath,
+			Sha256Checksum: fmt.Sprintf("%x", sha256.Sum256(jsonBytes)),
+			Components:     len(shard.Components),
+			FirstFilepath:  shard.Components[0].Filepath,
+			LastFilepath:   shard.Components[len(shard.Components)-1].Filepath,
+		})
+		filepaths = append(filepaths, shardFilepath)
+	}
+
+	jsonBytes, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+
+	indexFilepath := filepath.Join(dir, manifestIndexFilepaths[0])
+	if err := ioutil.WriteFile(indexFilepath, jsonBytes, 0644); err != nil {
+		return nil, err
+	}
+
+	if err := createSigFile(indexFilepath, filepath.Join(dir, manifestIndexFilepaths[1])); err != nil {
+		return nil, err
+	}
+
+	return append(filepaths, manifestIndexFilepaths...), nil
+}
+
+// publishManifestShards: shard the version's manifest and upload the shards
+// and their index alongside it
+func publishManifestShards(project Project, manifest ComponentManifest, shardSize int) ([]PublishedObject, error) {
+	versionGCSPrefix := project.gcsPrefix + manifest.Version + "/"
+	versionURLPrefix := project.urlPrefix + manifest.Version + "/"
+
+	tmpDir, err := newScratchDir("artifactor-shards")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filepaths, err := writeManifestShards(tmpDir, manifest, shardSize)
+	if err != nil {
+		return nil, err
+	}
+
+	components := make([]Component, 0, len(filepaths))
+	gcsPaths := make([]string, 0, len(filepaths))
+	for _, filename := range filepaths {
+		component, err := newTempComponent(tmpDir, filename, versionGCSPrefix, versionURLPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, component)
+		gcsPaths = append(gcsPaths, component.GCSFilepath)
+	}
+
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploadComponents(project.gcsPrefix, components, generations, false)
+}
+
+// fetchShardedComponent: look up a component through a version's manifest
+// index, verifying the index's signature against the trust policy and the
+// shard's checksum. Returns
+// false when the version has no manifest index
+func fetchShardedComponent(versionURL string, componentFilepath string, trust TrustPolicy) (Component, bool, error) {
+	indexURL := versionURL + manifestIndexFilepaths[0]
+
+	indexBytes, found, err := fetchOptionalURL(indexURL)
+	if err != nil || !found {
+		return Component{}, false, err
+	}
+
+	if trust.MinimumSignatures > 0 {
+		sigBytes, err := fetchURL(versionURL + manifestIndexFilepaths[1])
+		if err != nil {
+			return Component{}, false, err
+		}
+
+		if err := trust.verifySignature(indexBytes, sigBytes); err != nil {
+			return Component{}, false, fmt.Errorf("%s: %v", indexURL, err)
+		}
+	}
+
+	var index ManifestIndex
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return Component{}, false, err
+	}
+
+	entry, ok := index.find(componentFilepath)
+	if !ok {
+		return Component{}, true, fmt.Errorf("%s: no component %s in version %s", index.Project, componentFilepath, index.Version)
+	}
+
+	shardURL := versionURL + path.Clean(entry.Filepath)
+	shardBytes, err := fetchURL(shardURL)
+	if err != nil {
+		return Component{}, true, err
+	}
+
+	if sha256Checksum := fmt.Sprintf("%x", sha256.Sum256(shardBytes)); sha256Checksum != entry.Sha256Checksum {
+		return Component{}, true, fmt.Errorf("%s: expected sha256 %s, found %s", shardURL, entry.Sha256Checksum, sha256Checksum)
+	}
+
+	var shard ManifestShard
+	if err := json.Unmarshal(shardBytes, &shard); err != nil {
+		return Component{}, true, err
+	}
+
+	for _, component := range shard.Components {
+		if component.Filepath == componentFilepath {
+			return component, true, nil
+		}
+	}
+
+	return Component{}, true, fmt.Errorf("%s: no component %s in version %s", index.Project, componentFilepath, index.Version)
+}
@@ -0,0 +1,98 @@
+package artifactor
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Signer: creates and verifies the detached signatures published alongside
+// manifests. The local gpg is used unless another signer is set with
+// SetSigner, such as the fake in artifactortest
+type Signer interface {
+	// Sign: write an armored detached signature of input to output, holding
+	// a signature from each of the keys, or from the default key when none
+	// are given
+	Sign(input, output string, keys ...string) error
+
+	// Verify: the valid signatures in a detached signature of input, one for
+	// each signature it holds
+	Verify(input, signature string) ([]Signature, error)
+
+	// PublicKey: export a key's armored public key
+	PublicKey(key string) ([]byte, error)
+}
+
+// Signature: a valid signature, by the fingerprint of the key which made it
+// and that of its primary key. They're the same when a primary key signed
+type Signature struct {
+	Subkey  string
+	Primary string
+}
+
+var (
+	signerMu     sync.Mutex
+	customSigner Signer
+)
+
+// SetSigner: sign and verify with the given signer rather than the local gpg.
+// Setting nil goes back to gpg
+func SetSigner(s Signer) {
+	signerMu.Lock()
+	customSigner = s
+	signerMu.Unlock()
+}
+
+// currentSigner: the signer set with SetSigner, or gpg
+func currentSigner() Signer {
+	signerMu.Lock()
+	defer signerMu.Unlock()
+
+	if customSigner != nil {
+		return customSigner
+	}
+
+	return gpgSigner{}
+}
+
+// gpgSigner: Signer using the local gpg environment. This does not use the
+// crypto packages, so that it can use gpg-agent which is often tunneled over
+// ssh
+type gpgSigner struct{}
+
+func (gpgSigner) Sign(input, output string, keys ...string) error {
+	args := []string{"--yes", "--armor", "--output", output}
+	for _, key := range keys {
+		args = append(args, "--local-user", key)
+	}
+	args = append(args, "--detach-sig", input)
+
+	return exec.Command("gpg", args...).Run()
+}
+
+func (gpgSigner) Verify(input, signature string) ([]Signature, error) {
+	// gpg exits non-zero if any one of several signatures can't be checked,
+	// which is expected during a rotation, so only the status lines matter
+	output, _ := exec.Command("gpg", "--status-fd", "1", "--verify", signature, input).Output()
+
+	signatures := make([]Signature, 0)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "[GNUPG:]" || fields[1] != "VALIDSIG" {
+			continue
+		}
+
+		// the signing subkey's fingerprint, followed by the primary key's
+		signature := Signature{Subkey: fields[2], Primary: fields[2]}
+		if len(fields) > 11 {
+			signature.Primary = fields[11]
+		}
+		signatures = append(signatures, signature)
+	}
+
+	return signatures, nil
+}
+
+func (gpgSigner) PublicKey(key string) ([]byte, error) {
+	return exec.Command("gpg", "--armor", "--export", key).Output()
+}
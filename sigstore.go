@@ -0,0 +1,85 @@
+package artifactor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sigstore bundle published alongside a keyless signed manifest.json, such as
+// the one written by `cosign sign-blob --bundle`
+const sigstoreBundleFilepath = "manifest.json.sigstore.json"
+
+// SigstoreIdentity: the certificate identity a keyless signature must have
+// been made with. Both are regular expressions, which must match the whole
+// oidc issuer and subject of the signing certificate, as though anchored with
+// ^ and $
+type SigstoreIdentity struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+// verifySigstoreBundle: verify a version's manifest against its sigstore
+// bundle, checking the certificate identity along with the bundle's rekor
+// inclusion proof. This uses the local cosign, in the same way signatures are
+// created and verified with the local gpg
+func verifySigstoreBundle(manifestBytes []byte, bundleBytes []byte, identity SigstoreIdentity) error {
+	tmpDir, err := newScratchDir("artifactor-sigstore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifestFilepath := filepath.Join(tmpDir, "manifest.json")
+	bundleFilepath := filepath.Join(tmpDir, sigstoreBundleFilepath)
+	if err := ioutil.WriteFile(manifestFilepath, manifestBytes, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(bundleFilepath, bundleBytes, 0644); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("cosign", "verify-blob",
+		"--bundle", bundleFilepath,
+		"--certificate-oidc-issuer-regexp", anchorRegexp(identity.Issuer),
+		"--certificate-identity-regexp", anchorRegexp(identity.Subject),
+		manifestFilepath)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sigstore bundle verification failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// anchorRegexp: anchor a regular expression so it must match the whole of a
+// string. cosign matches identities anywhere within the certificate's, so
+// https://github.com/jonmorehouse/ would otherwise accept
+// https://evil.example/https://github.com/jonmorehouse/
+func anchorRegexp(expr string) string {
+	return "^(?:" + expr + ")$"
+}
+
+// verifyManifestBundle: fetch the sigstore bundle of a version's manifest and
+// verify it was signed by any of the identities, when any are required
+func verifyManifestBundle(manifestURL string, manifestBytes []byte, identities []SigstoreIdentity) error {
+	if len(identities) == 0 {
+		return nil
+	}
+
+	bundleBytes, err := fetchURL(strings.TrimSuffix(manifestURL, "manifest.json") + sigstoreBundleFilepath)
+	if err != nil {
+		return err
+	}
+
+	for _, identity := range identities {
+		if err = verifySigstoreBundle(manifestBytes, bundleBytes, identity); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: %v", manifestURL, err)
+}
@@ -0,0 +1,25 @@
+package artifactor
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestAnchorRegexp(t *testing.T) {
+	for _, test := range []struct {
+		expr, identity string
+		matches        bool
+	}{
+		{`https://github\.com/jonmorehouse/.*`, "https://github.com/jonmorehouse/artifactor/.github/workflows/release.yml@refs/heads/main", true},
+		{`https://github\.com/jonmorehouse/.*`, "https://evil.example/https://github.com/jonmorehouse/x", false},
+		{`https://github\.com/jonmorehouse/`, "https://github.com/jonmorehouse/artifactor", false},
+		{`^https://token\.actions\.githubusercontent\.com$`, "https://token.actions.githubusercontent.com", true},
+		{`https://token\.actions\.githubusercontent\.com`, "https://token.actions.githubusercontent.com.evil.example", false},
+		{`a|b`, "ab", false},
+		{`a|b`, "b", true},
+	} {
+		if matches := regexp.MustCompile(anchorRegexp(test.expr)).MatchString(test.identity); matches != test.matches {
+			t.Errorf("%s against %s: expected %v, got %v", test.expr, test.identity, test.matches, matches)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package artifactor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// directory of the project's PEP 503 simple repository
+const simpleIndexDir = "simple/"
+
+var (
+	simpleAnchorRegexp   = regexp.MustCompile(`<a href="([^"]*)">([^<]*)</a>`)
+	pythonNameSeparators = regexp.MustCompile(`[-_.]+`)
+)
+
+// pythonPackageName: the normalized name of the python package a wheel or
+// sdist belongs to. Sdists are only recognized when their name ends in a
+// version, such as example-1.2.0.tar.gz
+func pythonPackageName(filepath string) (string, bool) {
+	filename := path.Base(filepath)
+
+	var name string
+	switch {
+	case strings.HasSuffix(filename, ".whl"):
+		name = strings.SplitN(filename, "-", 2)[0]
+	case strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".zip"):
+		base := strings.TrimSuffix(strings.TrimSuffix(filename, ".tar.gz"), ".zip")
+		idx := strings.LastIndex(base, "-")
+		if idx < 1 || idx == len(base)-1 || base[idx+1] < '0' || base[idx+1] > '9' {
+			return "", false
+		}
+		name = base[:idx]
+	default:
+		return "", false
+	}
+
+	if name == "" {
+		return "", false
+	}
+
+	return strings.ToLower(pythonNameSeparators.ReplaceAllString(name, "-")), true
+}
+
+// pythonPackages: group the version's wheels and sdists by package. An
+// archive named like an sdist is only taken to be one when it holds a
+// PKG-INFO, so other release archives are left out of the index
+func pythonPackages(components []Component) (map[string][]Component, error) {
+	packages := make(map[string][]Component)
+	for _, component := range components {
+		name, ok := pythonPackageName(component.Filepath)
+		if !ok {
+			continue
+		}
+
+		if !strings.HasSuffix(component.Filepath, ".whl") {
+			sdist, err := hasPKGInfo(component)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", component.Filepath, err)
+			}
+			if !sdist {
+				continue
+			}
+		}
+
+		packages[name] = append(packages[name], component)
+	}
+
+	return packages, nil
+}
+
+// hasPKGInfo: whether a .tar.gz or .zip holds the PKG-INFO every sdist has in
+// its top level directory, such as example-1.2.0/PKG-INFO
+func hasPKGInfo(component Component) (bool, error) {
+	isPKGInfo := func(name string) bool {
+		parts := strings.Split(strings.TrimPrefix(name, "./"), "/")
+		return len(parts) == 2 && parts[1] == "PKG-INFO"
+	}
+
+	if strings.HasSuffix(component.Filepath, ".zip") {
+		byts, err := component.readContents()
+		if err != nil {
+			return false, err
+		}
+
+		reader, err := zip.NewReader(bytes.NewReader(byts), int64(len(byts)))
+		if err != nil {
+			return false, nil
+		}
+
+		for _, file := range reader.File {
+			if isPKGInfo(file.Name) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	contents, err := component.openContents()
+	if err != nil {
+		return false, err
+	}
+	defer contents.Close()
+
+	gzipReader, err := gzip.NewReader(contents)
+	if err != nil {
+		return false, nil
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			return false, nil
+		}
+
+		if isPKGInfo(header.Name) {
+			return true, nil
+		}
+	}
+}
+
+type simpleLink struct {
+	href, text string
+}
+
+// parseSimplePage: read the links out of a previously published simple page
+func parseSimplePage(byts []byte) []simpleLink {
+	matches := simpleAnchorRegexp.FindAllSubmatch(byts, -1)
+	links := make([]simpleLink, 0, len(matches))
+	for _, match := range matches {
+		links = append(links, simpleLink{
+			href: html.UnescapeString(string(match[1])),
+			text: html.UnescapeString(string(match[2])),
+		})
+	}
+
+	return links
+}
+
+// mergeSimpleLinks: add links to a page's previous links, replacing any with
+// the same text and sorting the result by it
+func mergeSimpleLinks(previous []simpleLink, links []simpleLink) []simpleLink {
+	byText := make(map[string]simpleLink, len(previous)+len(links))
+	for _, link := range append(previous, links...) {
+		byText[link.text] = link
+	}
+
+	merged := make([]simpleLink, 0, len(byText))
+	for _, link := range byText {
+		merged = append(merged, link)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].text < merged[j].text
+	})
+
+	return merged
+}
+
+func renderSimplePage(title string, links []simpleLink) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html>\n  <head>\n    <meta name=\"pypi:repository-version\" content=\"1.0\">\n    <title>%s</title>\n  </head>\n  <body>\n    <h1>%s</h1>\n", html.EscapeString(title), html.EscapeString(title))
+	for _, link := range links {
+		fmt.Fprintf(&buf, "    <a href=\"%s\">%s</a><br/>\n", html.EscapeString(link.href), html.EscapeString(link.text))
+	}
+	fmt.Fprintf(&buf, "  </body>\n</html>\n")
+
+	return buf.Bytes()
+}
+
+// updateSimpleIndex: add the version's wheels and sdists to the project's
+// PEP 503 simple repository, so that pip can install them with
+// --index-url <project url>/simple/. Pages are rewritten guarded by the
+// generation they were read at, and retried if a concurrent publisher gets
+// there first
+func updateSimpleIndex(project Project, components []Component) ([]PublishedObject, error) {
+	packages, err := pythonPackages(components)
+	if err != nil {
+		return nil, err
+	}
+	if len(packages) == 0 {
+		return nil, nil
+	}
+
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		var objects []PublishedObject
+
+		objects, err = tryUpdateSimpleIndex(project, packages)
+		if err == nil {
+			return retried(objects, attempt), nil
+		}
+
+		if !isPreconditionFailed(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func tryUpdateSimpleIndex(project Project, packages map[string][]Component) ([]PublishedObject, error) {
+	tmpDir, err := newScratchDir("artifactor-simple")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pages := map[string][]simpleLink{
+		simpleIndexDir + "index.html": nil,
+	}
+	titles := map[string]string{
+		simpleIndexDir + "index.html": "Simple index",
+	}
+	for name, packageComponents := range packages {
+		page := simpleIndexDir + name + "/index.html"
+		titles[page] = "Links for " + name
+		pages[simpleIndexDir+"index.html"] = append(pages[simpleIndexDir+"index.html"], simpleLink{href: name + "/", text: name})
+
+		for _, component := range packageComponents {
+			pages[page] = append(pages[page], simpleLink{
+				href: component.URL + "#sha256=" + component.Sha256Checksum,
+				text: path.Base(component.Filepath),
+			})
+		}
+	}
+
+	gcsPaths := make([]string, 0, len(pages))
+	for page := range pages {
+		gcsPaths = append(gcsPaths, project.gcsPrefix+page)
+	}
+
+	// generations are read before the pages, so a concurrent update between
+	// the two reads fails the write rather than being lost
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	pageComponents := make([]Component, 0, len(pages))
+	for page, links := range pages {
+		previous, _, err := fetchObject(project.gcsPrefix + page)
+		if err != nil && err != storage.ErrObjectNotExist {
+			return nil, err
+		}
+
+		localFilepath := filepath.Join(tmpDir, page)
+		if err := os.MkdirAll(filepath.Dir(localFilepath), 0755); err != nil {
+			return nil, err
+		}
+
+		byts := renderSimplePage(titles[page], mergeSimpleLinks(parseSimplePage(previous), links))
+		if err := ioutil.WriteFile(localFilepath, byts, 0644); err != nil {
+			return nil, err
+		}
+
+		component, err := newTempComponent(tmpDir, page, project.gcsPrefix, project.urlPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		pageComponents = append(pageComponents, component)
+	}
+
+	return uploadComponents(project.gcsPrefix, pageComponents, generations, false)
+}
@@ -0,0 +1,63 @@
+package artifactor_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/jonmorehouse/artifactor/artifactortest"
+)
+
+// testSdist: a gzipped tarball holding the given files, as an sdist does
+func testSdist(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func TestPythonIndex(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	files := map[string]string{
+		"example-1.2.0-py3-none-any.whl": "wheel",
+		"example-1.2.0.tar.gz":           testSdist(t, map[string]string{"example-1.2.0/PKG-INFO": "Name: example"}),
+		"tool-1.0.tar.gz":                testSdist(t, map[string]string{"tool-1.0/bin/tool": "tool"}),
+	}
+
+	publish(t, testOptions(urlPrefix, "v1"), files)
+	artifactortest.AssertObjects(t, store, "gcs://bucket/p/simple/")
+
+	opts := testOptions(urlPrefix, "v2")
+	opts.PythonIndex = true
+	publish(t, opts, files)
+
+	artifactortest.AssertObjects(t, store, "gcs://bucket/p/simple/", "index.html", "example/index.html")
+
+	page, _ := store.Get("gcs://bucket/p/simple/example/index.html")
+	for _, name := range []string{"example-1.2.0-py3-none-any.whl", "example-1.2.0.tar.gz"} {
+		if !strings.Contains(string(page), name) {
+			t.Fatalf("expected the index to link %s, got %s", name, page)
+		}
+	}
+}
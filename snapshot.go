@@ -0,0 +1,121 @@
+package artifactor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sourceFile: the size and modification time of a file in the source directory
+type sourceFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// sourceSnapshot: the files of a source directory, keyed by path, as they were
+// when the snapshot was taken
+type sourceSnapshot map[string]sourceFile
+
+// snapshotSource: record the path, size and modification time of every file
+// that would be published from the source directory, skipping the ignored
+// paths, which the publish itself writes. Ignored paths may be absolute, or
+// relative to the working directory
+func snapshotSource(srcDir string, ignored ...string) (sourceSnapshot, error) {
+	snapshot := make(sourceSnapshot)
+
+	ignoredPaths, err := relativePaths(srcDir, ignored)
+	if err != nil {
+		return nil, err
+	}
+
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || isManagedFilepath(path) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if ignoredPaths[relPath] {
+			return nil
+		}
+
+		snapshot[path] = sourceFile{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	}
+
+	if err := filepath.Walk(srcDir, walkFn); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// relativePaths: the paths which are within dir, relative to it
+func relativePaths(dir string, paths []string) (map[string]bool, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	relPaths := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		relPath, err := filepath.Rel(absDir, absPath)
+		if err != nil || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) || relPath == ".." {
+			continue
+		}
+		relPaths[relPath] = true
+	}
+
+	return relPaths, nil
+}
+
+// verify: snapshot the source directory again, failing if any file was added,
+// removed or modified since the snapshot was taken
+func (s sourceSnapshot) verify(srcDir string, ignored ...string) error {
+	current, err := snapshotSource(srcDir, ignored...)
+	if err != nil {
+		return err
+	}
+
+	changes := make([]string, 0)
+	for path, file := range s {
+		currentFile, ok := current[path]
+		switch {
+		case !ok:
+			changes = append(changes, path+" (removed)")
+		case currentFile.size != file.size || !currentFile.modTime.Equal(file.modTime):
+			changes = append(changes, path+" (modified)")
+		}
+	}
+
+	for path := range current {
+		if _, ok := s[path]; !ok {
+			changes = append(changes, path+" (added)")
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	sort.Strings(changes)
+	return fmt.Errorf("source directory changed during publish: %s", strings.Join(changes, ", "))
+}
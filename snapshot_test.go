@@ -0,0 +1,70 @@
+package artifactor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotIgnoresReport(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the content report is written into the source directory, given by
+	// its absolute path as bin/publish passes it
+	reportFilepath := filepath.Join(srcDir, "reports", "content.json")
+
+	snapshot, err := snapshotSource(srcDir, reportFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(reportFilepath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(reportFilepath, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := snapshot.verify(srcDir, reportFilepath); err != nil {
+		t.Fatalf("expected the report to be ignored: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = snapshot.verify(srcDir, reportFilepath)
+	if err == nil || !strings.Contains(err.Error(), "b.txt (added)") {
+		t.Fatalf("expected b.txt to be reported as added, got %v", err)
+	}
+}
+
+func TestSnapshotIgnoresRelativeReport(t *testing.T) {
+	srcDir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(srcDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	snapshot, err := snapshotSource(".", "report.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("report.json", []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := snapshot.verify(".", "report.json"); err != nil {
+		t.Fatalf("expected the report to be ignored: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package artifactor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// stagingDir: the directory beneath a project components are staged in
+// before the version they belong to is finalized. Being neither a version nor
+// an alias, what's left in it by a version which is never finalized is
+// collected as garbage once it's old enough
+const stagingDir = ".staging/"
+
+// StagedPart: the components one job staged for a version, recorded as
+// <part>.json in the version's staging directory once they're all uploaded
+type StagedPart struct {
+	Part       string      `json:"part"`
+	Version    string      `json:"version"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Actor      string      `json:"actor,omitempty"`
+	Components []Component `json:"components"`
+}
+
+// StageComponents: upload the components the options would publish, from a
+// directory, archive or stream, to the version's staging directory as part,
+// without publishing the version. Several jobs may each stage a part of
+// their own, and the version is published from all of them with a publish
+// whose options set Staged. Staging a part again replaces it
+func StageComponents(project Project, opts *Options, part string) (StagedPart, error) {
+	if err := checkPartName(part); err != nil {
+		return StagedPart{}, err
+	}
+
+	scratch, err := newScratchDir("artifactor-stage")
+	if err != nil {
+		return StagedPart{}, err
+	}
+	defer os.RemoveAll(scratch)
+
+	partGCSPrefix := stagingPrefix(project, opts.Version) + part + "/"
+	components, err := sourceComponents(opts, scratch, partGCSPrefix, "")
+	if err != nil {
+		return StagedPart{}, err
+	}
+	if len(components) == 0 {
+		return StagedPart{}, fmt.Errorf("%s: no components to stage", part)
+	}
+
+	// staged components stay private until the version is published
+	if _, err := uploadComponentsWithACL(partGCSPrefix, components, nil, opts.FailFast, "private", nil, newUploadSettings(opts)); err != nil {
+		return StagedPart{}, err
+	}
+
+	// the contents are read from the staged objects from here on
+	staged := StagedPart{
+		Part:       part,
+		Version:    opts.Version,
+		Timestamp:  time.Now().UTC(),
+		Actor:      opts.Actor,
+		Components: make([]Component, 0, len(components)),
+	}
+	for _, component := range components {
+		staged.Components = append(staged.Components, Component{
+			Filepath:       component.Filepath,
+			GCSFilepath:    component.GCSFilepath,
+			Bytes:          component.Bytes,
+			Md5Checksum:    component.Md5Checksum,
+			Sha256Checksum: component.Sha256Checksum,
+			Sha384Checksum: component.Sha384Checksum,
+			Sha512Checksum: component.Sha512Checksum,
+			Crc32cChecksum: component.Crc32cChecksum,
+		})
+	}
+
+	jsonBytes, err := json.Marshal(staged)
+	if err != nil {
+		return StagedPart{}, err
+	}
+
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return StagedPart{}, err
+	}
+
+	// the record is written last, so a part is only staged once every one
+	// of its components is
+	_, err = store.Write(ctx, stagingPrefix(project, opts.Version)+part+".json", jsonBytes, storage.ObjectAttrs{ContentType: "application/json", PredefinedACL: "private"}, storage.Conditions{})
+	if err != nil {
+		return StagedPart{}, err
+	}
+
+	return staged, nil
+}
+
+// ListStagedParts: the parts staged for a version which hasn't been
+// finalized yet, ordered by name
+func ListStagedParts(project Project, version string) ([]StagedPart, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versionStagingPrefix := stagingPrefix(project, version)
+	objects, err := store.ListObjects(ctx, versionStagingPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]StagedPart, 0)
+	for _, gcsPath := range objects {
+		relpath := strings.TrimPrefix(gcsPath, versionStagingPrefix)
+		if strings.Contains(relpath, "/") || !strings.HasSuffix(relpath, ".json") {
+			continue
+		}
+
+		byts, _, err := fetchObject(gcsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		var part StagedPart
+		if err := json.Unmarshal(byts, &part); err != nil {
+			return nil, fmt.Errorf("%s: %v", gcsPath, err)
+		}
+		parts = append(parts, part)
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Part < parts[j].Part
+	})
+
+	return parts, nil
+}
+
+// stagedComponents: the components staged for a version by every part,
+// failing unless each required part has staged. A file staged by several
+// parts must have the same contents in each. The components' contents are
+// read through a single store opened for them all
+func stagedComponents(project Project, version string, requiredParts []string, gcsPrefix, urlPrefix string) ([]Component, error) {
+	parts, err := ListStagedParts(project, version)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := openStorage(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("nothing has been staged for %s", version)
+	}
+
+	stagedParts := make(map[string]bool, len(parts))
+	for _, part := range parts {
+		stagedParts[part.Part] = true
+	}
+
+	missing := make([]string, 0)
+	for _, part := range requiredParts {
+		if !stagedParts[part] {
+			missing = append(missing, part)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s: waiting on parts %s to be staged", version, strings.Join(missing, ", "))
+	}
+
+	components := make([]Component, 0)
+	stagedBy := make(map[string]string)
+	checksums := make(map[string]string)
+	for _, part := range parts {
+		for _, component := range part.Components {
+			if previous, ok := stagedBy[component.Filepath]; ok {
+				if checksums[component.Filepath] != component.Sha256Checksum {
+					return nil, fmt.Errorf("%s: staged with different contents by parts %s and %s", component.Filepath, previous, part.Part)
+				}
+				continue
+			}
+			stagedBy[component.Filepath] = part.Part
+			checksums[component.Filepath] = component.Sha256Checksum
+
+			component.staged = component.GCSFilepath
+			component.stagedStore = store
+			component.GCSFilepath = gcsPrefix + component.Filepath
+			component.URL = urlPrefix + component.Filepath
+			components = append(components, component)
+		}
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Filepath < components[j].Filepath
+	})
+
+	return components, nil
+}
+
+// discardStaged: delete everything staged for a version
+func discardStaged(project Project, version string) error {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return err
+	}
+
+	objects, err := store.ListObjects(ctx, stagingPrefix(project, version))
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(objects))
+	semaphore := make(chan struct{}, 16)
+
+	for _, gcsPath := range objects {
+		wg.Add(1)
+
+		go func(gcsPath string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			if err := store.Delete(ctx, gcsPath, storage.Conditions{}); err != nil && err != storage.ErrObjectNotExist {
+				errCh <- fmt.Errorf("%s: %v", gcsPath, err)
+			}
+		}(gcsPath)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+	}
+
+	return nil
+}
+
+// stagingPrefix: the directory components are staged in for a version
+func stagingPrefix(project Project, version string) string {
+	return project.gcsPrefix + stagingDir + version + "/"
+}
+
+// checkPartName: a part names a single file in the staging directory
+func checkPartName(part string) error {
+	if part == "" || part == "." || part == ".." || strings.ContainsAny(part, "/\\") {
+		return fmt.Errorf("part %q must be a non-empty name without slashes", part)
+	}
+
+	return nil
+}
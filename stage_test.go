@@ -0,0 +1,113 @@
+package artifactor_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/jonmorehouse/artifactor"
+	"github.com/jonmorehouse/artifactor/artifactortest"
+)
+
+// testPDB: a minimal pdb 7.0 file with the given guid and age, holding the
+// info and dbi streams a symbol server key is read from
+func testPDB(guid []byte, age uint32) string {
+	const blockSize = 512
+	byts := make([]byte, blockSize*5)
+	copy(byts, "Microsoft C/C++ MSF 7.00\r\n\x1aDS\x00\x00\x00")
+
+	le := binary.LittleEndian
+	le.PutUint32(byts[32:], blockSize)
+	le.PutUint32(byts[36:], 1)
+	le.PutUint32(byts[40:], 5)
+
+	// the stream directory, in block 2: four streams, the info stream in
+	// block 3 and the dbi stream in block 4
+	directory := []uint32{4, 0, 28, 0xffffffff, 64, 3, 4}
+	le.PutUint32(byts[44:], uint32(len(directory)*4))
+	le.PutUint32(byts[52:], 1)
+	le.PutUint32(byts[blockSize:], 2)
+	for i, value := range directory {
+		le.PutUint32(byts[2*blockSize+i*4:], value)
+	}
+
+	le.PutUint32(byts[3*blockSize:], 20000404)
+	le.PutUint32(byts[3*blockSize+8:], age)
+	copy(byts[3*blockSize+12:], guid)
+	le.PutUint32(byts[4*blockSize+8:], age)
+
+	return string(byts)
+}
+
+// stage: stage the given files as a part of a version
+func stage(t *testing.T, opts artifactor.Options, part string, files map[string]string) {
+	t.Helper()
+
+	err := inDir(t, writeFiles(t, files), func() error {
+		_, err := artifactor.StageComponents(artifactor.NewProject(&opts), &opts, part)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("staging %s: %v", part, err)
+	}
+}
+
+// recordingUploader: a SymbolUploader keeping the contents of every archive
+// it's sent
+type recordingUploader struct {
+	archives []string
+}
+
+func (r *recordingUploader) UploadSymbols(project, version string, archives []string) error {
+	for _, archive := range archives {
+		byts, err := ioutil.ReadFile(archive)
+		if err != nil {
+			return err
+		}
+		r.archives = append(r.archives, string(byts))
+	}
+
+	return nil
+}
+
+func TestFinalizeStaged(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	opts := testOptions(urlPrefix, "v1")
+	stage(t, opts, "linux", map[string]string{"linux/app": "L"})
+
+	finalize := opts
+	finalize.Staged = true
+	finalize.RequiredParts = []string{"linux", "windows"}
+
+	err := inDir(t, t.TempDir(), func() error {
+		return artifactor.CreateVersion(artifactor.NewProject(&finalize), &finalize)
+	})
+	if err == nil || !strings.Contains(err.Error(), "windows") {
+		t.Fatalf("expected finalizing without the windows part to fail, got %v", err)
+	}
+
+	guid := []byte{0x78, 0x56, 0x34, 0x12, 0xbc, 0x9a, 0xf0, 0xde, 1, 2, 3, 4, 5, 6, 7, 8}
+	stage(t, opts, "windows", map[string]string{"windows/app.exe": "MZ", "windows/app.pdb": testPDB(guid, 0x1a), "App.app.dSYM.zip": "PK dsym"})
+
+	uploader := &recordingUploader{}
+	finalize.SymbolsPrefix = "gcs://symbols/"
+	finalize.SymbolServer = true
+	finalize.SymbolUploaders = []artifactor.SymbolUploader{uploader}
+
+	err = inDir(t, t.TempDir(), func() error {
+		return artifactor.CreateVersion(artifactor.NewProject(&finalize), &finalize)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifactortest.AssertManifest(t, store, "gcs://bucket/p/v1/manifest.json")
+	artifactortest.AssertObjects(t, store, "gcs://symbols/", "app.pdb/123456789ABCDEF001020304050607081A/app.pdb", "p/v1/App.app.dSYM.zip")
+
+	if len(uploader.archives) != 1 || uploader.archives[0] != "PK dsym" {
+		t.Fatalf("unexpected dSYM archives %q", uploader.archives)
+	}
+}
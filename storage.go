@@ -0,0 +1,483 @@
+package artifactor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// Storage: the object store versions are published to and served from, with
+// objects addressed by their path, such as gcs://bucket/object. The backend of
+// each path is chosen by its scheme from those registered with
+// RegisterStorage, Google Cloud Storage and Amazon S3 being registered as gcs
+// and s3, and http PUTs as http and https, unless a single store is set with
+// SetStorage, such as the in-memory fake in artifactortest
+type Storage interface {
+	// Attrs: the attributes of the latest generation of an object, or
+	// storage.ErrObjectNotExist
+	Attrs(ctx context.Context, gcsPath string) (*storage.ObjectAttrs, error)
+
+	// NewRangeReader: read length bytes of an object starting at offset,
+	// or the rest of it when length is -1. A generation of 0 reads the
+	// latest generation
+	NewRangeReader(ctx context.Context, gcsPath string, generation int64, offset int64, length int64) (io.ReadCloser, error)
+
+	// Write: write an object with the given attributes, failing with a 412
+	// unless the conditions hold. Empty conditions write unconditionally
+	Write(ctx context.Context, gcsPath string, byts []byte, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error)
+
+	// WriteFrom: write an object like Write, streaming attrs.Size bytes from
+	// the reader open returns rather than holding them in memory. attrs.MD5
+	// and attrs.CRC32C, when set, are checked against what's written, and
+	// open may be called again to retry the write
+	WriteFrom(ctx context.Context, gcsPath string, open func() (io.ReadCloser, error), attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error)
+
+	// Copy: copy an object server side, with the destination guarded by the
+	// conditions
+	Copy(ctx context.Context, srcGCSPath string, dstGCSPath string, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error)
+
+	// Delete: delete an object, guarded by the conditions
+	Delete(ctx context.Context, gcsPath string, conds storage.Conditions) error
+
+	// SignedURL: a url granting read access to an object until expiresAt
+	SignedURL(gcsPath string, expiresAt time.Time) (string, error)
+
+	// ListPrefixes: the prefixes directly beneath a prefix, each ending in
+	// a slash, such as the version directories of a project
+	ListPrefixes(ctx context.Context, gcsPrefix string) ([]string, error)
+
+	// ListObjects: the paths of every object beneath a prefix, however
+	// deeply nested
+	ListObjects(ctx context.Context, gcsPrefix string) ([]string, error)
+}
+
+// StorageOpener: open the Storage backend of a path scheme
+type StorageOpener func(ctx context.Context) (Storage, error)
+
+var (
+	storageMu     sync.Mutex
+	customStorage Storage
+
+	storageOpeners = map[string]StorageOpener{
+		"gcs":   openGCSStorage,
+		"s3":    openS3Storage,
+		"http":  openHTTPStorage,
+		"https": openHTTPStorage,
+	}
+)
+
+// RegisterStorage: publish to and serve from the given backend for paths
+// with the scheme, such as s3 for s3://bucket/object. Registering a scheme
+// again replaces its backend
+func RegisterStorage(scheme string, open StorageOpener) {
+	storageMu.Lock()
+	storageOpeners[scheme] = open
+	storageMu.Unlock()
+}
+
+// storageScheme: the scheme of a storage path, with paths lacking one being
+// gcs paths
+func storageScheme(gcsPath string) string {
+	separator := strings.Index(gcsPath, "://")
+	if separator < 0 {
+		return "gcs"
+	}
+
+	return gcsPath[:separator]
+}
+
+// SetStorage: publish to and serve from the given store rather than Google
+// Cloud Storage. Setting nil goes back to Google Cloud Storage
+func SetStorage(s Storage) {
+	storageMu.Lock()
+	customStorage = s
+	storageMu.Unlock()
+}
+
+// openStorage: the store set with SetStorage, or a store routing each path to
+// the backend registered for its scheme
+func openStorage(ctx context.Context) (Storage, error) {
+	storageMu.Lock()
+	s := customStorage
+	storageMu.Unlock()
+
+	if s != nil {
+		return s, nil
+	}
+
+	return &schemeStorage{ctx: ctx, stores: make(map[string]Storage)}, nil
+}
+
+// schemeStorage: Storage which routes each path to the backend registered for
+// its scheme, opening each backend the first time it is used
+type schemeStorage struct {
+	ctx context.Context
+
+	mu     sync.Mutex
+	stores map[string]Storage
+}
+
+func (s *schemeStorage) store(gcsPath string) (Storage, error) {
+	scheme := storageScheme(gcsPath)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if store, ok := s.stores[scheme]; ok {
+		return store, nil
+	}
+
+	storageMu.Lock()
+	open, ok := storageOpeners[scheme]
+	storageMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: no storage backend registered for %s://", gcsPath, scheme)
+	}
+
+	store, err := open(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.stores[scheme] = store
+
+	return store, nil
+}
+
+func (s *schemeStorage) Attrs(ctx context.Context, gcsPath string) (*storage.ObjectAttrs, error) {
+	store, err := s.store(gcsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Attrs(ctx, gcsPath)
+}
+
+func (s *schemeStorage) NewRangeReader(ctx context.Context, gcsPath string, generation int64, offset int64, length int64) (io.ReadCloser, error) {
+	store, err := s.store(gcsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.NewRangeReader(ctx, gcsPath, generation, offset, length)
+}
+
+func (s *schemeStorage) Write(ctx context.Context, gcsPath string, byts []byte, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	store, err := s.store(gcsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Write(ctx, gcsPath, byts, attrs, conds)
+}
+
+func (s *schemeStorage) WriteFrom(ctx context.Context, gcsPath string, open func() (io.ReadCloser, error), attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	store, err := s.store(gcsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.WriteFrom(ctx, gcsPath, open, attrs, conds)
+}
+
+func (s *schemeStorage) Copy(ctx context.Context, srcGCSPath string, dstGCSPath string, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	if storageScheme(srcGCSPath) != storageScheme(dstGCSPath) {
+		return nil, fmt.Errorf("can't copy %s to %s server side across storage backends", srcGCSPath, dstGCSPath)
+	}
+
+	store, err := s.store(dstGCSPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Copy(ctx, srcGCSPath, dstGCSPath, attrs, conds)
+}
+
+func (s *schemeStorage) Delete(ctx context.Context, gcsPath string, conds storage.Conditions) error {
+	store, err := s.store(gcsPath)
+	if err != nil {
+		return err
+	}
+
+	return store.Delete(ctx, gcsPath, conds)
+}
+
+func (s *schemeStorage) SignedURL(gcsPath string, expiresAt time.Time) (string, error) {
+	store, err := s.store(gcsPath)
+	if err != nil {
+		return "", err
+	}
+
+	return store.SignedURL(gcsPath, expiresAt)
+}
+
+func (s *schemeStorage) ListPrefixes(ctx context.Context, gcsPrefix string) ([]string, error) {
+	store, err := s.store(gcsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ListPrefixes(ctx, gcsPrefix)
+}
+
+func (s *schemeStorage) ListObjects(ctx context.Context, gcsPrefix string) ([]string, error) {
+	store, err := s.store(gcsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.ListObjects(ctx, gcsPrefix)
+}
+
+// openGCSStorage: open a Google Cloud Storage client
+func openGCSStorage(ctx context.Context) (Storage, error) {
+	client, err := newGCSClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcsStorage{client: client}, nil
+}
+
+// GCSEndpoint: open Google Cloud Storage through another endpoint, such as a
+// private service connect endpoint, or an emulator like fake-gcs-server. An
+// endpoint without a path is given the json api's /storage/v1/, and plain
+// http endpoints are taken to be emulators, which aren't authenticated with.
+// The STORAGE_EMULATOR_HOST environment variable is honored without this
+func GCSEndpoint(endpoint string) StorageOpener {
+	return func(ctx context.Context) (Storage, error) {
+		endpointURL, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+			return nil, fmt.Errorf("gcs endpoint %q must be an http:// or https:// url", endpoint)
+		}
+		if endpointURL.Path == "" || endpointURL.Path == "/" {
+			endpointURL.Path = "/storage/v1/"
+		}
+
+		opts := []option.ClientOption{option.WithEndpoint(endpointURL.String())}
+		if endpointURL.Scheme == "http" {
+			opts = append(opts, option.WithoutAuthentication())
+		}
+
+		client, err := newGCSClient(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		return gcsStorage{client: client}, nil
+	}
+}
+
+// gcsStorage: Storage backed by Google Cloud Storage
+type gcsStorage struct {
+	client *storage.Client
+}
+
+func (g gcsStorage) object(gcsPath string, conds storage.Conditions) *storage.ObjectHandle {
+	bucketName, objectName := splitGCSPath(gcsPath)
+	object := g.client.Bucket(bucketName).Object(objectName)
+
+	if conds != (storage.Conditions{}) {
+		object = object.If(conds)
+	}
+
+	return object
+}
+
+func (g gcsStorage) Attrs(ctx context.Context, gcsPath string) (*storage.ObjectAttrs, error) {
+	attrs, err := g.object(gcsPath, storage.Conditions{}).Attrs(ctx)
+	return attrs, gcsError(err)
+}
+
+func (g gcsStorage) NewRangeReader(ctx context.Context, gcsPath string, generation int64, offset int64, length int64) (io.ReadCloser, error) {
+	object := g.object(gcsPath, storage.Conditions{})
+	if generation != 0 {
+		object = object.Generation(generation)
+	}
+
+	reader, err := object.NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, gcsError(err)
+	}
+
+	return reader, nil
+}
+
+func (g gcsStorage) Write(ctx context.Context, gcsPath string, byts []byte, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	attrs.Size = int64(len(byts))
+	attrs.CRC32C = crc32.Checksum(byts, crc32.MakeTable(crc32.Castagnoli))
+
+	return g.WriteFrom(ctx, gcsPath, bytesOpener(byts), attrs, conds)
+}
+
+// WriteFrom: stream an object to gcs, computing its crc32c as it's sent and
+// checking it against the one gcs computed. A crc32c given in attrs is also
+// sent, so gcs refuses the object outright if its contents don't match
+func (g gcsStorage) WriteFrom(ctx context.Context, gcsPath string, open func() (io.ReadCloser, error), attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	reader, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	writer := g.object(gcsPath, conds).NewWriter(ctx)
+	writer.ChunkSize = uploadChunkSize(ctx, int(attrs.Size))
+	writer.ObjectAttrs = attrs
+	_, writer.ObjectAttrs.Name = splitGCSPath(gcsPath)
+
+	writer.SendCRC32C = attrs.CRC32C != 0 || attrs.Size == 0
+	writer.CRC32C = attrs.CRC32C
+
+	crc32cHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(writer, io.TeeReader(reader, crc32cHash)); err != nil {
+		writer.Close()
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	// gcs emulators may not compute a crc32c at all
+	written := writer.Attrs()
+	if written.CRC32C != 0 && written.CRC32C != crc32cHash.Sum32() {
+		return nil, fmt.Errorf("%s: sent crc32c %08x, but gcs stored %08x", gcsPath, crc32cHash.Sum32(), written.CRC32C)
+	}
+
+	return written, nil
+}
+
+// bytesOpener: open contents already held in memory, for backends whose
+// Write streams them through WriteFrom
+func bytesOpener(byts []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(byts)), nil
+	}
+}
+
+func (g gcsStorage) Copy(ctx context.Context, srcGCSPath string, dstGCSPath string, attrs storage.ObjectAttrs, conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	copier := g.object(dstGCSPath, conds).CopierFrom(g.object(srcGCSPath, storage.Conditions{}))
+	copier.ObjectAttrs = attrs
+
+	return copier.Run(ctx)
+}
+
+func (g gcsStorage) Delete(ctx context.Context, gcsPath string, conds storage.Conditions) error {
+	return gcsError(g.object(gcsPath, conds).Delete(ctx))
+}
+
+// uploadChunking: how uploads to Google Cloud Storage are buffered, from the
+// UploadChunkSize and SingleRequestUploadSize of a publish. It's carried by
+// the context given to Write and WriteFrom, since only gcs uses it
+type uploadChunking struct {
+	size, singleRequestSize int
+}
+
+type uploadChunkingKey struct{}
+
+// withUploadChunking: a context whose uploads to gcs are buffered in chunks
+// of size bytes, or the client's default when 0, sending objects no larger
+// than singleRequestSize in a single request
+func withUploadChunking(ctx context.Context, size, singleRequestSize int) context.Context {
+	return context.WithValue(ctx, uploadChunkingKey{}, uploadChunking{size: size, singleRequestSize: singleRequestSize})
+}
+
+// uploadChunkSize: the chunk size to upload an object of the given size with.
+// The writer allocates a whole chunk up front, so the chunk is shrunk to just
+// fit smaller objects, which are then still sent in a single, retryable
+// request
+func uploadChunkSize(ctx context.Context, objectSize int) int {
+	chunking, _ := ctx.Value(uploadChunkingKey{}).(uploadChunking)
+	size := chunking.size
+
+	if chunking.singleRequestSize > 0 && objectSize <= chunking.singleRequestSize {
+		return 0
+	}
+
+	if size <= 0 {
+		size = googleapi.DefaultUploadChunkSize
+	}
+
+	// chunks are a multiple of 256KiB, and an object exactly filling one
+	// would be sent in two requests
+	fitted := (objectSize/googleapi.MinUploadChunkSize + 1) * googleapi.MinUploadChunkSize
+	if fitted < size {
+		return fitted
+	}
+
+	return size
+}
+
+// gcsError: the client wraps storage.ErrObjectNotExist along with the api's
+// error, which is unwrapped so it can be compared against as Storage promises
+func gcsError(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return storage.ErrObjectNotExist
+	}
+
+	return err
+}
+
+func (g gcsStorage) SignedURL(gcsPath string, expiresAt time.Time) (string, error) {
+	bucketName, objectName := splitGCSPath(gcsPath)
+	return g.client.Bucket(bucketName).SignedURL(objectName, &storage.SignedURLOptions{
+		Method:  "GET",
+		Expires: expiresAt,
+		Scheme:  storage.SigningSchemeV4,
+	})
+}
+
+func (g gcsStorage) ListPrefixes(ctx context.Context, gcsPrefix string) ([]string, error) {
+	bucketName, objectPrefix := splitGCSPath(gcsPrefix)
+	base := strings.TrimSuffix(gcsPrefix, objectPrefix)
+
+	prefixes := make([]string, 0)
+	objects := g.client.Bucket(bucketName).Objects(ctx, &storage.Query{Prefix: objectPrefix, Delimiter: "/"})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return prefixes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if attrs.Prefix != "" {
+			prefixes = append(prefixes, base+attrs.Prefix)
+		}
+	}
+}
+
+func (g gcsStorage) ListObjects(ctx context.Context, gcsPrefix string) ([]string, error) {
+	bucketName, objectPrefix := splitGCSPath(gcsPrefix)
+	base := strings.TrimSuffix(gcsPrefix, objectPrefix)
+
+	gcsPaths := make([]string, 0)
+	objects := g.client.Bucket(bucketName).Objects(ctx, &storage.Query{Prefix: objectPrefix})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return gcsPaths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		gcsPaths = append(gcsPaths, base+attrs.Name)
+	}
+}
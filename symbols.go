@@ -0,0 +1,120 @@
+package artifactor
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// acl debug symbols are uploaded with unless another is set
+const defaultSymbolsACL = "private"
+
+// splitSymbols: separate the debug symbol components from the rest, moving
+// them to the same project and version path under the symbols prefix, and to
+// the symbols url prefix when there is one. With SymbolServer set, pdbs are
+// instead laid out at the root of the symbols prefix as a symbol server
+// expects, and a pdb already laid out by another component is left out
+func splitSymbols(project Project, opts *Options, components []Component) ([]Component, []Component, error) {
+	versionPath := strings.TrimPrefix(project.gcsPrefix, opts.GcsPrefix) + opts.Version + "/"
+
+	public := make([]Component, 0, len(components))
+	symbols := make([]Component, 0)
+	seen := make(map[string]Component)
+	for _, component := range components {
+		if component.Role != RoleSymbols {
+			public = append(public, component)
+			continue
+		}
+
+		symbolPath := versionPath + component.Filepath
+		if opts.SymbolServer && isPDBFilepath(component.Filepath) {
+			serverPath, err := symbolServerPath(component)
+			if err != nil {
+				log.Println(fmt.Sprintf("warning: %v, publishing it under the version instead", err))
+			} else {
+				symbolPath = serverPath
+			}
+		}
+
+		component.GCSFilepath = opts.SymbolsPrefix + symbolPath
+		component.URL = ""
+		if opts.SymbolsURLPrefix != "" {
+			component.URL = opts.SymbolsURLPrefix + symbolPath
+		}
+		component.Mirrors = nil
+
+		// the same pdb built into several directories has one guid, and so
+		// one path on the symbol server
+		if previous, ok := seen[component.GCSFilepath]; ok {
+			if previous.Sha256Checksum != component.Sha256Checksum {
+				return nil, nil, fmt.Errorf("%s and %s: different pdbs with the same guid and age", previous.Filepath, component.Filepath)
+			}
+			continue
+		}
+		seen[component.GCSFilepath] = component
+
+		symbols = append(symbols, component)
+	}
+
+	return public, symbols, nil
+}
+
+// isSharedSymbol: whether a version's debug symbol was laid out for a symbol
+// server rather than beneath the version, and so is shared by every version
+// built with the same pdb
+func isSharedSymbol(symbol Component, version string) bool {
+	return !strings.HasSuffix(symbol.GCSFilepath, "/"+version+"/"+symbol.Filepath)
+}
+
+// deletableSymbols: the paths of a version's debug symbols which can be
+// deleted along with it. Symbols shared through a symbol server layout are
+// kept while any other version of the project lists them
+func deletableSymbols(project Project, version string, symbols []Component) ([]string, error) {
+	gcsPaths := make([]string, 0, len(symbols))
+	shared := make([]string, 0)
+	for _, symbol := range symbols {
+		if isSharedSymbol(symbol, version) {
+			shared = append(shared, symbol.GCSFilepath)
+			continue
+		}
+
+		gcsPaths = append(gcsPaths, symbol.GCSFilepath)
+	}
+
+	if len(shared) == 0 {
+		return gcsPaths, nil
+	}
+
+	manifests, err := listManifests(project, DefaultConcurrency)
+	if err != nil {
+		return nil, fmt.Errorf("listing versions sharing symbols: %v", err)
+	}
+
+	referenced := make(map[string]bool)
+	for _, manifest := range manifests {
+		if manifest.Version == version {
+			continue
+		}
+
+		for _, symbol := range manifest.Symbols {
+			referenced[symbol.GCSFilepath] = true
+		}
+	}
+
+	for _, gcsPath := range shared {
+		if !referenced[gcsPath] {
+			gcsPaths = append(gcsPaths, gcsPath)
+		}
+	}
+
+	return gcsPaths, nil
+}
+
+// symbolsACL: the predefined acl debug symbols are uploaded with
+func symbolsACL(opts *Options) string {
+	if opts.SymbolsACL == nil {
+		return defaultSymbolsACL
+	}
+
+	return *opts.SymbolsACL
+}
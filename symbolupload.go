@@ -0,0 +1,143 @@
+package artifactor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// the sentry instance symbols are uploaded to unless another is set
+const defaultSentryURL = "https://sentry.io/"
+
+// SymbolUploader: sends the dSYMs of a published version to a crash reporting
+// service, so that it can symbolicate the version's crashes. Each archive is
+// a zip holding one or more .dSYM bundles
+type SymbolUploader interface {
+	UploadSymbols(project, version string, archives []string) error
+}
+
+// uploadSymbols: send the dSYM archives to every uploader. Failures are
+// logged rather than returned, since the version has already been published
+func uploadSymbols(uploaders []SymbolUploader, project, version string, archives []string) {
+	if len(archives) == 0 {
+		return
+	}
+
+	for _, uploader := range uploaders {
+		if err := uploader.UploadSymbols(project, version, archives); err != nil {
+			log.Println(fmt.Sprintf("warning: failed to upload symbols of %s %s: %v", project, version, err))
+		}
+	}
+}
+
+// SentryUploader: uploads dSYMs to a sentry project's debug information files,
+// with an auth token granted the project:write scope. URL is the sentry
+// instance, sentry.io by default
+type SentryUploader struct {
+	URL          string
+	Organization string
+	Project      string
+	Token        string
+}
+
+func (s SentryUploader) UploadSymbols(project, version string, archives []string) error {
+	baseURL := s.URL
+	if baseURL == "" {
+		baseURL = defaultSentryURL
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL = baseURL + "/"
+	}
+
+	uploadURL := fmt.Sprintf("%sapi/0/projects/%s/%s/files/dsyms/", baseURL, url.PathEscape(s.Organization), url.PathEscape(s.Project))
+	for _, archive := range archives {
+		if err := s.upload(uploadURL, archive); err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(archive), err)
+		}
+	}
+
+	return nil
+}
+
+func (s SentryUploader) upload(uploadURL, archive string) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filepath.Base(archive))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", uploadURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %s", uploadURL, resp.Status)
+	}
+
+	return nil
+}
+
+// CrashlyticsUploader: uploads dSYMs with firebase's upload-symbols tool, as
+// crashlytics has no public api for them. Command is the tool, upload-symbols
+// on the path by default, and GoogleServiceInfoFilepath the app's
+// GoogleService-Info.plist. Platform is ios unless set
+type CrashlyticsUploader struct {
+	Command                   []string
+	GoogleServiceInfoFilepath string
+	Platform                  string
+}
+
+func (c CrashlyticsUploader) UploadSymbols(project, version string, archives []string) error {
+	command := c.Command
+	if len(command) == 0 {
+		command = []string{"upload-symbols"}
+	}
+
+	platform := c.Platform
+	if platform == "" {
+		platform = "ios"
+	}
+
+	for _, archive := range archives {
+		args := append(append([]string(nil), command[1:]...), "-gsp", c.GoogleServiceInfoFilepath, "-p", platform, archive)
+
+		cmd := exec.Command(command[0], args...)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(archive), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package artifactor
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// terraformOutput: a single output, in the shape of `terraform output -json`
+type terraformOutput struct {
+	Sensitive bool        `json:"sensitive"`
+	Type      interface{} `json:"type"`
+	Value     interface{} `json:"value"`
+}
+
+func stringOutput(value string) terraformOutput {
+	return terraformOutput{Type: "string", Value: value}
+}
+
+func stringMapOutput(value map[string]string) terraformOutput {
+	return terraformOutput{Type: []interface{}{"map", "string"}, Value: value}
+}
+
+// writeTerraformOutputs: write the coordinates of a published version in the
+// shape of `terraform output -json`, so infrastructure code can consume them
+// without parsing manifest.json. When signedURLExpiry is set, signed urls for
+// every component, valid for that long, are included as well
+func writeTerraformOutputs(filepath string, project Project, manifest ComponentManifest, signedURLExpiry time.Duration) error {
+	versionURLPrefix := project.urlPrefix + manifest.Version + "/"
+
+	urls := make(map[string]string, len(manifest.Components))
+	gcsPaths := make(map[string]string, len(manifest.Components))
+	sha256Checksums := make(map[string]string, len(manifest.Components))
+	sha512Checksums := make(map[string]string, len(manifest.Components))
+	for _, component := range manifest.Components {
+		urls[component.Filepath] = component.URL
+		gcsPaths[component.Filepath] = component.GCSFilepath
+		sha256Checksums[component.Filepath] = component.Sha256Checksum
+		sha512Checksums[component.Filepath] = component.Sha512Checksum
+	}
+
+	outputs := map[string]terraformOutput{
+		"project":                stringOutput(manifest.Project),
+		"version":                stringOutput(manifest.Version),
+		"manifest_url":           stringOutput(versionURLPrefix + "manifest.json"),
+		"manifest_signature_url": stringOutput(versionURLPrefix + "manifest.json.asc.sig"),
+		"checksums_url":          stringOutput(versionURLPrefix + "checksums"),
+		"component_urls":         stringMapOutput(urls),
+		"component_gcs_paths":    stringMapOutput(gcsPaths),
+		"component_sha256":       stringMapOutput(sha256Checksums),
+		"component_sha512":       stringMapOutput(sha512Checksums),
+	}
+
+	if signedURLExpiry > 0 {
+		expiresAt := time.Now().Add(signedURLExpiry)
+
+		signedURLs, err := signComponentURLs(manifest.Components, expiresAt)
+		if err != nil {
+			return err
+		}
+
+		signedURLsOutput := stringMapOutput(signedURLs)
+		signedURLsOutput.Sensitive = true
+		outputs["component_signed_urls"] = signedURLsOutput
+		outputs["signed_url_expiry"] = stringOutput(expiresAt.UTC().Format(time.RFC3339))
+	}
+
+	jsonBytes, err := json.MarshalIndent(outputs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath, jsonBytes, 0644)
+}
+
+// signComponentURLs: create signed urls for reading each component until
+// expiresAt, using the default credentials to sign them
+func signComponentURLs(components []Component, expiresAt time.Time) (map[string]string, error) {
+	store, err := openStorage(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	signedURLs := make(map[string]string, len(components))
+	for _, component := range components {
+		signedURL, err := store.SignedURL(component.GCSFilepath, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		signedURLs[component.Filepath] = signedURL
+	}
+
+	return signedURLs, nil
+}
@@ -0,0 +1,77 @@
+package artifactor
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// size of the chunks that throttled responses are written in
+const throttleChunkSize = 32 * 1024
+
+// newByteLimiter: a limiter allowing bytesPerSecond, or nil for no limit
+func newByteLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), throttleChunkSize)
+}
+
+// throttledWriter: a response writer which waits on every limiter before
+// writing each chunk of the response
+type throttledWriter struct {
+	http.ResponseWriter
+
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+// throttle: wrap a response writer with the given limiters, ignoring any nil
+// limiters
+func throttle(ctx context.Context, w http.ResponseWriter, limiters ...*rate.Limiter) http.ResponseWriter {
+	active := make([]*rate.Limiter, 0, len(limiters))
+	for _, limiter := range limiters {
+		if limiter != nil {
+			active = append(active, limiter)
+		}
+	}
+
+	if len(active) == 0 {
+		return w
+	}
+
+	return &throttledWriter{
+		ResponseWriter: w,
+		ctx:            ctx,
+		limiters:       active,
+	}
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		chunk := len(p)
+		if chunk > throttleChunkSize {
+			chunk = throttleChunkSize
+		}
+
+		for _, limiter := range t.limiters {
+			if err := limiter.WaitN(t.ctx, chunk); err != nil {
+				return written, err
+			}
+		}
+
+		n, err := t.ResponseWriter.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[chunk:]
+	}
+
+	return written, nil
+}
@@ -0,0 +1,148 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+)
+
+// TrustPolicy: who a project's consumers trust to sign its versions, so that
+// trust can be configured once in a file rather than with flags on every
+// command
+type TrustPolicy struct {
+	// Fingerprints: the full fingerprints of the gpg keys whose signatures
+	// are accepted. When empty, any key in the local gpg keyring is accepted
+	Fingerprints []string `json:"fingerprints"`
+
+	// SigstoreIdentities: when set, a version's manifest must also have a
+	// sigstore bundle signed by one of the identities
+	SigstoreIdentities []SigstoreIdentity `json:"sigstore_identities"`
+
+	// MinimumSignatures: the number of distinct accepted keys the gpg
+	// signature of a manifest must be made by. 0 doesn't check gpg
+	// signatures at all
+	MinimumSignatures int `json:"minimum_signatures"`
+}
+
+// LoadTrustPolicy: read a trust policy from a json file, such as
+//
+//	{
+//	  "fingerprints": ["0123456789ABCDEF0123456789ABCDEF01234567"],
+//	  "sigstore_identities": [{"issuer": "^https://token.actions.githubusercontent.com$", "subject": "^https://github.com/jonmorehouse/.*"}],
+//	  "minimum_signatures": 1
+//	}
+//
+// minimum_signatures defaults to 1
+func LoadTrustPolicy(path string) (TrustPolicy, error) {
+	byts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return TrustPolicy{}, err
+	}
+
+	var policy struct {
+		TrustPolicy
+		MinimumSignatures *int `json:"minimum_signatures"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(byts))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return TrustPolicy{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	policy.TrustPolicy.MinimumSignatures = 1
+	if policy.MinimumSignatures != nil {
+		policy.TrustPolicy.MinimumSignatures = *policy.MinimumSignatures
+	}
+
+	if err := policy.TrustPolicy.validate(); err != nil {
+		return TrustPolicy{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return policy.TrustPolicy, nil
+}
+
+// validate: check that the policy can be satisfied and verifies something
+func (t TrustPolicy) validate() error {
+	if t.MinimumSignatures < 0 {
+		return fmt.Errorf("minimum_signatures can't be negative")
+	}
+
+	for _, fingerprint := range t.Fingerprints {
+		if err := checkFingerprint(fingerprint); err != nil {
+			return err
+		}
+	}
+
+	if len(t.Fingerprints) > 0 && t.MinimumSignatures > len(t.Fingerprints) {
+		return fmt.Errorf("minimum_signatures of %d can't be met by %d fingerprints", t.MinimumSignatures, len(t.Fingerprints))
+	}
+
+	if t.MinimumSignatures == 0 && len(t.SigstoreIdentities) == 0 {
+		return fmt.Errorf("a minimum_signatures of 0 requires sigstore_identities")
+	}
+
+	for _, identity := range t.SigstoreIdentities {
+		if identity.Issuer == "" || identity.Subject == "" {
+			return fmt.Errorf("sigstore identities require both an issuer and a subject")
+		}
+
+		for _, expr := range []string{identity.Issuer, identity.Subject} {
+			if _, err := regexp.Compile(expr); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// verifySignature: verify a detached gpg signature against the policy
+func (t TrustPolicy) verifySignature(byts []byte, sigBytes []byte) error {
+	keyRing := KeyRing{Keys: make([]SigningKey, 0, len(t.Fingerprints)), anyKey: len(t.Fingerprints) == 0}
+	for _, key := range t.Fingerprints {
+		if err := checkFingerprint(key); err != nil {
+			return err
+		}
+		keyRing.Keys = append(keyRing.Keys, SigningKey{Fingerprint: key})
+	}
+
+	return verifySigBytes(byts, sigBytes, keyRing, time.Now(), t.MinimumSignatures)
+}
+
+// verifyManifest: verify a version's manifest against the policy. The gpg
+// signature is that of the fetched manifest, which is the compressed
+// manifest.json.zst when the version has one, while the sigstore bundle
+// always signs the plain manifest.json. Manifests already verified against the
+// same policy are accepted from the verification cache
+func (t TrustPolicy) verifyManifest(manifestURL string, manifestBytes []byte, fetchedURL string, fetchedBytes []byte) error {
+	if t.MinimumSignatures == 0 && len(t.SigstoreIdentities) == 0 {
+		return nil
+	}
+
+	cachePath := manifestCachePath(manifestBytes, fetchedBytes, t)
+	if isCachedManifest(cachePath) {
+		return nil
+	}
+
+	if t.MinimumSignatures > 0 {
+		sigBytes, err := fetchURL(fetchedURL + ".asc.sig")
+		if err != nil {
+			return err
+		}
+
+		if err := t.verifySignature(fetchedBytes, sigBytes); err != nil {
+			return fmt.Errorf("%s: %v", fetchedURL, err)
+		}
+	}
+
+	if err := verifyManifestBundle(manifestURL, manifestBytes, t.SigstoreIdentities); err != nil {
+		return err
+	}
+
+	cacheVerified(cachePath, time.Now())
+	return nil
+}
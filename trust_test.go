@@ -0,0 +1,47 @@
+package artifactor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonmorehouse/artifactor"
+	"github.com/jonmorehouse/artifactor/artifactortest"
+)
+
+func TestLoadTrustPolicyThresholds(t *testing.T) {
+	identity := `"sigstore_identities": [{"issuer": "https://token\\.actions\\.githubusercontent\\.com", "subject": "https://github\\.com/jonmorehouse/.*"}]`
+	fingerprints := `"fingerprints": ["` + artifactortest.DefaultKey + `", "` + coSigner + `"]`
+
+	for _, test := range []struct {
+		policy            string
+		minimumSignatures int
+		err               string
+	}{
+		{`{` + fingerprints + `}`, 1, ""},
+		{`{` + fingerprints + `, "minimum_signatures": 2}`, 2, ""},
+		{`{` + fingerprints + `, "minimum_signatures": 3}`, 0, "can't be met by 2 fingerprints"},
+		{`{` + fingerprints + `, "minimum_signatures": -1}`, 0, "can't be negative"},
+		{`{` + fingerprints + `, "minimum_signatures": 0}`, 0, "requires sigstore_identities"},
+		{`{` + identity + `, "minimum_signatures": 0}`, 0, ""},
+		{`{"minimum_signatures": 5}`, 5, ""},
+		{`{"fingerprints": ["0123456789ABCDEF"]}`, 0, "fingerprint"},
+	} {
+		path := writeFiles(t, map[string]string{"policy.json": test.policy}) + "/policy.json"
+
+		policy, err := artifactor.LoadTrustPolicy(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", test.policy, test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.policy, err)
+			continue
+		}
+		if policy.MinimumSignatures != test.minimumSignatures {
+			t.Errorf("%s: expected minimum_signatures of %d, got %d", test.policy, test.minimumSignatures, policy.MinimumSignatures)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package artifactor
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var urlTemplatePlaceholder = regexp.MustCompile(`\{[a-z0-9_]+\}`)
+
+// URLTemplate: the public url of the components whose filepath matches the
+// pattern, such as https://dl.example.com/{project}/{version}/{path}?sig=.
+// Patterns are matched with path.Match, and an empty pattern matches every
+// component. {project}, {channel}, {version}, {path}, {name}, {object},
+// {platform} and {sha256} are replaced with the project, its channel, the
+// version, the component's filepath and file name, its object name relative
+// to the project, its os/arch platform and its sha256
+type URLTemplate struct {
+	Pattern  string
+	Template string
+}
+
+// validate: check that the template's pattern is well formed and that it only
+// uses known placeholders
+func (u URLTemplate) validate() error {
+	if _, err := path.Match(u.Pattern, ""); err != nil {
+		return fmt.Errorf("url template pattern %q: %v", u.Pattern, err)
+	}
+
+	for _, placeholder := range urlTemplatePlaceholder.FindAllString(u.Template, -1) {
+		switch placeholder {
+		case "{project}", "{channel}", "{version}", "{path}", "{name}", "{object}", "{platform}", "{sha256}":
+		default:
+			return fmt.Errorf("url template %q: unknown placeholder %s", u.Template, placeholder)
+		}
+	}
+
+	return nil
+}
+
+// matches: whether the template applies to a component
+func (u URLTemplate) matches(component Component) bool {
+	if u.Pattern == "" {
+		return true
+	}
+
+	matched, _ := path.Match(u.Pattern, component.Filepath)
+	if !matched {
+		matched, _ = path.Match(u.Pattern, path.Base(component.Filepath))
+	}
+
+	return matched
+}
+
+// templateURLs: set the url of each component from the first template
+// matching it. Components no template matches keep their url
+func templateURLs(project Project, opts *Options, components []Component) ([]Component, error) {
+	for _, template := range opts.URLTemplates {
+		if err := template.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	templated := make([]Component, 0, len(components))
+	for _, component := range components {
+		for _, template := range opts.URLTemplates {
+			if !template.matches(component) {
+				continue
+			}
+
+			component.URL = strings.NewReplacer(
+				"{project}", project.name,
+				"{channel}", opts.Channel,
+				"{version}", opts.Version,
+				"{path}", component.Filepath,
+				"{name}", path.Base(component.Filepath),
+				"{object}", strings.TrimPrefix(component.GCSFilepath, project.gcsPrefix),
+				"{platform}", componentPlatform(component.Filepath),
+				"{sha256}", component.Sha256Checksum,
+			).Replace(template.Template)
+			break
+		}
+
+		templated = append(templated, component)
+	}
+
+	return templated, nil
+}
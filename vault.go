@@ -0,0 +1,204 @@
+package artifactor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// VaultKey: an armored gpg private key stored in a HashiCorp Vault kv secret,
+// such as secret/data/artifactor/signing. Address and Token default to
+// VAULT_ADDR and VAULT_TOKEN, and Field and PassphraseField, the fields of the
+// secret holding the key and its passphrase if it has one, to private_key and
+// passphrase
+type VaultKey struct {
+	Address, Token  string
+	Path            string
+	Field           string
+	PassphraseField string
+}
+
+// vaultSigner: Signer holding a key fetched from vault in memory, so that the
+// private key never exists as a file. Other keys are verified and exported
+// with the local gpg
+type vaultSigner struct {
+	entity *openpgp.Entity
+	gpg    gpgSigner
+}
+
+// NewVaultSigner: fetch a signing key from vault and sign with it in memory.
+// Pass it to SetSigner to sign manifests with it
+func NewVaultSigner(key VaultKey) (Signer, error) {
+	if key.Address == "" {
+		key.Address = os.Getenv("VAULT_ADDR")
+	}
+	if key.Token == "" {
+		key.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if key.Field == "" {
+		key.Field = "private_key"
+	}
+	if key.PassphraseField == "" {
+		key.PassphraseField = "passphrase"
+	}
+
+	secret, err := fetchVaultSecret(key)
+	if err != nil {
+		return nil, err
+	}
+
+	armored, ok := secret[key.Field].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault %s: no %s field", key.Path, key.Field)
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("vault %s: %v", key.Path, err)
+	}
+	if len(entities) != 1 || entities[0].PrivateKey == nil {
+		return nil, fmt.Errorf("vault %s: expected a single private key", key.Path)
+	}
+	entity := entities[0]
+
+	if entity.PrivateKey.Encrypted {
+		passphrase, ok := secret[key.PassphraseField].(string)
+		if !ok {
+			return nil, fmt.Errorf("vault %s: the key is encrypted, but there's no %s field", key.Path, key.PassphraseField)
+		}
+
+		if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("vault %s: %v", key.Path, err)
+		}
+	}
+
+	return vaultSigner{entity: entity}, nil
+}
+
+// fetchVaultSecret: read the data of a kv secret, of either kv version
+func fetchVaultSecret(key VaultKey) (map[string]interface{}, error) {
+	if key.Address == "" || key.Token == "" {
+		return nil, fmt.Errorf("vault %s: VAULT_ADDR and VAULT_TOKEN are required", key.Path)
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(key.Address, "/")+"/v1/"+strings.TrimPrefix(key.Path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", key.Token)
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault %s: unexpected status %s", key.Path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	// kv version 2 nests the secret's data under data.data
+	if data, ok := body.Data["data"].(map[string]interface{}); ok {
+		return data, nil
+	}
+
+	return body.Data, nil
+}
+
+// matches: whether a key name given to sign with is the vault key's full
+// fingerprint. User ids and key ids are refused, as they could name other keys
+func (v vaultSigner) matches(key string) bool {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "0x"), "0X")
+
+	return strings.EqualFold(key, hex.EncodeToString(v.entity.PrimaryKey.Fingerprint))
+}
+
+func (v vaultSigner) Sign(input, output string, keys ...string) error {
+	for _, key := range keys {
+		if !v.matches(key) {
+			return fmt.Errorf("can't sign with %s, only with the vault signing key", key)
+		}
+	}
+
+	message, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer message.Close()
+
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, v.entity, message, nil); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(output, signature.Bytes(), 0644)
+}
+
+func (v vaultSigner) Verify(input, signature string) ([]Signature, error) {
+	signatures, err := v.gpg.Verify(input, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer message.Close()
+
+	signatureFile, err := os.Open(signature)
+	if err != nil {
+		return nil, err
+	}
+	defer signatureFile.Close()
+
+	// the vault key needn't be in the local keyring
+	if _, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{v.entity}, message, signatureFile, nil); err == nil {
+		fingerprint := strings.ToUpper(hex.EncodeToString(v.entity.PrimaryKey.Fingerprint))
+		for _, existing := range signatures {
+			if strings.EqualFold(existing.Primary, fingerprint) {
+				return signatures, nil
+			}
+		}
+		signatures = append(signatures, Signature{Subkey: fingerprint, Primary: fingerprint})
+	}
+
+	return signatures, nil
+}
+
+func (v vaultSigner) PublicKey(key string) ([]byte, error) {
+	if !v.matches(key) {
+		return v.gpg.PublicKey(key)
+	}
+
+	var armored bytes.Buffer
+	writer, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.entity.Serialize(writer); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return armored.Bytes(), nil
+}
@@ -0,0 +1,35 @@
+package artifactor
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestVaultSignerMatches(t *testing.T) {
+	entity, err := openpgp.NewEntity("Release", "", "release@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := vaultSigner{entity: entity}
+
+	fingerprint := hex.EncodeToString(entity.PrimaryKey.Fingerprint)
+	for key, want := range map[string]bool{
+		fingerprint:                           true,
+		strings.ToUpper(fingerprint):          true,
+		"0x" + fingerprint:                    true,
+		"":                                    false,
+		fingerprint[24:]:                      false,
+		"release@example.com":                 false,
+		"Release":                             false,
+		"e":                                   false,
+		strings.Repeat("0", len(fingerprint)): false,
+	} {
+		if got := signer.matches(key); got != want {
+			t.Errorf("matches(%q) = %v, expected %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package artifactor
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	verificationCacheMu  sync.Mutex
+	verificationCacheDir string
+)
+
+// SetVerificationCache: remember successful verifications in dir, so that
+// downloading or getting the same version again skips checking signatures
+// already verified against the same trust policy, and hashing local files
+// unchanged since they were verified. An empty dir turns the cache off
+func SetVerificationCache(dir string) {
+	verificationCacheMu.Lock()
+	verificationCacheDir = dir
+	verificationCacheMu.Unlock()
+}
+
+// DefaultVerificationCacheDir: the verification cache in the user's cache
+// directory, such as ~/.cache/artifactor/verified
+func DefaultVerificationCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(cacheDir, "artifactor", "verified")
+}
+
+// verifiedFile: what a local file looked like when it was verified
+type verifiedFile struct {
+	Bytes   int64     `json:"bytes"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// verificationCachePath: the cache entry for a key, or an empty string when
+// the cache is off
+func verificationCachePath(kind string, parts ...interface{}) string {
+	verificationCacheMu.Lock()
+	dir := verificationCacheDir
+	verificationCacheMu.Unlock()
+
+	if dir == "" {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%v\x00", part)
+	}
+
+	return filepath.Join(dir, kind, fmt.Sprintf("%x", h.Sum(nil)))
+}
+
+// manifestCachePath: the cache entry of a manifest verified against a trust
+// policy. The fetched bytes are the ones whose signature was checked
+func manifestCachePath(manifestBytes []byte, fetchedBytes []byte, trust TrustPolicy) string {
+	policyBytes, err := json.Marshal(trust)
+	if err != nil {
+		return ""
+	}
+
+	return verificationCachePath("manifests", fmt.Sprintf("%x", sha256.Sum256(manifestBytes)), fmt.Sprintf("%x", sha256.Sum256(fetchedBytes)), string(policyBytes))
+}
+
+// fileCachePath: the cache entry of a local file verified as a component
+func fileCachePath(path string, component Component) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+
+	return verificationCachePath("files", abs, component.Bytes, component.Md5Checksum, component.Sha256Checksum, component.Sha384Checksum, component.Sha512Checksum)
+}
+
+// cacheVerified: record a successful verification. The cache only saves
+// work, so failing to write to it is not an error
+func cacheVerified(cachePath string, v interface{}) {
+	if cachePath == "" {
+		return
+	}
+
+	byts, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return
+	}
+
+	ioutil.WriteFile(cachePath, byts, 0644)
+}
+
+// isCachedManifest: whether the manifest was already verified against the
+// trust policy
+func isCachedManifest(cachePath string) bool {
+	if cachePath == "" {
+		return false
+	}
+
+	_, err := os.Stat(cachePath)
+	return err == nil
+}
+
+// verifyComponentFileCached: verify a local file against a component, unless
+// it has the same size and modification time as when it was last verified
+func verifyComponentFileCached(path string, component Component) error {
+	cachePath := fileCachePath(path, component)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if cachePath != "" {
+		if byts, err := ioutil.ReadFile(cachePath); err == nil {
+			var cached verifiedFile
+			if json.Unmarshal(byts, &cached) == nil && cached.Bytes == info.Size() && cached.ModTime.Equal(info.ModTime()) {
+				return nil
+			}
+		}
+	}
+
+	if err := verifyComponentFile(path, component); err != nil {
+		return err
+	}
+
+	cacheVerified(cachePath, verifiedFile{Bytes: info.Size(), ModTime: info.ModTime()})
+	return nil
+}
@@ -0,0 +1,168 @@
+package artifactor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+// ListVersions: every version published under the project in the bucket,
+// found by listing its prefixes and reading the manifest of each, up to
+// concurrency at once. Versions are ordered by when they were published
+func ListVersions(project Project, concurrency int) ([]IndexVersion, error) {
+	manifests, err := listManifests(project, concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]IndexVersion, 0, len(manifests))
+	for _, manifest := range manifests {
+		versions = append(versions, NewIndexVersion(project, manifest, ""))
+	}
+
+	return versions, nil
+}
+
+// listManifests: the manifests of every version published under the project,
+// oldest first. Prefixes without a manifest.json, such as channels and
+// pointer aliases, are skipped, as are aliases holding a copy of the manifest
+// of the version they point at
+func listManifests(project Project, concurrency int) ([]ComponentManifest, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, err := store.ListPrefixes(ctx, project.gcsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(prefixes))
+	manifestCh := make(chan ComponentManifest, len(prefixes))
+	semaphore := make(chan struct{}, concurrency)
+
+	for _, prefix := range prefixes {
+		wg.Add(1)
+
+		go func(prefix string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			manifest, err := fetchManifest(prefix + "manifest.json")
+			if err == storage.ErrObjectNotExist {
+				return
+			}
+			if err != nil {
+				errCh <- fmt.Errorf("%s: %v", prefix+"manifest.json", err)
+				return
+			}
+
+			if manifest.Version == strings.TrimSuffix(strings.TrimPrefix(prefix, project.gcsPrefix), "/") {
+				manifestCh <- manifest
+			}
+		}(prefix)
+	}
+
+	wg.Wait()
+	close(manifestCh)
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	manifests := make([]ComponentManifest, 0, len(manifestCh))
+	for manifest := range manifestCh {
+		manifests = append(manifests, manifest)
+	}
+
+	sort.SliceStable(manifests, func(i, j int) bool {
+		if manifests[i].Timestamp.Equal(manifests[j].Timestamp) {
+			return manifests[i].Version < manifests[j].Version
+		}
+
+		return manifests[i].Timestamp.Before(manifests[j].Timestamp)
+	})
+
+	return manifests, nil
+}
+
+// listAliases: every alias in the project, found by listing its prefixes, and
+// the version each serves, checking up to concurrency prefixes at once
+func listAliases(project Project, concurrency int) (map[string]string, error) {
+	ctx := context.Background()
+	store, err := openStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, err := store.ListPrefixes(ctx, project.gcsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type aliasVersion struct {
+		alias, version string
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(prefixes))
+	aliasCh := make(chan aliasVersion, len(prefixes))
+	semaphore := make(chan struct{}, concurrency)
+
+	for _, prefix := range prefixes {
+		wg.Add(1)
+
+		go func(name string) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			version, found, err := aliasTarget(project, name)
+			if err != nil {
+				errCh <- fmt.Errorf("%s: %v", project.gcsPrefix+name, err)
+				return
+			}
+
+			// a version's own directory serves itself
+			if found && version != name {
+				aliasCh <- aliasVersion{name, version}
+			}
+		}(strings.TrimSuffix(strings.TrimPrefix(prefix, project.gcsPrefix), "/"))
+	}
+
+	wg.Wait()
+	close(aliasCh)
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	aliases := make(map[string]string, len(aliasCh))
+	for alias := range aliasCh {
+		aliases[alias.alias] = alias.version
+	}
+
+	return aliases, nil
+}
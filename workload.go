@@ -0,0 +1,83 @@
+package artifactor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+
+	"google.golang.org/api/option"
+)
+
+// WorkloadIdentity: a GCP workload identity federation provider, which short
+// lived GCP credentials are exchanged for from a ci job's oidc token, so that
+// release jobs don't need long lived service account keys on disk
+type WorkloadIdentity struct {
+	// Provider is the provider's full resource name, such as
+	// projects/123/locations/global/workloadIdentityPools/ci/providers/github
+	Provider string
+
+	// ServiceAccount, when set, is the service account impersonated with
+	// the federated credentials
+	ServiceAccount string
+
+	// TokenFilepath holds the oidc token, such as a GitLab CI id token. In
+	// GitHub Actions, a token is requested from the runner when it's unset
+	TokenFilepath string
+}
+
+// CredentialsJSON: an external_account credential configuration, which the
+// Google client libraries exchange for short lived access tokens, refreshing
+// the oidc token from its source whenever they expire
+func (w WorkloadIdentity) CredentialsJSON() ([]byte, error) {
+	credentialSource := map[string]interface{}{}
+
+	switch {
+	case w.TokenFilepath != "":
+		credentialSource["file"] = w.TokenFilepath
+	case os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL") != "":
+		// the runner issues tokens for the audience the provider expects
+		// by default, which is requested explicitly
+		credentialSource["url"] = os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL") + "&audience=" + url.QueryEscape("https://iam.googleapis.com/"+w.Provider)
+		credentialSource["headers"] = map[string]string{
+			"Authorization": "Bearer " + os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"),
+		}
+		credentialSource["format"] = map[string]string{
+			"type":                     "json",
+			"subject_token_field_name": "value",
+		}
+	default:
+		return nil, fmt.Errorf("workload identity: no oidc token file given, and not running in github actions with id-token permissions")
+	}
+
+	credentials := map[string]interface{}{
+		"type":               "external_account",
+		"audience":           "//iam.googleapis.com/" + w.Provider,
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":          "https://sts.googleapis.com/v1/token",
+		"credential_source":  credentialSource,
+	}
+
+	if w.ServiceAccount != "" {
+		credentials["service_account_impersonation_url"] = "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/" + w.ServiceAccount + ":generateAccessToken"
+	}
+
+	return json.Marshal(credentials)
+}
+
+// Storage: open Google Cloud Storage with the federated credentials. Register
+// it for the gcs scheme with RegisterStorage to publish with them
+func (w WorkloadIdentity) Storage(ctx context.Context) (Storage, error) {
+	credentials, err := w.CredentialsJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newGCSClient(ctx, option.WithAuthCredentialsJSON(option.ExternalAccount, credentials))
+	if err != nil {
+		return nil, err
+	}
+
+	return gcsStorage{client: client}, nil
+}
@@ -0,0 +1,338 @@
+package artifactor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// files written alongside a version when it's yanked
+var yankFilepaths = []string{"yanked.json", "yanked.json.asc.sig"}
+
+// the sigstore bundle of a version's manifest as it was before the version
+// was yanked
+const yankedSigstoreBundleFilepath = sigstoreBundleFilepath + ".yanked"
+
+// Yank: why a version was yanked, deprecating it so that users are steered
+// off it while its artifacts are kept
+type Yank struct {
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor,omitempty"`
+}
+
+// VersionYank: the signed record of a yanked version, published as
+// yanked.json in the version's directory
+type VersionYank struct {
+	Project string `json:"project"`
+	Version string `json:"version"`
+	Yanked  Yank   `json:"yanked"`
+}
+
+// YankVersion: mark a published version as yanked without deleting any of
+// its objects, replacing the reason given by any previous yank. The version's
+// signed yanked.json is written guarded by the generation it was read at, and
+// retried if a concurrent writer gets there first. The yank is then added to
+// the version's manifest, along with the copies of it held by aliases. When
+// the project keeps an index, the version's entry and any feeds are marked
+// yanked too, and the notifiers are told once it's done
+func YankVersion(project Project, version string, yank Yank, notifiers []Notifier) error {
+	if yank.Reason == "" {
+		return fmt.Errorf("a reason for yanking %s is required", version)
+	}
+
+	if _, err := fetchManifest(project.gcsPrefix + version + "/manifest.json"); err != nil {
+		return fmt.Errorf("%s %s: %v", project.name, version, err)
+	}
+
+	var err error
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		err = tryYankVersion(project, version, yank)
+		if err == nil || !isPreconditionFailed(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := yankManifest(project, version, yank); err != nil {
+		return fmt.Errorf("%s %s: %v", project.name, version, err)
+	}
+
+	err = updateIndexVersion(project, version, func(indexVersion *IndexVersion) {
+		indexVersion.Yanked = &yank
+	})
+	if err != nil {
+		return err
+	}
+
+	notify(notifiers, Event{
+		Kind:      EventYanked,
+		Project:   project.name,
+		Version:   version,
+		Timestamp: yank.Timestamp,
+		Summary:   fmt.Sprintf("yanked %s %s: %s", project.name, version, yank.Reason),
+		Details:   []string{fmt.Sprintf("manifest: %smanifest.json", project.urlPrefix+version+"/")},
+	})
+
+	return nil
+}
+
+func tryYankVersion(project Project, version string, yank Yank) error {
+	versionPrefix := project.gcsPrefix + version + "/"
+
+	gcsPaths := make([]string, 0, len(yankFilepaths))
+	for _, filename := range yankFilepaths {
+		gcsPaths = append(gcsPaths, versionPrefix+filename)
+	}
+
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.Marshal(VersionYank{Project: project.name, Version: version, Yanked: yank})
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := newScratchDir("artifactor-yank")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	yankFilepath := filepath.Join(tmpDir, yankFilepaths[0])
+	if err := ioutil.WriteFile(yankFilepath, jsonBytes, 0644); err != nil {
+		return err
+	}
+
+	if err := createSigFile(yankFilepath, filepath.Join(tmpDir, yankFilepaths[1])); err != nil {
+		return err
+	}
+
+	components := make([]Component, 0, len(yankFilepaths))
+	for _, filename := range yankFilepaths {
+		component, err := newTempComponent(tmpDir, filename, versionPrefix, project.urlPrefix+version+"/")
+		if err != nil {
+			return err
+		}
+
+		components = append(components, component)
+	}
+
+	_, err = uploadComponents(versionPrefix, components, generations, false)
+	return err
+}
+
+// yankManifest: rewrite the version's manifest with the yank, and its
+// compressed manifest when it has one, signing them with the current key,
+// and retrying if a concurrent writer changes them first. Copied aliases
+// serving the version are given the new manifest, and when the project keeps
+// a root the new manifest's digest is appended to it, so the rewrite is
+// recorded rather than looking like tampering
+func yankManifest(project Project, version string, yank Yank) error {
+	var manifest ComponentManifest
+	var components []Component
+	var err error
+	for attempt := 0; attempt < indexUpdateAttempts; attempt++ {
+		manifest, components, err = tryYankManifest(project, version, yank)
+		if err == nil || !isPreconditionFailed(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := yankAliasManifests(project, version, components[:2]); err != nil {
+		return err
+	}
+
+	_, rootBytes, _, err := fetchRoot(project)
+	if err != nil {
+		return err
+	}
+	if len(rootBytes) > 0 {
+		if _, err := updateRoot(project, version, components[:1], yank.Timestamp, manifest.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tryYankManifest: rewrite the version's manifests, guarded by the
+// generations they had before the manifest was read. A sigstore bundle can't
+// be reissued here, so one signing the old manifest is kept for forensics as
+// manifest.json.sigstore.json.yanked, where verifiers don't look for it
+func tryYankManifest(project Project, version string, yank Yank) (ComponentManifest, []Component, error) {
+	versionGCSPrefix := project.gcsPrefix + version + "/"
+	versionURLPrefix := project.urlPrefix + version + "/"
+
+	filenames := append(append([]string(nil), managedFilepaths[:2]...), compressedManifestFilepaths...)
+	filenames = append(filenames, sigstoreBundleFilepath, yankedSigstoreBundleFilepath)
+
+	gcsPaths := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		gcsPaths = append(gcsPaths, versionGCSPrefix+filename)
+	}
+
+	generations, err := fetchGenerations(gcsPaths)
+	if err != nil {
+		return ComponentManifest{}, nil, err
+	}
+
+	manifest, err := fetchManifest(versionGCSPrefix + managedFilepaths[0])
+	if err != nil {
+		return ComponentManifest{}, nil, err
+	}
+	manifest.Yanked = &yank
+
+	tmpDir, err := newScratchDir("artifactor-yank")
+	if err != nil {
+		return ComponentManifest{}, nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest.manifestFilepath = filepath.Join(tmpDir, managedFilepaths[0])
+	manifest.signatureFilepath = filepath.Join(tmpDir, managedFilepaths[1])
+	if err := manifest.write(); err != nil {
+		return ComponentManifest{}, nil, err
+	}
+
+	uploadFilenames := append([]string(nil), managedFilepaths[:2]...)
+
+	if generations[versionGCSPrefix+compressedManifestFilepaths[0]] != 0 {
+		if err := writeCompressedManifest(manifest.manifestFilepath); err != nil {
+			return ComponentManifest{}, nil, err
+		}
+
+		uploadFilenames = append(uploadFilenames, compressedManifestFilepaths...)
+	}
+
+	bundleGCSPath := versionGCSPrefix + sigstoreBundleFilepath
+	if generations[bundleGCSPath] != 0 {
+		bundleBytes, _, err := fetchObject(bundleGCSPath)
+		if err != nil {
+			return ComponentManifest{}, nil, err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, yankedSigstoreBundleFilepath), bundleBytes, 0644); err != nil {
+			return ComponentManifest{}, nil, err
+		}
+
+		uploadFilenames = append(uploadFilenames, yankedSigstoreBundleFilepath)
+	}
+
+	components := make([]Component, 0, len(uploadFilenames))
+	for _, filename := range uploadFilenames {
+		component, err := newTempComponent(tmpDir, filename, versionGCSPrefix, versionURLPrefix)
+		if err != nil {
+			return ComponentManifest{}, nil, err
+		}
+
+		components = append(components, component)
+	}
+
+	if _, err := uploadComponents(versionGCSPrefix, components, generations, false); err != nil {
+		return ComponentManifest{}, nil, err
+	}
+
+	// the bundle signs the manifest as it was, so it's only removed once the
+	// copy of it is stored
+	if generations[bundleGCSPath] != 0 {
+		if _, err := deleteObjects([]string{bundleGCSPath}); err != nil {
+			return ComponentManifest{}, nil, err
+		}
+	}
+
+	return manifest, components, nil
+}
+
+// yankAliasManifests: copy the yanked version's rewritten manifest and its
+// signature to every copied alias serving the version. Pointer aliases name
+// the version's manifest rather than holding a copy, so are left as they are
+func yankAliasManifests(project Project, version string, manifestComponents []Component) error {
+	aliases, err := listAliases(project, DefaultConcurrency)
+	if err != nil {
+		return fmt.Errorf("listing aliases: %v", err)
+	}
+
+	aliasNames := make([]string, 0, len(aliases))
+	for alias, aliasVersion := range aliases {
+		if aliasVersion == version {
+			aliasNames = append(aliasNames, alias)
+		}
+	}
+	sort.Strings(aliasNames)
+
+	for _, alias := range aliasNames {
+		aliasPrefix := project.gcsPrefix + alias + "/"
+
+		_, _, err := fetchObject(aliasPrefix + aliasPointerFilepaths[0])
+		if err == nil {
+			continue
+		}
+		if err != storage.ErrObjectNotExist {
+			return fmt.Errorf("alias %s: %v", alias, err)
+		}
+
+		gcsPaths := make([]string, 0, len(manifestComponents))
+		for _, component := range manifestComponents {
+			gcsPaths = append(gcsPaths, aliasPrefix+component.Filepath)
+		}
+
+		generations, err := fetchGenerations(gcsPaths)
+		if err != nil {
+			return err
+		}
+
+		if _, err := copyAliasComponents(aliasPrefix, manifestComponents, generations); err != nil {
+			return fmt.Errorf("alias %s: %v", alias, err)
+		}
+	}
+
+	return nil
+}
+
+// FetchYank: download the yank of a version from its public url, verifying
+// its signature against the trust policy's keys like FetchAdvisories, and
+// returning nil when the version hasn't been yanked
+func FetchYank(project Project, version string, trust TrustPolicy) (*Yank, error) {
+	yankURL := project.urlPrefix + version + "/" + yankFilepaths[0]
+
+	byts, found, err := fetchOptionalURL(yankURL)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	if trust.MinimumSignatures > 0 {
+		sigBytes, err := fetchURL(yankURL + ".asc.sig")
+		if err != nil {
+			return nil, err
+		}
+
+		trust.MinimumSignatures = 1
+		if err := trust.verifySignature(byts, sigBytes); err != nil {
+			return nil, fmt.Errorf("%s: %v", yankURL, err)
+		}
+	}
+
+	var yank VersionYank
+	if err := json.Unmarshal(byts, &yank); err != nil {
+		return nil, err
+	}
+
+	return &yank.Yanked, nil
+}
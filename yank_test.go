@@ -0,0 +1,64 @@
+package artifactor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonmorehouse/artifactor"
+	"github.com/jonmorehouse/artifactor/artifactortest"
+)
+
+func TestYankVersion(t *testing.T) {
+	store := artifactortest.Install(t)
+	urlPrefix := artifactortest.NewServer(t, store, "bucket")
+
+	opts := testOptions(urlPrefix, "v1")
+	opts.RootManifest = true
+	opts.CompressManifest = true
+	publish(t, opts, map[string]string{"a.txt": "a"})
+
+	// a sigstore bundle of the manifest as published
+	bundle := []byte(`{"mediaType":"application/vnd.dev.sigstore.bundle+json;version=0.2"}`)
+	store.Put("gcs://bucket/p/v1/manifest.json.sigstore.json", bundle)
+
+	project := artifactor.NewProject(&opts)
+	if err := artifactor.YankVersion(project, "v1", artifactor.Yank{}, nil); err == nil {
+		t.Fatal("expected yanking without a reason to fail")
+	}
+
+	for _, reason := range []string{"broken", "really broken"} {
+		err := inDir(t, t.TempDir(), func() error {
+			return artifactor.YankVersion(project, "v1", artifactor.Yank{Reason: reason, Timestamp: time.Now()}, nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trust := artifactor.TrustPolicy{Fingerprints: []string{artifactortest.DefaultKey}, MinimumSignatures: 1}
+	for _, version := range []string{"v1", "latest"} {
+		manifest, _, err := artifactor.FetchVerifiedManifest(project, version, trust)
+		if err != nil {
+			t.Fatalf("%s: %v", version, err)
+		}
+		if manifest.Yanked == nil || manifest.Yanked.Reason != "really broken" {
+			t.Fatalf("%s: expected the manifest to be yanked, found %+v", version, manifest.Yanked)
+		}
+	}
+
+	yank, err := artifactor.FetchYank(project, "v1", trust)
+	if err != nil || yank == nil || yank.Reason != "really broken" {
+		t.Fatalf("unexpected yank %+v: %v", yank, err)
+	}
+
+	if _, ok := store.Get("gcs://bucket/p/v1/manifest.json.sigstore.json"); ok {
+		t.Fatal("expected the bundle of the old manifest to be moved aside")
+	}
+	if kept, ok := store.Get("gcs://bucket/p/v1/manifest.json.sigstore.json.yanked"); !ok || string(kept) != string(bundle) {
+		t.Fatalf("expected the bundle of the old manifest to be kept, found %q", kept)
+	}
+
+	if err := artifactor.VerifyRoot(project, []string{artifactortest.DefaultKey}); err != nil {
+		t.Fatal(err)
+	}
+}